@@ -1,26 +1,115 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"go-url-shortener/internal/api"
+	"go-url-shortener/internal/clicks"
 	"go-url-shortener/internal/config"
 	"go-url-shortener/internal/core"
 	"go-url-shortener/internal/db"
+	"go-url-shortener/internal/geoip"
+	"go-url-shortener/internal/useragent"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
 func main() {
 	cfg := config.Load()
 
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			if err := runMigrate(cfg.DatabaseURL, os.Args[2:]); err != nil {
+				log.Fatalf("Migration failed: %v", err)
+			}
+			return
+		case "export":
+			if err := runExport(cfg.DatabaseURL, os.Args[2:]); err != nil {
+				log.Fatalf("Export failed: %v", err)
+			}
+			return
+		case "import":
+			if err := runImport(cfg.DatabaseURL, os.Args[2:]); err != nil {
+				log.Fatalf("Import failed: %v", err)
+			}
+			return
+		}
+	}
+
 	repo, err := db.InitRepository(cfg.DatabaseURL)
 	if err != nil {
 		log.Fatalf("Failed to initialize repository: %v", err)
 	}
 
+	var cache *db.CachedRepository
+	if cfg.CacheEnabled {
+		cache = db.NewCachedRepository(repo, db.CacheOptions{
+			Size:        cfg.CacheSize,
+			TTL:         cfg.CacheTTL,
+			NegativeTTL: cfg.CacheNegativeTTL,
+		})
+		repo = cache
+	}
+
+	enrichers := []clicks.Enricher{clicks.EnricherFunc(useragent.Enrich)}
+	if cfg.GeoIPDatabase != "" {
+		resolver, err := geoip.NewResolver(cfg.GeoIPDatabase, cfg.GeoIPReloadInterval)
+		if err != nil {
+			log.Fatalf("Failed to load GeoIP database: %v", err)
+		}
+		defer resolver.Close()
+		enrichers = append(enrichers, resolver)
+	}
+
+	recorder := clicks.NewRecorder(repo, clicks.Options{
+		QueueSize:     cfg.ClickQueueSize,
+		Workers:       cfg.ClickWorkers,
+		BatchSize:     cfg.ClickBatchSize,
+		FlushInterval: cfg.ClickFlushInterval,
+		Backpressure:  clicks.Backpressure(cfg.ClickBackpressure),
+		Enrichers:     enrichers,
+	})
+
+	// Batch click-count updates for links served from the cache
+	if cache != nil {
+		cache.SetClickCounter(recorder)
+	}
+
 	shortener := core.NewShortener(repo)
-	router := api.NewRouter(shortener, repo)
+	shortener.SetBaseURL(cfg.BaseURL)
+	router := api.NewRouter(cfg, shortener, repo, recorder)
 
-	addr := ":" + cfg.Port
-	log.Printf("Server starting on %s", addr)
-	log.Fatal(http.ListenAndServe(addr, router))
+	server := &http.Server{
+		Addr:    ":" + cfg.Port,
+		Handler: router,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		log.Printf("Server starting on %s", server.Addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Printf("Shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("HTTP server shutdown: %v", err)
+	}
+
+	// Write out queued clicks only after in-flight redirects have finished
+	if err := recorder.Close(shutdownCtx); err != nil {
+		log.Printf("Click recorder shutdown: %v", err)
+	}
 }
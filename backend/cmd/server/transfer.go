@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"go-url-shortener/internal/db"
+	"go-url-shortener/internal/transfer"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+)
+
+const (
+	exportUsage = "usage: server export [-format ndjson|csv] [-o file]"
+	importUsage = "usage: server import [-format ndjson|csv] [-conflict skip|overwrite|fail] [-dry-run] [file]"
+)
+
+// runExport implements the "export" subcommand. The export goes to stdout
+// unless -o names a file, whose extension then sets the default format.
+func runExport(databaseURL string, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	formatName := flags.String("format", "", "ndjson or csv")
+	output := flags.String("o", "", "write to this file instead of stdout")
+	if err := flags.Parse(args); err != nil || flags.NArg() > 0 {
+		return errors.New(exportUsage)
+	}
+
+	format, err := transfer.ParseFormat(formatOrExtension(*formatName, *output))
+	if err != nil {
+		return err
+	}
+
+	repo, err := openRepository(databaseURL)
+	if err != nil {
+		return err
+	}
+	defer closeRepository(repo)
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	summary, err := transfer.Export(ctx, repo, w, format)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Exported %d link(s) and %d click(s)\n", summary.URLs, summary.Clicks)
+	return nil
+}
+
+// runImport implements the "import" subcommand. It reads the named file, or
+// stdin when there is none or it is "-", and prints the import report.
+func runImport(databaseURL string, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	formatName := flags.String("format", "", "ndjson or csv")
+	conflictName := flags.String("conflict", string(db.ConflictSkip), "skip, overwrite or fail")
+	dryRun := flags.Bool("dry-run", false, "report what would be imported without writing")
+	if err := flags.Parse(args); err != nil || flags.NArg() > 1 {
+		return errors.New(importUsage)
+	}
+
+	input := flags.Arg(0)
+	format, err := transfer.ParseFormat(formatOrExtension(*formatName, input))
+	if err != nil {
+		return err
+	}
+	conflict, err := db.ParseConflictPolicy(*conflictName)
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	if input != "" && input != "-" {
+		file, err := os.Open(input)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	repo, err := openRepository(databaseURL)
+	if err != nil {
+		return err
+	}
+	defer closeRepository(repo)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	report, err := transfer.Import(ctx, repo, r, transfer.Options{
+		Format:   format,
+		Conflict: conflict,
+		DryRun:   *dryRun,
+	})
+	printReport(report)
+
+	return err
+}
+
+// formatOrExtension returns the -format flag, or else "csv" for a .csv file
+func formatOrExtension(format, path string) string {
+	if format == "" && strings.EqualFold(filepath.Ext(path), ".csv") {
+		return string(transfer.CSV)
+	}
+	return format
+}
+
+func openRepository(databaseURL string) (db.RepositoryInterface, error) {
+	repo, err := db.InitRepository(databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize repository: %w", err)
+	}
+	return repo, nil
+}
+
+func closeRepository(repo db.RepositoryInterface) {
+	if closer, ok := repo.(io.Closer); ok {
+		closer.Close()
+	}
+}
+
+func printReport(report *transfer.Report) {
+	if report == nil {
+		return
+	}
+
+	if report.DryRun {
+		fmt.Println("Dry run, nothing was written")
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Records read\t%d\n", report.Records)
+	fmt.Fprintf(w, "Links created\t%d\n", report.URLsCreated)
+	fmt.Fprintf(w, "Links overwritten\t%d\n", report.URLsOverwritten)
+	fmt.Fprintf(w, "Links skipped\t%d\n", report.URLsSkipped)
+	fmt.Fprintf(w, "Clicks imported\t%d\n", report.ClicksImported)
+	fmt.Fprintf(w, "Clicks skipped\t%d\n", report.ClicksSkipped)
+	if len(report.Conflicts) > 0 {
+		fmt.Fprintf(w, "Conflicting codes\t%s\n", strings.Join(report.Conflicts, ", "))
+	}
+	w.Flush()
+}
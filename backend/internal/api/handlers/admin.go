@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"go-url-shortener/internal/auth"
+	"go-url-shortener/internal/db"
+
+	"github.com/gorilla/mux"
+)
+
+// AdminHandler serves the admin API, which is guarded by
+// middleware.RequireAdmin
+type AdminHandler struct {
+	repo db.RepositoryInterface
+}
+
+func NewAdminHandler(repo db.RepositoryInterface) *AdminHandler {
+	return &AdminHandler{repo: repo}
+}
+
+type CreateAPIKeyRequest struct {
+	OwnerID string `json:"owner_id"`
+	Name    string `json:"name,omitempty"`
+}
+
+// CreateAPIKeyResponse is the only time the plaintext key is returned
+type CreateAPIKeyResponse struct {
+	*db.APIKey
+	Key string `json:"key"`
+}
+
+// maxKeyNameLength matches the api_keys.name column
+const maxKeyNameLength = 100
+
+// CreateAPIKey issues a new key for an owner
+func (h *AdminHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorStatus(w, r, http.StatusBadRequest, CodeInvalidRequest, "invalid JSON body")
+		return
+	}
+
+	if len(req.Name) > maxKeyNameLength {
+		writeErrorStatus(w, r, http.StatusBadRequest, CodeInvalidRequest, "name is too long")
+		return
+	}
+
+	plaintext, key, err := auth.NewKey(req.OwnerID, req.Name)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if err := h.repo.CreateAPIKey(r.Context(), key); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(CreateAPIKeyResponse{APIKey: key, Key: plaintext})
+}
+
+// ListAPIKeys lists keys, optionally only those of ?owner_id=
+func (h *AdminHandler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.repo.ListAPIKeys(r.Context(), r.URL.Query().Get("owner_id"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
+
+// RevokeAPIKey revokes a key by id. Requests using it fail from then on.
+func (h *AdminHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeErrorStatus(w, r, http.StatusBadRequest, CodeInvalidRequest, "invalid API key id")
+		return
+	}
+
+	if err := h.repo.RevokeAPIKey(r.Context(), id); err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			writeErrorStatus(w, r, http.StatusNotFound, CodeNotFound, "API key not found")
+			return
+		}
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -3,9 +3,12 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
 	"strings"
 
+	"go-url-shortener/internal/auth"
 	"go-url-shortener/internal/db"
+	"go-url-shortener/internal/useragent"
 )
 
 type AnalyticsHandler struct {
@@ -24,41 +27,78 @@ type AnalyticsResponse struct {
 	Summary     AnalyticsSummary  `json:"summary"`
 }
 
+// AnalyticsSummary covers the clicks in the response; bots are left out
+// unless asked for, and only counted in BotClicks
 type AnalyticsSummary struct {
 	TotalClicks     int                    `json:"total_clicks"`
+	BotClicks       int                    `json:"bot_clicks"`
 	UniqueIPs       int                    `json:"unique_ips"`
 	TopReferers     map[string]int         `json:"top_referers"`
-	TopUserAgents   map[string]int         `json:"top_user_agents"`
+	TopUserAgents   map[string]int         `json:"top_user_agents"` // by browser name
+	TopDevices      map[string]int         `json:"top_devices"`
+	TopOS           map[string]int         `json:"top_os"`
 	ClicksByHour    map[string]int         `json:"clicks_by_hour"`
+	// Keyed by ISO country code, and by "City, Region, CC"; clicks with no
+	// known location count as "Unknown"
+	TopCountries    map[string]int         `json:"top_countries"`
+	TopCities       map[string]int         `json:"top_cities"`
 }
 
-// GetURLAnalytics returns analytics data for a specific short URL
+// GetURLAnalytics returns analytics data for a specific short URL. Clicks
+// by bots are left out unless ?include_bots=true.
 func (h *AnalyticsHandler) GetURLAnalytics(w http.ResponseWriter, r *http.Request) {
 	// Extract short code from URL path
 	pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
 	if len(pathParts) < 3 { // /api/analytics/{shortCode}
-		http.Error(w, "Short code is required", http.StatusBadRequest)
+		writeErrorStatus(w, r, http.StatusBadRequest, CodeInvalidRequest, "short code is required")
 		return
 	}
 	
 	shortCode := pathParts[2]
 
+	includeBots := false
+	if value := r.URL.Query().Get("include_bots"); value != "" {
+		var err error
+		if includeBots, err = strconv.ParseBool(value); err != nil {
+			writeErrorStatus(w, r, http.StatusBadRequest, CodeInvalidRequest, "include_bots must be true or false")
+			return
+		}
+	}
+
 	// Get URL information
-	url, err := h.repo.GetShortURL(shortCode)
+	url, err := h.repo.GetShortURLForOwner(r.Context(), shortCode, auth.OwnerID(r.Context()))
 	if err != nil {
-		http.Error(w, "Short URL not found", http.StatusNotFound)
+		writeError(w, r, err)
 		return
 	}
 
 	// Get click events
-	clickEvents, err := h.repo.GetClickEvents(url.ID)
+	clickEvents, err := h.repo.GetClickEvents(r.Context(), url.ID)
 	if err != nil {
-		http.Error(w, "Failed to retrieve click events", http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
+	// Clicks recorded before user agents were parsed are parsed now
+	humans := make([]*db.ClickEvent, 0, len(clickEvents))
+	bots := 0
+	for _, event := range clickEvents {
+		if event.Browser == "" && event.OS == "" && event.Device == "" && event.Bot == "" {
+			useragent.Enrich(event)
+		}
+		if event.Bot != "" {
+			bots++
+			continue
+		}
+		humans = append(humans, event)
+	}
+	if !includeBots {
+		clickEvents = humans
+	}
+
 	// Generate summary analytics
 	summary := generateSummary(clickEvents)
+	summary.BotClicks = bots
 
 	response := AnalyticsResponse{
 		URL:         url,
@@ -70,13 +110,45 @@ func (h *AnalyticsHandler) GetURLAnalytics(w http.ResponseWriter, r *http.Reques
 	json.NewEncoder(w).Encode(response)
 }
 
+// CampaignAnalyticsResponse lists the caller's links grouped by one UTM
+// parameter
+type CampaignAnalyticsResponse struct {
+	GroupBy string             `json:"group_by"`
+	Groups  []*db.CampaignStat `json:"groups"`
+}
+
+// GetCampaignAnalytics groups the caller's links and their clicks by the
+// UTM parameter in ?group_by, utm_campaign by default
+func (h *AnalyticsHandler) GetCampaignAnalytics(w http.ResponseWriter, r *http.Request) {
+	groupBy := r.URL.Query().Get("group_by")
+	if groupBy == "" {
+		groupBy = db.UTMCampaign
+	}
+
+	groups, err := h.repo.GetCampaignStats(r.Context(), auth.OwnerID(r.Context()), groupBy)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(CampaignAnalyticsResponse{
+		GroupBy: groupBy,
+		Groups:  groups,
+	})
+}
+
 // generateSummary creates analytics summary from click events
 func generateSummary(events []*db.ClickEvent) AnalyticsSummary {
 	summary := AnalyticsSummary{
 		TotalClicks:   len(events),
 		TopReferers:   make(map[string]int),
 		TopUserAgents: make(map[string]int),
+		TopDevices:    make(map[string]int),
+		TopOS:         make(map[string]int),
 		ClicksByHour:  make(map[string]int),
+		TopCountries:  make(map[string]int),
+		TopCities:     make(map[string]int),
 	}
 
 	uniqueIPs := make(map[string]bool)
@@ -92,13 +164,22 @@ func generateSummary(events []*db.ClickEvent) AnalyticsSummary {
 		}
 		summary.TopReferers[referer]++
 
-		// Count user agents (simplified - browser name only)
-		browser := extractBrowser(event.UserAgent)
-		summary.TopUserAgents[browser]++
+		// Count browsers, devices and operating systems
+		summary.TopUserAgents[orOther(event.Browser)]++
+		summary.TopDevices[orOther(event.Device)]++
+		summary.TopOS[orOther(event.OS)]++
 
-		// Count clicks by hour
-		hour := event.CreatedAt.Format("2006-01-02 15:00")
+		// Count clicks by UTC hour; the time series endpoint takes a zone
+		hour := event.CreatedAt.UTC().Format("2006-01-02 15:00")
 		summary.ClicksByHour[hour]++
+
+		// Count locations resolved when the click was recorded
+		country := event.Country
+		if country == "" {
+			country = "Unknown"
+		}
+		summary.TopCountries[country]++
+		summary.TopCities[cityLabel(event)]++
 	}
 
 	summary.UniqueIPs = len(uniqueIPs)
@@ -106,21 +187,26 @@ func generateSummary(events []*db.ClickEvent) AnalyticsSummary {
 	return summary
 }
 
-// extractBrowser extracts browser name from user agent string (simplified)
-func extractBrowser(userAgent string) string {
-	userAgent = strings.ToLower(userAgent)
-	
-	if strings.Contains(userAgent, "chrome") {
-		return "Chrome"
-	} else if strings.Contains(userAgent, "firefox") {
-		return "Firefox"
-	} else if strings.Contains(userAgent, "safari") {
-		return "Safari"
-	} else if strings.Contains(userAgent, "edge") {
-		return "Edge"
-	} else if strings.Contains(userAgent, "opera") {
-		return "Opera"
+// cityLabel names the city of a click with its region and country, since
+// city names alone are ambiguous
+func cityLabel(event *db.ClickEvent) string {
+	if event.City == "" {
+		return "Unknown"
 	}
-	
-	return "Other"
-}
\ No newline at end of file
+
+	parts := []string{event.City}
+	for _, part := range []string{event.Region, event.Country} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// orOther names an unrecognized user agent detail
+func orOther(value string) string {
+	if value == "" {
+		return "Other"
+	}
+	return value
+}
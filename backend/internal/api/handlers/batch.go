@@ -0,0 +1,316 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-url-shortener/internal/auth"
+	"go-url-shortener/internal/core"
+	"go-url-shortener/internal/middleware"
+)
+
+// Limits for POST /api/shorten/batch
+const (
+	maxBatchItems = 1000
+	maxBatchBytes = 4 << 20
+)
+
+// Batch modes, chosen with ?mode=
+const (
+	// BatchTransactional creates every item or none (the default)
+	BatchTransactional = "transactional"
+	// BatchBestEffort creates the items that can be created
+	BatchBestEffort = "best_effort"
+)
+
+// errTooManyItems rejects batches over maxBatchItems
+var errTooManyItems = fmt.Errorf("a batch may contain at most %d items", maxBatchItems)
+
+// BatchShortenResult is the outcome of one item, at the same index as in
+// the request
+type BatchShortenResult struct {
+	Index  int                   `json:"index"`
+	Result *ShortenResponse      `json:"result,omitempty"`
+	Error  *middleware.ErrorBody `json:"error,omitempty"`
+}
+
+type BatchShortenResponse struct {
+	Mode    string               `json:"mode"`
+	Created int                  `json:"created"`
+	Failed  int                  `json:"failed"`
+	Results []BatchShortenResult `json:"results"`
+}
+
+// CreateShortURLs creates many links at once from a JSON array of
+// ShortenRequest items or from CSV, either as the request body (text/csv)
+// or as the "file" field of a multipart upload. The CSV header names its
+// columns after the JSON fields; only url is required and unknown columns
+// are rejected.
+//
+// The response holds one result per item. It is 201 when every item was
+// created, 207 when a best-effort batch created only some, and 422 when a
+// transactional batch created nothing.
+func (h *ShortenHandler) CreateShortURLs(w http.ResponseWriter, r *http.Request) {
+	mode := r.URL.Query().Get("mode")
+	switch mode {
+	case "":
+		mode = BatchTransactional
+	case BatchTransactional, BatchBestEffort:
+	default:
+		writeErrorStatus(w, r, http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("invalid mode %q, expected %s or %s", mode, BatchTransactional, BatchBestEffort))
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxBatchBytes)
+	reqs, err := parseBatch(r)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooLarge):
+			writeErrorStatus(w, r, http.StatusRequestEntityTooLarge, CodeTooLarge, fmt.Sprintf("request body exceeds %d bytes", maxBatchBytes))
+		case errors.Is(err, errTooManyItems):
+			writeErrorStatus(w, r, http.StatusRequestEntityTooLarge, CodeTooLarge, err.Error())
+		default:
+			writeErrorStatus(w, r, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		}
+		return
+	}
+
+	items := make([]core.BatchItem, len(reqs))
+	for i, req := range reqs {
+		items[i] = core.BatchItem{
+			OriginalURL: req.URL,
+			CustomCode:  req.CustomCode,
+			LinkOptions: core.LinkOptions{
+				Password:         req.Password,
+				MaxClicks:        req.MaxClicks,
+				RedirectType:     req.RedirectType,
+				ForcePreview:     req.ForcePreview,
+				QueryPassthrough: req.QueryPassthrough,
+				PathPassthrough:  req.PathPassthrough,
+				UTM:              req.UTM,
+				QueryParams:      req.QueryParams,
+			},
+		}
+		if req.ActivatesAt != "" {
+			activatesAt, err := time.Parse(time.RFC3339, req.ActivatesAt)
+			if err != nil {
+				writeErrorStatus(w, r, http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("item %d: invalid activates_at, expected RFC 3339 timestamp", i))
+				return
+			}
+			items[i].ActivatesAt = &activatesAt
+		}
+		if req.ExpiresAt != "" {
+			expiresAt, err := time.Parse(time.RFC3339, req.ExpiresAt)
+			if err != nil {
+				writeErrorStatus(w, r, http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("item %d: invalid expires_at, expected RFC 3339 timestamp", i))
+				return
+			}
+			items[i].ExpiresAt = &expiresAt
+		}
+	}
+
+	results, err := h.shortener.CreateShortURLs(r.Context(), auth.OwnerID(r.Context()), items, mode == BatchTransactional)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	response := BatchShortenResponse{
+		Mode:    mode,
+		Results: make([]BatchShortenResult, len(results)),
+	}
+	for i, res := range results {
+		response.Results[i].Index = i
+		if res.Err != nil {
+			response.Results[i].Error = errorBody(r, res.Err)
+			response.Failed++
+			continue
+		}
+		response.Results[i].Result = h.shortenResponse(res.URL)
+		response.Created++
+	}
+
+	status := http.StatusCreated
+	switch {
+	case response.Failed == 0:
+	case mode == BatchTransactional:
+		status = http.StatusUnprocessableEntity
+	default:
+		status = http.StatusMultiStatus
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// parseBatch reads the batch items in the request's format
+func parseBatch(r *http.Request) ([]ShortenRequest, error) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		mediaType = "application/json"
+	}
+
+	var reqs []ShortenRequest
+	switch mediaType {
+	case "application/json":
+		if err := json.NewDecoder(r.Body).Decode(&reqs); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				return nil, err
+			}
+			return nil, errors.New("invalid JSON body, expected an array of items")
+		}
+	case "text/csv":
+		if reqs, err = parseBatchCSV(r.Body); err != nil {
+			return nil, err
+		}
+	case "multipart/form-data":
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				return nil, err
+			}
+			return nil, errors.New(`multipart upload needs a CSV "file" field`)
+		}
+		defer file.Close()
+
+		if reqs, err = parseBatchCSV(file); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported Content-Type %q, expected application/json, text/csv or multipart/form-data", mediaType)
+	}
+
+	if len(reqs) == 0 {
+		return nil, errors.New("batch has no items")
+	}
+	if len(reqs) > maxBatchItems {
+		return nil, errTooManyItems
+	}
+
+	return reqs, nil
+}
+
+// parseBatchCSV reads items from CSV with a header row
+func parseBatchCSV(body io.Reader) ([]ShortenRequest, error) {
+	reader := csv.NewReader(body)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("CSV is empty")
+	}
+	if err != nil {
+		return nil, csvError(err)
+	}
+
+	names := make([]string, len(header))
+	seen := make(map[string]bool, len(header))
+	for i, name := range header {
+		// Spreadsheets often save UTF-8 with a byte order mark
+		name = strings.TrimPrefix(name, "\ufeff")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := batchCSVColumns[name]; !ok {
+			return nil, fmt.Errorf("unknown CSV column %q", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("CSV column %q appears twice", name)
+		}
+		seen[name] = true
+		names[i] = name
+	}
+	if !seen["url"] {
+		return nil, errors.New(`CSV header must have a "url" column`)
+	}
+
+	var reqs []ShortenRequest
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, csvError(err)
+		}
+
+		var req ShortenRequest
+		for i, value := range record {
+			if err := setCSVField(&req, names[i], strings.TrimSpace(value)); err != nil {
+				return nil, fmt.Errorf("item %d: %w", len(reqs), err)
+			}
+		}
+		reqs = append(reqs, req)
+		if len(reqs) > maxBatchItems {
+			return nil, errTooManyItems
+		}
+	}
+
+	return reqs, nil
+}
+
+// batchCSVColumns maps the JSON name of every ShortenRequest field that
+// holds a single value to its index, so CSV rows take the same options as
+// JSON items. Other fields cannot be written as one cell and are rejected.
+var batchCSVColumns = func() map[string][]int {
+	columns := make(map[string][]int)
+	for _, field := range reflect.VisibleFields(reflect.TypeOf(ShortenRequest{})) {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		switch field.Type.Kind() {
+		case reflect.String, reflect.Int, reflect.Bool:
+			columns[name] = field.Index
+		}
+	}
+	return columns
+}()
+
+// setCSVField sets the field of column to value. Empty cells leave the
+// field unset.
+func setCSVField(req *ShortenRequest, column, value string) error {
+	if value == "" {
+		return nil
+	}
+
+	field := reflect.ValueOf(req).Elem().FieldByIndex(batchCSVColumns[column])
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q, expected a whole number", column, value)
+		}
+		field.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q, expected true or false", column, value)
+		}
+		field.SetBool(b)
+	}
+
+	return nil
+}
+
+// csvError keeps body size errors recognizable and describes the rest
+func csvError(err error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return err
+	}
+	return fmt.Errorf("invalid CSV: %v", err)
+}
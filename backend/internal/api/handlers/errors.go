@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"go-url-shortener/internal/auth"
+	"go-url-shortener/internal/core"
+	"go-url-shortener/internal/db"
+	"go-url-shortener/internal/middleware"
+	"go-url-shortener/internal/transfer"
+)
+
+// statusClientClosedRequest is the non-standard status nginx uses when the
+// client goes away before the response is written
+const statusClientClosedRequest = 499
+
+// Machine-readable error codes sent in ErrorResponse
+const (
+	CodeInvalidRequest       = "invalid_request"
+	CodeInvalidURL           = "invalid_url"
+	CodeInvalidCode          = "invalid_code"
+	CodeBlocked              = "blocked"
+	CodeNotFound             = "not_found"
+	CodeExpired              = "expired"
+	CodeExhausted            = "exhausted"
+	CodeScheduled            = "scheduled"
+	CodeCodeTaken            = "code_taken"
+	CodeVersionConflict      = "version_conflict"
+	CodeBatchAborted         = "batch_aborted"
+	CodeTooLarge             = "too_large"
+	CodePreconditionRequired = "precondition_required"
+	CodeMethodNotAllowed     = "method_not_allowed"
+	CodeTimeout              = "timeout"
+	CodeInternal             = middleware.CodeInternal
+)
+
+// errorMapping ties a domain error to its HTTP status and error code
+type errorMapping struct {
+	err    error
+	status int
+	code   string
+}
+
+// errorMappings is the single place domain errors become HTTP responses.
+// The first entry matching with errors.Is wins.
+var errorMappings = []errorMapping{
+	{db.ErrNotFound, http.StatusNotFound, CodeNotFound},
+	{db.ErrExpired, http.StatusGone, CodeExpired},
+	{db.ErrExhausted, http.StatusGone, CodeExhausted},
+	{db.ErrScheduled, http.StatusNotFound, CodeScheduled},
+	{db.ErrCodeTaken, http.StatusConflict, CodeCodeTaken},
+	{db.ErrVersionConflict, http.StatusPreconditionFailed, CodeVersionConflict},
+	{db.ErrInvalidCursor, http.StatusBadRequest, CodeInvalidRequest},
+	{core.ErrInvalidURL, http.StatusBadRequest, CodeInvalidURL},
+	{core.ErrInvalidCode, http.StatusBadRequest, CodeInvalidCode},
+	{core.ErrInvalidMaxClicks, http.StatusBadRequest, CodeInvalidRequest},
+	{core.ErrInvalidSchedule, http.StatusBadRequest, CodeInvalidRequest},
+	{core.ErrInvalidRedirectType, http.StatusBadRequest, CodeInvalidRequest},
+	{core.ErrInvalidQueryPassthrough, http.StatusBadRequest, CodeInvalidRequest},
+	{core.ErrInvalidQueryParam, http.StatusBadRequest, CodeInvalidRequest},
+	{db.ErrInvalidGroupBy, http.StatusBadRequest, CodeInvalidRequest},
+	{core.ErrBlocked, http.StatusForbidden, CodeBlocked},
+	{core.ErrBatchAborted, http.StatusFailedDependency, CodeBatchAborted},
+	{auth.ErrInvalidOwner, http.StatusBadRequest, CodeInvalidRequest},
+	{auth.ErrInvalidPassword, http.StatusBadRequest, CodeInvalidRequest},
+	{transfer.ErrInvalidRecord, http.StatusBadRequest, CodeInvalidRequest},
+}
+
+// writeError turns err into a JSON error response. A passed deadline becomes
+// 504 Gateway Timeout; a client disconnect is only logged, since nobody is
+// left to read the response. Unknown errors are logged and reported as a
+// 500 without their details.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	// Drivers do not always wrap the context error, so trust the context itself
+	if ctxErr := r.Context().Err(); ctxErr != nil {
+		err = ctxErr
+	}
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		writeErrorStatus(w, r, http.StatusGatewayTimeout, CodeTimeout, "request timed out")
+		return
+	case errors.Is(err, context.Canceled):
+		log.Printf("%d client closed request: %s %s [%s]", statusClientClosedRequest, r.Method, r.URL.Path, middleware.RequestIDFromContext(r.Context()))
+		return
+	}
+
+	if m, ok := lookupError(err); ok {
+		writeErrorStatus(w, r, m.status, m.code, err.Error())
+		return
+	}
+
+	log.Printf("Internal error: %s %s [%s]: %v", r.Method, r.URL.Path, middleware.RequestIDFromContext(r.Context()), err)
+	writeErrorStatus(w, r, http.StatusInternalServerError, CodeInternal, "internal server error")
+}
+
+// lookupError finds the mapping for a domain error
+func lookupError(err error) (errorMapping, bool) {
+	for _, m := range errorMappings {
+		if errors.Is(err, m.err) {
+			return m, true
+		}
+	}
+	return errorMapping{}, false
+}
+
+// errorBody describes err in the same terms writeError would, for errors
+// reported inside a successful response such as a batch result. Unknown
+// errors are logged and hidden.
+func errorBody(r *http.Request, err error) *middleware.ErrorBody {
+	body := &middleware.ErrorBody{
+		Code:    CodeInternal,
+		Message: "internal server error",
+	}
+
+	if m, ok := lookupError(err); ok {
+		body.Code = m.code
+		body.Message = err.Error()
+	} else {
+		log.Printf("Internal error: %s %s [%s]: %v", r.Method, r.URL.Path, middleware.RequestIDFromContext(r.Context()), err)
+	}
+
+	return body
+}
+
+// writeErrorStatus writes an error response with an explicit status and code,
+// for failures that are not domain errors such as malformed input
+func writeErrorStatus(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	middleware.WriteError(w, r, status, code, message)
+}
+
+// NotFound answers requests that match no route
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	writeErrorStatus(w, r, http.StatusNotFound, CodeNotFound, "no route for "+r.URL.Path)
+}
+
+// MethodNotAllowed answers requests whose path matches a route registered
+// for other methods
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeErrorStatus(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "method "+r.Method+" is not allowed")
+}
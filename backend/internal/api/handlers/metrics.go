@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"go-url-shortener/internal/clicks"
+	"go-url-shortener/internal/db"
+)
+
+type MetricsHandler struct {
+	repo     db.RepositoryInterface
+	recorder *clicks.Recorder
+}
+
+func NewMetricsHandler(repo db.RepositoryInterface, recorder *clicks.Recorder) *MetricsHandler {
+	return &MetricsHandler{
+		repo:     repo,
+		recorder: recorder,
+	}
+}
+
+type MetricsResponse struct {
+	Cache  *db.CacheStats `json:"cache,omitempty"`
+	Clicks clicks.Stats   `json:"clicks"`
+}
+
+// GetMetrics reports counters for the server's in-process subsystems
+func (h *MetricsHandler) GetMetrics(w http.ResponseWriter, r *http.Request) {
+	response := MetricsResponse{
+		Clicks: h.recorder.Stats(),
+	}
+
+	// The cache is optional and disabled through config
+	if cached, ok := h.repo.(*db.CachedRepository); ok {
+		stats := cached.Stats()
+		response.Cache = &stats
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
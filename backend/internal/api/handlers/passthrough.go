@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"go-url-shortener/internal/db"
+)
+
+// subPath returns the still escaped path after the short code of a visit to
+// /{shortCode}/{path}, and whether the visit had one
+func subPath(r *http.Request) (string, bool) {
+	_, rest, found := strings.Cut(strings.TrimPrefix(r.URL.EscapedPath(), "/"), "/")
+	return rest, found
+}
+
+// checkSubPath turns away visits to a sub-path of a link that does not pass
+// paths through. It reads the link without counting, so the visit is turned
+// away before it is counted.
+func (h *RedirectHandler) checkSubPath(r *http.Request, shortCode string) error {
+	if _, ok := subPath(r); !ok {
+		return nil
+	}
+
+	shortURL, err := h.repo.GetShortURL(r.Context(), shortCode)
+	if err != nil {
+		return err
+	}
+	if !shortURL.PathPassthrough {
+		return db.ErrNotFound
+	}
+	return nil
+}
+
+// destination is where a visit to shortURL goes: the link's target, with
+// the visit's sub-path and query carried over if the link asks for it
+func destination(shortURL *db.URL, r *http.Request) string {
+	rest, hasPath := subPath(r)
+	hasPath = hasPath && shortURL.PathPassthrough
+	hasQuery := shortURL.QueryPassthrough != "" && r.URL.RawQuery != ""
+	if !hasPath && !hasQuery {
+		return shortURL.OriginalURL
+	}
+
+	target, err := url.Parse(shortURL.OriginalURL)
+	if err != nil {
+		// Targets are validated when links are created, so this is not
+		// expected; fall back to the plain target
+		return shortURL.OriginalURL
+	}
+	if hasPath {
+		appendPath(target, rest)
+	}
+	if hasQuery {
+		target.RawQuery = mergeQuery(target.Query(), r.URL.Query(), shortURL.QueryPassthrough).Encode()
+	}
+	return target.String()
+}
+
+// appendPath adds the escaped path rest to the path of target. Each segment
+// is unescaped and escaped again, so an encoded slash stays inside its
+// segment. Dot segments are dropped; they would let a visit climb out of
+// the target's path.
+func appendPath(target *url.URL, rest string) {
+	var segments []string
+	for _, segment := range strings.Split(rest, "/") {
+		segment, err := url.PathUnescape(segment)
+		if err != nil || segment == "." || segment == ".." {
+			continue
+		}
+		segments = append(segments, url.PathEscape(segment))
+	}
+
+	escaped := strings.TrimSuffix(target.EscapedPath(), "/") + "/" + strings.Join(segments, "/")
+	target.Path, _ = url.PathUnescape(escaped)
+	target.RawPath = escaped
+}
+
+// mergeQuery adds the visit's parameters to the target's with the given
+// db.QueryPassthrough* policy
+func mergeQuery(target, visit url.Values, policy string) url.Values {
+	for key, values := range visit {
+		_, taken := target[key]
+		switch {
+		case !taken || policy == db.QueryPassthroughOverride:
+			target[key] = values
+		case policy == db.QueryPassthroughAppend:
+			target[key] = append(target[key], values...)
+		}
+	}
+	return target
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-url-shortener/internal/auth"
+	"go-url-shortener/internal/db"
+	"go-url-shortener/internal/middleware"
+
+	"github.com/gorilla/mux"
+)
+
+// maxPasswordFormBytes bounds the body of a password form submission
+const maxPasswordFormBytes = 4 << 10
+
+// passwordForm asks for the password of a protected link and posts it back
+// to the link itself, along with the visit's sub-path and query
+var passwordForm = template.Must(template.New("password").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>Password required</title>
+<style>
+body { font-family: system-ui, sans-serif; display: flex; justify-content: center; margin-top: 15vh; color: #222; }
+form { width: 20rem; }
+input, button { width: 100%; box-sizing: border-box; padding: .6rem; margin-top: .5rem; font-size: 1rem; }
+.error { color: #b00020; }
+</style>
+</head>
+<body>
+<form method="post" action="{{.Action}}">
+<h1>Password required</h1>
+<p>This link is protected. Enter its password to continue.</p>
+{{if .Message}}<p class="error" role="alert">{{.Message}}</p>{{end}}
+<label for="password">Password</label>
+<input id="password" name="password" type="password" autocomplete="current-password" maxlength="{{.MaxLength}}" required autofocus>
+<button type="submit">Continue</button>
+</form>
+</body>
+</html>
+`))
+
+// SubmitPassword checks the password posted from the form of a protected
+// link. A match records the click and sends the visitor on, see follow; a
+// mismatch shows the form again with 403. Attempts are throttled per client
+// IP and link and per link alone, and a locked-out client gets 429 with
+// Retry-After.
+func (h *RedirectHandler) SubmitPassword(w http.ResponseWriter, r *http.Request) {
+	shortCode := mux.Vars(r)["shortCode"]
+	if err := h.checkSubPath(r, shortCode); err != nil {
+		h.writeLookupError(w, r, err)
+		return
+	}
+
+	// Look the link up without counting a click; only an unlock counts
+	shortURL, err := h.repo.GetShortURL(r.Context(), shortCode)
+	if err != nil {
+		h.writeLookupError(w, r, err)
+		return
+	}
+	switch {
+	case shortURL.IsScheduled():
+		h.writeLookupError(w, r, db.ErrScheduled)
+		return
+	case shortURL.IsExhausted():
+		writeError(w, r, db.ErrExhausted)
+		return
+	case !shortURL.IsPasswordProtected():
+		writeErrorStatus(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "link is not password protected")
+		return
+	}
+
+	key := middleware.ClientIP(r) + "|" + shortCode
+	now := time.Now()
+	ok, wait := h.opts.Throttle.Allow(key, now)
+	if ok {
+		ok, wait = h.opts.LinkThrottle.Allow(shortCode, now)
+	}
+	if !ok {
+		minutes := int(math.Ceil(wait.Minutes()))
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		writePasswordForm(w, http.StatusTooManyRequests, shortCode, r.URL.RequestURI(), fmt.Sprintf("Too many attempts. Try again in %d minute(s).", minutes))
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxPasswordFormBytes)
+	if !auth.CheckPassword(shortURL.PasswordHash, r.PostFormValue("password")) {
+		writePasswordForm(w, http.StatusForbidden, shortCode, r.URL.RequestURI(), "Incorrect password.")
+		return
+	}
+	// The link's own count is left to run out, or every unlock by a
+	// regular visitor would hand an attacker a fresh budget
+	h.opts.Throttle.Reset(key)
+
+	// Count the click now; the link may have expired or run out of clicks
+	// while the form was open
+	shortURL, err = h.repo.UnlockShortURL(r.Context(), shortCode)
+	if err != nil {
+		h.writeLookupError(w, r, err)
+		return
+	}
+
+	h.recordClick(r, shortURL)
+	h.follow(w, r, shortURL, true)
+}
+
+// writePasswordForm renders the password form, which posts to action. The
+// page must not be cached, framed or leak the short link through the
+// Referer header.
+func writePasswordForm(w http.ResponseWriter, status int, code, action, message string) {
+	h := w.Header()
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	h.Set("Cache-Control", "no-store")
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("Referrer-Policy", "no-referrer")
+	h.Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; form-action 'self'; frame-ancestors 'none'")
+	w.WriteHeader(status)
+
+	err := passwordForm.Execute(w, struct {
+		Action    string
+		Message   string
+		MaxLength int
+	}{action, message, auth.MaxPasswordLength})
+	if err != nil {
+		log.Printf("Failed to render password form for %s: %v", code, err)
+	}
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"time"
+
+	"go-url-shortener/internal/db"
+
+	"github.com/gorilla/mux"
+)
+
+// previewPage shows where a link leads before the visitor follows it
+var previewPage = template.Must(template.New("preview").Funcs(template.FuncMap{
+	"date": func(t time.Time) string { return t.UTC().Format("2006-01-02 15:04 UTC") },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>Link preview</title>
+<style>
+body { font-family: system-ui, sans-serif; display: flex; justify-content: center; margin-top: 15vh; color: #222; }
+main { width: 28rem; overflow-wrap: anywhere; }
+dt { font-weight: bold; margin-top: .5rem; }
+dd { margin: 0; }
+a.continue { display: inline-block; margin-top: 1.5rem; padding: .6rem 1.2rem; background: #1a73e8; color: #fff; text-decoration: none; }
+</style>
+</head>
+<body>
+<main>
+<h1>Link preview</h1>
+<dl>
+<dt>Destination</dt>
+<dd><code>{{.URL.OriginalURL}}</code></dd>
+<dt>Created</dt>
+<dd>{{date .URL.CreatedAt}}</dd>
+<dt>Expires</dt>
+<dd>{{with .URL.ExpiresAt}}{{date .}}{{else}}Never{{end}}</dd>
+<dt>Clicks</dt>
+<dd>{{.URL.ClickCount}}</dd>
+</dl>
+<a class="continue" href="{{.Continue}}" rel="noopener">Continue</a>
+</main>
+</body>
+</html>
+`))
+
+// PreviewLink serves the preview page of /{shortCode}+ and
+// /preview/{shortCode} without recording a click. Continue goes through the
+// short link, so following it counts as a visit, even for links that force
+// a preview. Links that are not active
+// yet or protected by a password do not reveal their destination here.
+func (h *RedirectHandler) PreviewLink(w http.ResponseWriter, r *http.Request) {
+	shortCode := mux.Vars(r)["shortCode"]
+
+	shortURL, err := h.repo.GetShortURL(r.Context(), shortCode)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	switch {
+	case shortURL.IsScheduled():
+		h.writeLookupError(w, r, db.ErrScheduled)
+		return
+	case shortURL.IsExhausted():
+		writeError(w, r, db.ErrExhausted)
+		return
+	case shortURL.IsPasswordProtected():
+		writePasswordForm(w, http.StatusOK, shortCode, "/"+shortCode, "")
+		return
+	}
+
+	// A forced preview is what the short link itself shows, so Continue
+	// asks it to skip the page this visitor has already seen
+	next := "/" + shortCode
+	if shortURL.ForcePreview {
+		next += "?" + continueParam + "=1"
+	}
+	writePreviewPage(w, shortURL, next)
+}
+
+// continueParam marks a visit that comes from the Continue link of the
+// preview route, so a forced preview is not shown twice
+const continueParam = "continue"
+
+// skipsPreview reports whether r follows a link that forces a preview from
+// the preview route. The marker is dropped from r so it is not passed on to
+// the target.
+func skipsPreview(r *http.Request) bool {
+	query := r.URL.Query()
+	if query.Get(continueParam) != "1" {
+		return false
+	}
+	query.Del(continueParam)
+	r.URL.RawQuery = query.Encode()
+	return true
+}
+
+// writePreviewPage renders the preview of shortURL with a Continue link to
+// next. It is not cached, so every visit reaches the server.
+func writePreviewPage(w http.ResponseWriter, shortURL *db.URL, next string) {
+	h := w.Header()
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	h.Set("Cache-Control", "no-store")
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; frame-ancestors 'none'")
+	w.WriteHeader(http.StatusOK)
+
+	err := previewPage.Execute(w, struct {
+		URL      *db.URL
+		Continue string
+	}{shortURL, next})
+	if err != nil {
+		log.Printf("Failed to render preview page for %s: %v", shortURL.ShortCode, err)
+	}
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"go-url-shortener/internal/auth"
+	"go-url-shortener/internal/core"
+	"go-url-shortener/internal/db"
+	"go-url-shortener/internal/qr"
+
+	"github.com/gorilla/mux"
+)
+
+type QRHandler struct {
+	shortener *core.Shortener
+	repo      db.RepositoryInterface
+}
+
+func NewQRHandler(shortener *core.Shortener, repo db.RepositoryInterface) *QRHandler {
+	return &QRHandler{
+		shortener: shortener,
+		repo:      repo,
+	}
+}
+
+// GetQRCode renders the QR code of a short link. See parseQROptions for the
+// query parameters.
+func (h *QRHandler) GetQRCode(w http.ResponseWriter, r *http.Request) {
+	shortCode := mux.Vars(r)["shortCode"]
+
+	format, opts, err := parseQROptions(r)
+	if err != nil {
+		writeErrorStatus(w, r, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		return
+	}
+
+	// Only the owner's existing, unexpired links get a code
+	if _, err := h.repo.GetShortURLForOwner(r.Context(), shortCode, auth.OwnerID(r.Context())); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	image, err := qr.Render(h.shortener.GetShortURL(shortCode), format, opts)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Length", strconv.Itoa(len(image)))
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Write(image)
+}
+
+// parseQROptions reads the QR query parameters:
+//
+//	format  png (default) or svg
+//	size    width and height in pixels, 32-2048 (default 256)
+//	level   error correction L, M (default), Q or H
+//	margin  quiet zone in modules, 0-32 (default 4)
+//	fg, bg  hex colors, RGB, RRGGBB or RRGGBBAA (default 000000 and ffffff)
+func parseQROptions(r *http.Request) (qr.Format, qr.Options, error) {
+	query := r.URL.Query()
+	opts := qr.DefaultOptions()
+	format := qr.PNG
+
+	var err error
+	if value := query.Get("format"); value != "" {
+		if format, err = qr.ParseFormat(value); err != nil {
+			return format, opts, err
+		}
+	}
+
+	if value := query.Get("level"); value != "" {
+		if opts.Level, err = qr.ParseLevel(value); err != nil {
+			return format, opts, err
+		}
+	}
+
+	for param, dest := range map[string]*int{"size": &opts.Size, "margin": &opts.Margin} {
+		if value := query.Get(param); value != "" {
+			if *dest, err = strconv.Atoi(value); err != nil {
+				return format, opts, fmt.Errorf("invalid %s %q", param, value)
+			}
+		}
+	}
+
+	if value := query.Get("fg"); value != "" {
+		if opts.Foreground, err = qr.ParseColor(value); err != nil {
+			return format, opts, err
+		}
+	}
+	if value := query.Get("bg"); value != "" {
+		if opts.Background, err = qr.ParseColor(value); err != nil {
+			return format, opts, err
+		}
+	}
+
+	return format, opts, opts.Validate()
+}
@@ -1,76 +1,161 @@
 package handlers
 
 import (
+	"errors"
+	"log"
 	"net/http"
-	"strings"
+	"strconv"
 
+	"go-url-shortener/internal/auth"
+	"go-url-shortener/internal/clicks"
 	"go-url-shortener/internal/db"
+	"go-url-shortener/internal/middleware"
+
+	"github.com/gorilla/mux"
 )
 
+// RedirectOptions configures a RedirectHandler
+type RedirectOptions struct {
+	// Throttle limits password attempts on protected links per client and
+	// link, and LinkThrottle per link from all clients, so changing address
+	// does not buy more guesses
+	Throttle     *auth.Throttle
+	LinkThrottle *auth.Throttle
+
+	// RedirectType is used by links without their own, one of the
+	// db.Redirect* types; the default is 301
+	RedirectType string
+
+	// ScheduledStatus is the status of the error response for links that
+	// are not active yet. When ScheduledURL is set, visitors are sent there
+	// with 302 Found instead, e.g. to a "coming soon" page.
+	ScheduledStatus int
+	ScheduledURL    string
+}
+
 type RedirectHandler struct {
-	repo      db.RepositoryInterface
+	repo     db.RepositoryInterface
+	recorder *clicks.Recorder
+	opts     RedirectOptions
 }
 
-func NewRedirectHandler(repo db.RepositoryInterface) *RedirectHandler {
+func NewRedirectHandler(repo db.RepositoryInterface, recorder *clicks.Recorder, opts RedirectOptions) *RedirectHandler {
+	if opts.Throttle == nil {
+		opts.Throttle = auth.NewThrottle(0, 0)
+	}
+	if opts.LinkThrottle == nil {
+		opts.LinkThrottle = auth.NewThrottle(0, 0)
+	}
+	if !db.IsValidRedirectType(opts.RedirectType) {
+		opts.RedirectType = db.RedirectMovedPermanently
+	}
+	// The response is an error body, so only error statuses make sense
+	if opts.ScheduledStatus < 400 || opts.ScheduledStatus > 599 {
+		opts.ScheduledStatus = http.StatusNotFound
+	}
+
 	return &RedirectHandler{
-		repo: repo,
+		repo:     repo,
+		recorder: recorder,
+		opts:     opts,
 	}
 }
 
 func (h *RedirectHandler) RedirectToOriginal(w http.ResponseWriter, r *http.Request) {
-	// Extract short code from URL path
-	shortCode := r.URL.Path[1:]
+	// Extract short code from URL path; anything after it is the sub-path
+	shortCode := mux.Vars(r)["shortCode"]
 	
 	if shortCode == "" {
-		http.Error(w, "Short code is required", http.StatusBadRequest)
+		writeErrorStatus(w, r, http.StatusBadRequest, CodeInvalidRequest, "short code is required")
+		return
+	}
+	if err := h.checkSubPath(r, shortCode); err != nil {
+		h.writeLookupError(w, r, err)
 		return
 	}
 
-	// Get original URL from database and increment click count
-	shortURL, err := h.repo.GetShortURLForRedirect(shortCode)
+	// Get original URL from database and increment click count; protected
+	// links are counted once unlocked
+	shortURL, err := h.repo.GetShortURLForRedirect(r.Context(), shortCode)
 	if err != nil {
-		http.Error(w, "Short URL not found", http.StatusNotFound)
+		h.writeLookupError(w, r, err)
 		return
 	}
 
 	// Check if URL is expired (already handled in GetShortURLForRedirect, but double-check)
 	if shortURL.IsExpired() {
-		http.Error(w, "Short URL has expired", http.StatusGone)
+		writeError(w, r, db.ErrExpired)
 		return
 	}
 
-	// Record click event with visitor information
-	ipAddress := getClientIP(r)
-	userAgent := r.UserAgent()
-	referer := r.Referer()
-	
-	// Add click event (ignore errors as it's not critical for redirect functionality)
-	_ = h.repo.AddClickEvent(shortURL.ID, ipAddress, userAgent, referer)
+	// Visitors have to unlock protected links first, see SubmitPassword
+	if shortURL.IsPasswordProtected() {
+		writePasswordForm(w, http.StatusOK, shortCode, r.URL.RequestURI(), "")
+		return
+	}
+
+	h.recordClick(r, shortURL)
 
 	// Redirect to original URL
-	http.Redirect(w, r, shortURL.OriginalURL, http.StatusMovedPermanently)
+	h.follow(w, r, shortURL, false)
 }
 
-// getClientIP extracts the real client IP address from the request
-func getClientIP(r *http.Request) string {
-	// Check X-Forwarded-For header first (when behind a proxy)
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		// X-Forwarded-For can contain multiple IPs, get the first one
-		if idx := strings.Index(xff, ","); idx != -1 {
-			return strings.TrimSpace(xff[:idx])
-		}
-		return strings.TrimSpace(xff)
+// follow sends the visitor on to the target, the way the link's redirect
+// type asks, or shows the preview page first if the link forces it and the
+// visitor has not come from the preview route already. After
+// a form post the HTTP types become 303 See Other, since 307 and 308 would
+// post the password on to the target.
+func (h *RedirectHandler) follow(w http.ResponseWriter, r *http.Request, shortURL *db.URL, afterPost bool) {
+	if shortURL.ForcePreview && !skipsPreview(r) {
+		writePreviewPage(w, shortURL, destination(shortURL, r))
+		return
+	}
+	target := destination(shortURL, r)
+
+	redirectType := shortURL.RedirectType
+	if redirectType == "" {
+		redirectType = h.opts.RedirectType
+	}
+
+	switch redirectType {
+	case db.RedirectMetaRefresh, db.RedirectInterstitial:
+		writeRedirectPage(w, redirectType, target)
+		return
+	}
+
+	status, err := strconv.Atoi(redirectType)
+	if err != nil || afterPost {
+		status = http.StatusSeeOther
+	}
+	http.Redirect(w, r, target, status)
+}
+
+// writeLookupError reports why a link cannot be followed. Links that are
+// not active yet get the configured response.
+func (h *RedirectHandler) writeLookupError(w http.ResponseWriter, r *http.Request, err error) {
+	if !errors.Is(err, db.ErrScheduled) {
+		writeError(w, r, err)
+		return
 	}
 
-	// Check X-Real-IP header
-	if xri := r.Header.Get("X-Real-IP"); xri != "" {
-		return strings.TrimSpace(xri)
+	if h.opts.ScheduledURL != "" {
+		w.Header().Set("Cache-Control", "no-store")
+		http.Redirect(w, r, h.opts.ScheduledURL, http.StatusFound)
+		return
 	}
+	writeErrorStatus(w, r, h.opts.ScheduledStatus, CodeScheduled, err.Error())
+}
 
-	// Fall back to RemoteAddr
-	ip := r.RemoteAddr
-	if idx := strings.LastIndex(ip, ":"); idx != -1 {
-		ip = ip[:idx]
+// recordClick queues a click event with visitor information; it is written
+// in the background so the redirect does not wait on the INSERT
+func (h *RedirectHandler) recordClick(r *http.Request, shortURL *db.URL) {
+	event := &db.ClickEvent{
+		URLId:     shortURL.ID,
+		IPAddress: middleware.ClientIP(r),
+		UserAgent: r.UserAgent(),
+		Referer:   r.Referer(),
 	}
-	return ip
-}
\ No newline at end of file
+	if err := h.recorder.Record(r.Context(), event); err != nil {
+		log.Printf("Click event for %s not recorded: %v", shortURL.ShortCode, err)
+	}
+}
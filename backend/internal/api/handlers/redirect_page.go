@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+
+	"go-url-shortener/internal/db"
+)
+
+// redirectPages are the HTML pages of the meta_refresh and interstitial
+// redirect types. Both link to the target so visitors without automatic
+// refresh can still follow it.
+var redirectPages = map[string]*template.Template{
+	db.RedirectMetaRefresh: template.Must(template.New("meta_refresh").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="0; url={{.}}">
+<meta name="robots" content="noindex">
+<title>Redirecting</title>
+</head>
+<body>
+<p>Redirecting to <a href="{{.}}">{{.}}</a></p>
+</body>
+</html>
+`)),
+	db.RedirectInterstitial: template.Must(template.New("interstitial").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>You are leaving this site</title>
+<style>
+body { font-family: system-ui, sans-serif; display: flex; justify-content: center; margin-top: 15vh; color: #222; }
+main { width: 28rem; overflow-wrap: anywhere; }
+a.continue { display: inline-block; margin-top: 1rem; padding: .6rem 1.2rem; background: #1a73e8; color: #fff; text-decoration: none; }
+</style>
+</head>
+<body>
+<main>
+<h1>You are leaving this site</h1>
+<p>This link goes to:</p>
+<p><code>{{.}}</code></p>
+<a class="continue" href="{{.}}" rel="noopener">Continue</a>
+</main>
+</body>
+</html>
+`)),
+}
+
+// writeRedirectPage serves the page of an HTML redirect type. The page is
+// not cached, so every visit reaches the server and is counted.
+func writeRedirectPage(w http.ResponseWriter, redirectType, target string) {
+	h := w.Header()
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	h.Set("Cache-Control", "no-store")
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; frame-ancestors 'none'")
+	w.WriteHeader(http.StatusOK)
+
+	if err := redirectPages[redirectType].Execute(w, target); err != nil {
+		log.Printf("Failed to render %s page: %v", redirectType, err)
+	}
+}
@@ -2,23 +2,44 @@ package handlers
 
 import (
 	"encoding/json"
+	"go-url-shortener/internal/auth"
 	"go-url-shortener/internal/core"
 	"go-url-shortener/internal/db"
+	"go-url-shortener/internal/qr"
+	"log"
 	"net/http"
 	"time"
 )
 
 type ShortenRequest struct {
-    URL        string `json:"url" validate:"required,url"`
-    CustomCode string `json:"custom_code,omitempty"`
-    ExpiresAt  string `json:"expires_at,omitempty"`
+    URL              string `json:"url" validate:"required,url"`
+    CustomCode       string `json:"custom_code,omitempty"`
+    ActivatesAt      string `json:"activates_at,omitempty"`
+    ExpiresAt        string `json:"expires_at,omitempty"`
+    Password         string `json:"password,omitempty"`
+    MaxClicks        int    `json:"max_clicks,omitempty"`
+    RedirectType     string `json:"redirect_type,omitempty"` // 301, 302, 307, 308, meta_refresh or interstitial
+    ForcePreview     bool   `json:"force_preview,omitempty"`
+    QueryPassthrough string `json:"query_passthrough,omitempty"` // keep, override or append
+    PathPassthrough  bool   `json:"path_passthrough,omitempty"`
+    // utm_source, utm_medium, ... and other parameters to add to the URL
+    db.UTM
+    QueryParams map[string]string `json:"query_params,omitempty"`
 }
 
 type ShortenResponse struct {
-    ShortURL    string `json:"short_url"`
-    OriginalURL string `json:"original_url"`
-    Code        string `json:"code"`
-    QRCode      string `json:"qr_code,omitempty"`
+    ShortURL          string     `json:"short_url"`
+    OriginalURL       string     `json:"original_url"`
+    Code              string     `json:"code"`
+    QRCode            string     `json:"qr_code,omitempty"`
+    ActivatesAt       *time.Time `json:"activates_at,omitempty"`
+    PasswordProtected bool       `json:"password_protected,omitempty"`
+    MaxClicks         int        `json:"max_clicks,omitempty"`
+    RedirectType      string     `json:"redirect_type,omitempty"`
+    ForcePreview      bool       `json:"force_preview,omitempty"`
+    QueryPassthrough  string     `json:"query_passthrough,omitempty"`
+    PathPassthrough   bool       `json:"path_passthrough,omitempty"`
+    db.UTM
 }
 
 type ShortenHandler struct {
@@ -38,7 +59,7 @@ func (h *ShortenHandler) CreateShortURL(w http.ResponseWriter, r *http.Request)
     
     // Parse JSON request
     if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-        http.Error(w, "Invalid JSON", http.StatusBadRequest)
+        writeErrorStatus(w, r, http.StatusBadRequest, CodeInvalidRequest, "invalid JSON body")
         return
     }
     
@@ -46,32 +67,69 @@ func (h *ShortenHandler) CreateShortURL(w http.ResponseWriter, r *http.Request)
     var expiresAt *time.Time
     if req.ExpiresAt != "" {
         if parsed, err := time.Parse(time.RFC3339, req.ExpiresAt); err != nil {
-            http.Error(w, "Invalid expiration date format", http.StatusBadRequest)
+            writeErrorStatus(w, r, http.StatusBadRequest, CodeInvalidRequest, "invalid expires_at, expected RFC 3339 timestamp")
             return
         } else {
             expiresAt = &parsed
         }
     }
     
-    // Create URL through business logic
-    url, err := h.shortener.CreateShortURL(req.URL, req.CustomCode, expiresAt)
-    if err != nil {
-        if err.Error() == "short code already exists" {
-            http.Error(w, err.Error(), http.StatusConflict)
+    var activatesAt *time.Time
+    if req.ActivatesAt != "" {
+        parsed, err := time.Parse(time.RFC3339, req.ActivatesAt)
+        if err != nil {
+            writeErrorStatus(w, r, http.StatusBadRequest, CodeInvalidRequest, "invalid activates_at, expected RFC 3339 timestamp")
             return
         }
-        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        activatesAt = &parsed
+    }
+    
+    // Create URL through business logic
+    url, err := h.shortener.CreateShortURL(r.Context(), auth.OwnerID(r.Context()), req.URL, req.CustomCode, expiresAt, core.LinkOptions{
+        Password:         req.Password,
+        MaxClicks:        req.MaxClicks,
+        ActivatesAt:      activatesAt,
+        RedirectType:     req.RedirectType,
+        ForcePreview:     req.ForcePreview,
+        QueryPassthrough: req.QueryPassthrough,
+        PathPassthrough:  req.PathPassthrough,
+        UTM:              req.UTM,
+        QueryParams:      req.QueryParams,
+    })
+    if err != nil {
+        writeError(w, r, err)
         return
     }
     
     // Prepare response
-    response := ShortenResponse{
-        ShortURL:    "http://localhost:8080/" + url.ShortCode, // TODO: Use config for base URL
-        OriginalURL: url.OriginalURL,
-        Code:        url.ShortCode,
+    response := h.shortenResponse(url)
+    shortURL := response.ShortURL
+    
+    // The link works without a QR code, so a rendering failure is not fatal
+    if qrCode, err := qr.DataURI(shortURL, qr.DefaultOptions()); err != nil {
+        log.Printf("Failed to render QR code for %s: %v", url.ShortCode, err)
+    } else {
+        response.QRCode = qrCode
     }
     
     w.Header().Set("Content-Type", "application/json")
     w.WriteHeader(http.StatusCreated)
     json.NewEncoder(w).Encode(response)
+}
+
+// shortenResponse describes a created link, without its QR code
+func (h *ShortenHandler) shortenResponse(url *db.URL) *ShortenResponse {
+    return &ShortenResponse{
+        ShortURL:          h.shortener.GetShortURL(url.ShortCode),
+        OriginalURL:       url.OriginalURL,
+        Code:              url.ShortCode,
+        ActivatesAt:       url.ActivatesAt,
+        PasswordProtected: url.IsPasswordProtected(),
+        MaxClicks:         url.MaxClicks,
+        RedirectType:      url.RedirectType,
+        ForcePreview:      url.ForcePreview,
+        QueryPassthrough:  url.QueryPassthrough,
+        PathPassthrough:   url.PathPassthrough,
+        UTM:               url.UTM,
+    }
 }
\ No newline at end of file
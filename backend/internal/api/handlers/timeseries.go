@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	_ "time/tzdata" // IANA zones for ?tz even where the host has none
+
+	"go-url-shortener/internal/auth"
+	"go-url-shortener/internal/db"
+
+	"github.com/gorilla/mux"
+)
+
+// defaultTimeSeriesSpans is how far back a time series reaches without
+// ?from, per granularity
+var defaultTimeSeriesSpans = map[string]time.Duration{
+	db.GranularityMinute: time.Hour,
+	db.GranularityHour:   24 * time.Hour,
+	db.GranularityDay:    30 * 24 * time.Hour,
+	db.GranularityWeek:   12 * 7 * 24 * time.Hour,
+	db.GranularityMonth:  365 * 24 * time.Hour,
+}
+
+// TimeSeriesResponse lists the clicks of a link per bucket. From is the
+// start of the first bucket, which may be earlier than the requested from.
+type TimeSeriesResponse struct {
+	ShortCode   string                 `json:"short_code"`
+	From        time.Time              `json:"from"`
+	To          time.Time              `json:"to"`
+	Granularity string                 `json:"granularity"`
+	Timezone    string                 `json:"timezone"`
+	GroupBy     string                 `json:"group_by,omitempty"`
+	Total       int                    `json:"total"`
+	Buckets     []*db.TimeSeriesBucket `json:"buckets"`
+}
+
+// GetClickTimeSeries counts the clicks of a link per minute, hour, day, week
+// or month, aligned to the IANA time zone in ?tz (UTC by default). ?from
+// and ?to take RFC 3339 timestamps or dates, which are midnight in that
+// zone; ?group_by splits buckets by referer, browser or country. Clicks by
+// bots are left out unless ?include_bots=true.
+func (h *AnalyticsHandler) GetClickTimeSeries(w http.ResponseWriter, r *http.Request) {
+	shortCode := mux.Vars(r)["shortCode"]
+
+	opts, err := parseTimeSeriesOptions(r)
+	if err != nil {
+		writeErrorStatus(w, r, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		return
+	}
+
+	url, err := h.repo.GetShortURLForOwner(r.Context(), shortCode, auth.OwnerID(r.Context()))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	buckets, err := h.repo.GetClickTimeSeries(r.Context(), url.ID, opts)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	response := TimeSeriesResponse{
+		ShortCode:   url.ShortCode,
+		From:        opts.From,
+		To:          opts.To.In(opts.Location),
+		Granularity: opts.Granularity,
+		Timezone:    opts.Location.String(),
+		GroupBy:     opts.GroupBy,
+		Buckets:     buckets,
+	}
+	for _, bucket := range buckets {
+		response.Total += bucket.Clicks
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// parseTimeSeriesOptions reads the query of a time series request and
+// fills in the defaults
+func parseTimeSeriesOptions(r *http.Request) (db.TimeSeriesOptions, error) {
+	query := r.URL.Query()
+	opts := db.TimeSeriesOptions{
+		Granularity: query.Get("granularity"),
+		GroupBy:     query.Get("group_by"),
+		Location:    time.UTC,
+	}
+
+	if tz := query.Get("tz"); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil || tz == "Local" {
+			return opts, fmt.Errorf("tz must be an IANA time zone such as Europe/Berlin")
+		}
+		opts.Location = loc
+	}
+
+	if value := query.Get("include_bots"); value != "" {
+		var err error
+		if opts.IncludeBots, err = strconv.ParseBool(value); err != nil {
+			return opts, fmt.Errorf("include_bots must be true or false")
+		}
+	}
+
+	var err error
+	if opts.From, err = parseTimeSeriesTime(query.Get("from"), opts.Location); err != nil {
+		return opts, fmt.Errorf("from: %w", err)
+	}
+	if opts.To, err = parseTimeSeriesTime(query.Get("to"), opts.Location); err != nil {
+		return opts, fmt.Errorf("to: %w", err)
+	}
+
+	if opts.To.IsZero() {
+		opts.To = time.Now()
+	}
+	if opts.From.IsZero() {
+		span, ok := defaultTimeSeriesSpans[opts.Granularity]
+		if !ok {
+			span = defaultTimeSeriesSpans[db.GranularityDay]
+		}
+		opts.From = opts.To.Add(-span)
+	}
+
+	return opts, opts.Normalize()
+}
+
+// parseTimeSeriesTime reads an RFC 3339 timestamp or a date, which is
+// midnight in loc. An empty value gives the zero time.
+func parseTimeSeriesTime(value string, loc *time.Location) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, loc); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("expected an RFC 3339 timestamp or a date like 2026-01-31, got %q", value)
+}
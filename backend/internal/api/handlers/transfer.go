@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"go-url-shortener/internal/db"
+	"go-url-shortener/internal/middleware"
+	"go-url-shortener/internal/transfer"
+)
+
+// ImportResponse reports what an import did. Error is set when it stopped
+// early; the counts then cover what was written before that.
+type ImportResponse struct {
+	Report *transfer.Report      `json:"report"`
+	Error  *middleware.ErrorBody `json:"error,omitempty"`
+}
+
+// Export streams every link and click event as NDJSON or CSV (?format=).
+// A failure after the first bytes were sent aborts the response, so a
+// truncated download never looks complete.
+func (h *AdminHandler) Export(w http.ResponseWriter, r *http.Request) {
+	format, err := transfer.ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		writeErrorStatus(w, r, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		return
+	}
+
+	r = withoutDBTimeout(r)
+
+	filename := fmt.Sprintf("shortener-export-%s.%s", time.Now().UTC().Format("20060102-150405"), format)
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	out := &trackingWriter{w: w}
+	if _, err := transfer.Export(r.Context(), h.repo, out, format); err != nil {
+		if !out.written {
+			w.Header().Del("Content-Disposition")
+			writeError(w, r, err)
+			return
+		}
+		log.Printf("Export aborted [%s]: %v", middleware.RequestIDFromContext(r.Context()), err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// Import reads an export from the request body and stores it. The format
+// comes from ?format= or the Content-Type, defaulting to NDJSON; ?conflict=
+// picks the db.ConflictPolicy and ?dry_run=true only reports what would
+// happen.
+func (h *AdminHandler) Import(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	opts := transfer.Options{Format: transfer.FormatForContentType(r.Header.Get("Content-Type"))}
+	if name := query.Get("format"); name != "" || opts.Format == "" {
+		format, err := transfer.ParseFormat(name)
+		if err != nil {
+			writeErrorStatus(w, r, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+			return
+		}
+		opts.Format = format
+	}
+
+	conflict, err := db.ParseConflictPolicy(query.Get("conflict"))
+	if err != nil {
+		writeErrorStatus(w, r, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		return
+	}
+	opts.Conflict = conflict
+
+	switch query.Get("dry_run") {
+	case "", "false", "0":
+	case "true", "1":
+		opts.DryRun = true
+	default:
+		writeErrorStatus(w, r, http.StatusBadRequest, CodeInvalidRequest, "dry_run must be true or false")
+		return
+	}
+
+	r = withoutDBTimeout(r)
+
+	report, err := transfer.Import(r.Context(), h.repo, r.Body, opts)
+	response := ImportResponse{Report: report}
+	status := http.StatusOK
+	if err != nil {
+		status = http.StatusInternalServerError
+		if m, ok := lookupError(err); ok {
+			status = m.status
+		}
+		response.Error = errorBody(r, err)
+		response.Error.RequestID = middleware.RequestIDFromContext(r.Context())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// withoutDBTimeout lifts the per-request DB_TIMEOUT deadline, which a whole
+// export or import would outlive. A client that goes away still stops the
+// transfer, since writing the response or reading the body then fails.
+func withoutDBTimeout(r *http.Request) *http.Request {
+	return r.WithContext(context.WithoutCancel(r.Context()))
+}
+
+// trackingWriter notes whether any of the response was written
+type trackingWriter struct {
+	w       http.ResponseWriter
+	written bool
+}
+
+func (t *trackingWriter) Write(p []byte) (int, error) {
+	t.written = true
+	return t.w.Write(p)
+}
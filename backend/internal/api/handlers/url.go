@@ -2,79 +2,270 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
+	"go-url-shortener/internal/auth"
+	"go-url-shortener/internal/core"
 	"go-url-shortener/internal/db"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 )
 
 type URLHandler struct {
-    repo db.RepositoryInterface
+    shortener *core.Shortener
+    repo      db.RepositoryInterface
 }
 
-func NewURLHandler(repo db.RepositoryInterface) *URLHandler {
-    return &URLHandler{repo: repo}
+func NewURLHandler(shortener *core.Shortener, repo db.RepositoryInterface) *URLHandler {
+    return &URLHandler{
+        shortener: shortener,
+        repo:      repo,
+    }
 }
 
 func (h *URLHandler) GetShortURL(w http.ResponseWriter, r *http.Request) {
     vars := mux.Vars(r)
     shortCode := vars["shortCode"]
     
-    url, err := h.repo.GetShortURL(shortCode)
+    url, err := h.repo.GetShortURLForOwner(r.Context(), shortCode, auth.OwnerID(r.Context()))
     if err != nil {
-        http.Error(w, "URL not found", http.StatusNotFound)
+        writeError(w, r, err)
         return
     }
     
     w.Header().Set("Content-Type", "application/json")
+    w.Header().Set("ETag", versionETag(url.Version))
     json.NewEncoder(w).Encode(url)
 }
 
+// UpdateURLRequest is the body of PATCH /api/urls/{shortCode}. Omitted
+// fields are left unchanged; "expires_at": null removes the expiry.
+type UpdateURLRequest struct {
+    OriginalURL *string         `json:"original_url,omitempty"`
+    ShortCode   *string         `json:"short_code,omitempty"`
+    ExpiresAt   json.RawMessage `json:"expires_at,omitempty"`
+    // Version is an alternative to the If-Match header
+    Version int `json:"version,omitempty"`
+}
+
+// UpdateShortURL edits a link. The caller must say which version it edits,
+// either with If-Match set to the ETag from GET or with "version" in the
+// body; if the link changed in the meantime the update fails with 412.
+// "If-Match: *" updates whatever the current version is.
+func (h *URLHandler) UpdateShortURL(w http.ResponseWriter, r *http.Request) {
+    shortCode := mux.Vars(r)["shortCode"]
+    
+    var req UpdateURLRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        writeErrorStatus(w, r, http.StatusBadRequest, CodeInvalidRequest, "invalid JSON body")
+        return
+    }
+    
+    update := db.URLUpdate{
+        OriginalURL: req.OriginalURL,
+        ShortCode:   req.ShortCode,
+    }
+    if len(req.ExpiresAt) > 0 {
+        update.SetExpiresAt = true
+        if string(req.ExpiresAt) != "null" {
+            var expiresAt time.Time
+            if err := json.Unmarshal(req.ExpiresAt, &expiresAt); err != nil {
+                writeErrorStatus(w, r, http.StatusBadRequest, CodeInvalidRequest, "invalid expires_at, expected RFC 3339 timestamp or null")
+                return
+            }
+            update.ExpiresAt = &expiresAt
+        }
+    }
+    
+    if update.OriginalURL == nil && update.ShortCode == nil && !update.SetExpiresAt {
+        writeErrorStatus(w, r, http.StatusBadRequest, CodeInvalidRequest, "nothing to update, set original_url, short_code or expires_at")
+        return
+    }
+    
+    version, err := expectedVersion(r.Header.Get("If-Match"), req.Version)
+    if err != nil {
+        writeErrorStatus(w, r, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+        return
+    }
+    if version < 0 {
+        writeErrorStatus(w, r, http.StatusPreconditionRequired, CodePreconditionRequired, "send If-Match or version to update a link")
+        return
+    }
+    
+    url, err := h.shortener.UpdateShortURL(r.Context(), auth.OwnerID(r.Context()), shortCode, version, update)
+    if err != nil {
+        writeError(w, r, err)
+        return
+    }
+    
+    w.Header().Set("Content-Type", "application/json")
+    w.Header().Set("ETag", versionETag(url.Version))
+    json.NewEncoder(w).Encode(url)
+}
+
+// versionETag is the entity tag of a link version
+func versionETag(version int) string {
+    return `"` + strconv.Itoa(version) + `"`
+}
+
+// expectedVersion reads the version an update is based on from If-Match or
+// the body. It returns 0 for "If-Match: *", which matches any version, and
+// -1 when the caller sent neither.
+func expectedVersion(ifMatch string, bodyVersion int) (int, error) {
+    ifMatch = strings.TrimSpace(ifMatch)
+    switch {
+    case ifMatch == "*":
+        return 0, nil
+    case ifMatch != "":
+        tag := strings.TrimPrefix(ifMatch, "W/")
+        version, err := strconv.Atoi(strings.Trim(tag, `"`))
+        if err != nil || version < 1 || !strings.HasPrefix(tag, `"`) {
+            return 0, fmt.Errorf("invalid If-Match %q", ifMatch)
+        }
+        if bodyVersion != 0 && bodyVersion != version {
+            return 0, fmt.Errorf("If-Match and version disagree")
+        }
+        return version, nil
+    case bodyVersion > 0:
+        return bodyVersion, nil
+    case bodyVersion < 0:
+        return 0, fmt.Errorf("invalid version %d", bodyVersion)
+    }
+    return -1, nil
+}
+
 func (h *URLHandler) DeleteShortURL(w http.ResponseWriter, r *http.Request) {
     vars := mux.Vars(r)
     shortCode := vars["shortCode"]
     
-    err := h.repo.DeleteShortURL(shortCode)
+    err := h.repo.DeleteShortURLForOwner(r.Context(), shortCode, auth.OwnerID(r.Context()))
     if err != nil {
-        http.Error(w, "URL not found", http.StatusNotFound)
+        writeError(w, r, err)
         return
     }
     
     w.WriteHeader(http.StatusNoContent)
 }
 
+// GetAllURLs returns a page of the caller's active URLs. Filters, sorting
+// and paging come from the query string, see parseListOptions.
 func (h *URLHandler) GetAllURLs(w http.ResponseWriter, r *http.Request) {
-    urls, err := h.repo.GetAllShortURLs()
+    opts, err := parseListOptions(r)
     if err != nil {
-        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        writeErrorStatus(w, r, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+        return
+    }
+    
+    // Only active links are listed here; the history endpoint shows all
+    if opts.Status == "" {
+        opts.Status = db.StatusActive
+    }
+    
+    page, err := h.repo.ListURLs(r.Context(), opts)
+    if err != nil {
+        writeError(w, r, err)
         return
     }
     
     w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(urls)
+    json.NewEncoder(w).Encode(page)
+}
+
+// URLHistoryItem is a URL with its computed status
+type URLHistoryItem struct {
+    *db.URL
+    Status string `json:"status"`
 }
 
+// URLHistoryPage is one page of the history endpoint
+type URLHistoryPage struct {
+    Items      []URLHistoryItem `json:"items"`
+    NextCursor string           `json:"next_cursor,omitempty"`
+    Total      int              `json:"total"`
+}
+
+// GetURLHistory returns a page of the caller's URLs of any status
 func (h *URLHandler) GetURLHistory(w http.ResponseWriter, r *http.Request) {
-    urls, err := h.repo.GetAllURLsHistory()
+    opts, err := parseListOptions(r)
     if err != nil {
-        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        writeErrorStatus(w, r, http.StatusBadRequest, CodeInvalidRequest, err.Error())
         return
     }
     
-    // Add status information to each URL
-    type URLHistoryItem struct {
-        *db.URL
-        Status string `json:"status"`
+    page, err := h.repo.ListURLs(r.Context(), opts)
+    if err != nil {
+        writeError(w, r, err)
+        return
     }
     
-    var historyItems []URLHistoryItem
-    for _, url := range urls {
-        historyItems = append(historyItems, URLHistoryItem{
+    // Add status information to each URL
+    history := URLHistoryPage{
+        Items:      make([]URLHistoryItem, 0, len(page.URLs)),
+        NextCursor: page.NextCursor,
+        Total:      page.Total,
+    }
+    for _, url := range page.URLs {
+        history.Items = append(history.Items, URLHistoryItem{
             URL:    url,
             Status: url.GetStatus(),
         })
     }
     
     w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(historyItems)
-}
\ No newline at end of file
+    json.NewEncoder(w).Encode(history)
+}
+
+// parseListOptions reads the list query parameters:
+//
+//	limit           page size (default 50, max 500)
+//	cursor          next_cursor from the previous page
+//	status          active, expired, scheduled or exhausted
+//	created_after   RFC 3339 timestamp, inclusive
+//	created_before  RFC 3339 timestamp, exclusive
+//	q               substring of the original URL, case-insensitive
+//	sort            created_at, click_count or last_clicked
+//	order           desc (default) or asc
+func parseListOptions(r *http.Request) (db.ListOptions, error) {
+    query := r.URL.Query()
+    opts := db.ListOptions{
+        OwnerID:     auth.OwnerID(r.Context()),
+        Cursor:      query.Get("cursor"),
+        Status:      query.Get("status"),
+        URLContains: query.Get("q"),
+        SortBy:      query.Get("sort"),
+    }
+    
+    if limit := query.Get("limit"); limit != "" {
+        n, err := strconv.Atoi(limit)
+        if err != nil || n < 1 {
+            return opts, fmt.Errorf("invalid limit %q", limit)
+        }
+        opts.Limit = n
+    }
+    
+    for param, dest := range map[string]**time.Time{
+        "created_after":  &opts.CreatedAfter,
+        "created_before": &opts.CreatedBefore,
+    } {
+        if value := query.Get(param); value != "" {
+            t, err := time.Parse(time.RFC3339, value)
+            if err != nil {
+                return opts, fmt.Errorf("invalid %s, expected RFC 3339 timestamp", param)
+            }
+            *dest = &t
+        }
+    }
+    
+    switch order := query.Get("order"); order {
+    case "", "desc":
+    case "asc":
+        opts.Ascending = true
+    default:
+        return opts, fmt.Errorf("invalid order %q", order)
+    }
+    
+    return opts, opts.Normalize()
+}
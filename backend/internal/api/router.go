@@ -1,7 +1,13 @@
 package api
 
 import (
+	"net/http"
+	"time"
+
 	"go-url-shortener/internal/api/handlers"
+	"go-url-shortener/internal/auth"
+	"go-url-shortener/internal/clicks"
+	"go-url-shortener/internal/config"
 	"go-url-shortener/internal/core"
 	"go-url-shortener/internal/db"
 	"go-url-shortener/internal/middleware"
@@ -9,31 +15,112 @@ import (
 	"github.com/gorilla/mux"
 )
 
-func NewRouter(shortener *core.Shortener, repo db.RepositoryInterface) *mux.Router {
+func NewRouter(cfg *config.Config, shortener *core.Shortener, repo db.RepositoryInterface, recorder *clicks.Recorder) *mux.Router {
     r := mux.NewRouter()
     
+    // Tag each request with an id for logs and error bodies
+    r.Use(middleware.RequestID)
+    
+    // Resolve the client address, trusting forwarding headers only from
+    // the configured proxies
+    r.Use(middleware.RealIP(cfg.TrustedProxies))
+    
     // Add CORS middleware
     r.Use(middleware.CORS)
     
+    // Bound database work per request
+    r.Use(middleware.DBTimeout(cfg.DBTimeout))
+    
     // Initialize handlers
     shortenHandler := handlers.NewShortenHandler(shortener, repo)
-    redirectHandler := handlers.NewRedirectHandler(repo)
-    urlHandler := handlers.NewURLHandler(repo)
+    redirectHandler := handlers.NewRedirectHandler(repo, recorder, handlers.RedirectOptions{
+        Throttle:        auth.NewThrottle(cfg.PasswordMaxAttempts, cfg.PasswordLockout),
+        LinkThrottle:    auth.NewThrottle(cfg.PasswordMaxAttemptsPerLink, cfg.PasswordLockout),
+        RedirectType:    cfg.RedirectType,
+        ScheduledStatus: cfg.ScheduledStatus,
+        ScheduledURL:    cfg.ScheduledRedirectURL,
+    })
+    urlHandler := handlers.NewURLHandler(shortener, repo)
     analyticsHandler := handlers.NewAnalyticsHandler(repo)
+    metricsHandler := handlers.NewMetricsHandler(repo, recorder)
+    qrHandler := handlers.NewQRHandler(shortener, repo)
+    
+    adminHandler := handlers.NewAdminHandler(repo)
+    
+    // Admin API, authenticated with ADMIN_TOKEN instead of an API key.
+    // Registered before /api so the API key middleware never sees it.
+    admin := r.PathPrefix("/api/admin").Subrouter()
+    admin.Use(middleware.RequireAdmin(cfg.AdminToken))
+    admin.HandleFunc("/keys", adminHandler.CreateAPIKey).Methods("POST")
+    admin.HandleFunc("/keys", adminHandler.ListAPIKeys).Methods("GET")
+    admin.HandleFunc("/keys/{id:[0-9]+}", adminHandler.RevokeAPIKey).Methods("DELETE")
+    admin.HandleFunc("/export", adminHandler.Export).Methods("GET")
+    admin.HandleFunc("/import", adminHandler.Import).Methods("POST")
+    // Operational metrics cover every owner's traffic
+    admin.HandleFunc("/metrics", metricsHandler.GetMetrics).Methods("GET")
     
-    // API routes
+    // Per-client rate limits. They run after Authenticate so API key
+    // callers are throttled per key rather than per IP.
+    shortenLimit := newRateLimiter(cfg.ShortenRateLimit, cfg.ShortenRateBurst, cfg.RateLimitIdleTTL)
+    manageLimit := newRateLimiter(cfg.ManagementRateLimit, cfg.ManagementRateBurst, cfg.RateLimitIdleTTL)
+    redirectLimit := newRateLimiter(cfg.RedirectRateLimit, cfg.RedirectRateBurst, cfg.RateLimitIdleTTL)
+    
+    // API routes. Management calls need an API key and only see the
+    // caller's own links; redirects stay public.
     api := r.PathPrefix("/api").Subrouter()
-    api.HandleFunc("/shorten", shortenHandler.CreateShortURL).Methods("POST")
-    api.HandleFunc("/urls/{shortCode}", urlHandler.GetShortURL).Methods("GET")
-    api.HandleFunc("/urls/{shortCode}", urlHandler.DeleteShortURL).Methods("DELETE")
-    api.HandleFunc("/urls", urlHandler.GetAllURLs).Methods("GET")
-    api.HandleFunc("/history", urlHandler.GetURLHistory).Methods("GET")
+    api.Use(middleware.Authenticate(repo))
+    owned := func(h http.HandlerFunc) http.Handler {
+        return middleware.RequireAPIKey(manageLimit(h))
+    }
+    
+    shorten := shortenLimit(http.HandlerFunc(shortenHandler.CreateShortURL))
+    if !cfg.AllowAnonymousShorten {
+        shorten = middleware.RequireAPIKey(shorten)
+    }
+    api.Handle("/shorten", shorten).Methods("POST")
+    // Batches always need an API key
+    api.Handle("/shorten/batch", middleware.RequireAPIKey(shortenLimit(http.HandlerFunc(shortenHandler.CreateShortURLs)))).Methods("POST")
+    api.Handle("/urls/{shortCode}", owned(urlHandler.GetShortURL)).Methods("GET")
+    api.Handle("/urls/{shortCode}", owned(urlHandler.UpdateShortURL)).Methods("PATCH")
+    api.Handle("/urls/{shortCode}", owned(urlHandler.DeleteShortURL)).Methods("DELETE")
+    api.Handle("/urls/{shortCode}/qr", owned(qrHandler.GetQRCode)).Methods("GET")
+    api.Handle("/urls", owned(urlHandler.GetAllURLs)).Methods("GET")
+    api.Handle("/history", owned(urlHandler.GetURLHistory)).Methods("GET")
     
     // Analytics routes
-    api.HandleFunc("/analytics/{shortCode}", analyticsHandler.GetURLAnalytics).Methods("GET")
+    api.Handle("/analytics", owned(analyticsHandler.GetCampaignAnalytics)).Methods("GET")
+    api.Handle("/analytics/{shortCode}", owned(analyticsHandler.GetURLAnalytics)).Methods("GET")
+    api.Handle("/analytics/{shortCode}/timeseries", owned(analyticsHandler.GetClickTimeSeries)).Methods("GET")
+    
+    // Preview pages, registered first since /{shortCode} would match
+    // "code+" as well
+    preview := redirectLimit(http.HandlerFunc(redirectHandler.PreviewLink))
+    r.Handle("/{shortCode}+", preview).Methods("GET")
+    r.Handle("/preview/{shortCode}", preview).Methods("GET")
     
     // Redirect route
-    r.HandleFunc("/{shortCode}", redirectHandler.RedirectToOriginal).Methods("GET")
+    redirect := redirectLimit(http.HandlerFunc(redirectHandler.RedirectToOriginal))
+    r.Handle("/{shortCode}", redirect).Methods("GET")
+    // Password form submissions for protected links
+    unlock := redirectLimit(http.HandlerFunc(redirectHandler.SubmitPassword))
+    r.Handle("/{shortCode}", unlock).Methods("POST")
+    // Sub-paths, for links that pass them on to their target
+    r.Handle("/{shortCode}/{path:.*}", redirect).Methods("GET")
+    r.Handle("/{shortCode}/{path:.*}", unlock).Methods("POST")
+    
+    // Unmatched requests skip r.Use middleware, so wrap these explicitly
+    r.NotFoundHandler = middleware.RequestID(middleware.CORS(http.HandlerFunc(handlers.NotFound)))
+    r.MethodNotAllowedHandler = middleware.RequestID(middleware.CORS(http.HandlerFunc(handlers.MethodNotAllowed)))
     
     return r
 }
+
+// newRateLimiter builds the middleware for one class of routes; a
+// non-positive limit disables it
+func newRateLimiter(perMinute, burst int, idleTTL time.Duration) func(http.Handler) http.Handler {
+    return middleware.NewRateLimiter(middleware.RateLimitOptions{
+        PerMinute: perMinute,
+        Burst:     burst,
+        IdleTTL:   idleTTL,
+    }).Limit
+}
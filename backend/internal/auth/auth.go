@@ -0,0 +1,118 @@
+// Package auth issues API keys and carries the authenticated caller through
+// the request context. Keys are random 256-bit secrets, so a single SHA-256
+// is enough to store them safely; a slow password hash would only add latency
+// to every API call.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go-url-shortener/internal/db"
+)
+
+// KeyPrefix starts every API key, so leaked keys are easy to recognise
+const KeyPrefix = "usk_"
+
+// displayPrefixLength is how much of a key is kept in clear for listings
+const displayPrefixLength = len(KeyPrefix) + 8
+
+// maxOwnerIDLength matches the owner_id column
+const maxOwnerIDLength = 64
+
+// ErrInvalidOwner is returned for an empty or malformed owner id
+var ErrInvalidOwner = errors.New("invalid owner id")
+
+// Principal is the caller an API key belongs to
+type Principal struct {
+	KeyID   int
+	OwnerID string
+}
+
+type principalKey struct{}
+
+// NewContext returns a copy of ctx carrying p
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the authenticated caller, or nil for anonymous requests
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
+
+// OwnerID returns the caller's owner id, or "" for anonymous requests
+func OwnerID(ctx context.Context) string {
+	if p := FromContext(ctx); p != nil {
+		return p.OwnerID
+	}
+	return ""
+}
+
+// NewKey generates a key for ownerID. The returned plaintext is shown to the
+// caller once; only the hash in the returned APIKey is stored.
+func NewKey(ownerID, name string) (string, *db.APIKey, error) {
+	if err := ValidateOwnerID(ownerID); err != nil {
+		return "", nil, err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, fmt.Errorf("failed to generate API key: %w", err)
+	}
+
+	plaintext := KeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	key := &db.APIKey{
+		Name:    name,
+		OwnerID: ownerID,
+		Prefix:  plaintext[:displayPrefixLength],
+		Hash:    HashKey(plaintext),
+	}
+
+	return plaintext, key, nil
+}
+
+// HashKey returns the hex SHA-256 of a key, as stored in api_keys.key_hash
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// BearerToken extracts the token from an "Authorization: Bearer <token>"
+// header value
+func BearerToken(header string) (string, bool) {
+	scheme, token, ok := strings.Cut(strings.TrimSpace(header), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// TokenEqual compares two secrets in constant time
+func TokenEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// ValidateOwnerID accepts 1-64 characters of letters, digits and . _ @ -
+func ValidateOwnerID(ownerID string) error {
+	if ownerID == "" || len(ownerID) > maxOwnerIDLength {
+		return ErrInvalidOwner
+	}
+	for _, c := range ownerID {
+		if !((c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') ||
+			c == '.' || c == '_' || c == '@' || c == '-') {
+			return ErrInvalidOwner
+		}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Link passwords are chosen by people, so unlike API keys they get a slow,
+// salted hash. They are stored as
+//
+//	pbkdf2-sha256$<iterations>$<salt>$<hash>
+//
+// with salt and hash in unpadded base64, so the cost can be raised later
+// without invalidating existing hashes.
+const (
+	passwordScheme     = "pbkdf2-sha256"
+	passwordIterations = 600_000
+	passwordSaltLength = 16
+	passwordKeyLength  = 32
+
+	// maxPasswordIterations rejects stored hashes, e.g. from an import,
+	// that would make every check expensive
+	maxPasswordIterations = 10_000_000
+)
+
+// MaxPasswordLength bounds the work hashing a password costs
+const MaxPasswordLength = 128
+
+// ErrInvalidPassword is returned for an empty or overlong link password
+var ErrInvalidPassword = fmt.Errorf("password must be 1-%d characters", MaxPasswordLength)
+
+// HashPassword returns the encoded hash of a link password
+func HashPassword(password string) (string, error) {
+	if password == "" || len(password) > MaxPasswordLength {
+		return "", ErrInvalidPassword
+	}
+
+	salt := make([]byte, passwordSaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	key, err := pbkdf2.Key(sha256.New, password, salt, passwordIterations, passwordKeyLength)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	return strings.Join([]string{
+		passwordScheme,
+		strconv.Itoa(passwordIterations),
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	}, "$"), nil
+}
+
+// CheckPassword reports whether password matches an encoded hash. The
+// final comparison takes constant time.
+func CheckPassword(encoded, password string) bool {
+	if password == "" || len(password) > MaxPasswordLength {
+		return false
+	}
+
+	iterations, salt, want, err := parsePasswordHash(encoded)
+	if err != nil {
+		return false
+	}
+
+	got, err := pbkdf2.Key(sha256.New, password, salt, iterations, len(want))
+	if err != nil {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
+
+func parsePasswordHash(encoded string) (int, []byte, []byte, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 4 || parts[0] != passwordScheme {
+		return 0, nil, nil, errors.New("unknown password hash format")
+	}
+
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations < 1 || iterations > maxPasswordIterations {
+		return 0, nil, nil, errors.New("invalid password hash iterations")
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return 0, nil, nil, errors.New("invalid password hash salt")
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(key) == 0 {
+		return 0, nil, nil, errors.New("invalid password hash")
+	}
+
+	return iterations, salt, key, nil
+}
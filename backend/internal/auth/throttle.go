@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// Throttle limits password attempts per key. Every attempt counts until a
+// correct password resets the key, so parallel guesses are throttled as
+// well as sequential ones. Once a key has made MaxAttempts attempts within
+// Window of its first one, it is locked out until that window ends.
+type Throttle struct {
+	maxAttempts int
+	window      time.Duration
+
+	mu        sync.Mutex
+	attempts  map[string]*attempts
+	lastSweep time.Time
+}
+
+type attempts struct {
+	count   int
+	started time.Time
+}
+
+// NewThrottle returns a throttle allowing maxAttempts attempts per window.
+// A maxAttempts of zero or less disables it.
+func NewThrottle(maxAttempts int, window time.Duration) *Throttle {
+	return &Throttle{
+		maxAttempts: maxAttempts,
+		window:      window,
+		attempts:    make(map[string]*attempts),
+		lastSweep:   time.Now(),
+	}
+}
+
+// Allow records an attempt for key and reports whether it may go ahead.
+// When it may not, the duration is how long until the lockout ends.
+func (t *Throttle) Allow(key string, now time.Time) (bool, time.Duration) {
+	if t.maxAttempts <= 0 {
+		return true, 0
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if now.Sub(t.lastSweep) >= t.window {
+		t.sweep(now)
+	}
+
+	a, ok := t.attempts[key]
+	if !ok || !now.Before(a.started.Add(t.window)) {
+		t.attempts[key] = &attempts{count: 1, started: now}
+		return true, 0
+	}
+
+	if a.count >= t.maxAttempts {
+		return false, a.started.Add(t.window).Sub(now)
+	}
+	a.count++
+
+	return true, 0
+}
+
+// Reset forgets the attempts of key, after a correct password
+func (t *Throttle) Reset(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.attempts, key)
+}
+
+// sweep drops keys whose window has ended. Callers hold mu.
+func (t *Throttle) sweep(now time.Time) {
+	for key, a := range t.attempts {
+		if !now.Before(a.started.Add(t.window)) {
+			delete(t.attempts, key)
+		}
+	}
+	t.lastSweep = now
+}
@@ -0,0 +1,347 @@
+// Package clicks records redirect clicks off the request path. Click events
+// are queued in memory and written in batches by a pool of workers, and
+// click-count increments for cached links are aggregated and flushed
+// periodically.
+package clicks
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-url-shortener/internal/db"
+)
+
+// Backpressure decides what Record does when the queue is full
+type Backpressure string
+
+const (
+	// Drop discards the event and counts it as dropped
+	Drop Backpressure = "drop"
+	// Block waits for room in the queue, or until the request is cancelled
+	Block Backpressure = "block"
+)
+
+var (
+	// ErrClosed is returned by Record after Close has been called
+	ErrClosed = errors.New("click recorder is closed")
+	// ErrQueueFull is returned by Record when the Drop policy discards an
+	// event because the queue has no room
+	ErrQueueFull = errors.New("click queue is full")
+)
+
+// Enricher adds derived details to a click event, such as its location.
+// It runs on a worker before the event is written, so slow lookups stay
+// off the request path.
+type Enricher interface {
+	Enrich(event *db.ClickEvent)
+}
+
+// EnricherFunc adapts a function to the Enricher interface
+type EnricherFunc func(event *db.ClickEvent)
+
+// Enrich calls f(event)
+func (f EnricherFunc) Enrich(event *db.ClickEvent) {
+	f(event)
+}
+
+// Options configures a Recorder
+type Options struct {
+	QueueSize     int
+	Workers       int
+	BatchSize     int
+	FlushInterval time.Duration
+	Backpressure  Backpressure
+
+	// Enrichers run in order on every event before it is written
+	Enrichers []Enricher
+}
+
+// Stats is a snapshot of recorder activity
+type Stats struct {
+	Queued        uint64 `json:"queued"`
+	Recorded      uint64 `json:"recorded"`
+	Dropped       uint64 `json:"dropped"`
+	Failed        uint64 `json:"failed"`
+	CountsFlushed uint64 `json:"counts_flushed"`
+	CountsFailed  uint64 `json:"counts_failed"`
+	QueueLength   int    `json:"queue_length"`
+	QueueCapacity int    `json:"queue_capacity"`
+}
+
+// Recorder asynchronously persists click events and click counts
+type Recorder struct {
+	repo db.RepositoryInterface
+	opts Options
+
+	queue chan *db.ClickEvent
+
+	// closeMu guards queue against sends after it is closed
+	closeMu sync.RWMutex
+	closed  bool
+
+	countsMu sync.Mutex
+	counts   map[string]*pendingCount
+
+	workers sync.WaitGroup
+	flusher sync.WaitGroup
+	stop    chan struct{}
+
+	queued        atomic.Uint64
+	recorded      atomic.Uint64
+	dropped       atomic.Uint64
+	failed        atomic.Uint64
+	countsFlushed atomic.Uint64
+	countsFailed  atomic.Uint64
+}
+
+// pendingCount is a click-count increment waiting to be flushed
+type pendingCount struct {
+	delta       int
+	lastClicked time.Time
+}
+
+// NewRecorder starts the worker pool and the periodic count flusher
+func NewRecorder(repo db.RepositoryInterface, opts Options) *Recorder {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 10000
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 2
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = time.Second
+	}
+	if opts.Backpressure != Block {
+		opts.Backpressure = Drop
+	}
+
+	r := &Recorder{
+		repo:   repo,
+		opts:   opts,
+		queue:  make(chan *db.ClickEvent, opts.QueueSize),
+		counts: make(map[string]*pendingCount),
+		stop:   make(chan struct{}),
+	}
+
+	for i := 0; i < opts.Workers; i++ {
+		r.workers.Add(1)
+		go r.runWorker()
+	}
+
+	r.flusher.Add(1)
+	go r.runCountFlusher()
+
+	return r
+}
+
+// Record queues a click event. With the Drop policy it never blocks; with
+// Block it waits for room until ctx is done. The event is stamped with the
+// current time if it has none, since it may be written much later.
+func (r *Recorder) Record(ctx context.Context, event *db.ClickEvent) error {
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+
+	r.closeMu.RLock()
+	defer r.closeMu.RUnlock()
+
+	if r.closed {
+		r.dropped.Add(1)
+		return ErrClosed
+	}
+
+	if r.opts.Backpressure == Block {
+		select {
+		case r.queue <- event:
+			r.queued.Add(1)
+			return nil
+		case <-ctx.Done():
+			r.dropped.Add(1)
+			return ctx.Err()
+		}
+	}
+
+	select {
+	case r.queue <- event:
+		r.queued.Add(1)
+		return nil
+	default:
+		r.dropped.Add(1)
+		return ErrQueueFull
+	}
+}
+
+// CountClick adds one click to a link's pending count. Counts are written
+// on the next flush, so it satisfies db.ClickCounter without touching the
+// database.
+func (r *Recorder) CountClick(ctx context.Context, code string, clickedAt time.Time) error {
+	r.countsMu.Lock()
+	defer r.countsMu.Unlock()
+
+	pending, ok := r.counts[code]
+	if !ok {
+		pending = &pendingCount{}
+		r.counts[code] = pending
+	}
+
+	pending.delta++
+	if clickedAt.After(pending.lastClicked) {
+		pending.lastClicked = clickedAt
+	}
+
+	return nil
+}
+
+// Close stops accepting events, drains the queue and flushes pending counts.
+// It returns ctx.Err() if ctx ends before everything is written.
+func (r *Recorder) Close(ctx context.Context) error {
+	r.closeMu.Lock()
+	if r.closed {
+		r.closeMu.Unlock()
+		return nil
+	}
+	r.closed = true
+	close(r.queue)
+	close(r.stop)
+	r.closeMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		r.workers.Wait()
+		r.flusher.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stats returns the current counters
+func (r *Recorder) Stats() Stats {
+	return Stats{
+		Queued:        r.queued.Load(),
+		Recorded:      r.recorded.Load(),
+		Dropped:       r.dropped.Load(),
+		Failed:        r.failed.Load(),
+		CountsFlushed: r.countsFlushed.Load(),
+		CountsFailed:  r.countsFailed.Load(),
+		QueueLength:   len(r.queue),
+		QueueCapacity: cap(r.queue),
+	}
+}
+
+// runWorker collects events into batches and writes a batch when it is full,
+// when the flush interval passes, or when the queue is closed
+func (r *Recorder) runWorker() {
+	defer r.workers.Done()
+
+	ticker := time.NewTicker(r.opts.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*db.ClickEvent, 0, r.opts.BatchSize)
+	for {
+		select {
+		case event, ok := <-r.queue:
+			if !ok {
+				r.writeBatch(batch)
+				return
+			}
+			for _, enricher := range r.opts.Enrichers {
+				enricher.Enrich(event)
+			}
+			batch = append(batch, event)
+			if len(batch) >= r.opts.BatchSize {
+				r.writeBatch(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			r.writeBatch(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+// writeBatch inserts a batch in one statement. If that fails, e.g. because
+// one link was deleted meanwhile, the events are retried one by one so a
+// single bad row does not lose the whole batch.
+func (r *Recorder) writeBatch(batch []*db.ClickEvent) {
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := r.repo.AddClickEvents(ctx, batch)
+	if err == nil {
+		r.recorded.Add(uint64(len(batch)))
+		return
+	}
+
+	if len(batch) == 1 {
+		r.failed.Add(1)
+		log.Printf("Failed to record click event: %v", err)
+		return
+	}
+
+	for _, event := range batch {
+		if err := r.repo.AddClickEvents(ctx, []*db.ClickEvent{event}); err != nil {
+			r.failed.Add(1)
+			log.Printf("Failed to record click event: %v", err)
+			continue
+		}
+		r.recorded.Add(1)
+	}
+}
+
+func (r *Recorder) runCountFlusher() {
+	defer r.flusher.Done()
+
+	ticker := time.NewTicker(r.opts.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.flushCounts()
+		case <-r.stop:
+			r.flushCounts()
+			return
+		}
+	}
+}
+
+// flushCounts writes every pending click-count increment
+func (r *Recorder) flushCounts() {
+	r.countsMu.Lock()
+	counts := r.counts
+	r.counts = make(map[string]*pendingCount)
+	r.countsMu.Unlock()
+
+	if len(counts) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for code, pending := range counts {
+		if err := r.repo.IncrementClickCount(ctx, code, pending.delta, pending.lastClicked); err != nil {
+			r.countsFailed.Add(uint64(pending.delta))
+			log.Printf("Failed to update click count for %s: %v", code, err)
+			continue
+		}
+		r.countsFlushed.Add(uint64(pending.delta))
+	}
+}
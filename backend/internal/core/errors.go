@@ -0,0 +1,36 @@
+package core
+
+import (
+	"errors"
+
+	"go-url-shortener/internal/db"
+)
+
+// Validation errors returned by Shortener. Lookups and writes also return the
+// repository errors db.ErrNotFound, db.ErrExpired and db.ErrCodeTaken.
+var (
+	// ErrInvalidURL means the target is not an absolute http(s) URL
+	ErrInvalidURL = errors.New("invalid URL format")
+	// ErrInvalidCode means a custom code has the wrong length or characters,
+	// or is reserved
+	ErrInvalidCode = errors.New("invalid custom code format")
+	// ErrInvalidMaxClicks means a click limit is negative
+	ErrInvalidMaxClicks = errors.New("max_clicks must not be negative")
+	// ErrInvalidSchedule means a link would expire before it activates. It
+	// is the repositories' error, which updates check against the stored
+	// activates_at.
+	ErrInvalidSchedule = db.ErrInvalidSchedule
+	// ErrInvalidRedirectType means a link asked for an unknown redirect type
+	ErrInvalidRedirectType = errors.New("redirect_type must be 301, 302, 307, 308, meta_refresh or interstitial")
+	// ErrInvalidQueryPassthrough means a link asked for an unknown query
+	// passthrough policy
+	ErrInvalidQueryPassthrough = errors.New("query_passthrough must be keep, override or append")
+	// ErrInvalidQueryParam means a UTM field or extra query parameter is
+	// malformed or clashes with the target's query
+	ErrInvalidQueryParam = errors.New("invalid query parameter")
+	// ErrBlocked means the target host may not be shortened
+	ErrBlocked = errors.New("URL domain is blocked")
+	// ErrBatchAborted marks the valid items of an atomic batch that was not
+	// created because another item failed
+	ErrBatchAborted = errors.New("not created because another item in the batch failed")
+)
@@ -1,9 +1,11 @@
 package core
 
 import (
+	"context"
 	"crypto/rand"
 	"errors"
 	"fmt"
+	"go-url-shortener/internal/auth"
 	"go-url-shortener/internal/db"
 	"net/url"
 	"strings"
@@ -22,54 +24,271 @@ func NewShortener(repo db.RepositoryInterface) *Shortener {
     }
 }
 
-// CreateShortURL is the main business logic method
-func (s *Shortener) CreateShortURL(originalURL, customCode string, expiresAt *time.Time) (*db.URL, error) {
-    // Validate URL
-    if !s.isValidURL(originalURL) {
-        return nil, errors.New("invalid URL format")
+// LinkOptions are the optional settings of a new link
+type LinkOptions struct {
+    // Password must be entered by visitors before they are redirected.
+    // Only its hash is stored.
+    Password string
+    // MaxClicks is the number of redirects after which the link stops
+    // working, e.g. 1 for a one-time link. Zero means no limit.
+    MaxClicks int
+    // ActivatesAt keeps the link from redirecting before that time. The
+    // default expiry then counts from activation.
+    ActivatesAt *time.Time
+    // RedirectType is one of the db.Redirect* types; empty means the
+    // server default
+    RedirectType string
+    // ForcePreview shows every visitor the preview page first
+    ForcePreview bool
+    // QueryPassthrough is one of the db.QueryPassthrough* policies for
+    // merging the visit's query into the target; empty drops it
+    QueryPassthrough string
+    // PathPassthrough appends the path after the short code to the target
+    PathPassthrough bool
+    // UTM fields and QueryParams are added to the target's query, see
+    // addQueryParams
+    UTM         db.UTM
+    QueryParams map[string]string
+}
+
+// CreateShortURL is the main business logic method. ownerID is the caller's
+// owner id, or empty for an anonymous link.
+func (s *Shortener) CreateShortURL(ctx context.Context, ownerID, originalURL, customCode string, expiresAt *time.Time, opts LinkOptions) (*db.URL, error) {
+    urlObj, err := s.newLink(ownerID, originalURL, expiresAt, opts)
+    if err != nil {
+        return nil, err
     }
 
     // Generate or validate short code
-    shortCode, err := s.GenerateShortCode(originalURL, customCode)
+    shortCode, err := s.GenerateShortCode(ctx, urlObj.OriginalURL, customCode)
     if err != nil {
         return nil, err
     }
 
     // Check if short code already exists
-    existingURL, err := s.repo.GetShortURL(shortCode)
+    existingURL, err := s.repo.GetShortURL(ctx, shortCode)
     if err == nil && existingURL != nil {
-        return nil, errors.New("short code already exists")
-    }
-
-    // Create URL object
-    urlObj := &db.URL{
-        OriginalURL: originalURL,
-        ShortCode:   shortCode,
-        CreatedAt:   time.Now(),
+        return nil, db.ErrCodeTaken
     }
+    urlObj.ShortCode = shortCode
 
     // Set expiration
-    if expiresAt != nil {
-        urlObj.ExpiresAt = expiresAt
-    } else {
+    if expiresAt == nil {
         urlObj.SetDefaultExpiration() // 60 minutes default
     }
 
     // Save to database
-    err = s.repo.CreateShortURL(urlObj)
+    err = s.repo.CreateShortURL(ctx, urlObj)
     if err != nil {
+        // Lost a race with another request for the same code
+        if errors.Is(err, db.ErrCodeTaken) {
+            return nil, db.ErrCodeTaken
+        }
         return nil, fmt.Errorf("failed to create short URL: %w", err)
     }
 
     return urlObj, nil
 }
 
+// newLink validates a link to originalURL with opts, the same way for
+// single and batch creation, and returns it without a short code. The
+// password is hashed and the UTM fields and query parameters are added to
+// the target.
+func (s *Shortener) newLink(ownerID, originalURL string, expiresAt *time.Time, opts LinkOptions) (*db.URL, error) {
+    // Validate URL
+    if err := s.validateURL(originalURL); err != nil {
+        return nil, err
+    }
+    
+    originalURL, err := addQueryParams(originalURL, opts.UTM, opts.QueryParams)
+    if err != nil {
+        return nil, err
+    }
+    
+    if opts.MaxClicks < 0 {
+        return nil, ErrInvalidMaxClicks
+    }
+    if opts.RedirectType != "" && !db.IsValidRedirectType(opts.RedirectType) {
+        return nil, ErrInvalidRedirectType
+    }
+    if opts.QueryPassthrough != "" && !db.IsValidQueryPassthrough(opts.QueryPassthrough) {
+        return nil, ErrInvalidQueryPassthrough
+    }
+    if opts.ActivatesAt != nil && expiresAt != nil && !opts.ActivatesAt.Before(*expiresAt) {
+        return nil, ErrInvalidSchedule
+    }
+    
+    var passwordHash string
+    if opts.Password != "" {
+        if passwordHash, err = auth.HashPassword(opts.Password); err != nil {
+            return nil, err
+        }
+    }
+
+    return &db.URL{
+        OriginalURL:      originalURL,
+        CreatedAt:        time.Now(),
+        ExpiresAt:        expiresAt,
+        ActivatesAt:      opts.ActivatesAt,
+        OwnerID:          ownerID,
+        PasswordHash:     passwordHash,
+        MaxClicks:        opts.MaxClicks,
+        RedirectType:     opts.RedirectType,
+        ForcePreview:     opts.ForcePreview,
+        QueryPassthrough: opts.QueryPassthrough,
+        PathPassthrough:  opts.PathPassthrough,
+    }, nil
+}
+
+// BatchItem is one link to create with CreateShortURLs. Its options are
+// validated like those of CreateShortURL.
+type BatchItem struct {
+    OriginalURL string
+    CustomCode  string
+    ExpiresAt   *time.Time
+    LinkOptions
+}
+
+// BatchResult is the outcome of one BatchItem: the created link or the
+// reason it was not created
+type BatchResult struct {
+    URL *db.URL
+    Err error
+}
+
+// maxCodeRetries bounds how often a colliding random code is regenerated
+const maxCodeRetries = 5
+
+// CreateShortURLs validates and creates a batch of links for ownerID with
+// one repository call. The results line up with items. In atomic mode
+// nothing is created unless every item can be, and the valid items fail
+// with ErrBatchAborted; otherwise each item succeeds or fails on its own.
+// The error return is for failures of the batch as a whole.
+func (s *Shortener) CreateShortURLs(ctx context.Context, ownerID string, items []BatchItem, atomic bool) ([]BatchResult, error) {
+    results := make([]BatchResult, len(items))
+    urls := make([]*db.URL, len(items))
+    generated := make([]bool, len(items))
+    pending := make([]int, 0, len(items))
+    
+    for i, item := range items {
+        urlObj, err := s.newLink(ownerID, item.OriginalURL, item.ExpiresAt, item.LinkOptions)
+        if err != nil {
+            results[i].Err = err
+            continue
+        }
+        
+        code := item.CustomCode
+        if code == "" {
+            // Random codes are checked by the batch insert itself rather
+            // than with a lookup per item
+            if code, err = s.generateRandomCode(6); err != nil {
+                return nil, err
+            }
+            generated[i] = true
+        } else if !s.isValidCustomCode(code) {
+            results[i].Err = ErrInvalidCode
+            continue
+        }
+        
+        urlObj.ShortCode = code
+        urls[i] = urlObj
+        pending = append(pending, i)
+    }
+    
+    if atomic && len(pending) < len(items) {
+        return abortBatch(results), nil
+    }
+    
+    for attempt := 0; len(pending) > 0; attempt++ {
+        batch := make([]*db.URL, len(pending))
+        for j, i := range pending {
+            batch[j] = urls[i]
+        }
+        
+        errs, err := s.repo.CreateShortURLs(ctx, batch, atomic)
+        if err != nil {
+            return nil, fmt.Errorf("failed to create short URLs: %w", err)
+        }
+        
+        // A random code that collided gets a new one and another try
+        var retry []int
+        failed := false
+        for j, i := range pending {
+            switch {
+            case errs[j] == nil:
+                results[i].URL = urls[i]
+            case generated[i] && errors.Is(errs[j], db.ErrCodeTaken) && attempt < maxCodeRetries:
+                retry = append(retry, i)
+            default:
+                results[i].Err = errs[j]
+                failed = true
+            }
+        }
+        
+        if atomic && failed {
+            return abortBatch(results), nil
+        }
+        
+        for _, i := range retry {
+            if urls[i].ShortCode, err = s.generateRandomCode(6); err != nil {
+                return nil, err
+            }
+        }
+        
+        // An atomic batch stored nothing if any code collided, so all of
+        // it goes again
+        if atomic && len(retry) > 0 {
+            continue
+        }
+        pending = retry
+    }
+    
+    return results, nil
+}
+
+// abortBatch fails the items of an atomic batch that had no error of their own
+func abortBatch(results []BatchResult) []BatchResult {
+    for i := range results {
+        if results[i].Err == nil {
+            results[i] = BatchResult{Err: ErrBatchAborted}
+        }
+    }
+    return results
+}
+
+// UpdateShortURL edits one of ownerID's links. Changed fields are validated
+// like in CreateShortURL; a new expiry must come after the stored
+// activates_at, which the repository checks with the write, otherwise
+// ErrInvalidSchedule is returned. A positive version must match the link's
+// current version, otherwise db.ErrVersionConflict is returned.
+func (s *Shortener) UpdateShortURL(ctx context.Context, ownerID, shortCode string, version int, update db.URLUpdate) (*db.URL, error) {
+    if update.OriginalURL != nil {
+        if err := s.validateURL(*update.OriginalURL); err != nil {
+            return nil, err
+        }
+    }
+    
+    if update.ShortCode != nil && !s.isValidCustomCode(*update.ShortCode) {
+        return nil, ErrInvalidCode
+    }
+    
+    urlObj, err := s.repo.UpdateShortURL(ctx, shortCode, ownerID, version, update)
+    if err != nil {
+        if errors.Is(err, db.ErrCodeTaken) {
+            return nil, db.ErrCodeTaken
+        }
+        return nil, err
+    }
+    
+    return urlObj, nil
+}
+
 // GenerateShortCode creates a short code for the given URL
-func (s *Shortener) GenerateShortCode(originalURL, customCode string) (string, error) {
+func (s *Shortener) GenerateShortCode(ctx context.Context, originalURL, customCode string) (string, error) {
     // Use custom code if provided
     if customCode != "" {
         if !s.isValidCustomCode(customCode) {
-            return "", errors.New("invalid custom code format")
+            return "", ErrInvalidCode
         }
         return customCode, nil
     }
@@ -83,7 +302,10 @@ func (s *Shortener) GenerateShortCode(originalURL, customCode string) (string, e
         }
 
         // Check if code already exists
-        _, err = s.repo.GetShortURL(code)
+        _, err = s.repo.GetShortURL(ctx, code)
+        if ctxErr := ctx.Err(); ctxErr != nil {
+            return "", ctxErr
+        }
         if err != nil {
             // Code doesn't exist, we can use it
             return code, nil
@@ -94,40 +316,43 @@ func (s *Shortener) GenerateShortCode(originalURL, customCode string) (string, e
 }
 
 // GetOriginalURL retrieves and validates the original URL
-func (s *Shortener) GetOriginalURL(shortCode string) (string, error) {
-    urlObj, err := s.repo.GetShortURL(shortCode)
+func (s *Shortener) GetOriginalURL(ctx context.Context, shortCode string) (string, error) {
+    urlObj, err := s.repo.GetShortURL(ctx, shortCode)
     if err != nil {
-        return "", errors.New("short URL not found")
+        if ctxErr := ctx.Err(); ctxErr != nil {
+            return "", ctxErr
+        }
+        return "", err
     }
 
     if urlObj.IsExpired() {
-        return "", errors.New("short URL has expired")
+        return "", db.ErrExpired
     }
 
     return urlObj.OriginalURL, nil
 }
 
 // DeleteShortURL removes a short URL
-func (s *Shortener) DeleteShortURL(shortCode string) error {
-    return s.repo.DeleteShortURL(shortCode)
+func (s *Shortener) DeleteShortURL(ctx context.Context, shortCode string) error {
+    return s.repo.DeleteShortURL(ctx, shortCode)
 }
 
 // GetAllShortURLs returns all URLs (for admin/management)
-func (s *Shortener) GetAllShortURLs() ([]*db.URL, error) {
-    return s.repo.GetAllShortURLs()
+func (s *Shortener) GetAllShortURLs(ctx context.Context) ([]*db.URL, error) {
+    return s.repo.GetAllShortURLs(ctx)
 }
 
 // ValidateAndSanitizeURL performs comprehensive URL validation
 func (s *Shortener) ValidateAndSanitizeURL(urlStr string) (string, error) {
     // Basic format validation
     if !s.isValidURL(urlStr) {
-        return "", errors.New("invalid URL format")
+        return "", ErrInvalidURL
     }
 
     // Parse URL for further validation
     parsedURL, err := url.Parse(urlStr)
     if err != nil {
-        return "", errors.New("failed to parse URL")
+        return "", ErrInvalidURL
     }
 
     // Security checks
@@ -139,13 +364,28 @@ func (s *Shortener) ValidateAndSanitizeURL(urlStr string) (string, error) {
     return parsedURL.String(), nil
 }
 
+// validateURL checks that urlStr is a well-formed http(s) URL that passes
+// the security checks
+func (s *Shortener) validateURL(urlStr string) error {
+    if !s.isValidURL(urlStr) {
+        return ErrInvalidURL
+    }
+
+    parsedURL, err := url.Parse(urlStr)
+    if err != nil {
+        return ErrInvalidURL
+    }
+
+    return s.checkURLSecurity(parsedURL)
+}
+
 // checkURLSecurity performs security validation
 func (s *Shortener) checkURLSecurity(parsedURL *url.URL) error {
     // Block localhost and internal IPs
     if strings.Contains(parsedURL.Host, "localhost") || 
        strings.Contains(parsedURL.Host, "127.0.0.1") ||
        strings.Contains(parsedURL.Host, "0.0.0.0") {
-        return errors.New("localhost URLs are not allowed")
+        return fmt.Errorf("%w: localhost URLs are not allowed", ErrBlocked)
     }
 
     // Block known malicious domains (example)
@@ -157,7 +397,7 @@ func (s *Shortener) checkURLSecurity(parsedURL *url.URL) error {
 
     for _, domain := range blockedDomains {
         if strings.Contains(parsedURL.Host, domain) {
-            return errors.New("URL domain is blocked")
+            return ErrBlocked
         }
     }
 
@@ -196,7 +436,7 @@ func (s *Shortener) isValidCustomCode(code string) bool {
     }
 
     // Don't allow codes that might conflict with API routes
-    reservedCodes := []string{"api", "admin", "health", "metrics"}
+    reservedCodes := []string{"api", "admin", "health", "metrics", "preview"}
     for _, reserved := range reservedCodes {
         if strings.ToLower(code) == reserved {
             return false
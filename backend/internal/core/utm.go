@@ -0,0 +1,102 @@
+package core
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode"
+
+	"go-url-shortener/internal/db"
+)
+
+const (
+	// maxQueryParams bounds the extra query parameters of one link
+	maxQueryParams = 20
+	// maxQueryParamLength bounds each UTM value and extra key or value
+	maxQueryParamLength = 256
+)
+
+// addQueryParams adds the UTM fields and extra query parameters to
+// originalURL. They go after the URL's own query, which is kept as written.
+// A parameter the URL already has is left alone if the value is the same,
+// and is an error if it differs, rather than being silently replaced.
+func addQueryParams(originalURL string, utm db.UTM, params map[string]string) (string, error) {
+	if utm == (db.UTM{}) && len(params) == 0 {
+		return originalURL, nil
+	}
+	if len(params) > maxQueryParams {
+		return "", fmt.Errorf("%w: at most %d query_params are allowed", ErrInvalidQueryParam, maxQueryParams)
+	}
+
+	target, err := url.Parse(originalURL)
+	if err != nil {
+		return "", ErrInvalidURL
+	}
+	existing := target.Query()
+
+	// UTM fields first, in their usual order, then the extras by name
+	var added []string
+	add := func(key, value string) error {
+		if err := checkQueryParam(key, value); err != nil {
+			return err
+		}
+		if values, ok := existing[key]; ok {
+			if len(values) == 1 && values[0] == value {
+				return nil
+			}
+			return fmt.Errorf("%w: %s is already set to a different value in url", ErrInvalidQueryParam, key)
+		}
+		added = append(added, url.QueryEscape(key)+"="+url.QueryEscape(value))
+		return nil
+	}
+
+	for _, param := range utm.Params() {
+		if param[1] == "" {
+			continue
+		}
+		if err := add(param[0], param[1]); err != nil {
+			return "", err
+		}
+	}
+
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		if db.IsUTMParam(key) {
+			return "", fmt.Errorf("%w: set %s with its own field instead of query_params", ErrInvalidQueryParam, key)
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := add(key, params[key]); err != nil {
+			return "", err
+		}
+	}
+
+	if len(added) == 0 {
+		return originalURL, nil
+	}
+	if target.RawQuery != "" {
+		added = append([]string{target.RawQuery}, added...)
+	}
+	target.RawQuery = strings.Join(added, "&")
+	target.ForceQuery = false
+
+	return target.String(), nil
+}
+
+// checkQueryParam rejects empty keys, overlong keys or values and control
+// characters
+func checkQueryParam(key, value string) error {
+	if strings.TrimSpace(key) == "" {
+		return fmt.Errorf("%w: query parameter names must not be empty", ErrInvalidQueryParam)
+	}
+	if len(key) > maxQueryParamLength || len(value) > maxQueryParamLength {
+		return fmt.Errorf("%w: %s is longer than %d characters", ErrInvalidQueryParam, key, maxQueryParamLength)
+	}
+	if strings.IndexFunc(key+value, unicode.IsControl) >= 0 {
+		return fmt.Errorf("%w: %s contains control characters", ErrInvalidQueryParam, key)
+	}
+	return nil
+}
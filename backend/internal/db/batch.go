@@ -0,0 +1,204 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// batchChunkSize bounds the rows per statement, keeping the placeholder
+// count well under the limits of both drivers
+const batchChunkSize = 500
+
+// prepareBatch stamps the links like CreateShortURL does and marks codes
+// that are already taken, or repeat an earlier link of the batch, with
+// ErrCodeTaken. It returns the indexes of the links left to insert.
+func prepareBatch(urls []*URL, taken map[string]bool) ([]int, []error) {
+	errs := make([]error, len(urls))
+	pending := make([]int, 0, len(urls))
+	seen := make(map[string]bool, len(urls))
+	now := time.Now()
+
+	for i, url := range urls {
+		if taken[url.ShortCode] || seen[url.ShortCode] {
+			errs[i] = ErrCodeTaken
+			continue
+		}
+		seen[url.ShortCode] = true
+
+		url.ID = 0
+		url.CreatedAt = now
+		if url.ExpiresAt == nil {
+			url.SetDefaultExpiration()
+		}
+		pending = append(pending, i)
+	}
+
+	return pending, errs
+}
+
+// createShortURLsSQL implements CreateShortURLs for PostgreSQL and SQLite
+func createShortURLsSQL(ctx context.Context, db *sql.DB, dialect string, urls []*URL, atomic bool) ([]error, error) {
+	if len(urls) == 0 {
+		return []error{}, nil
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	taken, err := takenCodes(ctx, tx, dialect, urls)
+	if err != nil {
+		return nil, err
+	}
+
+	pending, errs := prepareBatch(urls, taken)
+	if atomic && len(pending) < len(urls) {
+		return errs, nil
+	}
+
+	for start := 0; start < len(pending); start += batchChunkSize {
+		chunk := pending[start:min(start+batchChunkSize, len(pending))]
+		if err := insertURLChunk(ctx, tx, dialect, urls, chunk, atomic); err != nil {
+			return nil, err
+		}
+	}
+
+	// Lost a race with a concurrent insert; ON CONFLICT skipped the row
+	for _, i := range pending {
+		if urls[i].ID == 0 {
+			errs[i] = ErrCodeTaken
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit batch: %w", err)
+	}
+
+	return errs, nil
+}
+
+// takenCodes returns which of the batch's codes already exist
+func takenCodes(ctx context.Context, tx *sql.Tx, dialect string, urls []*URL) (map[string]bool, error) {
+	taken := make(map[string]bool)
+
+	for start := 0; start < len(urls); start += batchChunkSize {
+		chunk := urls[start:min(start+batchChunkSize, len(urls))]
+
+		placeholders := make([]string, len(chunk))
+		args := make([]any, len(chunk))
+		for i, url := range chunk {
+			placeholders[i] = placeholder(dialect, i+1)
+			args[i] = url.ShortCode
+		}
+
+		query := "SELECT short_code FROM urls WHERE short_code IN (" + strings.Join(placeholders, ", ") + ")"
+		rows, err := tx.QueryContext(ctx, query, args...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check short codes: %w", err)
+		}
+
+		for rows.Next() {
+			var code string
+			if err := rows.Scan(&code); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan short code: %w", err)
+			}
+			taken[code] = true
+		}
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("failed to iterate rows: %w", err)
+		}
+	}
+
+	return taken, nil
+}
+
+// insertURLChunk inserts urls[i] for each i in chunk with one multi-row
+// INSERT and sets their ID and Version. Outside atomic mode, codes taken
+// concurrently are skipped instead of failing the batch.
+func insertURLChunk(ctx context.Context, tx *sql.Tx, dialect string, urls []*URL, chunk []int, atomic bool) error {
+	var query strings.Builder
+	query.WriteString("INSERT INTO urls (short_code, original_url, created_at, activates_at, expires_at, click_count, last_clicked, owner_id, password_hash, max_clicks, redirect_type, force_preview, query_passthrough, path_passthrough, utm_source, utm_medium, utm_campaign, utm_term, utm_content) VALUES ")
+
+	var args []any
+	for n, i := range chunk {
+		if n > 0 {
+			query.WriteString(", ")
+		}
+
+		url := urls[i]
+		createdAt, activatesAt, expiresAt, lastClicked := &url.CreatedAt, url.ActivatesAt, url.ExpiresAt, url.LastClicked
+		if dialect == dialectSQLite {
+			createdAt, activatesAt, expiresAt, lastClicked = utc(createdAt), utc(activatesAt), utc(expiresAt), utc(lastClicked)
+		}
+		url.UTM = ParseUTM(url.OriginalURL)
+		row := []any{url.ShortCode, url.OriginalURL, createdAt, activatesAt, expiresAt, url.ClickCount, lastClicked, nullString(url.OwnerID), nullString(url.PasswordHash), nullInt(url.MaxClicks), nullString(url.RedirectType), url.ForcePreview, nullString(url.QueryPassthrough), url.PathPassthrough,
+			nullString(url.UTM.Source), nullString(url.UTM.Medium), nullString(url.UTM.Campaign), nullString(url.UTM.Term), nullString(url.UTM.Content)}
+
+		query.WriteString("(")
+		for j, value := range row {
+			if j > 0 {
+				query.WriteString(", ")
+			}
+			args = append(args, value)
+			query.WriteString(placeholder(dialect, len(args)))
+		}
+		query.WriteString(")")
+	}
+
+	if !atomic {
+		query.WriteString(" ON CONFLICT (short_code) DO NOTHING")
+	}
+	query.WriteString(" RETURNING short_code, id, version")
+
+	rows, err := tx.QueryContext(ctx, query.String(), args...)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("failed to create short URLs: %w", ErrCodeTaken)
+		}
+		return fmt.Errorf("failed to create short URLs: %w", err)
+	}
+	defer rows.Close()
+
+	byCode := make(map[string]*URL, len(chunk))
+	for _, i := range chunk {
+		byCode[urls[i].ShortCode] = urls[i]
+	}
+
+	for rows.Next() {
+		var code string
+		var id, version int
+		if err := rows.Scan(&code, &id, &version); err != nil {
+			return fmt.Errorf("failed to scan created URL: %w", err)
+		}
+		if url, ok := byCode[code]; ok {
+			url.ID = id
+			url.Version = version
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("failed to create short URLs: %w", ErrCodeTaken)
+		}
+		return fmt.Errorf("failed to create short URLs: %w", err)
+	}
+
+	return nil
+}
+
+// placeholder returns the n-th (1-based) bind parameter for the dialect
+func placeholder(dialect string, n int) string {
+	if dialect == dialectSQLite {
+		return "?" + strconv.Itoa(n)
+	}
+	return "$" + strconv.Itoa(n)
+}
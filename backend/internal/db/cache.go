@@ -0,0 +1,388 @@
+package db
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"hash/maphash"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CacheOptions configures a CachedRepository
+type CacheOptions struct {
+	// Size is the maximum number of short codes kept in memory
+	Size int
+	// TTL bounds how long a link is served from memory. Entries never outlive
+	// the link's own ExpiresAt.
+	TTL time.Duration
+	// NegativeTTL is how long an unknown short code is remembered as missing
+	NegativeTTL time.Duration
+}
+
+// CacheStats is a snapshot of cache activity
+type CacheStats struct {
+	Hits         uint64 `json:"hits"`
+	Misses       uint64 `json:"misses"`
+	NegativeHits uint64 `json:"negative_hits"`
+	Evictions    uint64 `json:"evictions"`
+	Entries      int    `json:"entries"`
+	Capacity     int    `json:"capacity"`
+}
+
+// ClickCounter receives the clicks on links served from the cache, which
+// never reach GetShortURLForRedirect on the wrapped repository
+type ClickCounter interface {
+	CountClick(ctx context.Context, code string, clickedAt time.Time) error
+}
+
+// CachedRepository is a RepositoryInterface decorator that serves redirect
+// lookups from a size-bounded LRU cache. Clicks on cached links are still
+// counted, by default with a synchronous IncrementClickCount, so only the
+// SELECT is saved.
+type CachedRepository struct {
+	next    RepositoryInterface
+	opts    CacheOptions
+	counter ClickCounter
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	// generations counts the invalidations of the codes hashed to each
+	// slot. A lookup only stores what it read if its slot did not move in
+	// the meantime, so a write that lands during the lookup is not undone
+	// by the stale row. Codes sharing a slot merely skip a store.
+	generations [256]uint64
+	seed        maphash.Seed
+
+	hits         atomic.Uint64
+	misses       atomic.Uint64
+	negativeHits atomic.Uint64
+	evictions    atomic.Uint64
+}
+
+// cacheEntry holds a cached link, or a nil url for a code known not to exist
+type cacheEntry struct {
+	code      string
+	url       *URL
+	expiresAt time.Time
+}
+
+func NewCachedRepository(next RepositoryInterface, opts CacheOptions) *CachedRepository {
+	if opts.Size <= 0 {
+		opts.Size = 10000
+	}
+
+	c := &CachedRepository{
+		next:    next,
+		opts:    opts,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+		seed:    maphash.MakeSeed(),
+	}
+	c.counter = syncCounter{c}
+
+	return c
+}
+
+// SetClickCounter replaces the synchronous click counting used on cache hits,
+// e.g. with a recorder that batches increments
+func (c *CachedRepository) SetClickCounter(counter ClickCounter) {
+	c.counter = counter
+}
+
+func (c *CachedRepository) CreateShortURL(ctx context.Context, shortURL *URL) error {
+	// Drop any negative entry so the new link resolves immediately
+	defer c.invalidate(shortURL.ShortCode)
+	return c.next.CreateShortURL(ctx, shortURL)
+}
+
+func (c *CachedRepository) CreateShortURLs(ctx context.Context, urls []*URL, atomic bool) ([]error, error) {
+	for _, url := range urls {
+		defer c.invalidate(url.ShortCode)
+	}
+	return c.next.CreateShortURLs(ctx, urls, atomic)
+}
+
+func (c *CachedRepository) GetShortURL(ctx context.Context, code string) (*URL, error) {
+	return c.next.GetShortURL(ctx, code)
+}
+
+func (c *CachedRepository) GetShortURLForRedirect(ctx context.Context, code string) (*URL, error) {
+	if entry, ok := c.lookup(code); ok {
+		if entry.url == nil {
+			c.negativeHits.Add(1)
+			return nil, ErrNotFound
+		}
+
+		now := time.Now()
+		if err := c.counter.CountClick(ctx, code, now); err != nil {
+			return nil, err
+		}
+
+		c.hits.Add(1)
+		return c.recordClick(code, entry.url, now), nil
+	}
+
+	c.misses.Add(1)
+
+	generation := c.generation(code)
+	url, err := c.next.GetShortURLForRedirect(ctx, code)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) && c.opts.NegativeTTL > 0 {
+			c.store(code, generation, nil, time.Now().Add(c.opts.NegativeTTL))
+		}
+		return nil, err
+	}
+
+	// Limited and protected links are counted by the database on every
+	// click, so a cache hit cannot stand in for them
+	if url.MaxClicks == 0 && !url.IsPasswordProtected() {
+		c.storeURL(url, generation)
+	}
+
+	return url, nil
+}
+
+func (c *CachedRepository) UnlockShortURL(ctx context.Context, code string) (*URL, error) {
+	return c.next.UnlockShortURL(ctx, code)
+}
+
+func (c *CachedRepository) IncrementClickCount(ctx context.Context, code string, delta int, clickedAt time.Time) error {
+	err := c.next.IncrementClickCount(ctx, code, delta, clickedAt)
+
+	// The link was removed behind our back, e.g. by another replica
+	if errors.Is(err, ErrNotFound) {
+		c.invalidate(code)
+	}
+
+	return err
+}
+
+func (c *CachedRepository) DeleteShortURL(ctx context.Context, code string) error {
+	defer c.invalidate(code)
+	return c.next.DeleteShortURL(ctx, code)
+}
+
+func (c *CachedRepository) GetAllShortURLs(ctx context.Context) ([]*URL, error) {
+	return c.next.GetAllShortURLs(ctx)
+}
+
+func (c *CachedRepository) GetAllURLsHistory(ctx context.Context) ([]*URL, error) {
+	return c.next.GetAllURLsHistory(ctx)
+}
+
+func (c *CachedRepository) ListURLs(ctx context.Context, opts ListOptions) (*URLPage, error) {
+	return c.next.ListURLs(ctx, opts)
+}
+
+func (c *CachedRepository) GetCampaignStats(ctx context.Context, ownerID, groupBy string) ([]*CampaignStat, error) {
+	return c.next.GetCampaignStats(ctx, ownerID, groupBy)
+}
+
+func (c *CachedRepository) AddClickEvent(ctx context.Context, urlId int, ipAddress, userAgent, referer string) error {
+	return c.next.AddClickEvent(ctx, urlId, ipAddress, userAgent, referer)
+}
+
+func (c *CachedRepository) AddClickEvents(ctx context.Context, events []*ClickEvent) error {
+	return c.next.AddClickEvents(ctx, events)
+}
+
+func (c *CachedRepository) GetClickEvents(ctx context.Context, urlId int) ([]*ClickEvent, error) {
+	return c.next.GetClickEvents(ctx, urlId)
+}
+
+func (c *CachedRepository) GetClickTimeSeries(ctx context.Context, urlId int, opts TimeSeriesOptions) ([]*TimeSeriesBucket, error) {
+	return c.next.GetClickTimeSeries(ctx, urlId, opts)
+}
+
+func (c *CachedRepository) GetShortURLForOwner(ctx context.Context, code, ownerID string) (*URL, error) {
+	return c.next.GetShortURLForOwner(ctx, code, ownerID)
+}
+
+func (c *CachedRepository) DeleteShortURLForOwner(ctx context.Context, code, ownerID string) error {
+	defer c.invalidate(code)
+	return c.next.DeleteShortURLForOwner(ctx, code, ownerID)
+}
+
+func (c *CachedRepository) UpdateShortURL(ctx context.Context, code, ownerID string, version int, update URLUpdate) (*URL, error) {
+	// A rename also has to clear a negative entry for the new code
+	defer c.invalidate(code)
+	if update.ShortCode != nil {
+		defer c.invalidate(*update.ShortCode)
+	}
+	return c.next.UpdateShortURL(ctx, code, ownerID, version, update)
+}
+
+func (c *CachedRepository) ExportURLs(ctx context.Context, fn func(*URL) error) error {
+	return c.next.ExportURLs(ctx, fn)
+}
+
+func (c *CachedRepository) ExportClickEvents(ctx context.Context, fn func(string, *ClickEvent) error) error {
+	return c.next.ExportClickEvents(ctx, fn)
+}
+
+func (c *CachedRepository) ImportURLs(ctx context.Context, urls []*URL, policy ConflictPolicy) ([]ImportOutcome, error) {
+	for _, url := range urls {
+		defer c.invalidate(url.ShortCode)
+	}
+	return c.next.ImportURLs(ctx, urls, policy)
+}
+
+func (c *CachedRepository) CreateAPIKey(ctx context.Context, key *APIKey) error {
+	return c.next.CreateAPIKey(ctx, key)
+}
+
+func (c *CachedRepository) GetAPIKeyByHash(ctx context.Context, hash string) (*APIKey, error) {
+	return c.next.GetAPIKeyByHash(ctx, hash)
+}
+
+func (c *CachedRepository) ListAPIKeys(ctx context.Context, ownerID string) ([]*APIKey, error) {
+	return c.next.ListAPIKeys(ctx, ownerID)
+}
+
+func (c *CachedRepository) RevokeAPIKey(ctx context.Context, id int) error {
+	return c.next.RevokeAPIKey(ctx, id)
+}
+
+// Stats returns the current hit/miss counters
+func (c *CachedRepository) Stats() CacheStats {
+	c.mu.Lock()
+	entries := c.lru.Len()
+	c.mu.Unlock()
+
+	return CacheStats{
+		Hits:         c.hits.Load(),
+		Misses:       c.misses.Load(),
+		NegativeHits: c.negativeHits.Load(),
+		Evictions:    c.evictions.Load(),
+		Entries:      entries,
+		Capacity:     c.opts.Size,
+	}
+}
+
+// Close closes the wrapped repository if it supports closing
+func (c *CachedRepository) Close() error {
+	if closer, ok := c.next.(interface{ Close() error }); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// lookup returns a live entry and marks it as recently used
+func (c *CachedRepository) lookup(code string) (cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[code]
+	if !ok {
+		return cacheEntry{}, false
+	}
+
+	entry := elem.Value.(*cacheEntry)
+	if !time.Now().Before(entry.expiresAt) {
+		c.removeElement(elem)
+		return cacheEntry{}, false
+	}
+
+	c.lru.MoveToFront(elem)
+
+	return *entry, true
+}
+
+// storeURL caches a link until the cache TTL or the link's expiry, whichever
+// comes first
+func (c *CachedRepository) storeURL(url *URL, generation uint64) {
+	if c.opts.TTL <= 0 {
+		return
+	}
+
+	expiresAt := time.Now().Add(c.opts.TTL)
+	if url.ExpiresAt != nil && url.ExpiresAt.Before(expiresAt) {
+		expiresAt = *url.ExpiresAt
+	}
+
+	c.store(url.ShortCode, generation, copyURL(url), expiresAt)
+}
+
+// store caches url for code unless code was invalidated since generation
+// was read
+func (c *CachedRepository) store(code string, generation uint64, url *URL, expiresAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.generations[c.slot(code)] != generation {
+		return
+	}
+
+	if elem, ok := c.entries[code]; ok {
+		entry := elem.Value.(*cacheEntry)
+		entry.url = url
+		entry.expiresAt = expiresAt
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	c.entries[code] = c.lru.PushFront(&cacheEntry{code: code, url: url, expiresAt: expiresAt})
+
+	for c.lru.Len() > c.opts.Size {
+		c.removeElement(c.lru.Back())
+		c.evictions.Add(1)
+	}
+}
+
+// recordClick applies a click to the cached copy and returns a copy for the caller
+func (c *CachedRepository) recordClick(code string, cached *URL, clickedAt time.Time) *URL {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[code]; ok {
+		if entry := elem.Value.(*cacheEntry); entry.url != nil {
+			cached = entry.url
+			cached.ClickCount++
+			cached.LastClicked = &clickedAt
+		}
+	}
+
+	return copyURL(cached)
+}
+
+// invalidate drops code and keeps lookups already in flight from storing it
+// again. Writes call it once they are done.
+func (c *CachedRepository) invalidate(code string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generations[c.slot(code)]++
+	if elem, ok := c.entries[code]; ok {
+		c.removeElement(elem)
+	}
+}
+
+// generation returns the invalidation count of code's slot, to be passed to
+// store after the lookup
+func (c *CachedRepository) generation(code string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.generations[c.slot(code)]
+}
+
+func (c *CachedRepository) slot(code string) int {
+	return int(maphash.String(c.seed, code) % uint64(len(c.generations)))
+}
+
+func (c *CachedRepository) removeElement(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*cacheEntry)
+	delete(c.entries, entry.code)
+}
+
+// syncCounter counts each cached click with its own UPDATE
+type syncCounter struct {
+	repo *CachedRepository
+}
+
+func (s syncCounter) CountClick(ctx context.Context, code string, clickedAt time.Time) error {
+	return s.repo.IncrementClickCount(ctx, code, 1, clickedAt)
+}
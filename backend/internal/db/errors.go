@@ -0,0 +1,48 @@
+package db
+
+import (
+	"errors"
+
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Errors returned by every repository implementation. Callers should test
+// for them with errors.Is, since they may be wrapped with more context.
+var (
+	// ErrNotFound means no link exists with the given short code
+	ErrNotFound = errors.New("short URL not found")
+	// ErrExpired means the link exists but its expiry time has passed
+	ErrExpired = errors.New("short URL has expired")
+	// ErrScheduled means the link exists but its activation time is still
+	// ahead
+	ErrScheduled = errors.New("short URL is not available yet")
+	// ErrExhausted means the link exists but has reached its click limit
+	ErrExhausted = errors.New("short URL has reached its click limit")
+	// ErrCodeTaken means another link already uses the short code
+	ErrCodeTaken = errors.New("short code already exists")
+	// ErrVersionConflict means the link was changed since the version the
+	// caller based its update on
+	ErrVersionConflict = errors.New("short URL was modified by another request")
+	// ErrInvalidSchedule means an update would make a link expire before
+	// it activates
+	ErrInvalidSchedule = errors.New("activates_at must be before expires_at")
+)
+
+// isUniqueViolation reports whether err is a unique constraint failure from
+// either SQL driver
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23505"
+	}
+
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE ||
+			sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+	}
+
+	return false
+}
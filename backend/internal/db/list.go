@@ -0,0 +1,341 @@
+package db
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Status filters for ListURLs
+const (
+	StatusActive    = "active"
+	StatusExpired   = "expired"
+	StatusScheduled = "scheduled"
+	StatusExhausted = "exhausted"
+)
+
+// Sort fields for ListURLs
+const (
+	SortCreatedAt   = "created_at"
+	SortClickCount  = "click_count"
+	SortLastClicked = "last_clicked"
+)
+
+const (
+	DefaultListLimit = 50
+	MaxListLimit     = 500
+)
+
+// ErrInvalidCursor is returned when a cursor is malformed or was issued for
+// a different sort order
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ListOptions selects one page of URLs
+type ListOptions struct {
+	// Limit is the page size; zero means DefaultListLimit
+	Limit int
+	// Cursor is the NextCursor of the previous page, empty for the first page
+	Cursor string
+
+	// Status keeps only links with that URL.GetStatus when set
+	Status string
+	// CreatedAfter and CreatedBefore bound created_at (inclusive, exclusive)
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	// URLContains keeps links whose original URL contains it, ignoring case
+	URLContains string
+	// OwnerID keeps only links owned by it when set
+	OwnerID string
+
+	// SortBy is one of the Sort* constants; empty means SortCreatedAt
+	SortBy string
+	// Ascending reverses the default newest/largest first order
+	Ascending bool
+}
+
+// URLPage is one page of ListURLs results
+type URLPage struct {
+	URLs       []*URL `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	// Total counts every URL matching the filters, across all pages
+	Total int `json:"total"`
+}
+
+// Normalize applies defaults and validates the options
+func (o *ListOptions) Normalize() error {
+	if o.Limit <= 0 {
+		o.Limit = DefaultListLimit
+	}
+	if o.Limit > MaxListLimit {
+		o.Limit = MaxListLimit
+	}
+
+	switch o.Status {
+	case "", StatusActive, StatusExpired, StatusScheduled, StatusExhausted:
+	default:
+		return fmt.Errorf("invalid status %q", o.Status)
+	}
+
+	switch o.SortBy {
+	case "":
+		o.SortBy = SortCreatedAt
+	case SortCreatedAt, SortClickCount, SortLastClicked:
+	default:
+		return fmt.Errorf("invalid sort field %q", o.SortBy)
+	}
+
+	return nil
+}
+
+// listCursor is the decoded form of an opaque page cursor. It records the
+// sort key and id of the last row on the page, plus the sort it belongs to.
+type listCursor struct {
+	SortBy    string    `json:"s"`
+	Ascending bool      `json:"a,omitempty"`
+	Time      time.Time `json:"t,omitempty"`
+	Count     int       `json:"n,omitempty"`
+	ID        int       `json:"id"`
+}
+
+func encodeCursor(opts ListOptions, last *URL) string {
+	c := listCursor{SortBy: opts.SortBy, Ascending: opts.Ascending, ID: last.ID}
+
+	switch opts.SortBy {
+	case SortClickCount:
+		c.Count = last.ClickCount
+	case SortLastClicked:
+		c.Time = sortableTime(last.LastClicked)
+	default:
+		c.Time = last.CreatedAt.UTC()
+	}
+
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(opts ListOptions) (*listCursor, error) {
+	if opts.Cursor == "" {
+		return nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(opts.Cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c listCursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	if c.SortBy != opts.SortBy || c.Ascending != opts.Ascending {
+		return nil, ErrInvalidCursor
+	}
+
+	return &c, nil
+}
+
+// zeroTime stands in for a NULL last_clicked so never-clicked links sort
+// before every clicked one
+var zeroTime = time.Time{}
+
+func sortableTime(t *time.Time) time.Time {
+	if t == nil {
+		return zeroTime
+	}
+	return t.UTC()
+}
+
+// sqlListQuery builds the WHERE/ORDER BY clauses for ListURLs. Placeholders
+// are $N for PostgreSQL and ?N for SQLite; time arguments pass through conv
+// so each dialect can normalize them.
+type sqlListQuery struct {
+	dialect string
+	where   []string
+	args    []any
+}
+
+func (q *sqlListQuery) arg(v any) string {
+	if t, ok := v.(time.Time); ok && q.dialect == dialectSQLite {
+		v = t.UTC()
+	}
+	q.args = append(q.args, v)
+
+	prefix := "$"
+	if q.dialect == dialectSQLite {
+		prefix = "?"
+	}
+	return prefix + strconv.Itoa(len(q.args))
+}
+
+// sortExpr returns the SQL expression the page is ordered by
+func (q *sqlListQuery) sortExpr(sortBy string) string {
+	switch sortBy {
+	case SortClickCount:
+		return "click_count"
+	case SortLastClicked:
+		if q.dialect == dialectSQLite {
+			return "COALESCE(last_clicked, '0001-01-01 00:00:00+00:00')"
+		}
+		return "COALESCE(last_clicked, '0001-01-01 00:00:00'::timestamp)"
+	default:
+		return "created_at"
+	}
+}
+
+// filters adds the conditions shared by the page query and the total count
+func (q *sqlListQuery) filters(opts ListOptions, now time.Time) {
+	// Statuses take precedence in the order of URL.GetStatus: expired,
+	// scheduled, exhausted
+	if opts.Status != "" {
+		t := q.arg(now)
+		notExpired := "(expires_at IS NULL OR expires_at > " + t + ")"
+		started := "(activates_at IS NULL OR activates_at <= " + t + ")"
+
+		switch opts.Status {
+		case StatusActive:
+			q.where = append(q.where, notExpired, started, "(max_clicks IS NULL OR click_count < max_clicks)")
+		case StatusExpired:
+			q.where = append(q.where, "expires_at <= "+t)
+		case StatusScheduled:
+			q.where = append(q.where, notExpired, "activates_at > "+t)
+		case StatusExhausted:
+			q.where = append(q.where, notExpired, started, "click_count >= max_clicks")
+		}
+	}
+
+	if opts.CreatedAfter != nil {
+		q.where = append(q.where, "created_at >= "+q.arg(*opts.CreatedAfter))
+	}
+	if opts.CreatedBefore != nil {
+		q.where = append(q.where, "created_at < "+q.arg(*opts.CreatedBefore))
+	}
+
+	if opts.OwnerID != "" {
+		q.where = append(q.where, "owner_id = "+q.arg(opts.OwnerID))
+	}
+
+	if opts.URLContains != "" {
+		fn := "strpos"
+		if q.dialect == dialectSQLite {
+			fn = "instr"
+		}
+		q.where = append(q.where, fmt.Sprintf("%s(lower(original_url), lower(%s)) > 0", fn, q.arg(opts.URLContains)))
+	}
+}
+
+// after adds the keyset condition that starts the page after the cursor
+func (q *sqlListQuery) after(opts ListOptions, c *listCursor) {
+	if c == nil {
+		return
+	}
+
+	op := "<"
+	if opts.Ascending {
+		op = ">"
+	}
+
+	var value any = c.Time
+	if opts.SortBy == SortClickCount {
+		value = c.Count
+	}
+
+	expr := q.sortExpr(opts.SortBy)
+	v := q.arg(value)
+	id := q.arg(c.ID)
+	q.where = append(q.where, fmt.Sprintf("(%s %s %s OR (%s = %s AND id %s %s))", expr, op, v, expr, v, op, id))
+}
+
+func (q *sqlListQuery) whereClause() string {
+	if len(q.where) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(q.where, " AND ")
+}
+
+func (q *sqlListQuery) orderClause(opts ListOptions) string {
+	dir := "DESC"
+	if opts.Ascending {
+		dir = "ASC"
+	}
+	return fmt.Sprintf("ORDER BY %s %s, id %s", q.sortExpr(opts.SortBy), dir, dir)
+}
+
+// matchesListFilters reports whether url passes the filters in opts; used by
+// the in-memory repository
+func matchesListFilters(url *URL, opts ListOptions, now time.Time) bool {
+	status := StatusActive
+	switch {
+	case url.ExpiresAt != nil && !url.ExpiresAt.After(now):
+		status = StatusExpired
+	case url.ActivatesAt != nil && url.ActivatesAt.After(now):
+		status = StatusScheduled
+	case url.IsExhausted():
+		status = StatusExhausted
+	}
+
+	if opts.Status != "" && opts.Status != status {
+		return false
+	}
+
+	if opts.CreatedAfter != nil && url.CreatedAt.Before(*opts.CreatedAfter) {
+		return false
+	}
+	if opts.CreatedBefore != nil && !url.CreatedAt.Before(*opts.CreatedBefore) {
+		return false
+	}
+
+	if opts.OwnerID != "" && url.OwnerID != opts.OwnerID {
+		return false
+	}
+
+	if opts.URLContains != "" && !strings.Contains(strings.ToLower(url.OriginalURL), strings.ToLower(opts.URLContains)) {
+		return false
+	}
+
+	return true
+}
+
+// compareForList orders two URLs by the sort field, then by id, in
+// descending order unless opts.Ascending is set. It returns a negative
+// number when a comes first.
+func compareForList(a, b *URL, opts ListOptions) int {
+	var cmp int
+
+	switch opts.SortBy {
+	case SortClickCount:
+		cmp = a.ClickCount - b.ClickCount
+	case SortLastClicked:
+		cmp = sortableTime(a.LastClicked).Compare(sortableTime(b.LastClicked))
+	default:
+		cmp = a.CreatedAt.Compare(b.CreatedAt)
+	}
+
+	if cmp == 0 {
+		cmp = a.ID - b.ID
+	}
+
+	if opts.Ascending {
+		return cmp
+	}
+	return -cmp
+}
+
+// afterCursor reports whether url comes after the cursor position
+func afterCursor(url *URL, opts ListOptions, c *listCursor) bool {
+	if c == nil {
+		return true
+	}
+
+	pivot := &URL{ID: c.ID, ClickCount: c.Count, CreatedAt: c.Time}
+	if opts.SortBy == SortLastClicked {
+		t := c.Time
+		pivot.LastClicked = &t
+	}
+
+	return compareForList(url, pivot, opts) > 0
+}
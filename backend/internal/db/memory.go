@@ -0,0 +1,749 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryRepository is an in-process implementation of RepositoryInterface.
+// It mirrors the behaviour of PostgresRepository and is intended for local
+// development and tests that cannot reach a database server.
+type MemoryRepository struct {
+	mu          sync.RWMutex
+	urls        map[string]*URL
+	clickEvents map[int][]*ClickEvent
+	apiKeys     map[int]*APIKey
+	nextURLID   int
+	nextEventID int
+	nextKeyID   int
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{
+		urls:        make(map[string]*URL),
+		clickEvents: make(map[int][]*ClickEvent),
+		apiKeys:     make(map[int]*APIKey),
+		nextURLID:   1,
+		nextEventID: 1,
+		nextKeyID:   1,
+	}
+}
+
+func (r *MemoryRepository) CreateShortURL(ctx context.Context, shortURL *URL) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.urls[shortURL.ShortCode]; exists {
+		return fmt.Errorf("failed to create short URL: %w", ErrCodeTaken)
+	}
+
+	shortURL.CreatedAt = time.Now()
+
+	// Set default expiration if not set
+	if shortURL.ExpiresAt == nil {
+		shortURL.SetDefaultExpiration()
+	}
+
+	shortURL.UTM = ParseUTM(shortURL.OriginalURL)
+	shortURL.ID = r.nextURLID
+	shortURL.Version = 1
+	r.nextURLID++
+
+	r.urls[shortURL.ShortCode] = copyURL(shortURL)
+
+	return nil
+}
+
+// CreateShortURLs inserts a batch of links, see RepositoryInterface
+func (r *MemoryRepository) CreateShortURLs(ctx context.Context, urls []*URL, atomic bool) ([]error, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	taken := make(map[string]bool)
+	for _, url := range urls {
+		if _, exists := r.urls[url.ShortCode]; exists {
+			taken[url.ShortCode] = true
+		}
+	}
+
+	pending, errs := prepareBatch(urls, taken)
+	if atomic && len(pending) < len(urls) {
+		return errs, nil
+	}
+
+	for _, i := range pending {
+		urls[i].UTM = ParseUTM(urls[i].OriginalURL)
+		urls[i].ID = r.nextURLID
+		urls[i].Version = 1
+		r.nextURLID++
+		r.urls[urls[i].ShortCode] = copyURL(urls[i])
+	}
+
+	return errs, nil
+}
+
+func (r *MemoryRepository) GetShortURL(ctx context.Context, code string) (*URL, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	url, ok := r.urls[code]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	if url.IsExpired() {
+		return nil, ErrExpired
+	}
+
+	return copyURL(url), nil
+}
+
+func (r *MemoryRepository) GetShortURLForRedirect(ctx context.Context, code string) (*URL, error) {
+	return r.countClick(ctx, code, false)
+}
+
+func (r *MemoryRepository) UnlockShortURL(ctx context.Context, code string) (*URL, error) {
+	return r.countClick(ctx, code, true)
+}
+
+// countClick checks and counts a click under the write lock, so concurrent
+// clicks cannot exceed MaxClicks. Protected links are only counted when
+// unlocked.
+func (r *MemoryRepository) countClick(ctx context.Context, code string, unlocked bool) (*URL, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	url, ok := r.urls[code]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	if url.IsExpired() {
+		return nil, ErrExpired
+	}
+	if url.IsScheduled() {
+		return nil, ErrScheduled
+	}
+	if url.IsExhausted() {
+		return nil, ErrExhausted
+	}
+	if url.IsPasswordProtected() && !unlocked {
+		return copyURL(url), nil
+	}
+
+	url.IncrementClickCount()
+
+	return copyURL(url), nil
+}
+
+// IncrementClickCount adds delta clicks to a URL without reading it first.
+// last_clicked only moves forward, so out-of-order updates cannot rewind it.
+func (r *MemoryRepository) IncrementClickCount(ctx context.Context, code string, delta int, clickedAt time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	url, ok := r.urls[code]
+	if !ok {
+		return ErrNotFound
+	}
+
+	url.ClickCount += delta
+	if url.LastClicked == nil || url.LastClicked.Before(clickedAt) {
+		lastClicked := clickedAt
+		url.LastClicked = &lastClicked
+	}
+
+	return nil
+}
+
+func (r *MemoryRepository) DeleteShortURL(ctx context.Context, code string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	url, ok := r.urls[code]
+	if !ok {
+		return ErrNotFound
+	}
+
+	// Mirror ON DELETE CASCADE on click_events
+	delete(r.clickEvents, url.ID)
+	delete(r.urls, code)
+
+	return nil
+}
+
+func (r *MemoryRepository) GetAllShortURLs(ctx context.Context) ([]*URL, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	urls := make([]*URL, 0, len(r.urls))
+	for _, url := range r.urls {
+		if url.IsExpired() {
+			continue
+		}
+		urls = append(urls, copyURL(url))
+	}
+
+	sortByCreatedAtDesc(urls)
+
+	return urls, nil
+}
+
+func (r *MemoryRepository) GetAllURLsHistory(ctx context.Context) ([]*URL, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	urls := make([]*URL, 0, len(r.urls))
+	for _, url := range r.urls {
+		urls = append(urls, copyURL(url))
+	}
+
+	sortByCreatedAtDesc(urls)
+
+	return urls, nil
+}
+
+// ListURLs returns one page of URLs matching opts
+func (r *MemoryRepository) ListURLs(ctx context.Context, opts ListOptions) (*URLPage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := opts.Normalize(); err != nil {
+		return nil, err
+	}
+
+	cursor, err := decodeCursor(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	page := &URLPage{URLs: []*URL{}}
+
+	var matched []*URL
+	for _, url := range r.urls {
+		if !matchesListFilters(url, opts, now) {
+			continue
+		}
+		page.Total++
+		if afterCursor(url, opts, cursor) {
+			matched = append(matched, url)
+		}
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		return compareForList(matched[i], matched[j], opts) < 0
+	})
+
+	if len(matched) > opts.Limit {
+		matched = matched[:opts.Limit]
+		page.NextCursor = encodeCursor(opts, matched[len(matched)-1])
+	}
+
+	for _, url := range matched {
+		page.URLs = append(page.URLs, copyURL(url))
+	}
+
+	return page, nil
+}
+
+// GetCampaignStats groups links by a UTM parameter, see RepositoryInterface
+func (r *MemoryRepository) GetCampaignStats(ctx context.Context, ownerID, groupBy string) ([]*CampaignStat, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if !IsUTMParam(groupBy) {
+		return nil, fmt.Errorf("%w %q, expected a UTM parameter such as utm_campaign", ErrInvalidGroupBy, groupBy)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	groups := make(map[string]*CampaignStat)
+	stats := []*CampaignStat{}
+	for _, url := range r.urls {
+		value := url.UTM.Get(groupBy)
+		if value == "" || (ownerID != "" && url.OwnerID != ownerID) {
+			continue
+		}
+		stat, ok := groups[value]
+		if !ok {
+			stat = &CampaignStat{Value: value}
+			groups[value] = stat
+			stats = append(stats, stat)
+		}
+		stat.Links++
+		stat.Clicks += url.ClickCount
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Clicks != stats[j].Clicks {
+			return stats[i].Clicks > stats[j].Clicks
+		}
+		return stats[i].Value < stats[j].Value
+	})
+
+	return stats, nil
+}
+
+// AddClickEvent records a click event
+func (r *MemoryRepository) AddClickEvent(ctx context.Context, urlId int, ipAddress, userAgent, referer string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Mirror the foreign key on click_events.url_id
+	if !r.hasURLID(urlId) {
+		return fmt.Errorf("failed to add click event: url %d does not exist", urlId)
+	}
+
+	event := &ClickEvent{
+		ID:        r.nextEventID,
+		URLId:     urlId,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+		Referer:   referer,
+		CreatedAt: time.Now(),
+	}
+	r.nextEventID++
+
+	r.clickEvents[urlId] = append(r.clickEvents[urlId], event)
+
+	return nil
+}
+
+// AddClickEvents records a batch of click events. Like a single INSERT, the
+// batch is rejected as a whole if any event references a missing URL.
+func (r *MemoryRepository) AddClickEvents(ctx context.Context, events []*ClickEvent) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, event := range events {
+		if !r.hasURLID(event.URLId) {
+			return fmt.Errorf("failed to add click events: url %d does not exist", event.URLId)
+		}
+	}
+
+	now := time.Now()
+	for _, event := range events {
+		stored := *event
+		stored.ID = r.nextEventID
+		if stored.CreatedAt.IsZero() {
+			stored.CreatedAt = now
+		}
+		r.nextEventID++
+
+		r.clickEvents[event.URLId] = append(r.clickEvents[event.URLId], &stored)
+	}
+
+	return nil
+}
+
+// GetClickEvents returns click events for a URL
+func (r *MemoryRepository) GetClickEvents(ctx context.Context, urlId int) ([]*ClickEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	stored := r.clickEvents[urlId]
+	events := make([]*ClickEvent, 0, len(stored))
+	for i := len(stored) - 1; i >= 0; i-- {
+		event := *stored[i]
+		events = append(events, &event)
+	}
+
+	return events, nil
+}
+
+// GetClickTimeSeries counts clicks per bucket, see RepositoryInterface
+func (r *MemoryRepository) GetClickTimeSeries(ctx context.Context, urlId int, opts TimeSeriesOptions) ([]*TimeSeriesBucket, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := opts.Normalize(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return fillTimeSeries(opts, countTimeSeries(opts, r.clickEvents[urlId])), nil
+}
+
+// GetShortURLForOwner is GetShortURL restricted to links owned by ownerID
+func (r *MemoryRepository) GetShortURLForOwner(ctx context.Context, code, ownerID string) (*URL, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	url, ok := r.urls[code]
+	if !ok || ownerID == "" || url.OwnerID != ownerID {
+		return nil, ErrNotFound
+	}
+
+	if url.IsExpired() {
+		return nil, ErrExpired
+	}
+
+	return copyURL(url), nil
+}
+
+// DeleteShortURLForOwner deletes a link only if ownerID owns it
+func (r *MemoryRepository) DeleteShortURLForOwner(ctx context.Context, code, ownerID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	url, ok := r.urls[code]
+	if !ok || ownerID == "" || url.OwnerID != ownerID {
+		return ErrNotFound
+	}
+
+	delete(r.clickEvents, url.ID)
+	delete(r.urls, code)
+
+	return nil
+}
+
+// UpdateShortURL edits a link owned by ownerID and increments its version.
+// Expired links can be updated, e.g. to extend them, but not to expire
+// before they activate.
+func (r *MemoryRepository) UpdateShortURL(ctx context.Context, code, ownerID string, version int, update URLUpdate) (*URL, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	url, ok := r.urls[code]
+	if !ok || ownerID == "" || url.OwnerID != ownerID {
+		return nil, ErrNotFound
+	}
+
+	if update.expiresBefore(url.ActivatesAt) {
+		return nil, ErrInvalidSchedule
+	}
+	if version > 0 && url.Version != version {
+		return nil, ErrVersionConflict
+	}
+
+	updated := copyURL(url)
+	if update.OriginalURL != nil {
+		updated.OriginalURL = *update.OriginalURL
+		updated.UTM = update.utm()
+	}
+	if update.ShortCode != nil && *update.ShortCode != code {
+		if _, taken := r.urls[*update.ShortCode]; taken {
+			return nil, fmt.Errorf("failed to update short URL: %w", ErrCodeTaken)
+		}
+		updated.ShortCode = *update.ShortCode
+	}
+	if update.SetExpiresAt {
+		updated.ExpiresAt = nil
+		if update.ExpiresAt != nil {
+			expiresAt := *update.ExpiresAt
+			updated.ExpiresAt = &expiresAt
+		}
+	}
+	updated.Version++
+
+	delete(r.urls, code)
+	r.urls[updated.ShortCode] = updated
+
+	return copyURL(updated), nil
+}
+
+// ExportURLs streams every link to fn, oldest first. The links are copied
+// under the lock and fn runs without it.
+func (r *MemoryRepository) ExportURLs(ctx context.Context, fn func(*URL) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.RLock()
+	urls := make([]*URL, 0, len(r.urls))
+	for _, url := range r.urls {
+		urls = append(urls, copyURL(url))
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(urls, func(i, j int) bool { return urls[i].ID < urls[j].ID })
+
+	for _, url := range urls {
+		if err := fn(url); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ExportClickEvents streams every click event to fn, oldest first
+func (r *MemoryRepository) ExportClickEvents(ctx context.Context, fn func(string, *ClickEvent) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	type exported struct {
+		code  string
+		event ClickEvent
+	}
+
+	r.mu.RLock()
+	var events []exported
+	for _, url := range r.urls {
+		for _, event := range r.clickEvents[url.ID] {
+			events = append(events, exported{code: url.ShortCode, event: *event})
+		}
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(events, func(i, j int) bool { return events[i].event.ID < events[j].event.ID })
+
+	for i := range events {
+		if err := fn(events[i].code, &events[i].event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ImportURLs stores exported links, see RepositoryInterface
+func (r *MemoryRepository) ImportURLs(ctx context.Context, urls []*URL, policy ConflictPolicy) ([]ImportOutcome, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	taken := make(map[string]bool)
+	for _, url := range urls {
+		if _, exists := r.urls[url.ShortCode]; exists {
+			taken[url.ShortCode] = true
+		}
+	}
+
+	outcomes, replace, err := resolveImport(urls, taken, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	// Mirror ON DELETE CASCADE on click_events
+	for _, code := range replace {
+		delete(r.clickEvents, r.urls[code].ID)
+		delete(r.urls, code)
+	}
+
+	for i, url := range urls {
+		url.ID = 0
+		if outcomes[i] == ImportSkipped {
+			continue
+		}
+		url.UTM = ParseUTM(url.OriginalURL)
+		url.ID = r.nextURLID
+		url.Version = 1
+		r.nextURLID++
+		r.urls[url.ShortCode] = copyURL(url)
+	}
+
+	return outcomes, nil
+}
+
+// CreateAPIKey stores a new key and sets its ID and CreatedAt
+func (r *MemoryRepository) CreateAPIKey(ctx context.Context, key *APIKey) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Mirror the UNIQUE constraint on key_hash
+	for _, existing := range r.apiKeys {
+		if existing.Hash == key.Hash {
+			return fmt.Errorf("failed to create API key: duplicate key hash")
+		}
+	}
+
+	key.ID = r.nextKeyID
+	key.CreatedAt = time.Now()
+	r.nextKeyID++
+
+	r.apiKeys[key.ID] = copyAPIKey(key)
+
+	return nil
+}
+
+// GetAPIKeyByHash looks a key up by its hash. Revoked keys are returned too;
+// callers must check IsRevoked.
+func (r *MemoryRepository) GetAPIKeyByHash(ctx context.Context, hash string) (*APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, key := range r.apiKeys {
+		if key.Hash == hash {
+			return copyAPIKey(key), nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+// ListAPIKeys returns the keys of one owner, or of every owner when ownerID
+// is empty, oldest first
+func (r *MemoryRepository) ListAPIKeys(ctx context.Context, ownerID string) ([]*APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	keys := []*APIKey{}
+	for _, key := range r.apiKeys {
+		if ownerID == "" || key.OwnerID == ownerID {
+			keys = append(keys, copyAPIKey(key))
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].ID < keys[j].ID
+	})
+
+	return keys, nil
+}
+
+// RevokeAPIKey marks a key as revoked. Revoking a revoked key keeps the
+// original revocation time.
+func (r *MemoryRepository) RevokeAPIKey(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.apiKeys[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	if key.RevokedAt == nil {
+		now := time.Now()
+		key.RevokedAt = &now
+	}
+
+	return nil
+}
+
+func (r *MemoryRepository) Close() error {
+	return nil
+}
+
+func (r *MemoryRepository) hasURLID(id int) bool {
+	for _, url := range r.urls {
+		if url.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// copyURL returns a deep copy so callers cannot mutate repository state
+func copyURL(src *URL) *URL {
+	dst := *src
+	if src.ActivatesAt != nil {
+		activatesAt := *src.ActivatesAt
+		dst.ActivatesAt = &activatesAt
+	}
+	if src.ExpiresAt != nil {
+		expiresAt := *src.ExpiresAt
+		dst.ExpiresAt = &expiresAt
+	}
+	if src.LastClicked != nil {
+		lastClicked := *src.LastClicked
+		dst.LastClicked = &lastClicked
+	}
+	return &dst
+}
+
+// copyAPIKey returns a deep copy so callers cannot mutate repository state
+func copyAPIKey(src *APIKey) *APIKey {
+	dst := *src
+	if src.RevokedAt != nil {
+		revokedAt := *src.RevokedAt
+		dst.RevokedAt = &revokedAt
+	}
+	return &dst
+}
+
+func sortByCreatedAtDesc(urls []*URL) {
+	sort.SliceStable(urls, func(i, j int) bool {
+		if urls[i].CreatedAt.Equal(urls[j].CreatedAt) {
+			return urls[i].ID > urls[j].ID
+		}
+		return urls[i].CreatedAt.After(urls[j].CreatedAt)
+	})
+}
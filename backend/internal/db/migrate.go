@@ -0,0 +1,388 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/postgres/*.sql migrations/sqlite/*.sql
+var migrationFiles embed.FS
+
+// migrationLockID is the PostgreSQL advisory lock key held while migrating,
+// so replicas starting at the same time apply each migration exactly once.
+const migrationLockID = 7_245_012_581
+
+const (
+	dialectPostgres = "postgres"
+	dialectSQLite   = "sqlite"
+)
+
+// backfills fill in columns that a migration adds from data its SQL cannot
+// parse. Each runs after the up script of its version, in the same
+// transaction.
+var backfills = map[int]func(ctx context.Context, tx *sql.Tx, m *Migrator) error{
+	10: backfillUTM,
+}
+
+// Migration is a numbered schema change with its up and down SQL
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus reports whether a migration has been applied
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt *time.Time
+}
+
+// Migrator applies the embedded migrations for one SQL dialect
+type Migrator struct {
+	db         *sql.DB
+	dialect    string
+	migrations []Migration
+	owned      bool
+}
+
+func NewMigrator(db *sql.DB, dialect string) (*Migrator, error) {
+	migrations, err := loadMigrations(dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: db, dialect: dialect, migrations: migrations}, nil
+}
+
+// OpenMigrator connects to databaseURL without running any migrations, for
+// use by the migrate command. The returned Migrator must be closed.
+func OpenMigrator(databaseURL string) (*Migrator, error) {
+	databaseURL = strings.TrimSpace(databaseURL)
+
+	var (
+		db      *sql.DB
+		dialect string
+		err     error
+	)
+
+	switch {
+	case strings.HasPrefix(databaseURL, "postgres://") || strings.HasPrefix(databaseURL, "postgresql://"):
+		dialect = dialectPostgres
+		db, err = openPostgres(databaseURL)
+	case strings.HasPrefix(databaseURL, "sqlite://"):
+		dialect = dialectSQLite
+		db, err = openSQLite(sqlitePath(databaseURL))
+	case strings.HasPrefix(databaseURL, "memory://"):
+		return nil, fmt.Errorf("the in-memory repository has no schema to migrate")
+	default:
+		return nil, fmt.Errorf("unsupported database URL scheme (expected postgres://, postgresql:// or sqlite://)")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := NewMigrator(db, dialect)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	m.owned = true
+
+	return m, nil
+}
+
+// Close releases the database connection if the Migrator opened it
+func (m *Migrator) Close() error {
+	if !m.owned {
+		return nil
+	}
+	return m.db.Close()
+}
+
+// Up applies every pending migration in order and returns how many ran
+func (m *Migrator) Up() (int, error) {
+	applied := 0
+
+	err := m.withLock(func(conn *sql.Conn) error {
+		current, err := m.appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := current[migration.Version]; ok {
+				continue
+			}
+			if err := m.apply(conn, migration, migration.Up, true); err != nil {
+				return err
+			}
+			applied++
+		}
+
+		return nil
+	})
+
+	return applied, err
+}
+
+// Down reverts up to steps applied migrations, newest first, and returns how
+// many were reverted
+func (m *Migrator) Down(steps int) (int, error) {
+	reverted := 0
+
+	err := m.withLock(func(conn *sql.Conn) error {
+		current, err := m.appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && reverted < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := current[migration.Version]; !ok {
+				continue
+			}
+			if err := m.apply(conn, migration, migration.Down, false); err != nil {
+				return err
+			}
+			reverted++
+		}
+
+		return nil
+	})
+
+	return reverted, err
+}
+
+// Status lists every known migration and whether it has been applied
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+
+	err := m.withConn(func(conn *sql.Conn) error {
+		if err := m.ensureTable(conn); err != nil {
+			return err
+		}
+
+		current, err := m.appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+			if appliedAt, ok := current[migration.Version]; ok {
+				status.Applied = true
+				status.AppliedAt = &appliedAt
+			}
+			statuses = append(statuses, status)
+		}
+
+		return nil
+	})
+
+	return statuses, err
+}
+
+// apply runs a single migration and records it in schema_migrations within
+// one transaction, so a failed migration leaves no partial state behind
+func (m *Migrator) apply(conn *sql.Conn, migration Migration, script string, up bool) error {
+	direction := "down"
+	if up {
+		direction = "up"
+	}
+
+	ctx := context.Background()
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start migration %04d: %w", migration.Version, err)
+	}
+	defer tx.Rollback()
+
+	if strings.TrimSpace(script) != "" {
+		if _, err := tx.ExecContext(ctx, script); err != nil {
+			return fmt.Errorf("failed to run migration %04d_%s (%s): %w", migration.Version, migration.Name, direction, err)
+		}
+	}
+
+	if backfill := backfills[migration.Version]; up && backfill != nil {
+		if err := backfill(ctx, tx, m); err != nil {
+			return fmt.Errorf("failed to backfill migration %04d_%s: %w", migration.Version, migration.Name, err)
+		}
+	}
+
+	if up {
+		_, err = tx.ExecContext(ctx, m.rebind("INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)"),
+			migration.Version, migration.Name, time.Now().UTC())
+	} else {
+		_, err = tx.ExecContext(ctx, m.rebind("DELETE FROM schema_migrations WHERE version = $1"), migration.Version)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record migration %04d: %w", migration.Version, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit migration %04d: %w", migration.Version, err)
+	}
+
+	return nil
+}
+
+// withLock runs fn on a dedicated connection while holding the migration lock
+func (m *Migrator) withLock(fn func(conn *sql.Conn) error) error {
+	return m.withConn(func(conn *sql.Conn) error {
+		ctx := context.Background()
+
+		// SQLite serializes writers on its own: every transaction takes the
+		// write lock up front (_txlock=immediate) and busy_timeout waits for it.
+		if m.dialect == dialectPostgres {
+			if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+				return fmt.Errorf("failed to acquire migration lock: %w", err)
+			}
+			defer conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", migrationLockID)
+		}
+
+		if err := m.ensureTable(conn); err != nil {
+			return err
+		}
+
+		return fn(conn)
+	})
+}
+
+func (m *Migrator) withConn(fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Close()
+
+	return fn(conn)
+}
+
+func (m *Migrator) ensureTable(conn *sql.Conn) error {
+	query := `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	);`
+
+	if _, err := conn.ExecContext(context.Background(), query); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	return nil
+}
+
+func (m *Migrator) appliedVersions(conn *sql.Conn) (map[int]time.Time, error) {
+	rows, err := conn.QueryContext(context.Background(), "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	versions := make(map[int]time.Time)
+	for rows.Next() {
+		var (
+			version   int
+			appliedAt time.Time
+		)
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan schema_migrations: %w", err)
+		}
+		versions[version] = appliedAt
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return versions, nil
+}
+
+// rebind converts $N placeholders to ? for SQLite
+func (m *Migrator) rebind(query string) string {
+	if m.dialect != dialectSQLite {
+		return query
+	}
+	for i := 9; i >= 1; i-- {
+		query = strings.ReplaceAll(query, "$"+strconv.Itoa(i), "?")
+	}
+	return query
+}
+
+// loadMigrations reads NNNN_name.up.sql / NNNN_name.down.sql pairs for a dialect
+func loadMigrations(dialect string) ([]Migration, error) {
+	dir := path.Join("migrations", dialect)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for dialect %q: %w", dialect, err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		fileName := entry.Name()
+
+		var direction string
+		switch {
+		case strings.HasSuffix(fileName, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(fileName, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		base := strings.TrimSuffix(fileName, "."+direction+".sql")
+		versionPart, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("invalid migration file name %q", fileName)
+		}
+
+		version, err := strconv.Atoi(versionPart)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %q: %w", fileName, err)
+		}
+
+		contents, err := fs.ReadFile(migrationFiles, path.Join(dir, fileName))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %q: %w", fileName, err)
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		}
+
+		if direction == "up" {
+			migration.Up = string(contents)
+		} else {
+			migration.Down = string(contents)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no up script", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
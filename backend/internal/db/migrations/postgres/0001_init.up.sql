@@ -0,0 +1,24 @@
+-- Initial schema. Uses IF NOT EXISTS so databases created before
+-- migrations were introduced can adopt this version without changes.
+CREATE TABLE IF NOT EXISTS urls (
+	id SERIAL PRIMARY KEY,
+	short_code VARCHAR(50) UNIQUE NOT NULL,
+	original_url TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	expires_at TIMESTAMP,
+	click_count INTEGER DEFAULT 0,
+	last_clicked TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS click_events (
+	id SERIAL PRIMARY KEY,
+	url_id INTEGER REFERENCES urls(id) ON DELETE CASCADE,
+	ip_address INET,
+	user_agent TEXT,
+	referer TEXT,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_urls_short_code ON urls(short_code);
+CREATE INDEX IF NOT EXISTS idx_click_events_url_id ON click_events(url_id);
+CREATE INDEX IF NOT EXISTS idx_urls_expires_at ON urls(expires_at);
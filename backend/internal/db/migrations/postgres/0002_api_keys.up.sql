@@ -0,0 +1,17 @@
+-- API keys and link ownership. Keys are stored as SHA-256 hashes; links
+-- created before this migration, or anonymously, have no owner.
+CREATE TABLE api_keys (
+	id SERIAL PRIMARY KEY,
+	name VARCHAR(100) NOT NULL DEFAULT '',
+	owner_id VARCHAR(64) NOT NULL,
+	key_prefix VARCHAR(16) NOT NULL,
+	key_hash CHAR(64) UNIQUE NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	revoked_at TIMESTAMP
+);
+
+CREATE INDEX idx_api_keys_owner_id ON api_keys(owner_id);
+
+ALTER TABLE urls ADD COLUMN owner_id VARCHAR(64);
+
+CREATE INDEX idx_urls_owner_id ON urls(owner_id);
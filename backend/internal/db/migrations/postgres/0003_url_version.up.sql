@@ -0,0 +1,3 @@
+-- Row version for optimistic concurrency on link edits; every update
+-- increments it
+ALTER TABLE urls ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
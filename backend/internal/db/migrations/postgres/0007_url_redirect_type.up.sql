@@ -0,0 +1,3 @@
+-- How the link sends visitors on: an HTTP status (301, 302, 307, 308),
+-- meta_refresh or interstitial. NULL uses the server default.
+ALTER TABLE urls ADD COLUMN redirect_type TEXT;
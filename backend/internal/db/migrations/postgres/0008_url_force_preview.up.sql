@@ -0,0 +1,2 @@
+-- Show every visitor the preview page instead of redirecting
+ALTER TABLE urls ADD COLUMN force_preview BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,5 @@
+-- Carry the query string and sub-path of a visit over to the target.
+-- query_passthrough is the conflict policy (keep, override or append);
+-- NULL leaves the query out.
+ALTER TABLE urls ADD COLUMN query_passthrough TEXT;
+ALTER TABLE urls ADD COLUMN path_passthrough BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,10 @@
+-- UTM parameters of the target URL, kept in step with original_url so
+-- clicks can be grouped by campaign across links. Existing links are
+-- filled in by backfillUTM, which parses original_url after this script.
+ALTER TABLE urls ADD COLUMN utm_source TEXT;
+ALTER TABLE urls ADD COLUMN utm_medium TEXT;
+ALTER TABLE urls ADD COLUMN utm_campaign TEXT;
+ALTER TABLE urls ADD COLUMN utm_term TEXT;
+ALTER TABLE urls ADD COLUMN utm_content TEXT;
+
+CREATE INDEX idx_urls_utm_campaign ON urls(utm_campaign) WHERE utm_campaign IS NOT NULL;
@@ -0,0 +1,5 @@
+-- Location of the visitor, resolved from ip_address with the GeoIP
+-- database when the click is recorded
+ALTER TABLE click_events ADD COLUMN country TEXT;
+ALTER TABLE click_events ADD COLUMN region TEXT;
+ALTER TABLE click_events ADD COLUMN city TEXT;
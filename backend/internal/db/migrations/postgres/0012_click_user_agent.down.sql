@@ -0,0 +1,6 @@
+ALTER TABLE click_events DROP COLUMN bot;
+ALTER TABLE click_events DROP COLUMN device;
+ALTER TABLE click_events DROP COLUMN os_version;
+ALTER TABLE click_events DROP COLUMN os;
+ALTER TABLE click_events DROP COLUMN browser_version;
+ALTER TABLE click_events DROP COLUMN browser;
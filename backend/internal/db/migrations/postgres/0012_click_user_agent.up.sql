@@ -0,0 +1,10 @@
+-- Client details parsed from user_agent when the click is recorded; bot
+-- names the crawler or tool and is NULL for people. Existing clicks are
+-- left NULL: analytics parses their user_agent when read, time series
+-- counts them as people.
+ALTER TABLE click_events ADD COLUMN browser TEXT;
+ALTER TABLE click_events ADD COLUMN browser_version TEXT;
+ALTER TABLE click_events ADD COLUMN os TEXT;
+ALTER TABLE click_events ADD COLUMN os_version TEXT;
+ALTER TABLE click_events ADD COLUMN device TEXT;
+ALTER TABLE click_events ADD COLUMN bot TEXT;
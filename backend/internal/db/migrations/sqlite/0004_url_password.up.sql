@@ -0,0 +1,2 @@
+-- Hash of the password protecting the link, NULL for public links
+ALTER TABLE urls ADD COLUMN password_hash TEXT;
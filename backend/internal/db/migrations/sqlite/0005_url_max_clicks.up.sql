@@ -0,0 +1,2 @@
+-- Number of clicks after which the link stops redirecting, NULL for no limit
+ALTER TABLE urls ADD COLUMN max_clicks INTEGER CHECK (max_clicks > 0);
@@ -0,0 +1,3 @@
+-- Time before which the link does not redirect, NULL for links active
+-- from creation
+ALTER TABLE urls ADD COLUMN activates_at DATETIME;
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_urls_utm_campaign;
+ALTER TABLE urls DROP COLUMN utm_content;
+ALTER TABLE urls DROP COLUMN utm_term;
+ALTER TABLE urls DROP COLUMN utm_campaign;
+ALTER TABLE urls DROP COLUMN utm_medium;
+ALTER TABLE urls DROP COLUMN utm_source;
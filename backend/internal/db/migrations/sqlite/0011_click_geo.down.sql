@@ -0,0 +1,3 @@
+ALTER TABLE click_events DROP COLUMN city;
+ALTER TABLE click_events DROP COLUMN region;
+ALTER TABLE click_events DROP COLUMN country;
@@ -3,30 +3,141 @@ package db
 import "time"
 
 type URL struct {
-	ID           int        `json:"id" db:"id"`
-	ShortCode    string     `json:"short_code" db:"short_code"`
-	OriginalURL  string     `json:"original_url" db:"original_url"`
-	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
-	ExpiresAt    *time.Time `json:"expires_at,omitempty" db:"expires_at"`
-	ClickCount   int        `json:"click_count" db:"click_count"`
-	LastClicked  *time.Time `json:"last_clicked,omitempty" db:"last_clicked"`
+	ID               int        `json:"id" db:"id"`
+	ShortCode        string     `json:"short_code" db:"short_code"`
+	OriginalURL      string     `json:"original_url" db:"original_url"`
+	CreatedAt        time.Time  `json:"created_at" db:"created_at"`
+	ActivatesAt      *time.Time `json:"activates_at,omitempty" db:"activates_at"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	ClickCount       int        `json:"click_count" db:"click_count"`
+	LastClicked      *time.Time `json:"last_clicked,omitempty" db:"last_clicked"`
+	OwnerID          string     `json:"owner_id,omitempty" db:"owner_id"`                   // empty for anonymous links
+	Version          int        `json:"version" db:"version"`                               // incremented by every update
+	PasswordHash     string     `json:"-" db:"password_hash"`                               // empty for public links
+	MaxClicks        int        `json:"max_clicks,omitempty" db:"max_clicks"`               // zero for no limit
+	RedirectType     string     `json:"redirect_type,omitempty" db:"redirect_type"`         // empty for the server default
+	ForcePreview     bool       `json:"force_preview,omitempty" db:"force_preview"`         // show the preview page instead of redirecting
+	QueryPassthrough string     `json:"query_passthrough,omitempty" db:"query_passthrough"` // a QueryPassthrough* policy; empty drops the visit's query
+	PathPassthrough  bool       `json:"path_passthrough,omitempty" db:"path_passthrough"`   // append the path after the short code to the target
+	UTM                         // read from OriginalURL by the repositories
+}
+
+// Redirect types a link can choose. The first four are HTTP redirects with
+// that status; the others serve an HTML page that sends the visitor on.
+const (
+	RedirectMovedPermanently = "301"
+	RedirectFound            = "302"
+	RedirectTemporary        = "307"
+	RedirectPermanent        = "308"
+	RedirectMetaRefresh      = "meta_refresh"
+	RedirectInterstitial     = "interstitial"
+)
+
+// IsValidRedirectType reports whether t is one of the redirect types
+func IsValidRedirectType(t string) bool {
+	switch t {
+	case RedirectMovedPermanently, RedirectFound, RedirectTemporary, RedirectPermanent, RedirectMetaRefresh, RedirectInterstitial:
+		return true
+	}
+	return false
+}
+
+// Query passthrough policies decide which value wins when the visit and the
+// target both set a parameter
+const (
+	QueryPassthroughKeep     = "keep"     // the target's values stay
+	QueryPassthroughOverride = "override" // the visit's values replace them
+	QueryPassthroughAppend   = "append"   // both are kept, the target's first
+)
+
+// IsValidQueryPassthrough reports whether p is one of the query passthrough
+// policies
+func IsValidQueryPassthrough(p string) bool {
+	switch p {
+	case QueryPassthroughKeep, QueryPassthroughOverride, QueryPassthroughAppend:
+		return true
+	}
+	return false
+}
+
+// URLUpdate describes an edit to a link. Nil fields are left unchanged.
+type URLUpdate struct {
+	OriginalURL *string
+	// ShortCode renames the link; its clicks and history are kept
+	ShortCode *string
+	// SetExpiresAt replaces expires_at with ExpiresAt, which may be nil to
+	// make the link permanent
+	SetExpiresAt bool
+	ExpiresAt    *time.Time
+}
+
+// expiresBefore reports whether the update sets an expiry at or before
+// activatesAt, which would keep the link from ever going live
+func (u URLUpdate) expiresBefore(activatesAt *time.Time) bool {
+	return u.SetExpiresAt && u.ExpiresAt != nil && activatesAt != nil && !activatesAt.Before(*u.ExpiresAt)
 }
 
 type ClickEvent struct {
-	ID        int       `json:"id" db:"id"`
-	URLId     int       `json:"url_id" db:"url_id"`
-	IPAddress string    `json:"ip_address" db:"ip_address"`
-	UserAgent string    `json:"user_agent" db:"user_agent"`
-	Referer   string    `json:"referer" db:"referer"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	ID             int       `json:"id" db:"id"`
+	URLId          int       `json:"url_id" db:"url_id"`
+	IPAddress      string    `json:"ip_address" db:"ip_address"`
+	UserAgent      string    `json:"user_agent" db:"user_agent"`
+	Referer        string    `json:"referer" db:"referer"`
+	Country        string    `json:"country,omitempty" db:"country"` // ISO code, empty if unknown
+	Region         string    `json:"region,omitempty" db:"region"`
+	City           string    `json:"city,omitempty" db:"city"`
+	Browser        string    `json:"browser,omitempty" db:"browser"` // parsed from UserAgent
+	BrowserVersion string    `json:"browser_version,omitempty" db:"browser_version"`
+	OS             string    `json:"os,omitempty" db:"os"`
+	OSVersion      string    `json:"os_version,omitempty" db:"os_version"`
+	Device         string    `json:"device,omitempty" db:"device"` // desktop, mobile or tablet
+	Bot            string    `json:"bot,omitempty" db:"bot"`       // crawler or tool name, empty for people
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+}
+
+// APIKey authenticates API calls on behalf of an owner. Only the SHA-256
+// hash of the key is stored; Prefix is kept so keys can be told apart.
+type APIKey struct {
+	ID        int        `json:"id" db:"id"`
+	Name      string     `json:"name" db:"name"`
+	OwnerID   string     `json:"owner_id" db:"owner_id"`
+	Prefix    string     `json:"prefix" db:"key_prefix"`
+	Hash      string     `json:"-" db:"key_hash"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+}
+
+// IsRevoked reports whether the key has been revoked
+func (k *APIKey) IsRevoked() bool {
+	return k.RevokedAt != nil
 }
 
-// SetDefaultExpiration sets the expiration time to 60 minutes from now
+// SetDefaultExpiration sets the expiration time to 60 minutes from now, or
+// from activation for a scheduled link
 func (s *URL) SetDefaultExpiration() {
-	expiration := time.Now().Add(60 * time.Minute)
+	start := time.Now()
+	if s.IsScheduled() {
+		start = *s.ActivatesAt
+	}
+	expiration := start.Add(60 * time.Minute)
 	s.ExpiresAt = &expiration
 }
 
+// IsPasswordProtected reports whether visitors must enter a password
+func (s *URL) IsPasswordProtected() bool {
+	return s.PasswordHash != ""
+}
+
+// IsScheduled reports whether the link is not active yet
+func (s *URL) IsScheduled() bool {
+	return s.ActivatesAt != nil && s.ActivatesAt.After(time.Now())
+}
+
+// IsExhausted reports whether the link has used up its clicks
+func (s *URL) IsExhausted() bool {
+	return s.MaxClicks > 0 && s.ClickCount >= s.MaxClicks
+}
+
 // IsExpired checks if the short URL has expired
 func (s *URL) IsExpired() bool {
 	if s.ExpiresAt == nil {
@@ -39,6 +150,12 @@ func (s *URL) GetStatus() string {
 	if s.IsExpired() {
 		return "expired"
 	}
+	if s.IsScheduled() {
+		return "scheduled"
+	}
+	if s.IsExhausted() {
+		return "exhausted"
+	}
 	return "active"
 }
 
@@ -47,4 +164,4 @@ func (s *URL) IncrementClickCount() {
 	s.ClickCount++
 	now := time.Now()
 	s.LastClicked = &now
-}
\ No newline at end of file
+}
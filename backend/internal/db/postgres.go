@@ -1,7 +1,9 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 
@@ -13,78 +15,43 @@ type PostgresRepository struct {
 }
 
 func NewPostgresRepository(databaseURL string) (*PostgresRepository, error) {
-	db, err := sql.Open("postgres", databaseURL)
+	db, err := openPostgres(databaseURL)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
-	}
-
-	if err := db.Ping(); err != nil {
-		return nil, fmt.Errorf("failed to ping database: %w", err)
+		return nil, err
 	}
 
 	repo := &PostgresRepository{db: db}
-	
-	// Initialize database schema
-	if err := repo.initSchema(); err != nil {
-		return nil, fmt.Errorf("failed to initialize schema: %w", err)
+
+	// Bring the schema up to date
+	migrator, err := NewMigrator(db, dialectPostgres)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load migrations: %w", err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		return nil, fmt.Errorf("failed to migrate schema: %w", err)
 	}
 
 	return repo, nil
 }
 
-func (r *PostgresRepository) initSchema() error {
-	// Create urls table
-	urlsSchema := `
-	CREATE TABLE IF NOT EXISTS urls (
-		id SERIAL PRIMARY KEY,
-		short_code VARCHAR(50) UNIQUE NOT NULL,
-		original_url TEXT NOT NULL,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		expires_at TIMESTAMP,
-		click_count INTEGER DEFAULT 0,
-		last_clicked TIMESTAMP
-	);`
-
-	if _, err := r.db.Exec(urlsSchema); err != nil {
-		return fmt.Errorf("failed to create urls table: %w", err)
-	}
-
-	// Create click_events table
-	clickEventsSchema := `
-	CREATE TABLE IF NOT EXISTS click_events (
-		id SERIAL PRIMARY KEY,
-		url_id INTEGER REFERENCES urls(id) ON DELETE CASCADE,
-		ip_address INET,
-		user_agent TEXT,
-		referer TEXT,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-	);`
-
-	if _, err := r.db.Exec(clickEventsSchema); err != nil {
-		return fmt.Errorf("failed to create click_events table: %w", err)
-	}
-
-	// Create indexes for better performance
-	indexes := []string{
-		"CREATE INDEX IF NOT EXISTS idx_urls_short_code ON urls(short_code);",
-		"CREATE INDEX IF NOT EXISTS idx_click_events_url_id ON click_events(url_id);",
-		"CREATE INDEX IF NOT EXISTS idx_urls_expires_at ON urls(expires_at);",
-	}
-
-	for _, idx := range indexes {
-		if _, err := r.db.Exec(idx); err != nil {
-			return fmt.Errorf("failed to create index: %w", err)
-		}
+func openPostgres(databaseURL string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
-	return nil
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	return db, nil
 }
 
-func (r *PostgresRepository) CreateShortURL(shortURL *URL) error {
+func (r *PostgresRepository) CreateShortURL(ctx context.Context, shortURL *URL) error {
 	query := `
-		INSERT INTO urls (short_code, original_url, created_at, expires_at, click_count)
-		VALUES ($1, $2, $3, $4, $5)
-		RETURNING id`
+		INSERT INTO urls (short_code, original_url, created_at, activates_at, expires_at, click_count, owner_id, password_hash, max_clicks, redirect_type, force_preview, query_passthrough, path_passthrough, utm_source, utm_medium, utm_campaign, utm_term, utm_content)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)
+		RETURNING id, version`
 
 	now := time.Now()
 	shortURL.CreatedAt = now
@@ -93,93 +60,138 @@ func (r *PostgresRepository) CreateShortURL(shortURL *URL) error {
 	if shortURL.ExpiresAt == nil {
 		shortURL.SetDefaultExpiration()
 	}
+	shortURL.UTM = ParseUTM(shortURL.OriginalURL)
 
-	err := r.db.QueryRow(
+	err := r.db.QueryRowContext(
+		ctx,
 		query,
 		shortURL.ShortCode,
 		shortURL.OriginalURL,
-		shortURL.CreatedAt,
-		shortURL.ExpiresAt,
+		utc(&shortURL.CreatedAt),
+		utc(shortURL.ActivatesAt),
+		utc(shortURL.ExpiresAt),
 		shortURL.ClickCount,
-	).Scan(&shortURL.ID)
+		nullString(shortURL.OwnerID),
+		nullString(shortURL.PasswordHash),
+		nullInt(shortURL.MaxClicks),
+		nullString(shortURL.RedirectType),
+		shortURL.ForcePreview,
+		nullString(shortURL.QueryPassthrough),
+		shortURL.PathPassthrough,
+		nullString(shortURL.UTM.Source),
+		nullString(shortURL.UTM.Medium),
+		nullString(shortURL.UTM.Campaign),
+		nullString(shortURL.UTM.Term),
+		nullString(shortURL.UTM.Content),
+	).Scan(&shortURL.ID, &shortURL.Version)
 
 	if err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("failed to create short URL: %w", ErrCodeTaken)
+		}
 		return fmt.Errorf("failed to create short URL: %w", err)
 	}
 
 	return nil
 }
 
-func (r *PostgresRepository) GetShortURL(code string) (*URL, error) {
+// CreateShortURLs inserts a batch of links, see RepositoryInterface
+func (r *PostgresRepository) CreateShortURLs(ctx context.Context, urls []*URL, atomic bool) ([]error, error) {
+	return createShortURLsSQL(ctx, r.db, dialectPostgres, urls, atomic)
+}
+
+func (r *PostgresRepository) GetShortURL(ctx context.Context, code string) (*URL, error) {
 	query := `
-		SELECT id, short_code, original_url, created_at, expires_at, click_count, last_clicked
+		SELECT ` + urlColumns + `
 		FROM urls 
 		WHERE short_code = $1`
 
-	url := &URL{}
-	err := r.db.QueryRow(query, code).Scan(
-		&url.ID,
-		&url.ShortCode,
-		&url.OriginalURL,
-		&url.CreatedAt,
-		&url.ExpiresAt,
-		&url.ClickCount,
-		&url.LastClicked,
-	)
-
+	url, err := scanURL(r.db.QueryRowContext(ctx, query, code))
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("short URL not found")
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
 		}
 		return nil, fmt.Errorf("failed to get short URL: %w", err)
 	}
 
 	// Check if expired
 	if url.IsExpired() {
-		return nil, fmt.Errorf("short URL has expired")
+		return nil, ErrExpired
 	}
 
 	return url, nil
 }
 
-func (r *PostgresRepository) GetShortURLForRedirect(code string) (*URL, error) {
-	// Start transaction for atomic read and update
-	tx, err := r.db.Begin()
-	if err != nil {
-		return nil, fmt.Errorf("failed to start transaction: %w", err)
-	}
-	defer tx.Rollback()
+// GetShortURLForRedirect resolves a short code and counts the click, see
+// RepositoryInterface
+func (r *PostgresRepository) GetShortURLForRedirect(ctx context.Context, code string) (*URL, error) {
+	return r.countClick(ctx, code, false)
+}
+
+// UnlockShortURL counts the click on a protected link, see RepositoryInterface
+func (r *PostgresRepository) UnlockShortURL(ctx context.Context, code string) (*URL, error) {
+	return r.countClick(ctx, code, true)
+}
 
-	// Get URL
-	url, err := r.GetShortURL(code)
+// countClick resolves a short code and counts the click in a single
+// statement, so a link that is deleted, not active yet, expired or out of
+// clicks can never be counted, and concurrent clicks cannot exceed
+// max_clicks. Protected links are only counted when unlocked.
+func (r *PostgresRepository) countClick(ctx context.Context, code string, unlocked bool) (*URL, error) {
+	query := `
+		UPDATE urls
+		SET click_count = click_count + 1, last_clicked = now() AT TIME ZONE 'UTC'
+		WHERE short_code = $1 AND (expires_at IS NULL OR expires_at > now() AT TIME ZONE 'UTC')
+			AND (activates_at IS NULL OR activates_at <= now() AT TIME ZONE 'UTC')
+			AND (max_clicks IS NULL OR click_count < max_clicks)
+			AND ($2 OR password_hash IS NULL)
+		RETURNING ` + urlColumns
+
+	url, err := scanURL(r.db.QueryRowContext(ctx, query, code, unlocked))
+	if errors.Is(err, sql.ErrNoRows) {
+		// Nothing was counted; report why without touching the row
+		url, err := r.GetShortURL(ctx, code)
+		if err != nil {
+			return nil, err
+		}
+		return clickMissResult(url, unlocked)
+	}
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to update click count: %w", err)
 	}
 
-	// Update click count and last clicked
-	updateQuery := `
-		UPDATE urls 
-		SET click_count = click_count + 1, last_clicked = $1 
-		WHERE short_code = $2`
+	return url, nil
+}
+
+// IncrementClickCount adds delta clicks to a URL without reading it first.
+// last_clicked only moves forward, so out-of-order updates cannot rewind it.
+func (r *PostgresRepository) IncrementClickCount(ctx context.Context, code string, delta int, clickedAt time.Time) error {
+	query := `
+		UPDATE urls
+		SET click_count = click_count + $1,
+			last_clicked = CASE WHEN last_clicked IS NULL OR last_clicked < $2 THEN $2 ELSE last_clicked END
+		WHERE short_code = $3`
 
-	now := time.Now()
-	if _, err := tx.Exec(updateQuery, now, code); err != nil {
-		return nil, fmt.Errorf("failed to update click count: %w", err)
+	result, err := r.db.ExecContext(ctx, query, delta, utc(&clickedAt), code)
+	if err != nil {
+		return fmt.Errorf("failed to update click count: %w", err)
 	}
 
-	if err := tx.Commit(); err != nil {
-		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
 	}
 
-	url.ClickCount++
-	url.LastClicked = &now
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
 
-	return url, nil
+	return nil
 }
 
-func (r *PostgresRepository) DeleteShortURL(code string) error {
+func (r *PostgresRepository) DeleteShortURL(ctx context.Context, code string) error {
 	query := `DELETE FROM urls WHERE short_code = $1`
-	result, err := r.db.Exec(query, code)
+	result, err := r.db.ExecContext(ctx, query, code)
 	if err != nil {
 		return fmt.Errorf("failed to delete short URL: %w", err)
 	}
@@ -190,94 +202,61 @@ func (r *PostgresRepository) DeleteShortURL(code string) error {
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("short URL not found")
+		return ErrNotFound
 	}
 
 	return nil
 }
 
-func (r *PostgresRepository) GetAllShortURLs() ([]*URL, error) {
+func (r *PostgresRepository) GetAllShortURLs(ctx context.Context) ([]*URL, error) {
 	query := `
-		SELECT id, short_code, original_url, created_at, expires_at, click_count, last_clicked
+		SELECT ` + urlColumns + `
 		FROM urls 
-		WHERE expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP
+		WHERE expires_at IS NULL OR expires_at > now() AT TIME ZONE 'UTC'
 		ORDER BY created_at DESC`
 
-	rows, err := r.db.Query(query)
+	rows, err := r.db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get all URLs: %w", err)
 	}
 	defer rows.Close()
 
-	var urls []*URL
-	for rows.Next() {
-		url := &URL{}
-		err := rows.Scan(
-			&url.ID,
-			&url.ShortCode,
-			&url.OriginalURL,
-			&url.CreatedAt,
-			&url.ExpiresAt,
-			&url.ClickCount,
-			&url.LastClicked,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan URL: %w", err)
-		}
-		urls = append(urls, url)
-	}
-
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("failed to iterate rows: %w", err)
-	}
-
-	return urls, nil
+	return scanURLs(rows)
 }
 
-func (r *PostgresRepository) GetAllURLsHistory() ([]*URL, error) {
+func (r *PostgresRepository) GetAllURLsHistory(ctx context.Context) ([]*URL, error) {
 	query := `
-		SELECT id, short_code, original_url, created_at, expires_at, click_count, last_clicked
+		SELECT ` + urlColumns + `
 		FROM urls 
 		ORDER BY created_at DESC`
 
-	rows, err := r.db.Query(query)
+	rows, err := r.db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get URL history: %w", err)
 	}
 	defer rows.Close()
 
-	var urls []*URL
-	for rows.Next() {
-		url := &URL{}
-		err := rows.Scan(
-			&url.ID,
-			&url.ShortCode,
-			&url.OriginalURL,
-			&url.CreatedAt,
-			&url.ExpiresAt,
-			&url.ClickCount,
-			&url.LastClicked,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan URL: %w", err)
-		}
-		urls = append(urls, url)
-	}
+	return scanURLs(rows)
+}
 
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("failed to iterate rows: %w", err)
-	}
+// ListURLs returns one page of URLs matching opts, filtered and sorted in SQL
+func (r *PostgresRepository) ListURLs(ctx context.Context, opts ListOptions) (*URLPage, error) {
+	return listURLsSQL(ctx, r.db, dialectPostgres, opts)
+}
 
-	return urls, nil
+// GetCampaignStats groups links by a UTM parameter, see RepositoryInterface
+func (r *PostgresRepository) GetCampaignStats(ctx context.Context, ownerID, groupBy string) ([]*CampaignStat, error) {
+	return campaignStatsSQL(ctx, r.db, dialectPostgres, ownerID, groupBy)
 }
 
 // AddClickEvent records a click event
-func (r *PostgresRepository) AddClickEvent(urlId int, ipAddress, userAgent, referer string) error {
+func (r *PostgresRepository) AddClickEvent(ctx context.Context, urlId int, ipAddress, userAgent, referer string) error {
 	query := `
 		INSERT INTO click_events (url_id, ip_address, user_agent, referer, created_at)
 		VALUES ($1, $2, $3, $4, $5)`
 
-	_, err := r.db.Exec(query, urlId, ipAddress, userAgent, referer, time.Now())
+	now := time.Now()
+	_, err := r.db.ExecContext(ctx, query, urlId, ipAddress, userAgent, referer, utc(&now))
 	if err != nil {
 		return fmt.Errorf("failed to add click event: %w", err)
 	}
@@ -285,42 +264,236 @@ func (r *PostgresRepository) AddClickEvent(urlId int, ipAddress, userAgent, refe
 	return nil
 }
 
+// AddClickEvents records a batch of click events with multi-row INSERTs in
+// one transaction. Events without a CreatedAt are stamped with the current
+// time.
+func (r *PostgresRepository) AddClickEvents(ctx context.Context, events []*ClickEvent) error {
+	return addClickEventsSQL(ctx, r.db, dialectPostgres, events)
+}
+
 // GetClickEvents returns click events for a URL
-func (r *PostgresRepository) GetClickEvents(urlId int) ([]*ClickEvent, error) {
+func (r *PostgresRepository) GetClickEvents(ctx context.Context, urlId int) ([]*ClickEvent, error) {
 	query := `
-		SELECT id, url_id, ip_address, user_agent, referer, created_at
-		FROM click_events 
-		WHERE url_id = $1 
+		SELECT ` + clickEventColumns + `
+		FROM click_events
+		WHERE url_id = $1
 		ORDER BY created_at DESC`
 
-	rows, err := r.db.Query(query, urlId)
+	rows, err := r.db.QueryContext(ctx, query, urlId)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get click events: %w", err)
 	}
 	defer rows.Close()
 
-	var events []*ClickEvent
+	return scanClickEvents(rows)
+}
+
+// GetClickTimeSeries counts clicks per bucket, see RepositoryInterface.
+// created_at holds UTC without a zone; date_trunc with a time zone aligns
+// buckets to local midnights and hours, daylight saving time included.
+func (r *PostgresRepository) GetClickTimeSeries(ctx context.Context, urlId int, opts TimeSeriesOptions) ([]*TimeSeriesBucket, error) {
+	if err := opts.Normalize(); err != nil {
+		return nil, err
+	}
+
+	// GroupBy is one of the column names checked by Normalize
+	group := "''"
+	if opts.GroupBy != "" {
+		group = "COALESCE(" + opts.GroupBy + ", '')"
+	}
+	query := `
+		SELECT date_trunc($2, created_at AT TIME ZONE 'UTC', $3), ` + group + `, COUNT(*)
+		FROM click_events
+		WHERE url_id = $1 AND created_at >= $4 AND created_at < $5 AND ($6 OR bot IS NULL)
+		GROUP BY 1, 2
+		ORDER BY 1`
+
+	rows, err := r.db.QueryContext(ctx, query, urlId, opts.Granularity, opts.Location.String(),
+		opts.From.UTC(), opts.To.UTC(), opts.IncludeBots)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get click time series: %w", err)
+	}
+	defer rows.Close()
+
+	var counts []timeSeriesCount
 	for rows.Next() {
-		event := &ClickEvent{}
-		err := rows.Scan(
-			&event.ID,
-			&event.URLId,
-			&event.IPAddress,
-			&event.UserAgent,
-			&event.Referer,
-			&event.CreatedAt,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan click event: %w", err)
+		var count timeSeriesCount
+		if err := rows.Scan(&count.start, &count.group, &count.clicks); err != nil {
+			return nil, fmt.Errorf("failed to scan click time series: %w", err)
 		}
-		events = append(events, event)
+		counts = append(counts, count)
 	}
-
 	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("failed to iterate rows: %w", err)
 	}
 
-	return events, nil
+	return fillTimeSeries(opts, counts), nil
+}
+
+// GetShortURLForOwner is GetShortURL restricted to links owned by ownerID
+func (r *PostgresRepository) GetShortURLForOwner(ctx context.Context, code, ownerID string) (*URL, error) {
+	query := `
+		SELECT ` + urlColumns + `
+		FROM urls
+		WHERE short_code = $1 AND owner_id = $2`
+
+	url, err := scanURL(r.db.QueryRowContext(ctx, query, code, ownerID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get short URL: %w", err)
+	}
+
+	if url.IsExpired() {
+		return nil, ErrExpired
+	}
+
+	return url, nil
+}
+
+// DeleteShortURLForOwner deletes a link only if ownerID owns it
+func (r *PostgresRepository) DeleteShortURLForOwner(ctx context.Context, code, ownerID string) error {
+	query := `DELETE FROM urls WHERE short_code = $1 AND owner_id = $2`
+	result, err := r.db.ExecContext(ctx, query, code, ownerID)
+	if err != nil {
+		return fmt.Errorf("failed to delete short URL: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// UpdateShortURL edits a link owned by ownerID and increments its version.
+// Expired links can be updated, e.g. to extend them, but not to expire
+// before they activate.
+func (r *PostgresRepository) UpdateShortURL(ctx context.Context, code, ownerID string, version int, update URLUpdate) (*URL, error) {
+	query := `
+		UPDATE urls SET
+			original_url = COALESCE($3, original_url),
+			short_code = COALESCE($4, short_code),
+			expires_at = CASE WHEN $5::boolean THEN $6::timestamp ELSE expires_at END,
+			utm_source = CASE WHEN $3::text IS NULL THEN utm_source ELSE $8 END,
+			utm_medium = CASE WHEN $3::text IS NULL THEN utm_medium ELSE $9 END,
+			utm_campaign = CASE WHEN $3::text IS NULL THEN utm_campaign ELSE $10 END,
+			utm_term = CASE WHEN $3::text IS NULL THEN utm_term ELSE $11 END,
+			utm_content = CASE WHEN $3::text IS NULL THEN utm_content ELSE $12 END,
+			version = version + 1
+		WHERE short_code = $1 AND owner_id = $2 AND ($7::integer = 0 OR version = $7)
+			AND (NOT $5::boolean OR $6::timestamp IS NULL OR activates_at IS NULL OR activates_at < $6::timestamp)
+		RETURNING ` + urlColumns
+
+	utm := update.utm()
+	url, err := scanURL(r.db.QueryRowContext(ctx, query,
+		code, ownerID, update.OriginalURL, update.ShortCode, update.SetExpiresAt, utc(update.ExpiresAt), version,
+		nullString(utm.Source), nullString(utm.Medium), nullString(utm.Campaign), nullString(utm.Term), nullString(utm.Content)))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, updateMissError(ctx, r.db, `SELECT activates_at FROM urls WHERE short_code = $1 AND owner_id = $2`, code, ownerID, update)
+		}
+		if isUniqueViolation(err) {
+			return nil, fmt.Errorf("failed to update short URL: %w", ErrCodeTaken)
+		}
+		return nil, fmt.Errorf("failed to update short URL: %w", err)
+	}
+
+	return url, nil
+}
+
+// ExportURLs streams every link to fn, oldest first
+func (r *PostgresRepository) ExportURLs(ctx context.Context, fn func(*URL) error) error {
+	return exportURLsSQL(ctx, r.db, fn)
+}
+
+// ExportClickEvents streams every click event to fn, oldest first
+func (r *PostgresRepository) ExportClickEvents(ctx context.Context, fn func(string, *ClickEvent) error) error {
+	return exportClickEventsSQL(ctx, r.db, fn)
+}
+
+// ImportURLs stores exported links in one transaction
+func (r *PostgresRepository) ImportURLs(ctx context.Context, urls []*URL, policy ConflictPolicy) ([]ImportOutcome, error) {
+	return importURLsSQL(ctx, r.db, dialectPostgres, urls, policy)
+}
+
+// CreateAPIKey stores a new key and sets its ID and CreatedAt
+func (r *PostgresRepository) CreateAPIKey(ctx context.Context, key *APIKey) error {
+	query := `
+		INSERT INTO api_keys (name, owner_id, key_prefix, key_hash, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id`
+
+	key.CreatedAt = time.Now()
+	err := r.db.QueryRowContext(ctx, query, key.Name, key.OwnerID, key.Prefix, key.Hash, utc(&key.CreatedAt)).Scan(&key.ID)
+	if err != nil {
+		return fmt.Errorf("failed to create API key: %w", err)
+	}
+
+	return nil
+}
+
+// GetAPIKeyByHash looks a key up by its hash. Revoked keys are returned too;
+// callers must check IsRevoked.
+func (r *PostgresRepository) GetAPIKeyByHash(ctx context.Context, hash string) (*APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE key_hash = $1`
+
+	key, err := scanAPIKey(r.db.QueryRowContext(ctx, query, hash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+
+	return key, nil
+}
+
+// ListAPIKeys returns the keys of one owner, or of every owner when ownerID
+// is empty, oldest first
+func (r *PostgresRepository) ListAPIKeys(ctx context.Context, ownerID string) ([]*APIKey, error) {
+	query := `
+		SELECT ` + apiKeyColumns + `
+		FROM api_keys
+		WHERE $1 = '' OR owner_id = $1
+		ORDER BY id`
+
+	rows, err := r.db.QueryContext(ctx, query, ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+	defer rows.Close()
+
+	return scanAPIKeys(rows)
+}
+
+// RevokeAPIKey marks a key as revoked. Revoking a revoked key keeps the
+// original revocation time.
+func (r *PostgresRepository) RevokeAPIKey(ctx context.Context, id int) error {
+	query := `UPDATE api_keys SET revoked_at = COALESCE(revoked_at, $1) WHERE id = $2`
+
+	now := time.Now()
+	result, err := r.db.ExecContext(ctx, query, utc(&now), id)
+	if err != nil {
+		return fmt.Errorf("failed to revoke API key: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
 }
 
 func (r *PostgresRepository) Close() error {
@@ -1,21 +1,67 @@
 package db
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strings"
+	"time"
 )
 
 // URL Operations
 type RepositoryInterface interface {
-	CreateShortURL(shortURL *URL) error
-	GetShortURL(code string) (*URL, error)
-	GetShortURLForRedirect(code string) (*URL, error)
-	DeleteShortURL(code string) error
-	GetAllShortURLs() ([]*URL, error)
-	GetAllURLsHistory() ([]*URL, error)
-	AddClickEvent(urlId int, ipAddress, userAgent, referer string) error
-	GetClickEvents(urlId int) ([]*ClickEvent, error)
+	CreateShortURL(ctx context.Context, shortURL *URL) error
+	// CreateShortURLs inserts a batch of links in one transaction, setting
+	// their fields like CreateShortURL. It returns one error per link: nil
+	// if it was stored, ErrCodeTaken if its code is used by an existing link
+	// or an earlier one in the batch. In atomic mode nothing is stored
+	// unless every link can be. The error return fails the whole batch.
+	CreateShortURLs(ctx context.Context, urls []*URL, atomic bool) ([]error, error)
+	GetShortURL(ctx context.Context, code string) (*URL, error)
+	// GetShortURLForRedirect resolves a short code and counts the click.
+	// It returns ErrScheduled, ErrExpired or ErrExhausted for links that
+	// may not be followed. Password-protected links are returned without counting;
+	// UnlockShortURL counts them once the password has been checked.
+	GetShortURLForRedirect(ctx context.Context, code string) (*URL, error)
+	UnlockShortURL(ctx context.Context, code string) (*URL, error)
+	IncrementClickCount(ctx context.Context, code string, delta int, clickedAt time.Time) error
+	DeleteShortURL(ctx context.Context, code string) error
+	GetAllShortURLs(ctx context.Context) ([]*URL, error)
+	GetAllURLsHistory(ctx context.Context) ([]*URL, error)
+	ListURLs(ctx context.Context, opts ListOptions) (*URLPage, error)
+	// GetCampaignStats groups the links of ownerID, or all links if it is
+	// empty, by the UTM parameter groupBy, e.g. UTMCampaign. Links without
+	// that parameter are left out; the most clicked groups come first.
+	GetCampaignStats(ctx context.Context, ownerID, groupBy string) ([]*CampaignStat, error)
+	AddClickEvent(ctx context.Context, urlId int, ipAddress, userAgent, referer string) error
+	AddClickEvents(ctx context.Context, events []*ClickEvent) error
+	GetClickEvents(ctx context.Context, urlId int) ([]*ClickEvent, error)
+	// GetClickTimeSeries counts the clicks of a link in buckets of
+	// opts.Granularity aligned to opts.Location. Every bucket from From to
+	// To is returned, with zero clicks where there were none.
+	GetClickTimeSeries(ctx context.Context, urlId int, opts TimeSeriesOptions) ([]*TimeSeriesBucket, error)
+
+	// Owner-scoped access; a link owned by someone else is ErrNotFound
+	GetShortURLForOwner(ctx context.Context, code, ownerID string) (*URL, error)
+	DeleteShortURLForOwner(ctx context.Context, code, ownerID string) error
+	// UpdateShortURL applies update and returns the new row. A positive
+	// version must match the stored one or ErrVersionConflict is returned.
+	UpdateShortURL(ctx context.Context, code, ownerID string, version int, update URLUpdate) (*URL, error)
+
+	// Export and import. The export methods stream every row, oldest first,
+	// and stop at the first error returned by fn. ImportURLs stores links
+	// from an export in one transaction, keeping their short code, owner,
+	// timestamps and click count and setting their ID; it returns one outcome
+	// per link and, under ConflictFail, ErrCodeTaken for a taken code.
+	ExportURLs(ctx context.Context, fn func(*URL) error) error
+	ExportClickEvents(ctx context.Context, fn func(shortCode string, event *ClickEvent) error) error
+	ImportURLs(ctx context.Context, urls []*URL, policy ConflictPolicy) ([]ImportOutcome, error)
+
+	// API keys
+	CreateAPIKey(ctx context.Context, key *APIKey) error
+	GetAPIKeyByHash(ctx context.Context, hash string) (*APIKey, error)
+	ListAPIKeys(ctx context.Context, ownerID string) ([]*APIKey, error)
+	RevokeAPIKey(ctx context.Context, id int) error
 }
 
 func InitRepository(databaseURL string) (RepositoryInterface, error) {
@@ -24,12 +70,21 @@ func InitRepository(databaseURL string) (RepositoryInterface, error) {
 		return nil, fmt.Errorf("database URL is required (set DATABASE_URL or POSTGRES_URL)")
 	}
 
-	// PostgreSQL only
 	if strings.HasPrefix(databaseURL, "postgres://") || strings.HasPrefix(databaseURL, "postgresql://") {
 		return NewPostgresRepository(databaseURL)
 	}
 
-	return nil, fmt.Errorf("unsupported database URL scheme (expected postgres:// or postgresql://)")
+	// Embedded SQLite database file, e.g. sqlite://data/urls.db
+	if strings.HasPrefix(databaseURL, "sqlite://") {
+		return NewSQLiteRepository(sqlitePath(databaseURL))
+	}
+
+	// In-memory storage, data is lost when the process exits
+	if strings.HasPrefix(databaseURL, "memory://") {
+		return NewMemoryRepository(), nil
+	}
+
+	return nil, fmt.Errorf("unsupported database URL scheme (expected postgres://, postgresql://, sqlite:// or memory://)")
 }
 
 func GetDatabaseURL() string {
@@ -0,0 +1,359 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Helpers shared by the PostgreSQL and SQLite repositories
+
+const urlColumns = "id, short_code, original_url, created_at, activates_at, expires_at, click_count, last_clicked, owner_id, version, password_hash, max_clicks, redirect_type, force_preview, query_passthrough, path_passthrough, utm_source, utm_medium, utm_campaign, utm_term, utm_content"
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanURL reads one row selected with urlColumns
+func scanURL(row rowScanner) (*URL, error) {
+	url := &URL{}
+	var ownerID, passwordHash, redirectType, queryPassthrough sql.NullString
+	var utmSource, utmMedium, utmCampaign, utmTerm, utmContent sql.NullString
+	var maxClicks sql.NullInt64
+	err := row.Scan(
+		&url.ID,
+		&url.ShortCode,
+		&url.OriginalURL,
+		&url.CreatedAt,
+		&url.ActivatesAt,
+		&url.ExpiresAt,
+		&url.ClickCount,
+		&url.LastClicked,
+		&ownerID,
+		&url.Version,
+		&passwordHash,
+		&maxClicks,
+		&redirectType,
+		&url.ForcePreview,
+		&queryPassthrough,
+		&url.PathPassthrough,
+		&utmSource,
+		&utmMedium,
+		&utmCampaign,
+		&utmTerm,
+		&utmContent,
+	)
+	if err != nil {
+		return nil, err
+	}
+	url.OwnerID = ownerID.String
+	url.PasswordHash = passwordHash.String
+	url.MaxClicks = int(maxClicks.Int64)
+	url.RedirectType = redirectType.String
+	url.QueryPassthrough = queryPassthrough.String
+	url.UTM = UTM{
+		Source:   utmSource.String,
+		Medium:   utmMedium.String,
+		Campaign: utmCampaign.String,
+		Term:     utmTerm.String,
+		Content:  utmContent.String,
+	}
+
+	return url, nil
+}
+
+// nullString stores an empty string as NULL
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// nullInt stores zero as NULL
+func nullInt(n int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(n), Valid: n != 0}
+}
+
+// clickMissResult explains why counting a click matched no row, given the
+// link as read afterwards. A protected link that was not unlocked is
+// returned uncounted; otherwise the link is not active yet, ran out of
+// clicks or expired in the meantime.
+func clickMissResult(url *URL, unlocked bool) (*URL, error) {
+	switch {
+	case url.IsScheduled():
+		return nil, ErrScheduled
+	case url.IsExhausted():
+		return nil, ErrExhausted
+	case url.IsPasswordProtected() && !unlocked:
+		return url, nil
+	default:
+		return nil, ErrExpired
+	}
+}
+
+// updateMissError explains why an owner-scoped UPDATE matched no row. The
+// exists query selects the activates_at of the link by short code and
+// owner: when it finds one, either update would make the link expire
+// before it activates or the version condition failed.
+func updateMissError(ctx context.Context, db *sql.DB, exists, code, ownerID string, update URLUpdate) error {
+	var activatesAt *time.Time
+	err := db.QueryRowContext(ctx, exists, code, ownerID).Scan(&activatesAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update short URL: %w", err)
+	}
+	if update.expiresBefore(activatesAt) {
+		return ErrInvalidSchedule
+	}
+
+	return ErrVersionConflict
+}
+
+const apiKeyColumns = "id, name, owner_id, key_prefix, key_hash, created_at, revoked_at"
+
+// scanAPIKey reads one row selected with apiKeyColumns
+func scanAPIKey(row rowScanner) (*APIKey, error) {
+	key := &APIKey{}
+	err := row.Scan(
+		&key.ID,
+		&key.Name,
+		&key.OwnerID,
+		&key.Prefix,
+		&key.Hash,
+		&key.CreatedAt,
+		&key.RevokedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// scanAPIKeys reads every row of a query selecting apiKeyColumns
+func scanAPIKeys(rows *sql.Rows) ([]*APIKey, error) {
+	keys := []*APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan API key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return keys, nil
+}
+
+// scanURLs reads every row of a query selecting urlColumns
+func scanURLs(rows *sql.Rows) ([]*URL, error) {
+	urls := []*URL{}
+	for rows.Next() {
+		url, err := scanURL(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan URL: %w", err)
+		}
+		urls = append(urls, url)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return urls, nil
+}
+
+const clickEventColumns = "id, url_id, ip_address, user_agent, referer, country, region, city, browser, browser_version, os, os_version, device, bot, created_at"
+
+// scanClickEvent reads one row selected with clickEventColumns, after any
+// leading columns, which are scanned into prefix
+func scanClickEvent(row rowScanner, prefix ...any) (*ClickEvent, error) {
+	event := &ClickEvent{}
+	var ipAddress, userAgent, referer, country, region, city sql.NullString
+	var browser, browserVersion, os, osVersion, device, bot sql.NullString
+	dest := append(prefix,
+		&event.ID,
+		&event.URLId,
+		&ipAddress,
+		&userAgent,
+		&referer,
+		&country,
+		&region,
+		&city,
+		&browser,
+		&browserVersion,
+		&os,
+		&osVersion,
+		&device,
+		&bot,
+		&event.CreatedAt,
+	)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	event.IPAddress = ipAddress.String
+	event.UserAgent = userAgent.String
+	event.Referer = referer.String
+	event.Country = country.String
+	event.Region = region.String
+	event.City = city.String
+	event.Browser = browser.String
+	event.BrowserVersion = browserVersion.String
+	event.OS = os.String
+	event.OSVersion = osVersion.String
+	event.Device = device.String
+	event.Bot = bot.String
+
+	return event, nil
+}
+
+// scanClickEvents reads every row of a query selecting clickEventColumns
+func scanClickEvents(rows *sql.Rows) ([]*ClickEvent, error) {
+	events := []*ClickEvent{}
+	for rows.Next() {
+		event, err := scanClickEvent(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan click event: %w", err)
+		}
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return events, nil
+}
+
+// clickChunkSize bounds the rows per click INSERT, so a large batch stays
+// under the placeholder limits of both databases (each row takes 14). The
+// SQLite driver matches every placeholder against every argument, so it is
+// kept at the recorder's default batch size rather than near the limit.
+const clickChunkSize = 100
+
+// addClickEventsSQL records a batch of click events with multi-row INSERTs
+// of up to clickChunkSize rows, in one transaction so the batch is still
+// stored or rejected as a whole. Events without a CreatedAt are stamped with
+// the current time.
+func addClickEventsSQL(ctx context.Context, db *sql.DB, dialect string, events []*ClickEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	for start := 0; start < len(events); start += clickChunkSize {
+		chunk := events[start:min(start+clickChunkSize, len(events))]
+		if err := insertClickEventChunk(ctx, tx, dialect, chunk, now); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit click events: %w", err)
+	}
+
+	return nil
+}
+
+// insertClickEventChunk inserts events with one multi-row INSERT, stamping
+// those without a CreatedAt with now
+func insertClickEventChunk(ctx context.Context, tx *sql.Tx, dialect string, events []*ClickEvent, now time.Time) error {
+	var query strings.Builder
+	query.WriteString("INSERT INTO click_events (url_id, ip_address, user_agent, referer, country, region, city, browser, browser_version, os, os_version, device, bot, created_at) VALUES ")
+
+	var args []any
+	for i, event := range events {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+
+		// Both databases store click times without a zone, as UTC
+		createdAt := &event.CreatedAt
+		if createdAt.IsZero() {
+			createdAt = &now
+		}
+		createdAt = utc(createdAt)
+		row := []any{event.URLId, event.IPAddress, event.UserAgent, event.Referer, nullString(event.Country), nullString(event.Region), nullString(event.City),
+			nullString(event.Browser), nullString(event.BrowserVersion), nullString(event.OS), nullString(event.OSVersion), nullString(event.Device), nullString(event.Bot), createdAt}
+
+		query.WriteString("(")
+		for j, value := range row {
+			if j > 0 {
+				query.WriteString(", ")
+			}
+			args = append(args, value)
+			query.WriteString(placeholder(dialect, len(args)))
+		}
+		query.WriteString(")")
+	}
+
+	if _, err := tx.ExecContext(ctx, query.String(), args...); err != nil {
+		return fmt.Errorf("failed to add click events: %w", err)
+	}
+
+	return nil
+}
+
+// listURLsSQL runs the page and total-count queries for ListURLs
+func listURLsSQL(ctx context.Context, db *sql.DB, dialect string, opts ListOptions) (*URLPage, error) {
+	if err := opts.Normalize(); err != nil {
+		return nil, err
+	}
+
+	cursor, err := decodeCursor(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	// Total ignores the cursor so it stays the same on every page
+	count := &sqlListQuery{dialect: dialect}
+	count.filters(opts, now)
+
+	page := &URLPage{}
+	countQuery := "SELECT COUNT(*) FROM urls " + count.whereClause()
+	if err := db.QueryRowContext(ctx, countQuery, count.args...).Scan(&page.Total); err != nil {
+		return nil, fmt.Errorf("failed to count URLs: %w", err)
+	}
+
+	q := &sqlListQuery{dialect: dialect}
+	q.filters(opts, now)
+	q.after(opts, cursor)
+
+	// Fetch one extra row to learn whether another page follows
+	query := fmt.Sprintf("SELECT %s FROM urls %s %s LIMIT %d",
+		urlColumns, q.whereClause(), q.orderClause(opts), opts.Limit+1)
+
+	rows, err := db.QueryContext(ctx, query, q.args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list URLs: %w", err)
+	}
+	defer rows.Close()
+
+	urls, err := scanURLs(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(urls) > opts.Limit {
+		urls = urls[:opts.Limit]
+		page.NextCursor = encodeCursor(opts, urls[len(urls)-1])
+	}
+	page.URLs = urls
+
+	return page, nil
+}
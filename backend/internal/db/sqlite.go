@@ -0,0 +1,534 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// SQLiteRepository stores URLs in an embedded SQLite database file
+type SQLiteRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteRepository(path string) (*SQLiteRepository, error) {
+	db, err := openSQLite(path)
+	if err != nil {
+		return nil, err
+	}
+
+	repo := &SQLiteRepository{db: db}
+
+	// Bring the schema up to date
+	migrator, err := NewMigrator(db, dialectSQLite)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load migrations: %w", err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		return nil, fmt.Errorf("failed to migrate schema: %w", err)
+	}
+
+	return repo, nil
+}
+
+func openSQLite(path string) (*sql.DB, error) {
+	if path == "" {
+		return nil, fmt.Errorf("sqlite database path is required")
+	}
+
+	// WAL lets redirects read while a click is being written, busy_timeout
+	// waits for the writer lock instead of failing and _txlock=immediate
+	// takes that lock up front so read-then-write transactions cannot deadlock.
+	dsn := "file:" + path +
+		"?_pragma=journal_mode(WAL)" +
+		"&_pragma=busy_timeout(5000)" +
+		"&_pragma=foreign_keys(1)" +
+		"&_txlock=immediate" +
+		"&_time_format=sqlite"
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	return db, nil
+}
+
+func (r *SQLiteRepository) CreateShortURL(ctx context.Context, shortURL *URL) error {
+	query := `
+		INSERT INTO urls (short_code, original_url, created_at, activates_at, expires_at, click_count, owner_id, password_hash, max_clicks, redirect_type, force_preview, query_passthrough, path_passthrough, utm_source, utm_medium, utm_campaign, utm_term, utm_content)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id, version`
+
+	now := time.Now()
+	shortURL.CreatedAt = now
+
+	// Set default expiration if not set
+	if shortURL.ExpiresAt == nil {
+		shortURL.SetDefaultExpiration()
+	}
+	shortURL.UTM = ParseUTM(shortURL.OriginalURL)
+
+	err := r.db.QueryRowContext(
+		ctx,
+		query,
+		shortURL.ShortCode,
+		shortURL.OriginalURL,
+		utc(&shortURL.CreatedAt),
+		utc(shortURL.ActivatesAt),
+		utc(shortURL.ExpiresAt),
+		shortURL.ClickCount,
+		nullString(shortURL.OwnerID),
+		nullString(shortURL.PasswordHash),
+		nullInt(shortURL.MaxClicks),
+		nullString(shortURL.RedirectType),
+		shortURL.ForcePreview,
+		nullString(shortURL.QueryPassthrough),
+		shortURL.PathPassthrough,
+		nullString(shortURL.UTM.Source),
+		nullString(shortURL.UTM.Medium),
+		nullString(shortURL.UTM.Campaign),
+		nullString(shortURL.UTM.Term),
+		nullString(shortURL.UTM.Content),
+	).Scan(&shortURL.ID, &shortURL.Version)
+
+	if err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("failed to create short URL: %w", ErrCodeTaken)
+		}
+		return fmt.Errorf("failed to create short URL: %w", err)
+	}
+
+	return nil
+}
+
+// CreateShortURLs inserts a batch of links, see RepositoryInterface
+func (r *SQLiteRepository) CreateShortURLs(ctx context.Context, urls []*URL, atomic bool) ([]error, error) {
+	return createShortURLsSQL(ctx, r.db, dialectSQLite, urls, atomic)
+}
+
+func (r *SQLiteRepository) GetShortURL(ctx context.Context, code string) (*URL, error) {
+	query := `
+		SELECT ` + urlColumns + `
+		FROM urls
+		WHERE short_code = ?`
+
+	url, err := scanURL(r.db.QueryRowContext(ctx, query, code))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get short URL: %w", err)
+	}
+
+	// Check if expired
+	if url.IsExpired() {
+		return nil, ErrExpired
+	}
+
+	return url, nil
+}
+
+// GetShortURLForRedirect resolves a short code and counts the click, see
+// RepositoryInterface
+func (r *SQLiteRepository) GetShortURLForRedirect(ctx context.Context, code string) (*URL, error) {
+	return r.countClick(ctx, code, false)
+}
+
+// UnlockShortURL counts the click on a protected link, see RepositoryInterface
+func (r *SQLiteRepository) UnlockShortURL(ctx context.Context, code string) (*URL, error) {
+	return r.countClick(ctx, code, true)
+}
+
+// countClick resolves a short code and counts the click in a single
+// statement, so a link that is deleted, not active yet, expired or out of
+// clicks can never be counted, and concurrent clicks cannot exceed
+// max_clicks. Protected links are only counted when unlocked.
+func (r *SQLiteRepository) countClick(ctx context.Context, code string, unlocked bool) (*URL, error) {
+	query := `
+		UPDATE urls
+		SET click_count = click_count + 1, last_clicked = ?1
+		WHERE short_code = ?2 AND (expires_at IS NULL OR expires_at > ?1)
+			AND (activates_at IS NULL OR activates_at <= ?1)
+			AND (max_clicks IS NULL OR click_count < max_clicks)
+			AND (?3 OR password_hash IS NULL)
+		RETURNING ` + urlColumns
+
+	now := time.Now()
+	url, err := scanURL(r.db.QueryRowContext(ctx, query, utc(&now), code, unlocked))
+	if errors.Is(err, sql.ErrNoRows) {
+		// Nothing was counted; report why without touching the row
+		url, err := r.GetShortURL(ctx, code)
+		if err != nil {
+			return nil, err
+		}
+		return clickMissResult(url, unlocked)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update click count: %w", err)
+	}
+
+	return url, nil
+}
+
+// IncrementClickCount adds delta clicks to a URL without reading it first.
+// last_clicked only moves forward, so out-of-order updates cannot rewind it.
+func (r *SQLiteRepository) IncrementClickCount(ctx context.Context, code string, delta int, clickedAt time.Time) error {
+	query := `
+		UPDATE urls
+		SET click_count = click_count + ?1,
+			last_clicked = CASE WHEN last_clicked IS NULL OR last_clicked < ?2 THEN ?2 ELSE last_clicked END
+		WHERE short_code = ?3`
+
+	result, err := r.db.ExecContext(ctx, query, delta, utc(&clickedAt), code)
+	if err != nil {
+		return fmt.Errorf("failed to update click count: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *SQLiteRepository) DeleteShortURL(ctx context.Context, code string) error {
+	query := `DELETE FROM urls WHERE short_code = ?`
+	result, err := r.db.ExecContext(ctx, query, code)
+	if err != nil {
+		return fmt.Errorf("failed to delete short URL: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *SQLiteRepository) GetAllShortURLs(ctx context.Context) ([]*URL, error) {
+	query := `
+		SELECT ` + urlColumns + `
+		FROM urls
+		WHERE expires_at IS NULL OR expires_at > ?
+		ORDER BY created_at DESC, id DESC`
+
+	now := time.Now()
+	rows, err := r.db.QueryContext(ctx, query, utc(&now))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get all URLs: %w", err)
+	}
+	defer rows.Close()
+
+	return scanURLs(rows)
+}
+
+func (r *SQLiteRepository) GetAllURLsHistory(ctx context.Context) ([]*URL, error) {
+	query := `
+		SELECT ` + urlColumns + `
+		FROM urls
+		ORDER BY created_at DESC, id DESC`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get URL history: %w", err)
+	}
+	defer rows.Close()
+
+	return scanURLs(rows)
+}
+
+// ListURLs returns one page of URLs matching opts, filtered and sorted in SQL
+func (r *SQLiteRepository) ListURLs(ctx context.Context, opts ListOptions) (*URLPage, error) {
+	return listURLsSQL(ctx, r.db, dialectSQLite, opts)
+}
+
+// GetCampaignStats groups links by a UTM parameter, see RepositoryInterface
+func (r *SQLiteRepository) GetCampaignStats(ctx context.Context, ownerID, groupBy string) ([]*CampaignStat, error) {
+	return campaignStatsSQL(ctx, r.db, dialectSQLite, ownerID, groupBy)
+}
+
+// AddClickEvent records a click event
+func (r *SQLiteRepository) AddClickEvent(ctx context.Context, urlId int, ipAddress, userAgent, referer string) error {
+	query := `
+		INSERT INTO click_events (url_id, ip_address, user_agent, referer, created_at)
+		VALUES (?, ?, ?, ?, ?)`
+
+	now := time.Now()
+	_, err := r.db.ExecContext(ctx, query, urlId, ipAddress, userAgent, referer, utc(&now))
+	if err != nil {
+		return fmt.Errorf("failed to add click event: %w", err)
+	}
+
+	return nil
+}
+
+// AddClickEvents records a batch of click events with multi-row INSERTs in
+// one transaction. Events without a CreatedAt are stamped with the current
+// time.
+func (r *SQLiteRepository) AddClickEvents(ctx context.Context, events []*ClickEvent) error {
+	return addClickEventsSQL(ctx, r.db, dialectSQLite, events)
+}
+
+// GetClickEvents returns click events for a URL
+func (r *SQLiteRepository) GetClickEvents(ctx context.Context, urlId int) ([]*ClickEvent, error) {
+	query := `
+		SELECT ` + clickEventColumns + `
+		FROM click_events
+		WHERE url_id = ?
+		ORDER BY created_at DESC, id DESC`
+
+	rows, err := r.db.QueryContext(ctx, query, urlId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get click events: %w", err)
+	}
+	defer rows.Close()
+
+	return scanClickEvents(rows)
+}
+
+// GetClickTimeSeries counts clicks per bucket, see RepositoryInterface.
+// SQLite has no time zone support, so only the clicks in range are read and
+// they are bucketed in Go.
+func (r *SQLiteRepository) GetClickTimeSeries(ctx context.Context, urlId int, opts TimeSeriesOptions) ([]*TimeSeriesBucket, error) {
+	if err := opts.Normalize(); err != nil {
+		return nil, err
+	}
+
+	// GroupBy is one of the column names checked by Normalize
+	group := "''"
+	if opts.GroupBy != "" {
+		group = "COALESCE(" + opts.GroupBy + ", '')"
+	}
+	query := `
+		SELECT created_at, ` + group + `
+		FROM click_events
+		WHERE url_id = ?1 AND created_at >= ?2 AND created_at < ?3 AND (?4 OR bot IS NULL)`
+
+	rows, err := r.db.QueryContext(ctx, query, urlId, utc(&opts.From), utc(&opts.To), opts.IncludeBots)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get click time series: %w", err)
+	}
+	defer rows.Close()
+
+	var events []*ClickEvent
+	for rows.Next() {
+		var createdAt time.Time
+		var value string
+		if err := rows.Scan(&createdAt, &value); err != nil {
+			return nil, fmt.Errorf("failed to scan click time series: %w", err)
+		}
+		// countTimeSeries only reads the field GroupBy names
+		events = append(events, &ClickEvent{CreatedAt: createdAt, Referer: value, Browser: value, Country: value})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return fillTimeSeries(opts, countTimeSeries(opts, events)), nil
+}
+
+// GetShortURLForOwner is GetShortURL restricted to links owned by ownerID
+func (r *SQLiteRepository) GetShortURLForOwner(ctx context.Context, code, ownerID string) (*URL, error) {
+	query := `
+		SELECT ` + urlColumns + `
+		FROM urls
+		WHERE short_code = ?1 AND owner_id = ?2`
+
+	url, err := scanURL(r.db.QueryRowContext(ctx, query, code, ownerID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get short URL: %w", err)
+	}
+
+	if url.IsExpired() {
+		return nil, ErrExpired
+	}
+
+	return url, nil
+}
+
+// DeleteShortURLForOwner deletes a link only if ownerID owns it
+func (r *SQLiteRepository) DeleteShortURLForOwner(ctx context.Context, code, ownerID string) error {
+	query := `DELETE FROM urls WHERE short_code = ?1 AND owner_id = ?2`
+	result, err := r.db.ExecContext(ctx, query, code, ownerID)
+	if err != nil {
+		return fmt.Errorf("failed to delete short URL: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// UpdateShortURL edits a link owned by ownerID and increments its version.
+// Expired links can be updated, e.g. to extend them, but not to expire
+// before they activate.
+func (r *SQLiteRepository) UpdateShortURL(ctx context.Context, code, ownerID string, version int, update URLUpdate) (*URL, error) {
+	query := `
+		UPDATE urls SET
+			original_url = COALESCE(?3, original_url),
+			short_code = COALESCE(?4, short_code),
+			expires_at = CASE WHEN ?5 THEN ?6 ELSE expires_at END,
+			utm_source = CASE WHEN ?3 IS NULL THEN utm_source ELSE ?8 END,
+			utm_medium = CASE WHEN ?3 IS NULL THEN utm_medium ELSE ?9 END,
+			utm_campaign = CASE WHEN ?3 IS NULL THEN utm_campaign ELSE ?10 END,
+			utm_term = CASE WHEN ?3 IS NULL THEN utm_term ELSE ?11 END,
+			utm_content = CASE WHEN ?3 IS NULL THEN utm_content ELSE ?12 END,
+			version = version + 1
+		WHERE short_code = ?1 AND owner_id = ?2 AND (?7 = 0 OR version = ?7)
+			AND (NOT ?5 OR ?6 IS NULL OR activates_at IS NULL OR activates_at < ?6)
+		RETURNING ` + urlColumns
+
+	utm := update.utm()
+	url, err := scanURL(r.db.QueryRowContext(ctx, query,
+		code, ownerID, update.OriginalURL, update.ShortCode, update.SetExpiresAt, utc(update.ExpiresAt), version,
+		nullString(utm.Source), nullString(utm.Medium), nullString(utm.Campaign), nullString(utm.Term), nullString(utm.Content)))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, updateMissError(ctx, r.db, `SELECT activates_at FROM urls WHERE short_code = ?1 AND owner_id = ?2`, code, ownerID, update)
+		}
+		if isUniqueViolation(err) {
+			return nil, fmt.Errorf("failed to update short URL: %w", ErrCodeTaken)
+		}
+		return nil, fmt.Errorf("failed to update short URL: %w", err)
+	}
+
+	return url, nil
+}
+
+// ExportURLs streams every link to fn, oldest first
+func (r *SQLiteRepository) ExportURLs(ctx context.Context, fn func(*URL) error) error {
+	return exportURLsSQL(ctx, r.db, fn)
+}
+
+// ExportClickEvents streams every click event to fn, oldest first
+func (r *SQLiteRepository) ExportClickEvents(ctx context.Context, fn func(string, *ClickEvent) error) error {
+	return exportClickEventsSQL(ctx, r.db, fn)
+}
+
+// ImportURLs stores exported links in one transaction
+func (r *SQLiteRepository) ImportURLs(ctx context.Context, urls []*URL, policy ConflictPolicy) ([]ImportOutcome, error) {
+	return importURLsSQL(ctx, r.db, dialectSQLite, urls, policy)
+}
+
+// CreateAPIKey stores a new key and sets its ID and CreatedAt
+func (r *SQLiteRepository) CreateAPIKey(ctx context.Context, key *APIKey) error {
+	query := `
+		INSERT INTO api_keys (name, owner_id, key_prefix, key_hash, created_at)
+		VALUES (?1, ?2, ?3, ?4, ?5)
+		RETURNING id`
+
+	key.CreatedAt = time.Now()
+	err := r.db.QueryRowContext(ctx, query, key.Name, key.OwnerID, key.Prefix, key.Hash, utc(&key.CreatedAt)).Scan(&key.ID)
+	if err != nil {
+		return fmt.Errorf("failed to create API key: %w", err)
+	}
+
+	return nil
+}
+
+// GetAPIKeyByHash looks a key up by its hash. Revoked keys are returned too;
+// callers must check IsRevoked.
+func (r *SQLiteRepository) GetAPIKeyByHash(ctx context.Context, hash string) (*APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE key_hash = ?1`
+
+	key, err := scanAPIKey(r.db.QueryRowContext(ctx, query, hash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+
+	return key, nil
+}
+
+// ListAPIKeys returns the keys of one owner, or of every owner when ownerID
+// is empty, oldest first
+func (r *SQLiteRepository) ListAPIKeys(ctx context.Context, ownerID string) ([]*APIKey, error) {
+	query := `
+		SELECT ` + apiKeyColumns + `
+		FROM api_keys
+		WHERE ?1 = '' OR owner_id = ?1
+		ORDER BY id`
+
+	rows, err := r.db.QueryContext(ctx, query, ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+	defer rows.Close()
+
+	return scanAPIKeys(rows)
+}
+
+// RevokeAPIKey marks a key as revoked. Revoking a revoked key keeps the
+// original revocation time.
+func (r *SQLiteRepository) RevokeAPIKey(ctx context.Context, id int) error {
+	query := `UPDATE api_keys SET revoked_at = COALESCE(revoked_at, ?1) WHERE id = ?2`
+
+	now := time.Now()
+	result, err := r.db.ExecContext(ctx, query, utc(&now), id)
+	if err != nil {
+		return fmt.Errorf("failed to revoke API key: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *SQLiteRepository) Close() error {
+	return r.db.Close()
+}
+
+// utc normalizes timestamps before they are written. SQLite stores them as
+// text, so every value must share one offset for comparisons to be correct;
+// PostgreSQL click times are TIMESTAMP columns, which drop the offset.
+func utc(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
+
+// sqlitePath extracts the database file path from a sqlite:// URL
+func sqlitePath(databaseURL string) string {
+	return strings.TrimPrefix(databaseURL, "sqlite://")
+}
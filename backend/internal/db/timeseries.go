@@ -0,0 +1,243 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Bucket sizes for GetClickTimeSeries
+const (
+	GranularityMinute = "minute"
+	GranularityHour   = "hour"
+	GranularityDay    = "day"
+	GranularityWeek   = "week"
+	GranularityMonth  = "month"
+)
+
+// Click columns a time series can be split by
+const (
+	TimeSeriesByReferer = "referer"
+	TimeSeriesByBrowser = "browser"
+	TimeSeriesByCountry = "country"
+)
+
+// MaxTimeSeriesBuckets bounds the number of buckets one query may return
+const MaxTimeSeriesBuckets = 5000
+
+// TimeSeriesOptions selects the clicks of one link and how they are counted
+type TimeSeriesOptions struct {
+	// From and To bound created_at (inclusive, exclusive). From is moved
+	// back to the start of its bucket, so the first bucket is complete.
+	From time.Time
+	To   time.Time
+	// Granularity is one of the Granularity* constants; empty means day
+	Granularity string
+	// Location is the time zone buckets are aligned to, so days start at
+	// local midnight; nil means UTC. It must be an IANA zone.
+	Location *time.Location
+	// GroupBy splits each bucket by one of the TimeSeriesBy* columns
+	GroupBy string
+	// IncludeBots counts clicks by crawlers and other tools too. Clicks
+	// recorded before migration 0012 have no bot stored and always count.
+	IncludeBots bool
+}
+
+// TimeSeriesBucket counts the clicks from Start until the next bucket
+type TimeSeriesBucket struct {
+	Start  time.Time      `json:"start"`
+	Clicks int            `json:"clicks"`
+	Groups map[string]int `json:"groups,omitempty"`
+}
+
+// Normalize applies defaults and validates the options
+func (o *TimeSeriesOptions) Normalize() error {
+	if o.Location == nil {
+		o.Location = time.UTC
+	}
+	// time.Local has no name the database would understand
+	if o.Location == time.Local || o.Location.String() == "Local" {
+		return fmt.Errorf("time zone must be an IANA name such as Europe/Berlin")
+	}
+
+	var step time.Duration
+	switch o.Granularity {
+	case "":
+		o.Granularity = GranularityDay
+		step = 24 * time.Hour
+	case GranularityMinute:
+		step = time.Minute
+	case GranularityHour:
+		step = time.Hour
+	case GranularityDay:
+		step = 24 * time.Hour
+	case GranularityWeek:
+		step = 7 * 24 * time.Hour
+	case GranularityMonth:
+		step = 28 * 24 * time.Hour
+	default:
+		return fmt.Errorf("invalid granularity %q, expected minute, hour, day, week or month", o.Granularity)
+	}
+
+	switch o.GroupBy {
+	case "", TimeSeriesByReferer, TimeSeriesByBrowser, TimeSeriesByCountry:
+	default:
+		return fmt.Errorf("%w %q, expected referer, browser or country", ErrInvalidGroupBy, o.GroupBy)
+	}
+
+	if o.From.IsZero() || o.To.IsZero() {
+		return fmt.Errorf("from and to are required")
+	}
+	if !o.From.Before(o.To) {
+		return fmt.Errorf("from must be before to")
+	}
+	o.From = o.truncate(o.From)
+	if o.To.Sub(o.From)/step >= MaxTimeSeriesBuckets {
+		return fmt.Errorf("the range has more than %d %s buckets, use a coarser granularity", MaxTimeSeriesBuckets, o.Granularity)
+	}
+
+	return nil
+}
+
+// truncate returns the start of the bucket containing t. Weeks start on
+// Monday, like date_trunc('week', ...) in PostgreSQL.
+func (o *TimeSeriesOptions) truncate(t time.Time) time.Time {
+	t = t.In(o.Location)
+	year, month, day := t.Date()
+
+	// Minutes and hours are cut off the instant rather than rebuilt with
+	// time.Date, which would pick one of the two hours repeated when
+	// daylight saving time ends
+	switch o.Granularity {
+	case GranularityMinute:
+		return t.Add(-time.Duration(t.Second())*time.Second - time.Duration(t.Nanosecond()))
+	case GranularityHour:
+		return t.Add(-time.Duration(t.Minute())*time.Minute - time.Duration(t.Second())*time.Second - time.Duration(t.Nanosecond()))
+	case GranularityWeek:
+		return time.Date(year, month, day-(int(t.Weekday())+6)%7, 0, 0, 0, 0, o.Location)
+	case GranularityMonth:
+		return time.Date(year, month, 1, 0, 0, 0, 0, o.Location)
+	default:
+		return time.Date(year, month, day, 0, 0, 0, 0, o.Location)
+	}
+}
+
+// next returns the start of the bucket after the one starting at start.
+// Days, weeks and months follow the calendar, so they may be 23 or 25 hours
+// long around daylight saving changes.
+func (o *TimeSeriesOptions) next(start time.Time) time.Time {
+	year, month, day := start.Date()
+
+	switch o.Granularity {
+	case GranularityMinute:
+		return start.Add(time.Minute)
+	case GranularityHour:
+		return start.Add(time.Hour)
+	case GranularityWeek:
+		return time.Date(year, month, day+7, 0, 0, 0, 0, o.Location)
+	case GranularityMonth:
+		return time.Date(year, month+1, 1, 0, 0, 0, 0, o.Location)
+	default:
+		return time.Date(year, month, day+1, 0, 0, 0, 0, o.Location)
+	}
+}
+
+// timeSeriesCount is the number of clicks in one bucket and group
+type timeSeriesCount struct {
+	start  time.Time
+	group  string
+	clicks int
+}
+
+// fillTimeSeries lays counts out over every bucket from From to To, with
+// zero clicks in buckets that had none. Each count is added to the bucket
+// its start falls in, so databases that resolve a repeated local hour
+// differently still land in a bucket. Starts are in opts.Location.
+func fillTimeSeries(opts TimeSeriesOptions, counts []timeSeriesCount) []*TimeSeriesBucket {
+	buckets := []*TimeSeriesBucket{}
+	for start := opts.From; start.Before(opts.To); start = opts.next(start) {
+		buckets = append(buckets, &TimeSeriesBucket{Start: start.In(opts.Location)})
+	}
+
+	for _, count := range counts {
+		i := sort.Search(len(buckets), func(i int) bool {
+			return buckets[i].Start.After(count.start)
+		}) - 1
+		if i < 0 {
+			continue
+		}
+
+		bucket := buckets[i]
+		bucket.Clicks += count.clicks
+		if opts.GroupBy != "" {
+			if bucket.Groups == nil {
+				bucket.Groups = make(map[string]int)
+			}
+			bucket.Groups[timeSeriesGroup(opts.GroupBy, count.group)] += count.clicks
+		}
+	}
+
+	return buckets
+}
+
+// timeSeriesGroup names a group, using the labels of the analytics summary
+// for clicks without a value
+func timeSeriesGroup(groupBy, value string) string {
+	if value != "" {
+		return value
+	}
+	switch groupBy {
+	case TimeSeriesByReferer:
+		return "Direct"
+	case TimeSeriesByBrowser:
+		return "Other"
+	default:
+		return "Unknown"
+	}
+}
+
+// groupValue returns the GroupBy column of event
+func (o *TimeSeriesOptions) groupValue(event *ClickEvent) string {
+	switch o.GroupBy {
+	case TimeSeriesByReferer:
+		return event.Referer
+	case TimeSeriesByBrowser:
+		return event.Browser
+	case TimeSeriesByCountry:
+		return event.Country
+	}
+	return ""
+}
+
+// countTimeSeries buckets events in Go, for databases without time zone
+// aware date_trunc. Events outside the range and, unless included, bots
+// are skipped.
+func countTimeSeries(opts TimeSeriesOptions, events []*ClickEvent) []timeSeriesCount {
+	type key struct {
+		start int64
+		group string
+	}
+	index := make(map[key]int)
+
+	var counts []timeSeriesCount
+	for _, event := range events {
+		if event.CreatedAt.Before(opts.From) || !event.CreatedAt.Before(opts.To) {
+			continue
+		}
+		if event.Bot != "" && !opts.IncludeBots {
+			continue
+		}
+
+		start := opts.truncate(event.CreatedAt)
+		k := key{start.Unix(), opts.groupValue(event)}
+		i, ok := index[k]
+		if !ok {
+			i = len(counts)
+			index[k] = i
+			counts = append(counts, timeSeriesCount{start: start, group: k.group})
+		}
+		counts[i].clicks++
+	}
+
+	return counts
+}
@@ -0,0 +1,198 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// ConflictPolicy decides what ImportURLs does with a link whose short code
+// is already taken
+type ConflictPolicy string
+
+const (
+	// ConflictSkip keeps the existing link and drops the imported one
+	ConflictSkip ConflictPolicy = "skip"
+	// ConflictOverwrite replaces the existing link, click history included
+	ConflictOverwrite ConflictPolicy = "overwrite"
+	// ConflictFail fails the import with ErrCodeTaken
+	ConflictFail ConflictPolicy = "fail"
+)
+
+// ParseConflictPolicy validates a policy name; empty means ConflictSkip
+func ParseConflictPolicy(name string) (ConflictPolicy, error) {
+	switch policy := ConflictPolicy(strings.ToLower(strings.TrimSpace(name))); policy {
+	case "":
+		return ConflictSkip, nil
+	case ConflictSkip, ConflictOverwrite, ConflictFail:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid conflict policy %q, expected skip, overwrite or fail", name)
+	}
+}
+
+// ImportOutcome is what ImportURLs did with one link
+type ImportOutcome int
+
+const (
+	ImportCreated ImportOutcome = iota
+	ImportOverwritten
+	ImportSkipped
+)
+
+// resolveImport applies the conflict policy to a batch of imported links.
+// A code repeated within the batch conflicts with its earlier link. It
+// returns one outcome per link and the codes to delete before inserting.
+func resolveImport(urls []*URL, taken map[string]bool, policy ConflictPolicy) ([]ImportOutcome, []string, error) {
+	outcomes := make([]ImportOutcome, len(urls))
+	seen := make(map[string]int, len(urls))
+	var replace []string
+
+	for i, url := range urls {
+		earlier, repeated := seen[url.ShortCode]
+		if !repeated && !taken[url.ShortCode] {
+			seen[url.ShortCode] = i
+			continue
+		}
+
+		switch policy {
+		case ConflictOverwrite:
+			if repeated {
+				// The later link wins; the earlier one is never stored
+				outcomes[i], outcomes[earlier] = outcomes[earlier], ImportSkipped
+			} else {
+				replace = append(replace, url.ShortCode)
+				outcomes[i] = ImportOverwritten
+			}
+			seen[url.ShortCode] = i
+		case ConflictFail:
+			return nil, nil, fmt.Errorf("failed to import short code %q: %w", url.ShortCode, ErrCodeTaken)
+		default:
+			outcomes[i] = ImportSkipped
+		}
+	}
+
+	return outcomes, replace, nil
+}
+
+// importURLsSQL implements ImportURLs for PostgreSQL and SQLite
+func importURLsSQL(ctx context.Context, db *sql.DB, dialect string, urls []*URL, policy ConflictPolicy) ([]ImportOutcome, error) {
+	if len(urls) == 0 {
+		return []ImportOutcome{}, nil
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	taken, err := takenCodes(ctx, tx, dialect, urls)
+	if err != nil {
+		return nil, err
+	}
+
+	outcomes, replace, err := resolveImport(urls, taken, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	// Deleting cascades to the replaced links' click events
+	for start := 0; start < len(replace); start += batchChunkSize {
+		chunk := replace[start:min(start+batchChunkSize, len(replace))]
+
+		placeholders := make([]string, len(chunk))
+		args := make([]any, len(chunk))
+		for i, code := range chunk {
+			placeholders[i] = placeholder(dialect, i+1)
+			args[i] = code
+		}
+
+		query := "DELETE FROM urls WHERE short_code IN (" + strings.Join(placeholders, ", ") + ")"
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return nil, fmt.Errorf("failed to replace short URLs: %w", err)
+		}
+	}
+
+	pending := make([]int, 0, len(urls))
+	for i, url := range urls {
+		url.ID = 0
+		if outcomes[i] != ImportSkipped {
+			pending = append(pending, i)
+		}
+	}
+
+	for start := 0; start < len(pending); start += batchChunkSize {
+		chunk := pending[start:min(start+batchChunkSize, len(pending))]
+		if err := insertURLChunk(ctx, tx, dialect, urls, chunk, true); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit import: %w", err)
+	}
+
+	return outcomes, nil
+}
+
+// exportURLsSQL calls fn for every link, oldest first, one row at a time
+func exportURLsSQL(ctx context.Context, db *sql.DB, fn func(*URL) error) error {
+	rows, err := db.QueryContext(ctx, "SELECT "+urlColumns+" FROM urls ORDER BY id")
+	if err != nil {
+		return fmt.Errorf("failed to export URLs: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		url, err := scanURL(rows)
+		if err != nil {
+			return fmt.Errorf("failed to scan URL: %w", err)
+		}
+		if err := fn(url); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return nil
+}
+
+// exportClickEventsSQL calls fn for every click event, oldest first, one row
+// at a time, with the short code of its link
+func exportClickEventsSQL(ctx context.Context, db *sql.DB, fn func(string, *ClickEvent) error) error {
+	query := `
+		SELECT u.short_code, e.id, e.url_id, e.ip_address, e.user_agent, e.referer, e.country, e.region, e.city,
+			e.browser, e.browser_version, e.os, e.os_version, e.device, e.bot, e.created_at
+		FROM click_events e
+		JOIN urls u ON u.id = e.url_id
+		ORDER BY e.id`
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("failed to export click events: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var code string
+		event, err := scanClickEvent(rows, &code)
+		if err != nil {
+			return fmt.Errorf("failed to scan click event: %w", err)
+		}
+
+		if err := fn(code, event); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return nil
+}
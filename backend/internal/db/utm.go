@@ -0,0 +1,170 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+// ErrInvalidGroupBy is returned when stats are grouped by something other
+// than a UTM parameter
+var ErrInvalidGroupBy = errors.New("invalid group_by")
+
+// UTM holds the campaign parameters of a link's target. Repositories read
+// them from the target whenever a link is stored or its target changes, so
+// the utm_* columns always agree with the URL.
+type UTM struct {
+	Source   string `json:"utm_source,omitempty" db:"utm_source"`
+	Medium   string `json:"utm_medium,omitempty" db:"utm_medium"`
+	Campaign string `json:"utm_campaign,omitempty" db:"utm_campaign"`
+	Term     string `json:"utm_term,omitempty" db:"utm_term"`
+	Content  string `json:"utm_content,omitempty" db:"utm_content"`
+}
+
+// UTM parameter names, which are also the names of their columns
+const (
+	UTMSource   = "utm_source"
+	UTMMedium   = "utm_medium"
+	UTMCampaign = "utm_campaign"
+	UTMTerm     = "utm_term"
+	UTMContent  = "utm_content"
+)
+
+// Params lists the parameters in the order they are usually written,
+// including empty ones
+func (u UTM) Params() [][2]string {
+	return [][2]string{
+		{UTMSource, u.Source},
+		{UTMMedium, u.Medium},
+		{UTMCampaign, u.Campaign},
+		{UTMTerm, u.Term},
+		{UTMContent, u.Content},
+	}
+}
+
+// Get returns the value of the UTM parameter name, or "" for other names
+func (u UTM) Get(name string) string {
+	for _, param := range u.Params() {
+		if param[0] == name {
+			return param[1]
+		}
+	}
+	return ""
+}
+
+// IsUTMParam reports whether name is one of the UTM parameters
+func IsUTMParam(name string) bool {
+	switch name {
+	case UTMSource, UTMMedium, UTMCampaign, UTMTerm, UTMContent:
+		return true
+	}
+	return false
+}
+
+// ParseUTM reads the UTM parameters of rawURL. A parameter given more than
+// once keeps its first value; an unparsable URL has none.
+func ParseUTM(rawURL string) UTM {
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return UTM{}
+	}
+
+	query := target.Query()
+	return UTM{
+		Source:   query.Get(UTMSource),
+		Medium:   query.Get(UTMMedium),
+		Campaign: query.Get(UTMCampaign),
+		Term:     query.Get(UTMTerm),
+		Content:  query.Get(UTMContent),
+	}
+}
+
+// utm returns the UTM parameters of the new target, if the update sets one
+func (u URLUpdate) utm() UTM {
+	if u.OriginalURL == nil {
+		return UTM{}
+	}
+	return ParseUTM(*u.OriginalURL)
+}
+
+// backfillUTM fills the UTM columns of the links that existed before
+// migration 0010 added them
+func backfillUTM(ctx context.Context, tx *sql.Tx, m *Migrator) error {
+	rows, err := tx.QueryContext(ctx, "SELECT id, original_url FROM urls WHERE original_url LIKE '%utm_%'")
+	if err != nil {
+		return fmt.Errorf("failed to read links: %w", err)
+	}
+
+	// The rows are read in full first, a transaction runs one query at a time
+	utms := make(map[int]UTM)
+	for rows.Next() {
+		var id int
+		var originalURL string
+		if err := rows.Scan(&id, &originalURL); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan link: %w", err)
+		}
+		if utm := ParseUTM(originalURL); utm != (UTM{}) {
+			utms[id] = utm
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read links: %w", err)
+	}
+
+	query := m.rebind("UPDATE urls SET utm_source = $1, utm_medium = $2, utm_campaign = $3, utm_term = $4, utm_content = $5 WHERE id = $6")
+	for id, utm := range utms {
+		if _, err := tx.ExecContext(ctx, query, nullString(utm.Source), nullString(utm.Medium), nullString(utm.Campaign), nullString(utm.Term), nullString(utm.Content), id); err != nil {
+			return fmt.Errorf("failed to backfill link %d: %w", id, err)
+		}
+	}
+
+	return nil
+}
+
+// CampaignStat sums up the links that share one value of a UTM parameter
+type CampaignStat struct {
+	Value  string `json:"value"`
+	Links  int    `json:"links"`
+	Clicks int    `json:"clicks"`
+}
+
+// campaignStatsSQL groups the links of ownerID, or of everyone if it is
+// empty, by the UTM column groupBy. Links without a value are left out.
+// Groups come with the most clicks first.
+func campaignStatsSQL(ctx context.Context, db *sql.DB, dialect, ownerID, groupBy string) ([]*CampaignStat, error) {
+	if !IsUTMParam(groupBy) {
+		return nil, fmt.Errorf("%w %q, expected a UTM parameter such as utm_campaign", ErrInvalidGroupBy, groupBy)
+	}
+
+	// groupBy is one of the column names checked above
+	query := fmt.Sprintf(`
+		SELECT %[1]s, COUNT(*), COALESCE(SUM(click_count), 0)
+		FROM urls
+		WHERE %[1]s IS NOT NULL AND (%[2]s = '' OR owner_id = %[2]s)
+		GROUP BY %[1]s
+		ORDER BY 3 DESC, 1`, groupBy, placeholder(dialect, 1))
+
+	rows, err := db.QueryContext(ctx, query, ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get campaign stats: %w", err)
+	}
+	defer rows.Close()
+
+	stats := []*CampaignStat{}
+	for rows.Next() {
+		stat := &CampaignStat{}
+		if err := rows.Scan(&stat.Value, &stat.Links, &stat.Clicks); err != nil {
+			return nil, fmt.Errorf("failed to scan campaign stats: %w", err)
+		}
+		stats = append(stats, stat)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get campaign stats: %w", err)
+	}
+
+	return stats, nil
+}
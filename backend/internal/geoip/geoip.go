@@ -0,0 +1,180 @@
+// Package geoip resolves client IP addresses to a country, region and city
+// with a local MaxMind-format database, so no lookup ever leaves the server.
+// The database file is watched and reloaded when it changes, e.g. after a
+// scheduled geoipupdate run.
+package geoip
+
+import (
+	"log"
+	"net/netip"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-url-shortener/internal/db"
+)
+
+// Location is where an IP address was resolved to. Fields the database does
+// not know are empty.
+type Location struct {
+	// Country is the ISO 3166-1 alpha-2 code, e.g. "DE"
+	Country string
+	// Region is the English name of the first subdivision, e.g. "Bavaria"
+	Region string
+	// City is the English name of the city, e.g. "Munich"
+	City string
+}
+
+// Lookup resolves ip, which may be IPv4 or IPv6. Addresses the database has
+// no entry for, such as private ones, give an empty Location.
+func (d *Database) Lookup(ip netip.Addr) (Location, error) {
+	record, err := d.lookup(ip)
+	if err != nil || record == nil {
+		return Location{}, err
+	}
+
+	var loc Location
+	if country, ok := record["country"].(map[string]any); ok {
+		loc.Country, _ = country["iso_code"].(string)
+	}
+	if subdivisions, ok := record["subdivisions"].([]any); ok && len(subdivisions) > 0 {
+		loc.Region = englishName(subdivisions[0])
+	}
+	loc.City = englishName(record["city"])
+
+	return loc, nil
+}
+
+// englishName returns names.en of a city or subdivision entry
+func englishName(entry any) string {
+	m, _ := entry.(map[string]any)
+	names, _ := m["names"].(map[string]any)
+	name, _ := names["en"].(string)
+	return name
+}
+
+// Resolver looks addresses up in the database at a path and reloads it
+// when the file changes. Lookups never wait on a reload; they use whichever
+// database was loaded last.
+type Resolver struct {
+	path string
+	db   atomic.Pointer[Database]
+
+	// modTime and size of the loaded file, to notice replacements
+	statMu  sync.Mutex
+	modTime time.Time
+	size    int64
+
+	stop   chan struct{}
+	done   sync.WaitGroup
+	closed sync.Once
+}
+
+// NewResolver loads the database at path. With a positive reloadInterval
+// the file is checked that often and reloaded if its size or modification
+// time changed; a file that fails to load is logged and the previous
+// database is kept.
+func NewResolver(path string, reloadInterval time.Duration) (*Resolver, error) {
+	r := &Resolver{
+		path: path,
+		stop: make(chan struct{}),
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	if reloadInterval > 0 {
+		r.done.Add(1)
+		go r.watch(reloadInterval)
+	}
+
+	return r, nil
+}
+
+// Reload loads the database file again, whether or not it changed
+func (r *Resolver) Reload() error {
+	r.statMu.Lock()
+	defer r.statMu.Unlock()
+
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return err
+	}
+	database, err := Open(r.path)
+	if err != nil {
+		return err
+	}
+
+	r.db.Store(database)
+	r.modTime = info.ModTime()
+	r.size = info.Size()
+
+	return nil
+}
+
+// changed reports whether the file differs from the one loaded
+func (r *Resolver) changed() bool {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		// Keep the loaded database while the file is being replaced
+		return false
+	}
+
+	r.statMu.Lock()
+	defer r.statMu.Unlock()
+	return !info.ModTime().Equal(r.modTime) || info.Size() != r.size
+}
+
+func (r *Resolver) watch(interval time.Duration) {
+	defer r.done.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !r.changed() {
+				continue
+			}
+			if err := r.Reload(); err != nil {
+				log.Printf("GeoIP database %s not reloaded: %v", r.path, err)
+				continue
+			}
+			log.Printf("GeoIP database %s reloaded", r.path)
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// Lookup resolves ip. Unparsable addresses and lookup errors give an empty
+// Location, since a missing location should not lose the click.
+func (r *Resolver) Lookup(ip string) Location {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return Location{}
+	}
+
+	loc, err := r.db.Load().Lookup(addr)
+	if err != nil {
+		log.Printf("GeoIP lookup for %s failed: %v", ip, err)
+	}
+	return loc
+}
+
+// Enrich sets the location of a click event from its IP address; it
+// satisfies clicks.Enricher
+func (r *Resolver) Enrich(event *db.ClickEvent) {
+	loc := r.Lookup(event.IPAddress)
+	event.Country = loc.Country
+	event.Region = loc.Region
+	event.City = loc.City
+}
+
+// Close stops watching the file
+func (r *Resolver) Close() {
+	r.closed.Do(func() { close(r.stop) })
+	r.done.Wait()
+}
@@ -0,0 +1,367 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+	"os"
+)
+
+// Reader for the MaxMind DB format (.mmdb), as used by GeoLite2 and GeoIP2:
+// a binary search tree over the bits of the address whose leaves point into
+// a data section of typed values, followed by a metadata map.
+// See https://maxmind.github.io/MaxMind-DB/
+
+// metadataMarker starts the metadata section at the end of the file
+var metadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// maxMetadataSize bounds how far from the end the marker is looked for
+const maxMetadataSize = 128 * 1024
+
+// dataSectionSeparator is the number of zero bytes between the search tree
+// and the data section
+const dataSectionSeparator = 16
+
+// maxDepth bounds nested maps, arrays and pointers in a corrupt file
+const maxDepth = 32
+
+// ErrInvalidDatabase is returned for files that are not valid MaxMind DBs
+var ErrInvalidDatabase = errors.New("invalid MaxMind database")
+
+// Database is an .mmdb file loaded into memory. It is safe for concurrent
+// use.
+type Database struct {
+	buf        []byte
+	data       []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	// ipv4Start is the node reached after the 96 zero bits that IPv4
+	// addresses are stored under in an IPv6 tree
+	ipv4Start uint
+
+	// Type is the database_type from the metadata, e.g. "GeoLite2-City"
+	Type string
+}
+
+// Open reads and checks the database at path
+func Open(path string) (*Database, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return newDatabase(buf)
+}
+
+func newDatabase(buf []byte) (*Database, error) {
+	start := 0
+	if len(buf) > maxMetadataSize {
+		start = len(buf) - maxMetadataSize
+	}
+	i := bytes.LastIndex(buf[start:], metadataMarker)
+	if i < 0 {
+		return nil, fmt.Errorf("%w: metadata not found", ErrInvalidDatabase)
+	}
+	metaStart := start + i + len(metadataMarker)
+
+	value, _, err := decoder{buf: buf[metaStart:]}.decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%w: metadata: %v", ErrInvalidDatabase, err)
+	}
+	meta, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: metadata is not a map", ErrInvalidDatabase)
+	}
+
+	d := &Database{buf: buf}
+	d.nodeCount, _ = toUint(meta["node_count"])
+	d.recordSize, _ = toUint(meta["record_size"])
+	d.ipVersion, _ = toUint(meta["ip_version"])
+	d.Type, _ = meta["database_type"].(string)
+
+	if major, _ := toUint(meta["binary_format_major_version"]); major != 2 {
+		return nil, fmt.Errorf("%w: unsupported format version %d", ErrInvalidDatabase, major)
+	}
+	switch d.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("%w: unsupported record size %d", ErrInvalidDatabase, d.recordSize)
+	}
+	if d.ipVersion != 4 && d.ipVersion != 6 {
+		return nil, fmt.Errorf("%w: unsupported IP version %d", ErrInvalidDatabase, d.ipVersion)
+	}
+
+	treeSize := d.nodeCount * d.recordSize / 4
+	if treeSize+dataSectionSeparator > uint(start+i) {
+		return nil, fmt.Errorf("%w: search tree is larger than the file", ErrInvalidDatabase)
+	}
+	d.data = buf[treeSize+dataSectionSeparator : start+i]
+
+	if d.ipVersion == 6 {
+		node := uint(0)
+		for n := 0; n < 96 && node < d.nodeCount; n++ {
+			node = d.record(node, 0)
+		}
+		d.ipv4Start = node
+	}
+
+	return d, nil
+}
+
+// lookup returns the record stored for ip, or nil if there is none
+func (d *Database) lookup(ip netip.Addr) (map[string]any, error) {
+	ip = ip.Unmap()
+
+	var addr []byte
+	node := uint(0)
+	switch {
+	case ip.Is4() && d.ipVersion == 6:
+		a := ip.As4()
+		addr, node = a[:], d.ipv4Start
+	case ip.Is4():
+		a := ip.As4()
+		addr = a[:]
+	case ip.Is6() && d.ipVersion == 6:
+		a := ip.As16()
+		addr = a[:]
+	default:
+		// IPv6 addresses are not in an IPv4 database
+		return nil, nil
+	}
+
+	for i := 0; i < len(addr)*8 && node < d.nodeCount; i++ {
+		bit := uint(addr[i/8]>>(7-i%8)) & 1
+		node = d.record(node, bit)
+	}
+
+	if node == d.nodeCount {
+		return nil, nil
+	}
+	if node < d.nodeCount {
+		return nil, fmt.Errorf("%w: search tree is deeper than the address", ErrInvalidDatabase)
+	}
+
+	offset := node - d.nodeCount - dataSectionSeparator
+	value, _, err := decoder{buf: d.data}.decode(offset, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDatabase, err)
+	}
+	record, _ := value.(map[string]any)
+	return record, nil
+}
+
+// record returns the left (bit 0) or right (bit 1) record of node
+func (d *Database) record(node, bit uint) uint {
+	b := d.buf[node*d.recordSize/4:]
+	switch d.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(b[bit*4:]))
+	}
+}
+
+// Data section types
+const (
+	typeExtended  = 0
+	typePointer   = 1
+	typeString    = 2
+	typeDouble    = 3
+	typeBytes     = 4
+	typeUint16    = 5
+	typeUint32    = 6
+	typeMap       = 7
+	typeInt32     = 8
+	typeUint64    = 9
+	typeUint128   = 10
+	typeArray     = 11
+	typeContainer = 12
+	typeEnd       = 13
+	typeBool      = 14
+	typeFloat     = 15
+)
+
+// decoder reads values from a data section. Pointers are offsets into buf.
+type decoder struct {
+	buf []byte
+}
+
+var errTruncated = errors.New("unexpected end of data")
+
+// decode reads the value at offset and returns it with the offset after it.
+// Maps become map[string]any, arrays []any, unsigned integers uint64 (or
+// []byte for uint128), and the rest their natural Go type.
+func (d decoder) decode(offset uint, depth int) (any, uint, error) {
+	if depth > maxDepth {
+		return nil, 0, errors.New("data is nested too deeply")
+	}
+	if offset >= uint(len(d.buf)) {
+		return nil, 0, errTruncated
+	}
+
+	ctrl := d.buf[offset]
+	offset++
+	typ := ctrl >> 5
+
+	if typ == typePointer {
+		pointer, next, err := d.pointer(ctrl, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := d.decode(pointer, depth+1)
+		return value, next, err
+	}
+
+	if typ == typeExtended {
+		if offset >= uint(len(d.buf)) {
+			return nil, 0, errTruncated
+		}
+		typ = 7 + d.buf[offset]
+		offset++
+	}
+
+	size, offset, err := d.size(ctrl, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch typ {
+	case typeMap:
+		m := make(map[string]any, size)
+		for i := uint(0); i < size; i++ {
+			key, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			name, ok := key.(string)
+			if !ok {
+				return nil, 0, errors.New("map key is not a string")
+			}
+			m[name], offset, err = d.decode(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+		return m, offset, nil
+	case typeArray:
+		a := make([]any, 0, min(size, 1024))
+		for i := uint(0); i < size; i++ {
+			var value any
+			value, offset, err = d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, value)
+		}
+		return a, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	}
+
+	if offset+size > uint(len(d.buf)) {
+		return nil, 0, errTruncated
+	}
+	b := d.buf[offset : offset+size]
+	offset += size
+
+	switch typ {
+	case typeString:
+		return string(b), offset, nil
+	case typeBytes, typeUint128:
+		return b, offset, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("double of size %d", size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), offset, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("float of size %d", size)
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(b)), offset, nil
+	case typeUint16, typeUint32, typeUint64:
+		if size > 8 {
+			return nil, 0, fmt.Errorf("integer of size %d", size)
+		}
+		var n uint64
+		for _, c := range b {
+			n = n<<8 | uint64(c)
+		}
+		return n, offset, nil
+	case typeInt32:
+		if size > 4 {
+			return nil, 0, fmt.Errorf("int32 of size %d", size)
+		}
+		var n uint32
+		for _, c := range b {
+			n = n<<8 | uint32(c)
+		}
+		return int32(n), offset, nil
+	default:
+		return nil, 0, fmt.Errorf("unexpected data type %d", typ)
+	}
+}
+
+// size reads the payload size that follows a control byte
+func (d decoder) size(ctrl byte, offset uint) (uint, uint, error) {
+	size := uint(ctrl & 0x1F)
+	if size < 29 {
+		return size, offset, nil
+	}
+
+	n := size - 28
+	if offset+n > uint(len(d.buf)) {
+		return 0, 0, errTruncated
+	}
+	var extra uint
+	for _, c := range d.buf[offset : offset+n] {
+		extra = extra<<8 | uint(c)
+	}
+	switch size {
+	case 29:
+		size = 29 + extra
+	case 30:
+		size = 285 + extra
+	default:
+		size = 65821 + extra
+	}
+	return size, offset + n, nil
+}
+
+// pointer reads the target of a pointer whose control byte is ctrl
+func (d decoder) pointer(ctrl byte, offset uint) (uint, uint, error) {
+	n := uint(ctrl>>3&0x3) + 1
+	if offset+n > uint(len(d.buf)) {
+		return 0, 0, errTruncated
+	}
+
+	var pointer uint
+	if n < 4 {
+		pointer = uint(ctrl & 0x7)
+	}
+	for _, c := range d.buf[offset : offset+n] {
+		pointer = pointer<<8 | uint(c)
+	}
+	switch n {
+	case 2:
+		pointer += 2048
+	case 3:
+		pointer += 526336
+	}
+	return pointer, offset + n, nil
+}
+
+// toUint converts a decoded unsigned integer
+func toUint(value any) (uint, bool) {
+	n, ok := value.(uint64)
+	return uint(n), ok
+}
@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"go-url-shortener/internal/auth"
+	"go-url-shortener/internal/db"
+)
+
+// KeyStore finds API keys by hash; db.RepositoryInterface satisfies it
+type KeyStore interface {
+	GetAPIKeyByHash(ctx context.Context, hash string) (*db.APIKey, error)
+}
+
+// Authenticate resolves an "Authorization: Bearer <key>" header to the key's
+// owner and stores it in the request context, see auth.FromContext. Requests
+// without the header continue anonymously; a malformed, unknown or revoked
+// key is rejected with 401 rather than silently treated as anonymous.
+func Authenticate(keys KeyStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get("Authorization")
+			if header == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			token, ok := auth.BearerToken(header)
+			if !ok {
+				unauthorized(w, r, "Authorization header must be \"Bearer <api key>\"")
+				return
+			}
+
+			key, err := keys.GetAPIKeyByHash(r.Context(), auth.HashKey(token))
+			if errors.Is(err, db.ErrNotFound) || (err == nil && key.IsRevoked()) {
+				unauthorized(w, r, "invalid or revoked API key")
+				return
+			}
+			if err != nil {
+				log.Printf("API key lookup failed [%s]: %v", RequestIDFromContext(r.Context()), err)
+				WriteError(w, r, http.StatusInternalServerError, CodeInternal, "internal server error")
+				return
+			}
+
+			ctx := auth.NewContext(r.Context(), &auth.Principal{KeyID: key.ID, OwnerID: key.OwnerID})
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequireAPIKey rejects requests that Authenticate left anonymous
+func RequireAPIKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth.FromContext(r.Context()) == nil {
+			unauthorized(w, r, "an API key is required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireAdmin guards the admin API with a static bearer token. An empty
+// token disables the admin API entirely.
+func RequireAdmin(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token == "" {
+				WriteError(w, r, http.StatusForbidden, CodeForbidden, "admin API is disabled (set ADMIN_TOKEN)")
+				return
+			}
+
+			given, ok := auth.BearerToken(r.Header.Get("Authorization"))
+			if !ok || !auth.TokenEqual(given, token) {
+				unauthorized(w, r, "invalid admin token")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func unauthorized(w http.ResponseWriter, r *http.Request, message string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+	WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, message)
+}
@@ -0,0 +1,173 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go-url-shortener/internal/auth"
+)
+
+// RateLimitOptions configures a RateLimiter
+type RateLimitOptions struct {
+	// PerMinute is the sustained number of requests a client may make per
+	// minute. Zero or less disables the limiter.
+	PerMinute int
+	// Burst is how many requests a client may make at once after being
+	// idle. Defaults to PerMinute.
+	Burst int
+	// IdleTTL is how long a client's bucket is kept after its last request.
+	// It is never shorter than the time an empty bucket takes to refill, so
+	// eviction cannot hand a throttled client a fresh burst.
+	IdleTTL time.Duration
+}
+
+// RateLimiter is a per-client token bucket limiter. Each client has a
+// bucket of Burst tokens that refills at PerMinute tokens per minute; every
+// request takes one token and is rejected while the bucket is empty.
+type RateLimiter struct {
+	opts    RateLimitOptions
+	rate    float64 // tokens per second
+	idleTTL time.Duration
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// rateLimitResult is the outcome of taking a token
+type rateLimitResult struct {
+	allowed    bool
+	remaining  int
+	reset      time.Duration // until the bucket is full again
+	retryAfter time.Duration // until the next token, when not allowed
+}
+
+func NewRateLimiter(opts RateLimitOptions) *RateLimiter {
+	if opts.Burst <= 0 {
+		opts.Burst = opts.PerMinute
+	}
+
+	l := &RateLimiter{
+		opts:      opts,
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+
+	if opts.PerMinute > 0 {
+		l.rate = float64(opts.PerMinute) / 60
+		l.idleTTL = max(opts.IdleTTL, l.refillTime(float64(opts.Burst)))
+	}
+
+	return l
+}
+
+// Limit throttles next per client. Authenticated requests are keyed by API
+// key and anonymous ones by client IP, so it must run after Authenticate.
+// Every response carries RateLimit-* headers; rejected requests get 429
+// with Retry-After.
+func (l *RateLimiter) Limit(next http.Handler) http.Handler {
+	if l.opts.PerMinute <= 0 {
+		return next
+	}
+
+	policy := strconv.Itoa(l.opts.Burst) + ";w=" + strconv.Itoa(ceilSeconds(l.refillTime(float64(l.opts.Burst))))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res := l.take(rateLimitKey(r), time.Now())
+
+		h := w.Header()
+		h.Set("RateLimit-Policy", policy)
+		h.Set("RateLimit-Limit", strconv.Itoa(l.opts.Burst))
+		h.Set("RateLimit-Remaining", strconv.Itoa(res.remaining))
+		h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.reset)))
+
+		if !res.allowed {
+			h.Set("Retry-After", strconv.Itoa(ceilSeconds(res.retryAfter)))
+			WriteError(w, r, http.StatusTooManyRequests, CodeRateLimited, "rate limit exceeded, retry later")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Len returns the number of client buckets currently held
+func (l *RateLimiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(time.Now())
+	return len(l.buckets)
+}
+
+// take refills the client's bucket for the time since its last request and
+// takes a token if one is available
+func (l *RateLimiter) take(key string, now time.Time) rateLimitResult {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) >= l.idleTTL {
+		l.sweep(now)
+	}
+
+	burst := float64(l.opts.Burst)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, updated: now}
+		l.buckets[key] = b
+	} else if elapsed := now.Sub(b.updated); elapsed > 0 {
+		b.tokens = math.Min(burst, b.tokens+elapsed.Seconds()*l.rate)
+		b.updated = now
+	}
+
+	var res rateLimitResult
+	if b.tokens >= 1 {
+		b.tokens--
+		res.allowed = true
+	} else {
+		res.retryAfter = l.refillTime(1 - b.tokens)
+	}
+
+	res.remaining = int(b.tokens)
+	res.reset = l.refillTime(burst - b.tokens)
+
+	return res
+}
+
+// sweep evicts buckets idle for longer than idleTTL. Such buckets are full,
+// so dropping them is indistinguishable from keeping them. Callers hold mu.
+func (l *RateLimiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if now.Sub(b.updated) >= l.idleTTL {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// refillTime is how long the bucket takes to gain tokens
+func (l *RateLimiter) refillTime(tokens float64) time.Duration {
+	return time.Duration(tokens / l.rate * float64(time.Second))
+}
+
+// rateLimitKey identifies the client: the API key when the request has one,
+// the client IP otherwise
+func rateLimitKey(r *http.Request) string {
+	if p := auth.FromContext(r.Context()); p != nil {
+		return "key:" + strconv.Itoa(p.KeyID)
+	}
+	return "ip:" + ClientIP(r)
+}
+
+// ceilSeconds rounds d up to whole seconds for the HTTP headers
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
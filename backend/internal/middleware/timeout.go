@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// DBTimeout bounds how long the database work for a single request may take.
+// The deadline is attached to the request context, which handlers pass to
+// the repository, so queries are cancelled once it passes or the client
+// disconnects. A non-positive timeout disables the limit.
+func DBTimeout(timeout time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if timeout <= 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,280 @@
+// Package qr renders QR codes for short links as PNG or SVG. Encoding is done
+// by go-qrcode; this package only draws the module matrix, so the quiet zone,
+// colors and output format are under our control.
+package qr
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strconv"
+	"strings"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// Format is an output image format
+type Format string
+
+const (
+	PNG Format = "png"
+	SVG Format = "svg"
+)
+
+// ContentType returns the MIME type of the format
+func (f Format) ContentType() string {
+	if f == SVG {
+		return "image/svg+xml"
+	}
+	return "image/png"
+}
+
+// Level is an error-correction level, from L (7% recovery) to H (30%)
+type Level string
+
+const (
+	LevelLow      Level = "L"
+	LevelMedium   Level = "M"
+	LevelQuartile Level = "Q"
+	LevelHigh     Level = "H"
+)
+
+// Limits for Options
+const (
+	DefaultSize   = 256
+	MinSize       = 32
+	MaxSize       = 2048
+	DefaultMargin = 4
+	MaxMargin     = 32
+)
+
+// ErrInvalidOptions is wrapped by every validation error from ParseFormat,
+// ParseLevel, ParseColor and Options.Validate
+var ErrInvalidOptions = errors.New("invalid QR code options")
+
+// Options controls how a code is drawn
+type Options struct {
+	// Size is the width and height of the image in pixels. For SVG it is the
+	// rendered size; the drawing itself scales freely.
+	Size int
+	// Level is the error-correction level
+	Level Level
+	// Margin is the quiet zone around the code, in modules
+	Margin int
+	// Foreground and Background are the module and quiet-zone colors
+	Foreground color.NRGBA
+	Background color.NRGBA
+}
+
+// DefaultOptions returns a black-on-white 256px code with medium error
+// correction and the standard 4-module quiet zone
+func DefaultOptions() Options {
+	return Options{
+		Size:       DefaultSize,
+		Level:      LevelMedium,
+		Margin:     DefaultMargin,
+		Foreground: color.NRGBA{A: 0xff},
+		Background: color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff},
+	}
+}
+
+// Validate checks the options are within the supported limits
+func (o Options) Validate() error {
+	if o.Size < MinSize || o.Size > MaxSize {
+		return fmt.Errorf("%w: size must be between %d and %d", ErrInvalidOptions, MinSize, MaxSize)
+	}
+	if o.Margin < 0 || o.Margin > MaxMargin {
+		return fmt.Errorf("%w: margin must be between 0 and %d", ErrInvalidOptions, MaxMargin)
+	}
+	if _, err := o.Level.recoveryLevel(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ParseFormat accepts "png" or "svg", case-insensitively
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case PNG, SVG:
+		return f, nil
+	}
+	return "", fmt.Errorf("%w: format must be png or svg", ErrInvalidOptions)
+}
+
+// ParseLevel accepts L, M, Q or H, or the names low, medium, quartile and
+// high, case-insensitively
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(s) {
+	case "l", "low":
+		return LevelLow, nil
+	case "m", "medium":
+		return LevelMedium, nil
+	case "q", "quartile":
+		return LevelQuartile, nil
+	case "h", "high":
+		return LevelHigh, nil
+	}
+	return "", fmt.Errorf("%w: level must be L, M, Q or H", ErrInvalidOptions)
+}
+
+// ParseColor reads a hex color: RGB, RRGGBB or RRGGBBAA, with or without a
+// leading #
+func ParseColor(s string) (color.NRGBA, error) {
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if len(hex) != 8 || err != nil {
+		return color.NRGBA{}, fmt.Errorf("%w: color %q must be hex RGB, RRGGBB or RRGGBBAA", ErrInvalidOptions, s)
+	}
+
+	return color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
+}
+
+func (l Level) recoveryLevel() (qrcode.RecoveryLevel, error) {
+	switch l {
+	case LevelLow:
+		return qrcode.Low, nil
+	case LevelMedium:
+		return qrcode.Medium, nil
+	case LevelQuartile:
+		return qrcode.High, nil
+	case LevelHigh:
+		return qrcode.Highest, nil
+	}
+	return 0, fmt.Errorf("%w: level must be L, M, Q or H", ErrInvalidOptions)
+}
+
+// Render encodes content and draws it in the given format
+func Render(content string, format Format, opts Options) ([]byte, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	modules, err := encode(content, opts.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case PNG:
+		return renderPNG(modules, opts)
+	case SVG:
+		return renderSVG(modules, opts), nil
+	}
+	return nil, fmt.Errorf("%w: format must be png or svg", ErrInvalidOptions)
+}
+
+// DataURI renders content as a PNG and returns it as a data: URI, ready for
+// an <img src>
+func DataURI(content string, opts Options) (string, error) {
+	data, err := Render(content, PNG, opts)
+	if err != nil {
+		return "", err
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// encode returns the module matrix without a quiet zone; modules[y][x] is
+// true for a dark module
+func encode(content string, level Level) ([][]bool, error) {
+	recovery, err := level.recoveryLevel()
+	if err != nil {
+		return nil, err
+	}
+
+	code, err := qrcode.New(content, recovery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode QR code: %w", err)
+	}
+	code.DisableBorder = true
+
+	return code.Bitmap(), nil
+}
+
+// layout fits the matrix plus margin into size pixels. It returns the pixels
+// per module and the offset that centers the code; images too small for one
+// pixel per module grow to fit.
+func layout(n int, opts Options) (size, scale, offset int) {
+	total := n + 2*opts.Margin
+	size = opts.Size
+	if size < total {
+		size = total
+	}
+	scale = size / total
+	offset = (size-scale*total)/2 + scale*opts.Margin
+	return size, scale, offset
+}
+
+func renderPNG(modules [][]bool, opts Options) ([]byte, error) {
+	size, scale, offset := layout(len(modules), opts)
+
+	img := image.NewPaletted(image.Rect(0, 0, size, size), color.Palette{opts.Background, opts.Foreground})
+	for y, row := range modules {
+		for x, dark := range row {
+			if !dark {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				start := (offset+y*scale+dy)*img.Stride + offset + x*scale
+				for dx := 0; dx < scale; dx++ {
+					img.Pix[start+dx] = 1
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := encoder.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode PNG: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// renderSVG draws one path with a horizontal run per row segment of dark
+// modules. The viewBox is in modules, so the code stays sharp at any size.
+func renderSVG(modules [][]bool, opts Options) []byte {
+	n := len(modules)
+	total := n + 2*opts.Margin
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		opts.Size, opts.Size, total, total)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d"%s/>`, total, total, svgFill(opts.Background))
+
+	buf.WriteString(`<path d="`)
+	for y, row := range modules {
+		for x := 0; x < n; x++ {
+			if !row[x] {
+				continue
+			}
+			run := 1
+			for x+run < n && row[x+run] {
+				run++
+			}
+			fmt.Fprintf(&buf, "M%d %dh%dv1h-%dz", x+opts.Margin, y+opts.Margin, run, run)
+			x += run - 1
+		}
+	}
+	fmt.Fprintf(&buf, `"%s/></svg>`, svgFill(opts.Foreground))
+
+	return buf.Bytes()
+}
+
+func svgFill(c color.NRGBA) string {
+	fill := fmt.Sprintf(` fill="#%02x%02x%02x"`, c.R, c.G, c.B)
+	if c.A != 0xff {
+		fill += fmt.Sprintf(` fill-opacity="%.3g"`, float64(c.A)/0xff)
+	}
+	return fill
+}
@@ -0,0 +1,274 @@
+package transfer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// csvColumns is the CSV header, in order
+var csvColumns = []string{
+	"type", "short_code", "created_at",
+	"original_url", "activates_at", "expires_at", "click_count", "last_clicked", "owner_id", "password_hash", "max_clicks", "redirect_type", "force_preview", "query_passthrough", "path_passthrough",
+	"ip_address", "user_agent", "referer", "country", "region", "city",
+	"browser", "browser_version", "os", "os_version", "device", "bot",
+}
+
+// recordWriter encodes records one at a time
+type recordWriter interface {
+	Write(rec *Record) error
+	Flush() error
+}
+
+// recordReader decodes records one at a time, returning io.EOF at the end
+type recordReader interface {
+	Read() (*Record, error)
+}
+
+func newWriter(w io.Writer, format Format) (recordWriter, error) {
+	if format == CSV {
+		out := csv.NewWriter(w)
+		if err := out.Write(csvColumns); err != nil {
+			return nil, err
+		}
+		return &csvWriter{out: out}, nil
+	}
+
+	buf := bufio.NewWriter(w)
+	return &ndjsonWriter{buf: buf, enc: json.NewEncoder(buf)}, nil
+}
+
+func newReader(r io.Reader, format Format) (recordReader, error) {
+	if format == CSV {
+		return newCSVReader(r)
+	}
+	return &ndjsonReader{dec: json.NewDecoder(r)}, nil
+}
+
+type ndjsonWriter struct {
+	buf *bufio.Writer
+	enc *json.Encoder
+}
+
+func (w *ndjsonWriter) Write(rec *Record) error {
+	// Encode terminates each value with a newline
+	return w.enc.Encode(rec)
+}
+
+func (w *ndjsonWriter) Flush() error {
+	return w.buf.Flush()
+}
+
+type ndjsonReader struct {
+	dec *json.Decoder
+}
+
+func (r *ndjsonReader) Read() (*Record, error) {
+	rec := &Record{}
+	if err := r.dec.Decode(rec); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.EOF
+		}
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		var timeErr *time.ParseError
+		if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) || errors.As(err, &timeErr) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidRecord, err)
+		}
+		return nil, err
+	}
+	return rec, nil
+}
+
+type csvWriter struct {
+	out *csv.Writer
+}
+
+func (w *csvWriter) Write(rec *Record) error {
+	clickCount, maxClicks := "", ""
+	if rec.Type == TypeURL {
+		clickCount = strconv.Itoa(rec.ClickCount)
+	}
+	if rec.MaxClicks != 0 {
+		maxClicks = strconv.Itoa(rec.MaxClicks)
+	}
+
+	return w.out.Write([]string{
+		rec.Type, rec.ShortCode, formatTime(&rec.CreatedAt),
+		rec.OriginalURL, formatTime(rec.ActivatesAt), formatTime(rec.ExpiresAt), clickCount, formatTime(rec.LastClicked), rec.OwnerID, rec.PasswordHash, maxClicks, rec.RedirectType, formatBool(rec.ForcePreview), rec.QueryPassthrough, formatBool(rec.PathPassthrough),
+		rec.IPAddress, rec.UserAgent, rec.Referer, rec.Country, rec.Region, rec.City,
+		rec.Browser, rec.BrowserVersion, rec.OS, rec.OSVersion, rec.Device, rec.Bot,
+	})
+}
+
+func (w *csvWriter) Flush() error {
+	w.out.Flush()
+	return w.out.Error()
+}
+
+type csvReader struct {
+	in      *csv.Reader
+	columns map[string]int
+}
+
+func newCSVReader(r io.Reader) (*csvReader, error) {
+	in := csv.NewReader(r)
+	in.FieldsPerRecord = -1
+	in.ReuseRecord = true
+
+	header, err := in.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%w: CSV is empty", ErrInvalidRecord)
+	}
+	if err != nil {
+		return nil, csvError(err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		// Spreadsheets often save UTF-8 with a byte order mark
+		name = strings.TrimPrefix(name, "\ufeff")
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"type", "short_code", "created_at"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("%w: CSV header must have a %q column", ErrInvalidRecord, required)
+		}
+	}
+
+	return &csvReader{in: in, columns: columns}, nil
+}
+
+func (r *csvReader) Read() (*Record, error) {
+	row, err := r.in.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, csvError(err)
+	}
+
+	field := func(name string) string {
+		if i, ok := r.columns[name]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+
+	rec := &Record{
+		Type:           field("type"),
+		ShortCode:      field("short_code"),
+		OriginalURL:    field("original_url"),
+		OwnerID:        field("owner_id"),
+		PasswordHash:   field("password_hash"),
+		RedirectType:   field("redirect_type"),
+		IPAddress:      field("ip_address"),
+		UserAgent:      field("user_agent"),
+		Referer:        field("referer"),
+		Country:        field("country"),
+		Region:         field("region"),
+		City:           field("city"),
+		Browser:        field("browser"),
+		BrowserVersion: field("browser_version"),
+		OS:             field("os"),
+		OSVersion:      field("os_version"),
+		Device:         field("device"),
+		Bot:            field("bot"),
+	}
+
+	createdAt, err := parseTime("created_at", field("created_at"))
+	if err != nil {
+		return nil, err
+	}
+	if createdAt != nil {
+		rec.CreatedAt = *createdAt
+	}
+	if rec.ActivatesAt, err = parseTime("activates_at", field("activates_at")); err != nil {
+		return nil, err
+	}
+	if rec.ExpiresAt, err = parseTime("expires_at", field("expires_at")); err != nil {
+		return nil, err
+	}
+	if rec.LastClicked, err = parseTime("last_clicked", field("last_clicked")); err != nil {
+		return nil, err
+	}
+
+	if rec.ClickCount, err = parseInt("click_count", field("click_count")); err != nil {
+		return nil, err
+	}
+	if rec.MaxClicks, err = parseInt("max_clicks", field("max_clicks")); err != nil {
+		return nil, err
+	}
+	if rec.ForcePreview, err = parseBool("force_preview", field("force_preview")); err != nil {
+		return nil, err
+	}
+	rec.QueryPassthrough = field("query_passthrough")
+	if rec.PathPassthrough, err = parseBool("path_passthrough", field("path_passthrough")); err != nil {
+		return nil, err
+	}
+
+	return rec, nil
+}
+
+// csvError marks malformed CSV as invalid input and passes read errors on
+func csvError(err error) error {
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return fmt.Errorf("%w: %v", ErrInvalidRecord, err)
+	}
+	return err
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func parseTime(column, value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid %s, expected RFC 3339 timestamp", ErrInvalidRecord, column)
+	}
+	return &t, nil
+}
+
+func parseInt(column, value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid %s %q", ErrInvalidRecord, column, value)
+	}
+	return n, nil
+}
+
+// formatBool writes false as an empty field, like the other unset columns
+func formatBool(b bool) string {
+	if !b {
+		return ""
+	}
+	return "true"
+}
+
+func parseBool(column, value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%w: invalid %s %q", ErrInvalidRecord, column, value)
+	}
+	return b, nil
+}
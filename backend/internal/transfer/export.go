@@ -0,0 +1,49 @@
+package transfer
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"go-url-shortener/internal/db"
+)
+
+// ExportSummary counts the records an export wrote
+type ExportSummary struct {
+	URLs   int `json:"urls"`
+	Clicks int `json:"clicks"`
+}
+
+// Export writes every link, then every click event, to w. Rows are streamed
+// from the repository and encoded one at a time, so memory use does not grow
+// with the size of the database.
+func Export(ctx context.Context, repo db.RepositoryInterface, w io.Writer, format Format) (*ExportSummary, error) {
+	out, err := newWriter(w, format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write export: %w", err)
+	}
+
+	summary := &ExportSummary{}
+
+	err = repo.ExportURLs(ctx, func(url *db.URL) error {
+		summary.URLs++
+		return out.Write(urlRecord(url))
+	})
+	if err != nil {
+		return summary, fmt.Errorf("failed to export links: %w", err)
+	}
+
+	err = repo.ExportClickEvents(ctx, func(code string, event *db.ClickEvent) error {
+		summary.Clicks++
+		return out.Write(clickRecord(code, event))
+	})
+	if err != nil {
+		return summary, fmt.Errorf("failed to export clicks: %w", err)
+	}
+
+	if err := out.Flush(); err != nil {
+		return summary, fmt.Errorf("failed to write export: %w", err)
+	}
+
+	return summary, nil
+}
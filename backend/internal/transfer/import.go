@@ -0,0 +1,275 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"go-url-shortener/internal/db"
+)
+
+// ErrInvalidRecord means the input could not be parsed or a record is
+// missing a required field
+var ErrInvalidRecord = errors.New("invalid import record")
+
+// importBatchSize is how many links or clicks are written per transaction
+const importBatchSize = 500
+
+// maxReportedConflicts caps Report.Conflicts
+const maxReportedConflicts = 100
+
+// Options configure Import
+type Options struct {
+	Format   Format
+	Conflict db.ConflictPolicy
+	// DryRun reads and checks the input and reports what would be imported
+	// without writing anything
+	DryRun bool
+}
+
+// Report summarizes an import. Conflicts lists the first short codes that
+// were already taken, whatever the policy did with them.
+type Report struct {
+	DryRun          bool              `json:"dry_run"`
+	Conflict        db.ConflictPolicy `json:"conflict"`
+	Records         int               `json:"records"`
+	URLsCreated     int               `json:"urls_created"`
+	URLsOverwritten int               `json:"urls_overwritten"`
+	URLsSkipped     int               `json:"urls_skipped"`
+	ClicksImported  int               `json:"clicks_imported"`
+	ClicksSkipped   int               `json:"clicks_skipped"`
+	Conflicts       []string          `json:"conflicts"`
+}
+
+// Import reads records from r and stores them, keeping short codes,
+// timestamps, expiry, owners and click counts. Links are written in batches,
+// each in its own transaction, so an error leaves the batches before it in
+// place; the returned report counts what was written up to that point.
+//
+// Clicks are attached to the link with the same short code imported earlier
+// in the input. Clicks of links that were skipped, or that are not in the
+// input, are counted as skipped. A link that overwrites an existing one
+// replaces its click history.
+//
+// Under db.ConflictFail the first taken short code stops the import with
+// db.ErrCodeTaken; a dry run stops at the same place.
+func Import(ctx context.Context, repo db.RepositoryInterface, r io.Reader, opts Options) (*Report, error) {
+	if opts.Conflict == "" {
+		opts.Conflict = db.ConflictSkip
+	}
+
+	imp := &importer{
+		repo:    repo,
+		opts:    opts,
+		report:  &Report{DryRun: opts.DryRun, Conflict: opts.Conflict, Conflicts: []string{}},
+		ids:     make(map[string]int),
+		pending: make(map[string]bool),
+	}
+
+	in, err := newReader(r, opts.Format)
+	if err != nil {
+		return imp.report, err
+	}
+
+	for {
+		rec, err := in.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return imp.report, fmt.Errorf("record %d: %w", imp.report.Records+1, err)
+		}
+		imp.report.Records++
+
+		if err := rec.validate(); err != nil {
+			return imp.report, fmt.Errorf("record %d: %w", imp.report.Records, err)
+		}
+
+		if rec.Type == TypeURL {
+			err = imp.addURL(ctx, rec.url())
+		} else {
+			err = imp.addClick(ctx, rec)
+		}
+		if err != nil {
+			return imp.report, err
+		}
+	}
+
+	if err := imp.flushURLs(ctx); err != nil {
+		return imp.report, err
+	}
+	if err := imp.flushClicks(ctx); err != nil {
+		return imp.report, err
+	}
+
+	return imp.report, nil
+}
+
+// importer holds the state of one Import
+type importer struct {
+	repo   db.RepositoryInterface
+	opts   Options
+	report *Report
+
+	// ids maps the codes imported so far to their new link ids
+	ids map[string]int
+
+	// Buffered writes, and the codes of the buffered links
+	urls    []*db.URL
+	pending map[string]bool
+	clicks  []*db.ClickEvent
+}
+
+func (imp *importer) addURL(ctx context.Context, url *db.URL) error {
+	if imp.opts.DryRun {
+		return imp.checkURL(ctx, url)
+	}
+
+	// A repeated code resolves against the earlier link once it is stored
+	if imp.pending[url.ShortCode] {
+		if err := imp.flushURLs(ctx); err != nil {
+			return err
+		}
+	}
+
+	imp.urls = append(imp.urls, url)
+	imp.pending[url.ShortCode] = true
+	if len(imp.urls) >= importBatchSize {
+		return imp.flushURLs(ctx)
+	}
+
+	return nil
+}
+
+func (imp *importer) addClick(ctx context.Context, rec *Record) error {
+	// The click's link may still be buffered
+	if err := imp.flushURLs(ctx); err != nil {
+		return err
+	}
+
+	id, ok := imp.ids[rec.ShortCode]
+	if !ok {
+		imp.report.ClicksSkipped++
+		return nil
+	}
+	if imp.opts.DryRun {
+		imp.report.ClicksImported++
+		return nil
+	}
+
+	imp.clicks = append(imp.clicks, &db.ClickEvent{
+		URLId:          id,
+		IPAddress:      rec.IPAddress,
+		UserAgent:      rec.UserAgent,
+		Referer:        rec.Referer,
+		Country:        rec.Country,
+		Region:         rec.Region,
+		City:           rec.City,
+		CreatedAt:      rec.CreatedAt,
+		Browser:        rec.Browser,
+		BrowserVersion: rec.BrowserVersion,
+		OS:             rec.OS,
+		OSVersion:      rec.OSVersion,
+		Device:         rec.Device,
+		Bot:            rec.Bot,
+	})
+	if len(imp.clicks) >= importBatchSize {
+		return imp.flushClicks(ctx)
+	}
+
+	return nil
+}
+
+// checkURL works out what importing url would do, without writing it
+func (imp *importer) checkURL(ctx context.Context, url *db.URL) error {
+	_, taken := imp.ids[url.ShortCode]
+	if !taken {
+		_, err := imp.repo.GetShortURL(ctx, url.ShortCode)
+		switch {
+		case err == nil, errors.Is(err, db.ErrExpired):
+			taken = true
+		case !errors.Is(err, db.ErrNotFound):
+			return fmt.Errorf("failed to check short code %q: %w", url.ShortCode, err)
+		}
+	}
+
+	outcome := db.ImportCreated
+	if taken {
+		switch imp.opts.Conflict {
+		case db.ConflictOverwrite:
+			outcome = db.ImportOverwritten
+		case db.ConflictFail:
+			imp.conflict(url.ShortCode)
+			return fmt.Errorf("failed to import short code %q: %w", url.ShortCode, db.ErrCodeTaken)
+		default:
+			outcome = db.ImportSkipped
+		}
+	}
+
+	imp.record(url, outcome)
+	return nil
+}
+
+func (imp *importer) flushURLs(ctx context.Context) error {
+	if len(imp.urls) == 0 {
+		return nil
+	}
+
+	// Buffered clicks may belong to a link this batch overwrites
+	if err := imp.flushClicks(ctx); err != nil {
+		return err
+	}
+
+	outcomes, err := imp.repo.ImportURLs(ctx, imp.urls, imp.opts.Conflict)
+	if err != nil {
+		return err
+	}
+
+	for i, url := range imp.urls {
+		imp.record(url, outcomes[i])
+	}
+
+	imp.urls = imp.urls[:0]
+	clear(imp.pending)
+
+	return nil
+}
+
+func (imp *importer) flushClicks(ctx context.Context) error {
+	if len(imp.clicks) == 0 {
+		return nil
+	}
+
+	if err := imp.repo.AddClickEvents(ctx, imp.clicks); err != nil {
+		return fmt.Errorf("failed to import clicks: %w", err)
+	}
+
+	imp.report.ClicksImported += len(imp.clicks)
+	imp.clicks = imp.clicks[:0]
+
+	return nil
+}
+
+// record counts the outcome for url and remembers where its clicks go
+func (imp *importer) record(url *db.URL, outcome db.ImportOutcome) {
+	switch outcome {
+	case db.ImportCreated:
+		imp.report.URLsCreated++
+	case db.ImportOverwritten:
+		imp.report.URLsOverwritten++
+		imp.conflict(url.ShortCode)
+	case db.ImportSkipped:
+		imp.report.URLsSkipped++
+		imp.conflict(url.ShortCode)
+		return
+	}
+
+	imp.ids[url.ShortCode] = url.ID
+}
+
+func (imp *importer) conflict(code string) {
+	if len(imp.report.Conflicts) < maxReportedConflicts {
+		imp.report.Conflicts = append(imp.report.Conflicts, code)
+	}
+}
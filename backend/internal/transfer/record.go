@@ -0,0 +1,206 @@
+// Package transfer moves links and their click history in and out of a
+// repository as a stream of records, in NDJSON or CSV. An export lists every
+// link before any click, and clicks refer to their link by short code, so a
+// file can be imported into another database in one pass.
+package transfer
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+	"time"
+
+	"go-url-shortener/internal/db"
+)
+
+// Format is a serialization of the record stream
+type Format string
+
+const (
+	// NDJSON writes one JSON object per line
+	NDJSON Format = "ndjson"
+	// CSV writes a header row and one row per record, with the union of
+	// the link and click columns
+	CSV Format = "csv"
+)
+
+// ParseFormat validates a format name; empty means NDJSON
+func ParseFormat(name string) (Format, error) {
+	switch format := Format(strings.ToLower(strings.TrimSpace(name))); format {
+	case "":
+		return NDJSON, nil
+	case NDJSON, CSV:
+		return format, nil
+	default:
+		return "", fmt.Errorf("invalid format %q, expected ndjson or csv", name)
+	}
+}
+
+// FormatForContentType picks the format of a request body, or "" if the
+// media type is not one of ours
+func FormatForContentType(contentType string) Format {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/x-ndjson", "application/jsonl", "application/json":
+		return NDJSON
+	case "text/csv":
+		return CSV
+	default:
+		return ""
+	}
+}
+
+// ContentType returns the MIME type of the format
+func (f Format) ContentType() string {
+	if f == CSV {
+		return "text/csv; charset=utf-8"
+	}
+	return "application/x-ndjson"
+}
+
+// Record types
+const (
+	TypeURL   = "url"
+	TypeClick = "click"
+)
+
+// Record is one line of an export: a link or a click on one. Fields that do
+// not apply to the record's type are left empty. Protected links carry their
+// password hash, so they stay protected after an import.
+type Record struct {
+	Type      string    `json:"type"`
+	ShortCode string    `json:"short_code"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Link fields
+	OriginalURL      string     `json:"original_url,omitempty"`
+	ActivatesAt      *time.Time `json:"activates_at,omitempty"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"`
+	ClickCount       int        `json:"click_count,omitempty"`
+	LastClicked      *time.Time `json:"last_clicked,omitempty"`
+	OwnerID          string     `json:"owner_id,omitempty"`
+	PasswordHash     string     `json:"password_hash,omitempty"`
+	MaxClicks        int        `json:"max_clicks,omitempty"`
+	RedirectType     string     `json:"redirect_type,omitempty"`
+	ForcePreview     bool       `json:"force_preview,omitempty"`
+	QueryPassthrough string     `json:"query_passthrough,omitempty"`
+	PathPassthrough  bool       `json:"path_passthrough,omitempty"`
+
+	// Click fields
+	IPAddress      string `json:"ip_address,omitempty"`
+	UserAgent      string `json:"user_agent,omitempty"`
+	Referer        string `json:"referer,omitempty"`
+	Country        string `json:"country,omitempty"`
+	Region         string `json:"region,omitempty"`
+	City           string `json:"city,omitempty"`
+	Browser        string `json:"browser,omitempty"`
+	BrowserVersion string `json:"browser_version,omitempty"`
+	OS             string `json:"os,omitempty"`
+	OSVersion      string `json:"os_version,omitempty"`
+	Device         string `json:"device,omitempty"`
+	Bot            string `json:"bot,omitempty"`
+}
+
+// urlRecord describes a link
+func urlRecord(url *db.URL) *Record {
+	return &Record{
+		Type:             TypeURL,
+		ShortCode:        url.ShortCode,
+		CreatedAt:        url.CreatedAt.UTC(),
+		OriginalURL:      url.OriginalURL,
+		ActivatesAt:      utc(url.ActivatesAt),
+		ExpiresAt:        utc(url.ExpiresAt),
+		ClickCount:       url.ClickCount,
+		LastClicked:      utc(url.LastClicked),
+		OwnerID:          url.OwnerID,
+		PasswordHash:     url.PasswordHash,
+		MaxClicks:        url.MaxClicks,
+		RedirectType:     url.RedirectType,
+		ForcePreview:     url.ForcePreview,
+		QueryPassthrough: url.QueryPassthrough,
+		PathPassthrough:  url.PathPassthrough,
+	}
+}
+
+// clickRecord describes a click on the link with the given code
+func clickRecord(code string, event *db.ClickEvent) *Record {
+	return &Record{
+		Type:           TypeClick,
+		ShortCode:      code,
+		CreatedAt:      event.CreatedAt.UTC(),
+		IPAddress:      event.IPAddress,
+		UserAgent:      event.UserAgent,
+		Referer:        event.Referer,
+		Country:        event.Country,
+		Region:         event.Region,
+		City:           event.City,
+		Browser:        event.Browser,
+		BrowserVersion: event.BrowserVersion,
+		OS:             event.OS,
+		OSVersion:      event.OSVersion,
+		Device:         event.Device,
+		Bot:            event.Bot,
+	}
+}
+
+// url returns the link a TypeURL record describes
+func (rec *Record) url() *db.URL {
+	return &db.URL{
+		ShortCode:        rec.ShortCode,
+		OriginalURL:      rec.OriginalURL,
+		CreatedAt:        rec.CreatedAt,
+		ActivatesAt:      rec.ActivatesAt,
+		ExpiresAt:        rec.ExpiresAt,
+		ClickCount:       rec.ClickCount,
+		LastClicked:      rec.LastClicked,
+		OwnerID:          rec.OwnerID,
+		PasswordHash:     rec.PasswordHash,
+		MaxClicks:        rec.MaxClicks,
+		RedirectType:     rec.RedirectType,
+		ForcePreview:     rec.ForcePreview,
+		QueryPassthrough: rec.QueryPassthrough,
+		PathPassthrough:  rec.PathPassthrough,
+	}
+}
+
+// validate checks the fields an import needs
+func (rec *Record) validate() error {
+	if rec.ShortCode == "" {
+		return fmt.Errorf("%w: short_code is required", ErrInvalidRecord)
+	}
+	if rec.CreatedAt.IsZero() {
+		return fmt.Errorf("%w: created_at is required", ErrInvalidRecord)
+	}
+
+	switch rec.Type {
+	case TypeURL:
+		if rec.OriginalURL == "" {
+			return fmt.Errorf("%w: original_url is required", ErrInvalidRecord)
+		}
+		if rec.ClickCount < 0 {
+			return fmt.Errorf("%w: click_count must not be negative", ErrInvalidRecord)
+		}
+		if rec.MaxClicks < 0 {
+			return fmt.Errorf("%w: max_clicks must not be negative", ErrInvalidRecord)
+		}
+		if rec.RedirectType != "" && !db.IsValidRedirectType(rec.RedirectType) {
+			return fmt.Errorf("%w: unknown redirect_type %q", ErrInvalidRecord, rec.RedirectType)
+		}
+		if rec.QueryPassthrough != "" && !db.IsValidQueryPassthrough(rec.QueryPassthrough) {
+			return fmt.Errorf("%w: unknown query_passthrough %q", ErrInvalidRecord, rec.QueryPassthrough)
+		}
+	case TypeClick:
+	default:
+		return fmt.Errorf("%w: unknown type %q, expected %s or %s", ErrInvalidRecord, rec.Type, TypeURL, TypeClick)
+	}
+
+	return nil
+}
+
+func utc(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
@@ -0,0 +1,274 @@
+// Package useragent classifies User-Agent headers: browser and version,
+// operating system, device type, and whether the client is a crawler or
+// other automated tool. Browsers copy each other's tokens, so rules are
+// checked from the most to the least specific; Edge and Opera, for
+// instance, also claim to be Chrome and Safari.
+package useragent
+
+import (
+	"strings"
+
+	"go-url-shortener/internal/db"
+)
+
+// Device types
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+)
+
+// Agent is what a User-Agent header says about the client. Fields that
+// could not be recognized are empty.
+type Agent struct {
+	Browser        string // e.g. "Chrome", "Samsung Internet"
+	BrowserVersion string // as sent, e.g. "120.0.6099.109"
+	OS             string // e.g. "Windows", "iOS"
+	OSVersion      string // e.g. "10", "17.2"
+	Device         string // one of the Device* types; empty for bots
+	Bot            string // name of the crawler or tool; empty for people
+}
+
+// IsBot reports whether the client is a crawler, link previewer or script
+func (a Agent) IsBot() bool {
+	return a.Bot != ""
+}
+
+// browserRule recognizes a browser by a token in the header. The version
+// follows versionToken, or token itself if that is empty.
+type browserRule struct {
+	token        string
+	name         string
+	versionToken string
+}
+
+// browsers is checked in order; the first rule whose token appears wins
+var browsers = []browserRule{
+	{"EdgA/", "Edge", ""},
+	{"EdgiOS/", "Edge", ""},
+	{"Edg/", "Edge", ""},
+	{"Edge/", "Edge", ""},
+	{"OPR/", "Opera", ""},
+	{"OPiOS/", "Opera", ""},
+	{"OPT/", "Opera", ""},
+	{"Opera Mini/", "Opera Mini", ""},
+	{"Opera/", "Opera", "Version/"},
+	{"SamsungBrowser/", "Samsung Internet", ""},
+	{"YaBrowser/", "Yandex Browser", ""},
+	{"Vivaldi/", "Vivaldi", ""},
+	{"UCBrowser/", "UC Browser", ""},
+	{"FBAV/", "Facebook", ""},
+	{"Instagram ", "Instagram", ""},
+	{"FxiOS/", "Firefox", ""},
+	{"Firefox/", "Firefox", ""},
+	{"CriOS/", "Chrome", ""},
+	{"; wv)", "Android WebView", "Chrome/"},
+	{"Chromium/", "Chromium", ""},
+	{"Chrome/", "Chrome", ""},
+	{"Safari/", "Safari", "Version/"},
+	{"MSIE ", "Internet Explorer", ""},
+	{"Trident/", "Internet Explorer", "rv:"},
+}
+
+// botRule recognizes a well-known bot by a lower-case token
+type botRule struct {
+	token string
+	name  string
+}
+
+var bots = []botRule{
+	{"googlebot", "Googlebot"},
+	{"adsbot-google", "Googlebot"},
+	{"mediapartners-google", "Googlebot"},
+	{"google-inspectiontool", "Googlebot"},
+	{"bingbot", "Bingbot"},
+	{"bingpreview", "Bingbot"},
+	{"duckduckbot", "DuckDuckBot"},
+	{"baiduspider", "Baiduspider"},
+	{"yandexbot", "YandexBot"},
+	{"yahoo! slurp", "Yahoo! Slurp"},
+	{"applebot", "Applebot"},
+	{"facebookexternalhit", "Facebook"},
+	{"facebookcatalog", "Facebook"},
+	{"meta-externalagent", "Facebook"},
+	{"twitterbot", "Twitterbot"},
+	{"linkedinbot", "LinkedInBot"},
+	{"slackbot", "Slackbot"},
+	{"slack-imgproxy", "Slackbot"},
+	{"discordbot", "Discordbot"},
+	{"telegrambot", "TelegramBot"},
+	{"whatsapp/", "WhatsApp"},
+	{"skypeuripreview", "Skype"},
+	{"pinterestbot", "Pinterestbot"},
+	{"redditbot", "Redditbot"},
+	{"ahrefsbot", "AhrefsBot"},
+	{"semrushbot", "SemrushBot"},
+	{"mj12bot", "MJ12bot"},
+	{"petalbot", "PetalBot"},
+	{"bytespider", "Bytespider"},
+	{"gptbot", "GPTBot"},
+	{"ccbot", "CCBot"},
+	{"headlesschrome", "HeadlessChrome"},
+	{"phantomjs", "PhantomJS"},
+	{"curl/", "curl"},
+	{"wget/", "Wget"},
+	{"python-requests", "python-requests"},
+	{"python-urllib", "Python"},
+	{"aiohttp", "Python"},
+	{"go-http-client", "Go"},
+	{"okhttp", "OkHttp"},
+	{"apache-httpclient", "Java"},
+	{"java/", "Java"},
+	{"libwww-perl", "Perl"},
+	{"node-fetch", "Node.js"},
+	{"axios/", "Node.js"},
+	{"postmanruntime", "Postman"},
+}
+
+// botWords mark unknown bots, which usually name themselves "SomethingBot"
+var botWords = []string{"bot", "crawler", "spider", "scraper"}
+
+// notBots are tokens that contain a bot word but are not bots, such as
+// the Cubot phone brand
+var notBots = []string{"cubot"}
+
+// Parse classifies a User-Agent header
+func Parse(ua string) Agent {
+	ua = strings.TrimSpace(ua)
+	if ua == "" {
+		return Agent{}
+	}
+
+	var agent Agent
+	agent.Browser, agent.BrowserVersion = parseBrowser(ua)
+	agent.OS, agent.OSVersion = parseOS(ua)
+	agent.Bot = parseBot(ua)
+
+	if !agent.IsBot() && (agent.Browser != "" || agent.OS != "") {
+		agent.Device = parseDevice(ua)
+	}
+
+	return agent
+}
+
+// Enrich sets the parsed fields of a click event from its User-Agent; with
+// clicks.EnricherFunc it runs on the click recorder
+func Enrich(event *db.ClickEvent) {
+	agent := Parse(event.UserAgent)
+	event.Browser = agent.Browser
+	event.BrowserVersion = agent.BrowserVersion
+	event.OS = agent.OS
+	event.OSVersion = agent.OSVersion
+	event.Device = agent.Device
+	event.Bot = agent.Bot
+}
+
+func parseBrowser(ua string) (string, string) {
+	for _, rule := range browsers {
+		if !strings.Contains(ua, rule.token) {
+			continue
+		}
+		versionToken := rule.versionToken
+		if versionToken == "" {
+			versionToken = rule.token
+		}
+		return rule.name, versionAfter(ua, versionToken)
+	}
+	return "", ""
+}
+
+// windowsVersions maps Windows NT versions to product names. Windows 11
+// still reports NT 10.0.
+var windowsVersions = map[string]string{
+	"10.0": "10",
+	"6.3":  "8.1",
+	"6.2":  "8",
+	"6.1":  "7",
+	"6.0":  "Vista",
+	"5.2":  "XP",
+	"5.1":  "XP",
+}
+
+func parseOS(ua string) (string, string) {
+	switch {
+	case strings.Contains(ua, "Windows Phone"):
+		return "Windows Phone", versionAfter(ua, "Windows Phone ")
+	case strings.Contains(ua, "Windows NT "):
+		return "Windows", windowsVersions[versionAfter(ua, "Windows NT ")]
+	// iOS headers also say "like Mac OS X"
+	case strings.Contains(ua, "iPhone"), strings.Contains(ua, "iPad"), strings.Contains(ua, "iPod"):
+		return "iOS", versionAfter(ua, " OS ")
+	case strings.Contains(ua, "Android"):
+		return "Android", versionAfter(ua, "Android ")
+	case strings.Contains(ua, "CrOS"):
+		return "Chrome OS", ""
+	case strings.Contains(ua, "Mac OS X"):
+		return "macOS", versionAfter(ua, "Mac OS X ")
+	case strings.Contains(ua, "Linux"):
+		return "Linux", ""
+	}
+	return "", ""
+}
+
+func parseDevice(ua string) string {
+	switch {
+	case strings.Contains(ua, "iPad"), strings.Contains(ua, "Tablet"), strings.Contains(ua, "Kindle"), strings.Contains(ua, "Silk/"):
+		return DeviceTablet
+	case strings.Contains(ua, "Mobi"), strings.Contains(ua, "iPhone"), strings.Contains(ua, "iPod"), strings.Contains(ua, "Windows Phone"):
+		return DeviceMobile
+	// Android tablets leave out "Mobile"
+	case strings.Contains(ua, "Android"):
+		return DeviceTablet
+	}
+	return DeviceDesktop
+}
+
+func parseBot(ua string) string {
+	lower := strings.ToLower(ua)
+	for _, rule := range bots {
+		if strings.Contains(lower, rule.token) {
+			return rule.name
+		}
+	}
+
+	// Name unknown bots after the token that gave them away
+	tokens := strings.FieldsFunc(ua, func(r rune) bool {
+		return r == ' ' || r == ';' || r == '(' || r == ')' || r == ','
+	})
+	for _, token := range tokens {
+		name, _, _ := strings.Cut(token, "/")
+		lowerName := strings.ToLower(name)
+		if strings.HasPrefix(lowerName, "+http") || containsAny(lowerName, notBots) {
+			continue
+		}
+		if containsAny(lowerName, botWords) {
+			return name
+		}
+	}
+	return ""
+}
+
+func containsAny(s string, words []string) bool {
+	for _, word := range words {
+		if strings.Contains(s, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// versionAfter returns the version that follows token, e.g. "17.2" for
+// " OS " in "iPhone OS 17_2 like Mac OS X"
+func versionAfter(ua, token string) string {
+	i := strings.Index(ua, token)
+	if i < 0 {
+		return ""
+	}
+	rest := ua[i+len(token):]
+
+	end := 0
+	for end < len(rest) && (rest[end] >= '0' && rest[end] <= '9' || rest[end] == '.' || rest[end] == '_') {
+		end++
+	}
+	return strings.Trim(strings.ReplaceAll(rest[:end], "_", "."), ".")
+}
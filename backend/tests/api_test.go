@@ -0,0 +1,174 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"go-url-shortener/internal/api"
+	"go-url-shortener/internal/api/handlers"
+	"go-url-shortener/internal/auth"
+	"go-url-shortener/internal/clicks"
+	"go-url-shortener/internal/config"
+	"go-url-shortener/internal/core"
+	"go-url-shortener/internal/db"
+	"go-url-shortener/internal/middleware"
+	"go-url-shortener/internal/useragent"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testAdminToken guards the admin API of test servers
+const testAdminToken = "test-admin-token"
+
+// setupTestServer serves the full router over an in-memory repository. It
+// returns an API key owned by "alice".
+func setupTestServer(t *testing.T) (*httptest.Server, db.RepositoryInterface, string) {
+	return setupTestServerWithConfig(t, testConfig())
+}
+
+// testConfig is the configuration setupTestServer uses. Rate limits are
+// left at zero, which disables them.
+func testConfig() *config.Config {
+	return &config.Config{DBTimeout: 5 * time.Second, AdminToken: testAdminToken, AllowAnonymousShorten: true}
+}
+
+func setupTestServerWithConfig(t *testing.T, cfg *config.Config) (*httptest.Server, db.RepositoryInterface, string) {
+	repo := setupMemoryRepo(t)
+	recorder := clicks.NewRecorder(repo, clicks.Options{
+		FlushInterval: 10 * time.Millisecond,
+		Enrichers:     []clicks.Enricher{clicks.EnricherFunc(useragent.Enrich)},
+	})
+	t.Cleanup(func() { recorder.Close(context.Background()) })
+
+	router := api.NewRouter(cfg, core.NewShortener(repo), repo, recorder)
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	return server, repo, createTestAPIKey(t, repo, "alice")
+}
+
+// createTestAPIKey stores a new key for ownerID and returns its plaintext
+func createTestAPIKey(t *testing.T, repo db.RepositoryInterface, ownerID string) string {
+	plaintext, key, err := auth.NewKey(ownerID, "test")
+	if err != nil {
+		t.Fatalf("Failed to generate API key: %v", err)
+	}
+	if err := repo.CreateAPIKey(context.Background(), key); err != nil {
+		t.Fatalf("Failed to store API key: %v", err)
+	}
+	return plaintext
+}
+
+// noRedirectClient returns redirects to the test instead of following them
+var noRedirectClient = &http.Client{
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// doRequest sends a request with token as bearer credentials, if not empty
+func doRequest(t *testing.T, method, url, token, body string) *http.Response {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to build request: %v", err)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := noRedirectClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, url, err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// decodeError checks resp is a JSON error envelope and returns its body
+func decodeError(t *testing.T, resp *http.Response) middleware.ErrorBody {
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Expected JSON error body, got Content-Type %q", ct)
+	}
+
+	var envelope middleware.ErrorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		t.Fatalf("Failed to decode error body: %v", err)
+	}
+
+	if envelope.Error.RequestID == "" || envelope.Error.RequestID != resp.Header.Get("X-Request-ID") {
+		t.Errorf("Expected request_id to match X-Request-ID header %q, got %q", resp.Header.Get("X-Request-ID"), envelope.Error.RequestID)
+	}
+	return envelope.Error
+}
+
+func TestAPIErrorEnvelope(t *testing.T) {
+	server, repo, key := setupTestServer(t)
+
+	past := time.Now().Add(-time.Hour)
+	if err := repo.CreateShortURL(context.Background(), &db.URL{OriginalURL: "https://example.com/old", ShortCode: "tstgone", ExpiresAt: &past, OwnerID: "alice"}); err != nil {
+		t.Fatalf("Failed to create expired URL: %v", err)
+	}
+	if err := repo.CreateShortURL(context.Background(), &db.URL{OriginalURL: "https://example.com/taken", ShortCode: "tsttaken"}); err != nil {
+		t.Fatalf("Failed to create URL: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+		code   string
+	}{
+		{"invalid json", "POST", "/api/shorten", `{`, http.StatusBadRequest, handlers.CodeInvalidRequest},
+		{"invalid url", "POST", "/api/shorten", `{"url":"not a url"}`, http.StatusBadRequest, handlers.CodeInvalidURL},
+		{"invalid code", "POST", "/api/shorten", `{"url":"https://example.com","custom_code":"a!"}`, http.StatusBadRequest, handlers.CodeInvalidCode},
+		{"reserved code", "POST", "/api/shorten", `{"url":"https://example.com","custom_code":"admin"}`, http.StatusBadRequest, handlers.CodeInvalidCode},
+		{"blocked domain", "POST", "/api/shorten", `{"url":"https://malware.com/x"}`, http.StatusForbidden, handlers.CodeBlocked},
+		{"code taken", "POST", "/api/shorten", `{"url":"https://example.com","custom_code":"tsttaken"}`, http.StatusConflict, handlers.CodeCodeTaken},
+		{"get missing", "GET", "/api/urls/tstnone", "", http.StatusNotFound, handlers.CodeNotFound},
+		{"get expired", "GET", "/api/urls/tstgone", "", http.StatusGone, handlers.CodeExpired},
+		{"delete missing", "DELETE", "/api/urls/tstnone", "", http.StatusNotFound, handlers.CodeNotFound},
+		{"bad cursor", "GET", "/api/urls?cursor=bogus", "", http.StatusBadRequest, handlers.CodeInvalidRequest},
+		{"bad limit", "GET", "/api/history?limit=x", "", http.StatusBadRequest, handlers.CodeInvalidRequest},
+		{"analytics missing", "GET", "/api/analytics/tstnone", "", http.StatusNotFound, handlers.CodeNotFound},
+		{"redirect missing", "GET", "/tstnone", "", http.StatusNotFound, handlers.CodeNotFound},
+		{"redirect expired", "GET", "/tstgone", "", http.StatusGone, handlers.CodeExpired},
+		{"no route", "GET", "/api/nothing/here", "", http.StatusNotFound, handlers.CodeNotFound},
+		{"wrong method", "POST", "/tsttaken", "", http.StatusMethodNotAllowed, handlers.CodeMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := doRequest(t, tt.method, server.URL+tt.path, key, tt.body)
+			if resp.StatusCode != tt.status {
+				t.Errorf("Expected status %d, got %d", tt.status, resp.StatusCode)
+			}
+			if body := decodeError(t, resp); body.Code != tt.code {
+				t.Errorf("Expected error code %q, got %q (%s)", tt.code, body.Code, body.Message)
+			}
+		})
+	}
+}
+
+func TestAPIRequestIDPassthrough(t *testing.T) {
+	server, _, _ := setupTestServer(t)
+
+	req, _ := http.NewRequest("GET", server.URL+"/api/urls/tstnone", nil)
+	req.Header.Set("X-Request-ID", "trace-abc-123")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if body := decodeError(t, resp); body.RequestID != "trace-abc-123" {
+		t.Errorf("Expected upstream request id to be kept, got %q", body.RequestID)
+	}
+}
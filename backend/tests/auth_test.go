@@ -0,0 +1,267 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go-url-shortener/internal/api/handlers"
+	"go-url-shortener/internal/auth"
+	"go-url-shortener/internal/db"
+	"go-url-shortener/internal/middleware"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestAPIKeyStore(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo db.RepositoryInterface) {
+		ctx := context.Background()
+
+		plaintext, key, err := auth.NewKey("tstkeyowner", "ci")
+		if err != nil {
+			t.Fatalf("Error generating key: %v", err)
+		}
+		if !strings.HasPrefix(plaintext, auth.KeyPrefix) || !strings.HasPrefix(plaintext, key.Prefix) {
+			t.Errorf("Expected key %q to start with %q and its display prefix %q", plaintext, auth.KeyPrefix, key.Prefix)
+		}
+		if strings.Contains(key.Hash, plaintext) || key.Hash != auth.HashKey(plaintext) {
+			t.Error("Expected only the hash of the key to be kept")
+		}
+
+		if err := repo.CreateAPIKey(ctx, key); err != nil {
+			t.Fatalf("Error storing key: %v", err)
+		}
+		if key.ID == 0 {
+			t.Error("Expected stored key to get an ID")
+		}
+
+		found, err := repo.GetAPIKeyByHash(ctx, auth.HashKey(plaintext))
+		if err != nil {
+			t.Fatalf("Error looking up key: %v", err)
+		}
+		if found.ID != key.ID || found.OwnerID != "tstkeyowner" || found.Name != "ci" || found.IsRevoked() {
+			t.Errorf("Unexpected key %+v", found)
+		}
+
+		if _, err := repo.GetAPIKeyByHash(ctx, auth.HashKey("usk_unknown")); !errors.Is(err, db.ErrNotFound) {
+			t.Errorf("Expected ErrNotFound for unknown key, got %v", err)
+		}
+
+		keys, err := repo.ListAPIKeys(ctx, "tstkeyowner")
+		if err != nil {
+			t.Fatalf("Error listing keys: %v", err)
+		}
+		if len(keys) != 1 || keys[0].ID != key.ID {
+			t.Errorf("Expected only key %d for owner, got %d keys", key.ID, len(keys))
+		}
+
+		if err := repo.RevokeAPIKey(ctx, key.ID); err != nil {
+			t.Fatalf("Error revoking key: %v", err)
+		}
+		found, err = repo.GetAPIKeyByHash(ctx, auth.HashKey(plaintext))
+		if err != nil || !found.IsRevoked() {
+			t.Errorf("Expected revoked key to be returned as revoked, got %+v, %v", found, err)
+		}
+
+		if err := repo.RevokeAPIKey(ctx, key.ID+1000000); !errors.Is(err, db.ErrNotFound) {
+			t.Errorf("Expected ErrNotFound when revoking unknown key, got %v", err)
+		}
+	})
+}
+
+func TestOwnerScopedAccess(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo db.RepositoryInterface) {
+		ctx := context.Background()
+		defer cleanupTestURL(t, repo, "tstown")
+		defer cleanupTestURL(t, repo, "tstanon")
+
+		if err := repo.CreateShortURL(ctx, &db.URL{OriginalURL: "https://example.com/own", ShortCode: "tstown", OwnerID: "tstalice"}); err != nil {
+			t.Fatalf("Failed to create owned URL: %v", err)
+		}
+		if err := repo.CreateShortURL(ctx, &db.URL{OriginalURL: "https://example.com/anon", ShortCode: "tstanon"}); err != nil {
+			t.Fatalf("Failed to create anonymous URL: %v", err)
+		}
+
+		url, err := repo.GetShortURLForOwner(ctx, "tstown", "tstalice")
+		if err != nil {
+			t.Fatalf("Owner could not read own URL: %v", err)
+		}
+		if url.OwnerID != "tstalice" {
+			t.Errorf("Expected owner tstalice, got %q", url.OwnerID)
+		}
+
+		if _, err := repo.GetShortURLForOwner(ctx, "tstown", "tstbob"); !errors.Is(err, db.ErrNotFound) {
+			t.Errorf("Expected ErrNotFound for another owner's URL, got %v", err)
+		}
+		if _, err := repo.GetShortURLForOwner(ctx, "tstanon", ""); !errors.Is(err, db.ErrNotFound) {
+			t.Errorf("Expected anonymous URLs to have no owner, got %v", err)
+		}
+
+		page, err := repo.ListURLs(ctx, db.ListOptions{OwnerID: "tstalice"})
+		if err != nil {
+			t.Fatalf("Error listing URLs: %v", err)
+		}
+		if page.Total != 1 || len(page.URLs) != 1 || page.URLs[0].ShortCode != "tstown" {
+			t.Errorf("Expected only tstown for tstalice, got total %d", page.Total)
+		}
+
+		if err := repo.DeleteShortURLForOwner(ctx, "tstown", "tstbob"); !errors.Is(err, db.ErrNotFound) {
+			t.Errorf("Expected ErrNotFound deleting another owner's URL, got %v", err)
+		}
+		if err := repo.DeleteShortURLForOwner(ctx, "tstown", "tstalice"); err != nil {
+			t.Errorf("Owner could not delete own URL: %v", err)
+		}
+		if _, err := repo.GetShortURL(ctx, "tstown"); !errors.Is(err, db.ErrNotFound) {
+			t.Errorf("Expected URL to be deleted, got %v", err)
+		}
+	})
+}
+
+func TestAPIAuthentication(t *testing.T) {
+	server, repo, aliceKey := setupTestServer(t)
+	bobKey := createTestAPIKey(t, repo, "bob")
+
+	resp := doRequest(t, "POST", server.URL+"/api/shorten", aliceKey, `{"url":"https://example.com/alice","custom_code":"tstalice"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected 201 creating link, got %d", resp.StatusCode)
+	}
+	resp = doRequest(t, "POST", server.URL+"/api/shorten", "", `{"url":"https://example.com/anon","custom_code":"tstanon"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected anonymous shorten to be allowed, got %d", resp.StatusCode)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		status int
+	}{
+		{"owner reads", "GET", "/api/urls/tstalice", aliceKey, http.StatusOK},
+		{"no key", "GET", "/api/urls/tstalice", "", http.StatusUnauthorized},
+		{"unknown key", "GET", "/api/urls/tstalice", "usk_bogus", http.StatusUnauthorized},
+		{"other owner reads", "GET", "/api/urls/tstalice", bobKey, http.StatusNotFound},
+		{"other owner analytics", "GET", "/api/analytics/tstalice", bobKey, http.StatusNotFound},
+		{"other owner deletes", "DELETE", "/api/urls/tstalice", bobKey, http.StatusNotFound},
+		{"anonymous link is unmanaged", "GET", "/api/urls/tstanon", aliceKey, http.StatusNotFound},
+		{"list needs key", "GET", "/api/urls", "", http.StatusUnauthorized},
+		{"history needs key", "GET", "/api/history", "", http.StatusUnauthorized},
+		{"redirect is public", "GET", "/tstalice", "", http.StatusMovedPermanently},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := doRequest(t, tt.method, server.URL+tt.path, tt.token, "")
+			if resp.StatusCode != tt.status {
+				t.Errorf("Expected status %d, got %d", tt.status, resp.StatusCode)
+			}
+			if resp.StatusCode == http.StatusUnauthorized {
+				if body := decodeError(t, resp); body.Code != middleware.CodeUnauthorized {
+					t.Errorf("Expected code %q, got %q", middleware.CodeUnauthorized, body.Code)
+				}
+			}
+		})
+	}
+
+	var page struct {
+		Items []db.URL `json:"items"`
+		Total int      `json:"total"`
+	}
+	resp = doRequest(t, "GET", server.URL+"/api/history", bobKey, "")
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		t.Fatalf("Failed to decode history: %v", err)
+	}
+	if page.Total != 0 {
+		t.Errorf("Expected bob to see no links, got %d", page.Total)
+	}
+
+	resp = doRequest(t, "GET", server.URL+"/api/urls", aliceKey, "")
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		t.Fatalf("Failed to decode list: %v", err)
+	}
+	if page.Total != 1 || page.Items[0].ShortCode != "tstalice" || page.Items[0].OwnerID != "alice" {
+		t.Errorf("Expected alice to see only tstalice, got %+v", page)
+	}
+}
+
+func TestAdminAPIKeys(t *testing.T) {
+	server, _, _ := setupTestServer(t)
+	keysURL := server.URL + "/api/admin/keys"
+
+	for _, token := range []string{"", "wrong-token"} {
+		if resp := doRequest(t, "GET", keysURL, token, ""); resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected 401 with admin token %q, got %d", token, resp.StatusCode)
+		}
+	}
+
+	resp := doRequest(t, "POST", keysURL, testAdminToken, `{"owner_id":"carol","name":"laptop"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected 201 issuing key, got %d", resp.StatusCode)
+	}
+	var issued struct {
+		ID      int    `json:"id"`
+		Key     string `json:"key"`
+		OwnerID string `json:"owner_id"`
+		Hash    string `json:"key_hash"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&issued); err != nil {
+		t.Fatalf("Failed to decode issued key: %v", err)
+	}
+	if issued.Key == "" || issued.OwnerID != "carol" || issued.Hash != "" {
+		t.Errorf("Unexpected issued key %+v", issued)
+	}
+
+	if resp := doRequest(t, "POST", keysURL, testAdminToken, `{"owner_id":"not valid!"}`); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for invalid owner id, got %d", resp.StatusCode)
+	}
+
+	resp = doRequest(t, "POST", server.URL+"/api/shorten", issued.Key, `{"url":"https://example.com/carol","custom_code":"tstcarol"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected issued key to work, got %d", resp.StatusCode)
+	}
+
+	var keys []db.APIKey
+	resp = doRequest(t, "GET", keysURL+"?owner_id=carol", testAdminToken, "")
+	if err := json.NewDecoder(resp.Body).Decode(&keys); err != nil {
+		t.Fatalf("Failed to decode key list: %v", err)
+	}
+	if len(keys) != 1 || keys[0].ID != issued.ID {
+		t.Errorf("Expected carol's key in the list, got %+v", keys)
+	}
+
+	if resp := doRequest(t, "DELETE", keysURL+"/"+strconv.Itoa(issued.ID), testAdminToken, ""); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected 204 revoking key, got %d", resp.StatusCode)
+	}
+	resp = doRequest(t, "GET", server.URL+"/api/urls/tstcarol", issued.Key, "")
+	if body := decodeError(t, resp); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected revoked key to be rejected, got %d %q", resp.StatusCode, body.Code)
+	}
+
+	resp = doRequest(t, "DELETE", keysURL+"/999", testAdminToken, "")
+	if body := decodeError(t, resp); resp.StatusCode != http.StatusNotFound || body.Code != handlers.CodeNotFound {
+		t.Errorf("Expected 404 revoking unknown key, got %d %q", resp.StatusCode, body.Code)
+	}
+}
+
+func TestAdminMetrics(t *testing.T) {
+	server, _, key := setupTestServer(t)
+	metricsURL := server.URL + "/api/admin/metrics"
+
+	// Metrics describe the whole server, so API keys are not enough
+	for _, token := range []string{"", "wrong-token", key} {
+		if resp := doRequest(t, "GET", metricsURL, token, ""); resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected 401 with token %q, got %d", token, resp.StatusCode)
+		}
+	}
+
+	resp := doRequest(t, "GET", metricsURL, testAdminToken, "")
+	var metrics handlers.MetricsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&metrics); resp.StatusCode != http.StatusOK || err != nil {
+		t.Errorf("Expected metrics for the admin, got %d, %v", resp.StatusCode, err)
+	}
+
+	if resp := doRequest(t, "GET", server.URL+"/api/metrics", key, ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected the old metrics path to be gone, got %d", resp.StatusCode)
+	}
+}
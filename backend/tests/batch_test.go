@@ -0,0 +1,385 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-url-shortener/internal/api/handlers"
+	"go-url-shortener/internal/auth"
+	"go-url-shortener/internal/db"
+	"go-url-shortener/internal/middleware"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCreateShortURLs(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo db.RepositoryInterface) {
+		ctx := context.Background()
+		for _, code := range []string{"tstbatch0", "tstbatch1", "tstbatch2", "tstbatch3"} {
+			defer cleanupTestURL(t, repo, code)
+		}
+
+		if err := repo.CreateShortURL(ctx, &db.URL{OriginalURL: "https://example.com/existing", ShortCode: "tstbatch0"}); err != nil {
+			t.Fatalf("Failed to create URL: %v", err)
+		}
+
+		newBatch := func() []*db.URL {
+			return []*db.URL{
+				{OriginalURL: "https://example.com/1", ShortCode: "tstbatch1", OwnerID: "tstbatcher"},
+				{OriginalURL: "https://example.com/0", ShortCode: "tstbatch0", OwnerID: "tstbatcher"},
+				{OriginalURL: "https://example.com/2", ShortCode: "tstbatch2", OwnerID: "tstbatcher"},
+				{OriginalURL: "https://example.com/2b", ShortCode: "tstbatch2", OwnerID: "tstbatcher"},
+			}
+		}
+
+		// Atomic: a single taken code stores nothing
+		errs, err := repo.CreateShortURLs(ctx, newBatch(), true)
+		if err != nil {
+			t.Fatalf("Error creating atomic batch: %v", err)
+		}
+		if !errors.Is(errs[1], db.ErrCodeTaken) || !errors.Is(errs[3], db.ErrCodeTaken) {
+			t.Errorf("Expected ErrCodeTaken for the taken and the repeated code, got %v", errs)
+		}
+		if _, err := repo.GetShortURL(ctx, "tstbatch1"); !errors.Is(err, db.ErrNotFound) {
+			t.Errorf("Expected atomic batch to store nothing, got %v", err)
+		}
+
+		// Best effort: the free codes are stored
+		urls := newBatch()
+		errs, err = repo.CreateShortURLs(ctx, urls, false)
+		if err != nil {
+			t.Fatalf("Error creating batch: %v", err)
+		}
+		for i, want := range []bool{true, false, true, false} {
+			if stored := errs[i] == nil; stored != want {
+				t.Errorf("Item %d: expected stored=%v, got error %v", i, want, errs[i])
+			}
+		}
+		if urls[0].ID == 0 || urls[0].ID == urls[2].ID || urls[0].Version != 1 || urls[0].ExpiresAt == nil {
+			t.Errorf("Expected stored links to get ids, version 1 and default expiry, got %+v and %+v", urls[0], urls[2])
+		}
+
+		stored, err := repo.GetShortURL(ctx, "tstbatch2")
+		if err != nil || stored.OriginalURL != "https://example.com/2" || stored.OwnerID != "tstbatcher" {
+			t.Errorf("Expected the first tstbatch2 to win, got %+v, %v", stored, err)
+		}
+		existing, _ := repo.GetShortURL(ctx, "tstbatch0")
+		if existing == nil || existing.OriginalURL != "https://example.com/existing" {
+			t.Errorf("Expected existing link to be untouched, got %+v", existing)
+		}
+
+		errs, err = repo.CreateShortURLs(ctx, []*db.URL{{OriginalURL: "https://example.com/3", ShortCode: "tstbatch3"}}, true)
+		if err != nil || errs[0] != nil {
+			t.Errorf("Expected atomic batch without conflicts to succeed, got %v, %v", errs, err)
+		}
+	})
+}
+
+// batchResponse decodes the body of a batch response
+func batchResponse(t *testing.T, resp *http.Response) handlers.BatchShortenResponse {
+	t.Helper()
+	var body handlers.BatchShortenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode batch response: %v", err)
+	}
+	return body
+}
+
+func TestBatchShortenAPI(t *testing.T) {
+	server, _, key := setupTestServer(t)
+	batchURL := server.URL + "/api/shorten/batch"
+
+	resp := doRequest(t, "POST", batchURL, key, `[
+		{"url":"https://example.com/a","custom_code":"tstba"},
+		{"url":"https://example.com/b","expires_at":"2099-01-01T00:00:00Z"}
+	]`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d", resp.StatusCode)
+	}
+	body := batchResponse(t, resp)
+	if body.Mode != handlers.BatchTransactional || body.Created != 2 || body.Failed != 0 {
+		t.Errorf("Unexpected summary %+v", body)
+	}
+	if r := body.Results[0].Result; r == nil || r.Code != "tstba" || !strings.HasSuffix(r.ShortURL, "/tstba") {
+		t.Errorf("Unexpected first result %+v", body.Results[0])
+	}
+	if r := body.Results[1].Result; r == nil || len(r.Code) != 6 {
+		t.Errorf("Expected a generated code for the second item, got %+v", body.Results[1])
+	}
+
+	// Transactional: one bad item aborts the rest
+	resp = doRequest(t, "POST", batchURL, key, `[
+		{"url":"https://example.com/c","custom_code":"tstbc"},
+		{"url":"not a url"},
+		{"url":"https://example.com/a","custom_code":"tstba"}
+	]`)
+	if resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected 422, got %d", resp.StatusCode)
+	}
+	body = batchResponse(t, resp)
+	for i, code := range []string{handlers.CodeBatchAborted, handlers.CodeInvalidURL, handlers.CodeBatchAborted} {
+		if e := body.Results[i].Error; e == nil || e.Code != code {
+			t.Errorf("Item %d: expected error %q, got %+v", i, code, body.Results[i])
+		}
+	}
+	if resp := doRequest(t, "GET", server.URL+"/api/urls/tstbc", key, ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected aborted item not to exist, got %d", resp.StatusCode)
+	}
+
+	// Best effort: each item on its own
+	resp = doRequest(t, "POST", batchURL+"?mode=best_effort", key, `[
+		{"url":"https://example.com/c","custom_code":"tstbc"},
+		{"url":"http://localhost/x"},
+		{"url":"https://example.com/a","custom_code":"tstba"},
+		{"url":"https://example.com/d","custom_code":"api"}
+	]`)
+	if resp.StatusCode != http.StatusMultiStatus {
+		t.Fatalf("Expected 207, got %d", resp.StatusCode)
+	}
+	body = batchResponse(t, resp)
+	if body.Created != 1 || body.Failed != 3 || body.Results[0].Result == nil {
+		t.Errorf("Unexpected best-effort summary %+v", body)
+	}
+	for i, code := range map[int]string{1: handlers.CodeBlocked, 2: handlers.CodeCodeTaken, 3: handlers.CodeInvalidCode} {
+		if e := body.Results[i].Error; e == nil || e.Code != code {
+			t.Errorf("Item %d: expected error %q, got %+v", i, code, body.Results[i])
+		}
+	}
+}
+
+func TestBatchShortenCSV(t *testing.T) {
+	server, _, key := setupTestServer(t)
+	batchURL := server.URL + "/api/shorten/batch"
+	csvBody := "\ufeffurl, custom_code ,expires_at\nhttps://example.com/x,tstcsv1,\nhttps://example.com/y,tstcsv2,2099-01-01T00:00:00Z\n"
+
+	req, _ := http.NewRequest("POST", batchURL, strings.NewReader(csvBody))
+	req.Header.Set("Authorization", "Bearer "+key)
+	req.Header.Set("Content-Type", "text/csv; charset=utf-8")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected 201 for CSV body, got %d", resp.StatusCode)
+	}
+	if body := batchResponse(t, resp); body.Created != 2 || body.Results[1].Result.Code != "tstcsv2" {
+		t.Errorf("Unexpected CSV result %+v", body)
+	}
+
+	var upload bytes.Buffer
+	form := multipart.NewWriter(&upload)
+	part, _ := form.CreateFormFile("file", "links.csv")
+	part.Write([]byte("url\nhttps://example.com/z\n"))
+	form.Close()
+
+	req, _ = http.NewRequest("POST", batchURL+"?mode=best_effort", &upload)
+	req.Header.Set("Authorization", "Bearer "+key)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if body := batchResponse(t, resp); resp.StatusCode != http.StatusCreated || body.Created != 1 {
+		t.Errorf("Expected 201 for multipart upload, got %d %+v", resp.StatusCode, body)
+	}
+}
+
+// TestBatchShortenOptions checks that batch items keep the link options of
+// POST /api/shorten
+func TestBatchShortenOptions(t *testing.T) {
+	server, repo, key := setupTestServer(t)
+	ctx := context.Background()
+
+	resp := doRequest(t, "POST", server.URL+"/api/shorten/batch", key, `[
+		{"url":"https://example.com/private","custom_code":"tstbopw","password":"s3cret pass"},
+		{"url":"https://example.com/once","custom_code":"tstboonce","max_clicks":1},
+		{"url":"https://example.com/launch","custom_code":"tstbolaunch","activates_at":"2099-01-01T00:00:00Z"},
+		{"url":"https://example.com/found","custom_code":"tstbofound","redirect_type":"302"},
+		{"url":"https://example.com/look","custom_code":"tstbolook","force_preview":true},
+		{"url":"https://docs.example.com/v2/?lang=en","custom_code":"tstbodocs","path_passthrough":true,"query_passthrough":"append"},
+		{"url":"https://example.com/p?ref=x","custom_code":"tstboutm","utm_source":"news letter","utm_campaign":"spring","query_params":{"lang":"en"}}
+	]`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d", resp.StatusCode)
+	}
+	body := batchResponse(t, resp)
+	if r := body.Results[0].Result; r == nil || !r.PasswordProtected {
+		t.Errorf("Expected password_protected in the result, got %+v", body.Results[0])
+	}
+
+	stored, err := repo.GetShortURL(ctx, "tstbopw")
+	if err != nil || !auth.CheckPassword(stored.PasswordHash, "s3cret pass") {
+		t.Fatalf("Expected the password hash to be stored, got %+v, %v", stored, err)
+	}
+	if resp := doRequest(t, "GET", server.URL+"/tstbopw", "", ""); resp.StatusCode != http.StatusOK || resp.Header.Get("Location") != "" {
+		t.Errorf("Expected the password form, got %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	if r := body.Results[1].Result; r == nil || r.MaxClicks != 1 {
+		t.Errorf("Expected max_clicks in the result, got %+v", body.Results[1])
+	}
+	for i, want := range []int{http.StatusMovedPermanently, http.StatusGone} {
+		if resp := doRequest(t, "GET", server.URL+"/tstboonce", "", ""); resp.StatusCode != want {
+			t.Errorf("Visit %d: expected %d, got %d", i+1, want, resp.StatusCode)
+		}
+	}
+
+	if r := body.Results[2].Result; r == nil || r.ActivatesAt == nil || r.ActivatesAt.Year() != 2099 {
+		t.Errorf("Expected activates_at in the result, got %+v", body.Results[2])
+	}
+	resp = doRequest(t, "GET", server.URL+"/tstbolaunch", "", "")
+	if e := decodeError(t, resp); resp.StatusCode != http.StatusNotFound || e.Code != handlers.CodeScheduled {
+		t.Errorf("Expected the link to be scheduled, got %d %q", resp.StatusCode, e.Code)
+	}
+	if stored, err := repo.GetShortURL(ctx, "tstbolaunch"); err != nil || stored.ExpiresAt == nil || !stored.ExpiresAt.After(*stored.ActivatesAt) {
+		t.Errorf("Expected the default expiry to count from activation, got %+v, %v", stored, err)
+	}
+
+	resp = doRequest(t, "POST", server.URL+"/api/shorten/batch", key, `[{"url":"https://example.com","activates_at":"2099-01-02T00:00:00Z","expires_at":"2099-01-01T00:00:00Z"}]`)
+	if body := batchResponse(t, resp); resp.StatusCode != http.StatusUnprocessableEntity || body.Results[0].Error == nil || body.Results[0].Error.Code != handlers.CodeInvalidRequest {
+		t.Errorf("Expected activation after expiry to fail, got %d %+v", resp.StatusCode, body.Results)
+	}
+
+	if r := body.Results[3].Result; r == nil || r.RedirectType != "302" {
+		t.Errorf("Expected redirect_type in the result, got %+v", body.Results[3])
+	}
+	if resp := doRequest(t, "GET", server.URL+"/tstbofound", "", ""); resp.StatusCode != http.StatusFound {
+		t.Errorf("Expected a 302 redirect, got %d", resp.StatusCode)
+	}
+
+	if r := body.Results[4].Result; r == nil || !r.ForcePreview {
+		t.Errorf("Expected force_preview in the result, got %+v", body.Results[4])
+	}
+	if resp := doRequest(t, "GET", server.URL+"/tstbolook", "", ""); resp.StatusCode != http.StatusOK || resp.Header.Get("Location") != "" {
+		t.Errorf("Expected the preview instead of a redirect, got %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	if r := body.Results[5].Result; r == nil || r.QueryPassthrough != "append" || !r.PathPassthrough {
+		t.Errorf("Expected the passthrough options in the result, got %+v", body.Results[5])
+	}
+	resp = doRequest(t, "GET", server.URL+"/tstbodocs/guide?lang=de", "", "")
+	if want := "https://docs.example.com/v2/guide?lang=en&lang=de"; resp.Header.Get("Location") != want {
+		t.Errorf("Expected a redirect to %s, got %d %q", want, resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	const tagged = "https://example.com/p?ref=x&utm_source=news+letter&utm_campaign=spring&lang=en"
+	if r := body.Results[6].Result; r == nil || r.OriginalURL != tagged || r.UTM != (db.UTM{Source: "news letter", Campaign: "spring"}) {
+		t.Errorf("Expected the UTM parameters to be added, got %+v", body.Results[6])
+	}
+	if stored, err := repo.GetShortURL(ctx, "tstboutm"); err != nil || stored.OriginalURL != tagged || stored.UTM.Campaign != "spring" {
+		t.Errorf("Expected the tagged URL to be stored, got %+v, %v", stored, err)
+	}
+
+	resp = doRequest(t, "POST", server.URL+"/api/shorten/batch", key, `[{"url":"https://example.com","redirect_type":"303"}]`)
+	if body := batchResponse(t, resp); resp.StatusCode != http.StatusUnprocessableEntity || body.Results[0].Error == nil || body.Results[0].Error.Code != handlers.CodeInvalidRequest {
+		t.Errorf("Expected an unknown redirect_type to fail, got %d %+v", resp.StatusCode, body.Results)
+	}
+
+	resp = doRequest(t, "POST", server.URL+"/api/shorten/batch", key, `[{"url":"https://example.com","query_passthrough":"merge"}]`)
+	if body := batchResponse(t, resp); resp.StatusCode != http.StatusUnprocessableEntity || body.Results[0].Error == nil || body.Results[0].Error.Code != handlers.CodeInvalidRequest {
+		t.Errorf("Expected an unknown query_passthrough to fail, got %d %+v", resp.StatusCode, body.Results)
+	}
+
+	resp = doRequest(t, "POST", server.URL+"/api/shorten/batch", key, `[{"url":"https://example.com/?utm_source=a","utm_source":"b"}]`)
+	if body := batchResponse(t, resp); resp.StatusCode != http.StatusUnprocessableEntity || body.Results[0].Error == nil || body.Results[0].Error.Code != handlers.CodeInvalidRequest {
+		t.Errorf("Expected a conflicting UTM parameter to fail, got %d %+v", resp.StatusCode, body.Results)
+	}
+
+	resp = doRequest(t, "POST", server.URL+"/api/shorten/batch", key, `[{"url":"https://example.com","max_clicks":-1}]`)
+	if body := batchResponse(t, resp); resp.StatusCode != http.StatusUnprocessableEntity || body.Results[0].Error == nil || body.Results[0].Error.Code != handlers.CodeInvalidRequest {
+		t.Errorf("Expected a negative max_clicks to fail, got %d %+v", resp.StatusCode, body.Results)
+	}
+
+	// CSV rows take the same options
+	resp = postCSV(t, server.URL+"/api/shorten/batch", key, "url,custom_code,password,max_clicks\nhttps://example.com/csv,tstbocsv,csv pass,3\n")
+	if body := batchResponse(t, resp); resp.StatusCode != http.StatusCreated || body.Results[0].Result == nil || !body.Results[0].Result.PasswordProtected || body.Results[0].Result.MaxClicks != 3 {
+		t.Errorf("Expected a protected link from CSV, got %d %+v", resp.StatusCode, body.Results)
+	}
+	resp = postCSV(t, server.URL+"/api/shorten/batch", key, "url,utm_source,utm_campaign\nhttps://example.com/csv,news,fall\n")
+	if body := batchResponse(t, resp); resp.StatusCode != http.StatusCreated || body.Results[0].Result == nil || body.Results[0].Result.OriginalURL != "https://example.com/csv?utm_source=news&utm_campaign=fall" {
+		t.Errorf("Expected UTM columns from CSV, got %d %+v", resp.StatusCode, body.Results)
+	}
+}
+
+// postCSV sends body to the batch endpoint as text/csv
+func postCSV(t *testing.T, batchURL, key, body string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest("POST", batchURL, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+key)
+	req.Header.Set("Content-Type", "text/csv")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestBatchShortenCSVRejects(t *testing.T) {
+	server, _, key := setupTestServer(t)
+	batchURL := server.URL + "/api/shorten/batch"
+
+	for name, body := range map[string]string{
+		"unknown column":   "url,title\nhttps://example.com,Home\n",
+		"repeated column":  "url,URL\nhttps://example.com,https://example.org\n",
+		"no url column":    "custom_code\ntstcsvx\n",
+		"ragged row":       "url,custom_code\nhttps://example.com\n",
+		"map column":       "url,query_params\nhttps://example.com,lang=en\n",
+		"bad number":       "url,max_clicks\nhttps://example.com,many\n",
+		"empty body":       "",
+		"misquoted column": "url\n\"https://example.com\n",
+	} {
+		resp := postCSV(t, batchURL, key, body)
+		if e := decodeError(t, resp); resp.StatusCode != http.StatusBadRequest || e.Code != handlers.CodeInvalidRequest {
+			t.Errorf("%s: expected 400, got %d %q", name, resp.StatusCode, e.Code)
+		}
+	}
+}
+
+func TestBatchShortenRejects(t *testing.T) {
+	server, _, key := setupTestServer(t)
+	batchURL := server.URL + "/api/shorten/batch"
+
+	var tooMany strings.Builder
+	tooMany.WriteString("[")
+	for i := 0; i <= 1000; i++ {
+		if i > 0 {
+			tooMany.WriteString(",")
+		}
+		fmt.Fprintf(&tooMany, `{"url":"https://example.com/%d"}`, i)
+	}
+	tooMany.WriteString("]")
+
+	tests := []struct {
+		name    string
+		url     string
+		token   string
+		body    string
+		status  int
+		errCode string
+	}{
+		{"no API key", batchURL, "", `[{"url":"https://example.com"}]`, http.StatusUnauthorized, middleware.CodeUnauthorized},
+		{"bad mode", batchURL + "?mode=maybe", key, `[{"url":"https://example.com"}]`, http.StatusBadRequest, handlers.CodeInvalidRequest},
+		{"not an array", batchURL, key, `{"url":"https://example.com"}`, http.StatusBadRequest, handlers.CodeInvalidRequest},
+		{"empty", batchURL, key, `[]`, http.StatusBadRequest, handlers.CodeInvalidRequest},
+		{"bad expiry", batchURL, key, `[{"url":"https://example.com","expires_at":"soon"}]`, http.StatusBadRequest, handlers.CodeInvalidRequest},
+		{"bad activation", batchURL, key, `[{"url":"https://example.com","activates_at":"soon"}]`, http.StatusBadRequest, handlers.CodeInvalidRequest},
+		{"too many items", batchURL, key, tooMany.String(), http.StatusRequestEntityTooLarge, handlers.CodeTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := doRequest(t, "POST", tt.url, tt.token, tt.body)
+			body := decodeError(t, resp)
+			if resp.StatusCode != tt.status || body.Code != tt.errCode {
+				t.Errorf("Expected %d %q, got %d %q", tt.status, tt.errCode, resp.StatusCode, body.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package tests
+
+import (
+	"context"
+	"go-url-shortener/internal/db"
+	"testing"
+	"time"
+)
+
+// setupCachedRepo wraps a fresh in-memory repository with the redirect cache
+func setupCachedRepo(t *testing.T, opts db.CacheOptions) (*db.CachedRepository, db.RepositoryInterface) {
+	inner := setupMemoryRepo(t)
+	return db.NewCachedRepository(inner, opts), inner
+}
+
+func TestCacheHitsAndCountsClicks(t *testing.T) {
+	cache, inner := setupCachedRepo(t, db.CacheOptions{Size: 10, TTL: time.Minute, NegativeTTL: time.Minute})
+	ctx := context.Background()
+
+	if err := cache.CreateShortURL(ctx, &db.URL{OriginalURL: "https://example.com", ShortCode: "tsthit"}); err != nil {
+		t.Fatalf("Failed to create URL: %v", err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		url, err := cache.GetShortURLForRedirect(ctx, "tsthit")
+		if err != nil {
+			t.Fatalf("Error resolving redirect: %v", err)
+		}
+		if url.ClickCount != i {
+			t.Errorf("Expected click count %d, got %d", i, url.ClickCount)
+		}
+	}
+
+	stats := cache.Stats()
+	if stats.Misses != 1 || stats.Hits != 2 {
+		t.Errorf("Expected 1 miss and 2 hits, got %d misses and %d hits", stats.Misses, stats.Hits)
+	}
+
+	// Clicks served from the cache still reach the underlying repository
+	stored, err := inner.GetShortURL(ctx, "tsthit")
+	if err != nil {
+		t.Fatalf("Error retrieving short URL: %v", err)
+	}
+	if stored.ClickCount != 3 {
+		t.Errorf("Expected stored click count 3, got %d", stored.ClickCount)
+	}
+}
+
+func TestCacheInvalidatesOnDelete(t *testing.T) {
+	cache, _ := setupCachedRepo(t, db.CacheOptions{Size: 10, TTL: time.Minute})
+	ctx := context.Background()
+
+	if err := cache.CreateShortURL(ctx, &db.URL{OriginalURL: "https://example.com", ShortCode: "tstinv"}); err != nil {
+		t.Fatalf("Failed to create URL: %v", err)
+	}
+	if _, err := cache.GetShortURLForRedirect(ctx, "tstinv"); err != nil {
+		t.Fatalf("Error resolving redirect: %v", err)
+	}
+
+	if err := cache.DeleteShortURL(ctx, "tstinv"); err != nil {
+		t.Fatalf("Error deleting short URL: %v", err)
+	}
+
+	if _, err := cache.GetShortURLForRedirect(ctx, "tstinv"); err == nil {
+		t.Error("Expected error when redirecting to deleted short URL, got nil")
+	}
+}
+
+func TestCacheDropsLinksDeletedElsewhere(t *testing.T) {
+	cache, inner := setupCachedRepo(t, db.CacheOptions{Size: 10, TTL: time.Minute})
+	ctx := context.Background()
+
+	if err := cache.CreateShortURL(ctx, &db.URL{OriginalURL: "https://example.com", ShortCode: "tstext"}); err != nil {
+		t.Fatalf("Failed to create URL: %v", err)
+	}
+	if _, err := cache.GetShortURLForRedirect(ctx, "tstext"); err != nil {
+		t.Fatalf("Error resolving redirect: %v", err)
+	}
+
+	// Simulate another replica deleting the link
+	if err := inner.DeleteShortURL(ctx, "tstext"); err != nil {
+		t.Fatalf("Error deleting short URL: %v", err)
+	}
+
+	if _, err := cache.GetShortURLForRedirect(ctx, "tstext"); err == nil {
+		t.Error("Expected error when redirecting to a link deleted elsewhere, got nil")
+	}
+	if cache.Stats().Entries != 0 {
+		t.Error("Expected the stale entry to be dropped")
+	}
+}
+
+func TestCacheNegativeEntries(t *testing.T) {
+	cache, _ := setupCachedRepo(t, db.CacheOptions{Size: 10, TTL: time.Minute, NegativeTTL: time.Minute})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, err := cache.GetShortURLForRedirect(ctx, "tstneg"); err == nil {
+			t.Fatal("Expected error for unknown short code, got nil")
+		}
+	}
+
+	if stats := cache.Stats(); stats.NegativeHits != 1 {
+		t.Errorf("Expected 1 negative hit, got %d", stats.NegativeHits)
+	}
+
+	// Creating the code must replace the negative entry
+	if err := cache.CreateShortURL(ctx, &db.URL{OriginalURL: "https://example.com", ShortCode: "tstneg"}); err != nil {
+		t.Fatalf("Failed to create URL: %v", err)
+	}
+	if _, err := cache.GetShortURLForRedirect(ctx, "tstneg"); err != nil {
+		t.Errorf("Expected newly created code to resolve, got %v", err)
+	}
+}
+
+func TestCacheRespectsLinkExpiry(t *testing.T) {
+	cache, _ := setupCachedRepo(t, db.CacheOptions{Size: 10, TTL: time.Hour})
+	ctx := context.Background()
+
+	expiresAt := time.Now().Add(100 * time.Millisecond)
+	if err := cache.CreateShortURL(ctx, &db.URL{OriginalURL: "https://example.com", ShortCode: "tstttl", ExpiresAt: &expiresAt}); err != nil {
+		t.Fatalf("Failed to create URL: %v", err)
+	}
+	if _, err := cache.GetShortURLForRedirect(ctx, "tstttl"); err != nil {
+		t.Fatalf("Error resolving redirect: %v", err)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+
+	if _, err := cache.GetShortURLForRedirect(ctx, "tstttl"); err == nil {
+		t.Error("Expected error when redirecting to an expired cached link, got nil")
+	}
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache, _ := setupCachedRepo(t, db.CacheOptions{Size: 2, TTL: time.Minute})
+	ctx := context.Background()
+
+	for _, code := range []string{"tstlr1", "tstlr2", "tstlr3"} {
+		if err := cache.CreateShortURL(ctx, &db.URL{OriginalURL: "https://example.com", ShortCode: code}); err != nil {
+			t.Fatalf("Failed to create URL: %v", err)
+		}
+		if _, err := cache.GetShortURLForRedirect(ctx, code); err != nil {
+			t.Fatalf("Error resolving redirect: %v", err)
+		}
+	}
+
+	stats := cache.Stats()
+	if stats.Entries != 2 || stats.Evictions != 1 {
+		t.Errorf("Expected 2 entries and 1 eviction, got %d entries and %d evictions", stats.Entries, stats.Evictions)
+	}
+
+	// tstlr1 was evicted, so resolving it is a miss
+	if _, err := cache.GetShortURLForRedirect(ctx, "tstlr1"); err != nil {
+		t.Fatalf("Error resolving redirect: %v", err)
+	}
+	if stats := cache.Stats(); stats.Misses != 4 {
+		t.Errorf("Expected 4 misses, got %d", stats.Misses)
+	}
+}
+
+// pausedRepository holds redirect lookups after they have read the link
+// until release is closed
+type pausedRepository struct {
+	db.RepositoryInterface
+	read    chan struct{}
+	release chan struct{}
+}
+
+func (p *pausedRepository) GetShortURLForRedirect(ctx context.Context, code string) (*db.URL, error) {
+	url, err := p.RepositoryInterface.GetShortURLForRedirect(ctx, code)
+	close(p.read)
+	<-p.release
+	return url, err
+}
+
+func TestCacheIgnoresLookupsRacingWrites(t *testing.T) {
+	inner := setupMemoryRepo(t)
+	paused := &pausedRepository{RepositoryInterface: inner, read: make(chan struct{}), release: make(chan struct{})}
+	cache := db.NewCachedRepository(paused, db.CacheOptions{Size: 10, TTL: time.Minute})
+	ctx := context.Background()
+
+	if err := inner.CreateShortURL(ctx, &db.URL{OriginalURL: "https://example.com", ShortCode: "tstrace"}); err != nil {
+		t.Fatalf("Failed to create URL: %v", err)
+	}
+
+	// A lookup reads the link, then the link is deleted before the lookup
+	// gets to cache it
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cache.GetShortURLForRedirect(ctx, "tstrace")
+	}()
+	<-paused.read
+
+	if err := cache.DeleteShortURL(ctx, "tstrace"); err != nil {
+		t.Fatalf("Failed to delete URL: %v", err)
+	}
+	close(paused.release)
+	<-done
+
+	if n := cache.Stats().Entries; n != 0 {
+		t.Errorf("Expected the stale row not to be cached, got %d entries", n)
+	}
+
+	paused.read = make(chan struct{})
+	if _, err := cache.GetShortURLForRedirect(ctx, "tstrace"); err == nil {
+		t.Error("Expected the deleted link not to resolve")
+	}
+}
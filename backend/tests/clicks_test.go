@@ -0,0 +1,203 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"go-url-shortener/internal/clicks"
+	"go-url-shortener/internal/db"
+	"testing"
+	"time"
+)
+
+// blockingRepo holds AddClickEvents until release is closed, so the
+// recorder's queue can be filled deterministically
+type blockingRepo struct {
+	db.RepositoryInterface
+	release chan struct{}
+}
+
+func (b *blockingRepo) AddClickEvents(ctx context.Context, events []*db.ClickEvent) error {
+	<-b.release
+	return b.RepositoryInterface.AddClickEvents(ctx, events)
+}
+
+func createRecorderTestURL(t *testing.T, repo db.RepositoryInterface, code string) *db.URL {
+	url := &db.URL{OriginalURL: "https://example.com/" + code, ShortCode: code}
+	if err := repo.CreateShortURL(context.Background(), url); err != nil {
+		t.Fatalf("Failed to create URL: %v", err)
+	}
+	return url
+}
+
+func TestRecorderWritesEventsOnClose(t *testing.T) {
+	repo := setupMemoryRepo(t)
+	url := createRecorderTestURL(t, repo, "tstrec")
+
+	// A long flush interval means only Close can write the events
+	recorder := clicks.NewRecorder(repo, clicks.Options{
+		QueueSize:     100,
+		Workers:       2,
+		BatchSize:     1000,
+		FlushInterval: time.Hour,
+	})
+
+	for i := 0; i < 25; i++ {
+		if err := recorder.Record(context.Background(), &db.ClickEvent{URLId: url.ID, IPAddress: "10.0.0.1"}); err != nil {
+			t.Fatalf("Error recording click: %v", err)
+		}
+	}
+
+	if err := recorder.Close(context.Background()); err != nil {
+		t.Fatalf("Error closing recorder: %v", err)
+	}
+
+	events, err := repo.GetClickEvents(context.Background(), url.ID)
+	if err != nil {
+		t.Fatalf("Error retrieving click events: %v", err)
+	}
+	if len(events) != 25 {
+		t.Errorf("Expected 25 click events after close, got %d", len(events))
+	}
+
+	stats := recorder.Stats()
+	if stats.Recorded != 25 || stats.Dropped != 0 {
+		t.Errorf("Expected 25 recorded and 0 dropped, got %d and %d", stats.Recorded, stats.Dropped)
+	}
+
+	if err := recorder.Record(context.Background(), &db.ClickEvent{URLId: url.ID}); !errors.Is(err, clicks.ErrClosed) {
+		t.Errorf("Expected ErrClosed when recording after close, got %v", err)
+	}
+}
+
+func TestRecorderDropsWhenFull(t *testing.T) {
+	inner := setupMemoryRepo(t)
+	url := createRecorderTestURL(t, inner, "tstdrp")
+	repo := &blockingRepo{RepositoryInterface: inner, release: make(chan struct{})}
+
+	recorder := clicks.NewRecorder(repo, clicks.Options{
+		QueueSize:     2,
+		Workers:       1,
+		BatchSize:     1,
+		FlushInterval: time.Hour,
+		Backpressure:  clicks.Drop,
+	})
+
+	// One event is held by the blocked worker and two fill the queue, so at
+	// least the remaining ones must be dropped
+	dropped := 0
+	for i := 0; i < 10; i++ {
+		err := recorder.Record(context.Background(), &db.ClickEvent{URLId: url.ID})
+		if errors.Is(err, clicks.ErrQueueFull) {
+			dropped++
+		} else if err != nil {
+			t.Fatalf("Expected ErrQueueFull, got %v", err)
+		}
+	}
+	if dropped < 7 {
+		t.Errorf("Expected at least 7 dropped events, got %d", dropped)
+	}
+
+	close(repo.release)
+	if err := recorder.Close(context.Background()); err != nil {
+		t.Fatalf("Error closing recorder: %v", err)
+	}
+
+	stats := recorder.Stats()
+	if int(stats.Dropped) != dropped {
+		t.Errorf("Expected dropped counter %d, got %d", dropped, stats.Dropped)
+	}
+	if stats.Recorded+stats.Dropped != 10 {
+		t.Errorf("Expected recorded+dropped to be 10, got %d", stats.Recorded+stats.Dropped)
+	}
+}
+
+func TestRecorderBlockHonorsContext(t *testing.T) {
+	inner := setupMemoryRepo(t)
+	url := createRecorderTestURL(t, inner, "tstblk")
+	repo := &blockingRepo{RepositoryInterface: inner, release: make(chan struct{})}
+
+	recorder := clicks.NewRecorder(repo, clicks.Options{
+		QueueSize:     1,
+		Workers:       1,
+		BatchSize:     1,
+		FlushInterval: time.Hour,
+		Backpressure:  clicks.Block,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	var err error
+	for i := 0; i < 5 && err == nil; i++ {
+		err = recorder.Record(ctx, &db.ClickEvent{URLId: url.ID})
+	}
+	if err == nil {
+		t.Error("Expected Record to give up once the context expired, got nil")
+	}
+
+	close(repo.release)
+	if err := recorder.Close(context.Background()); err != nil {
+		t.Fatalf("Error closing recorder: %v", err)
+	}
+}
+
+func TestRecorderFlushesCounts(t *testing.T) {
+	repo := setupMemoryRepo(t)
+	createRecorderTestURL(t, repo, "tstcnt")
+
+	recorder := clicks.NewRecorder(repo, clicks.Options{FlushInterval: time.Hour})
+
+	clickedAt := time.Now()
+	for i := 0; i < 4; i++ {
+		if err := recorder.CountClick(context.Background(), "tstcnt", clickedAt); err != nil {
+			t.Fatalf("Error counting click: %v", err)
+		}
+	}
+	// Counts for links that disappeared are reported as failed
+	if err := recorder.CountClick(context.Background(), "nonexist", clickedAt); err != nil {
+		t.Fatalf("Error counting click: %v", err)
+	}
+
+	if err := recorder.Close(context.Background()); err != nil {
+		t.Fatalf("Error closing recorder: %v", err)
+	}
+
+	stored, err := repo.GetShortURL(context.Background(), "tstcnt")
+	if err != nil {
+		t.Fatalf("Error retrieving short URL: %v", err)
+	}
+	if stored.ClickCount != 4 {
+		t.Errorf("Expected click count 4 after flush, got %d", stored.ClickCount)
+	}
+
+	stats := recorder.Stats()
+	if stats.CountsFlushed != 4 || stats.CountsFailed != 1 {
+		t.Errorf("Expected 4 flushed and 1 failed count, got %d and %d", stats.CountsFlushed, stats.CountsFailed)
+	}
+}
+
+// suffixEnricher appends itself to the city, to show the order enrichers
+// ran in
+type suffixEnricher string
+
+func (s suffixEnricher) Enrich(event *db.ClickEvent) {
+	event.City += string(s)
+}
+
+func TestRecorderEnrichers(t *testing.T) {
+	repo := setupMemoryRepo(t)
+	url := createRecorderTestURL(t, repo, "tstenrich")
+
+	recorder := clicks.NewRecorder(repo, clicks.Options{Enrichers: []clicks.Enricher{suffixEnricher("a"), suffixEnricher("b")}})
+	if err := recorder.Record(context.Background(), &db.ClickEvent{URLId: url.ID}); err != nil {
+		t.Fatalf("Error recording click: %v", err)
+	}
+	if err := recorder.Close(context.Background()); err != nil {
+		t.Fatalf("Error closing recorder: %v", err)
+	}
+
+	events, err := repo.GetClickEvents(context.Background(), url.ID)
+	if err != nil || len(events) != 1 || events[0].City != "ab" {
+		t.Errorf("Expected the enrichers to run in order, got %+v, %v", events, err)
+	}
+}
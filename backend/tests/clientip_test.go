@@ -0,0 +1,62 @@
+package tests
+
+import (
+	"go-url-shortener/internal/middleware"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestRealIP(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("2001:db8::/32")}
+
+	tests := []struct {
+		name   string
+		remote string
+		xff    []string
+		realIP string
+		want   string
+	}{
+		{"direct", "203.0.113.1:1234", nil, "", "203.0.113.1"},
+		{"spoofed XFF", "203.0.113.1:1234", []string{"198.51.100.7"}, "", "203.0.113.1"},
+		{"spoofed X-Real-IP", "203.0.113.1:1234", nil, "198.51.100.7", "203.0.113.1"},
+		{"IPv6 direct", "[2001:db9::1]:1234", nil, "", "2001:db9::1"},
+		{"trusted proxy", "10.0.0.2:1234", []string{"198.51.100.7"}, "", "198.51.100.7"},
+		{"client-supplied entry", "10.0.0.2:1234", []string{"192.0.2.99, 198.51.100.7"}, "", "198.51.100.7"},
+		{"proxy chain", "10.0.0.2:1234", []string{"192.0.2.99, 198.51.100.7", "10.1.1.1"}, "", "198.51.100.7"},
+		{"only proxies", "10.0.0.2:1234", []string{"10.0.0.3, 10.0.0.4"}, "", "10.0.0.3"},
+		{"malformed entry", "10.0.0.2:1234", []string{"198.51.100.7, junk, 10.0.0.3"}, "", "10.0.0.3"},
+		{"trusted X-Real-IP", "[2001:db8::2]:1234", nil, "198.51.100.7", "198.51.100.7"},
+		{"malformed X-Real-IP", "10.0.0.2:1234", nil, "junk", "10.0.0.2"},
+	}
+
+	for _, tc := range tests {
+		var got string
+		handler := middleware.RealIP(trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = middleware.ClientIP(r)
+		}))
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = tc.remote
+		for _, xff := range tc.xff {
+			req.Header.Add("X-Forwarded-For", xff)
+		}
+		if tc.realIP != "" {
+			req.Header.Set("X-Real-IP", tc.realIP)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		if got != tc.want {
+			t.Errorf("%s: expected %s, got %s", tc.name, tc.want, got)
+		}
+	}
+
+	// Without the middleware only the connection counts
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "203.0.113.1:1234"
+	req.Header.Set("X-Forwarded-For", "198.51.100.7")
+	if got := middleware.ClientIP(req); got != "203.0.113.1" {
+		t.Errorf("Expected the connection address, got %s", got)
+	}
+}
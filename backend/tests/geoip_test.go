@@ -0,0 +1,342 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"go-url-shortener/internal/api"
+	"go-url-shortener/internal/api/handlers"
+	"go-url-shortener/internal/clicks"
+	"go-url-shortener/internal/core"
+	"go-url-shortener/internal/geoip"
+	"go-url-shortener/internal/useragent"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// writeMMDB writes a MaxMind DB with one record per network, in the format
+// geoip reads: a search tree, 16 zero bytes, the data section and then the
+// metadata. IPv4 networks in an IPv6 tree go under 96 zero bits.
+func writeMMDB(t *testing.T, path string, ipVersion, recordSize int, networks map[string]map[string]any) {
+	t.Helper()
+
+	var data bytes.Buffer
+	nodes := [][2]int{{}} // 0 is empty, >0 a node, <0 -(data offset + 1)
+	for network, record := range networks {
+		prefix, err := netip.ParsePrefix(network)
+		if err != nil {
+			t.Fatalf("Bad test network %s: %v", network, err)
+		}
+
+		var addr []byte
+		bits := prefix.Bits()
+		if prefix.Addr().Is4() {
+			a := prefix.Addr().As4()
+			addr = a[:]
+			if ipVersion == 6 {
+				addr = append(make([]byte, 12), addr...)
+				bits += 96
+			}
+		} else {
+			a := prefix.Addr().As16()
+			addr = a[:]
+		}
+
+		leaf := -(data.Len() + 1)
+		encodeMMDB(&data, record)
+
+		node := 0
+		for i := 0; i < bits; i++ {
+			bit := int(addr[i/8]>>(7-i%8)) & 1
+			if i == bits-1 {
+				nodes[node][bit] = leaf
+				break
+			}
+			if nodes[node][bit] <= 0 {
+				nodes = append(nodes, [2]int{})
+				nodes[node][bit] = len(nodes) - 1
+			}
+			node = nodes[node][bit]
+		}
+	}
+
+	var file bytes.Buffer
+	nodeCount := len(nodes)
+	for _, node := range nodes {
+		var values [2]uint32
+		for i, record := range node {
+			switch {
+			case record == 0:
+				values[i] = uint32(nodeCount)
+			case record > 0:
+				values[i] = uint32(record)
+			default:
+				values[i] = uint32(nodeCount + 16 - record - 1)
+			}
+		}
+
+		left, right := values[0], values[1]
+		switch recordSize {
+		case 24:
+			file.Write([]byte{byte(left >> 16), byte(left >> 8), byte(left), byte(right >> 16), byte(right >> 8), byte(right)})
+		case 28:
+			file.Write([]byte{byte(left >> 16), byte(left >> 8), byte(left), byte(left>>24)<<4 | byte(right>>24), byte(right >> 16), byte(right >> 8), byte(right)})
+		default:
+			file.Write([]byte{byte(left >> 24), byte(left >> 16), byte(left >> 8), byte(left), byte(right >> 24), byte(right >> 16), byte(right >> 8), byte(right)})
+		}
+	}
+	file.Write(make([]byte, 16))
+	file.Write(data.Bytes())
+	file.WriteString("\xAB\xCD\xEFMaxMind.com")
+	encodeMMDB(&file, map[string]any{
+		"node_count":                  uint64(nodeCount),
+		"record_size":                 uint64(recordSize),
+		"ip_version":                  uint64(ipVersion),
+		"binary_format_major_version": uint64(2),
+		"binary_format_minor_version": uint64(0),
+		"build_epoch":                 uint64(time.Now().Unix()),
+		"database_type":               "Test-City",
+		"languages":                   []any{"en"},
+	})
+
+	// Write next to path and rename, as geoipupdate does
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, file.Bytes(), 0o644); err != nil {
+		t.Fatalf("Failed to write test database: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatalf("Failed to write test database: %v", err)
+	}
+}
+
+// encodeMMDB appends a value in the MaxMind DB data format. Strings, maps,
+// arrays and uint64 values (written as uint32 when they fit) are supported.
+func encodeMMDB(buf *bytes.Buffer, value any) {
+	control := func(typ byte, size int) {
+		head := []byte{0}
+		if typ > 7 {
+			head = append(head, typ-7)
+		} else {
+			head[0] = typ << 5
+		}
+		if size < 29 {
+			head[0] |= byte(size)
+		} else {
+			head[0] |= 29
+			head = append(head, byte(size-29))
+		}
+		buf.Write(head)
+	}
+
+	switch v := value.(type) {
+	case string:
+		control(2, len(v))
+		buf.WriteString(v)
+	case uint64:
+		typ, width := byte(6), 4
+		if v > 1<<32-1 {
+			typ, width = 9, 8
+		}
+		control(typ, width)
+		for i := width - 1; i >= 0; i-- {
+			buf.WriteByte(byte(v >> (8 * i)))
+		}
+	case []any:
+		control(11, len(v))
+		for _, item := range v {
+			encodeMMDB(buf, item)
+		}
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		control(7, len(v))
+		for _, key := range keys {
+			encodeMMDB(buf, key)
+			encodeMMDB(buf, v[key])
+		}
+	default:
+		panic("unsupported test value")
+	}
+}
+
+// cityRecord is a GeoIP2 City record with English names
+func cityRecord(country, region, city string) map[string]any {
+	record := map[string]any{"country": map[string]any{"iso_code": country}}
+	if region != "" {
+		record["subdivisions"] = []any{map[string]any{"iso_code": "X", "names": map[string]any{"en": region, "de": "x"}}}
+	}
+	if city != "" {
+		record["city"] = map[string]any{"geoname_id": uint64(2643743), "names": map[string]any{"en": city}}
+	}
+	return record
+}
+
+func TestGeoIPLookup(t *testing.T) {
+	for _, recordSize := range []int{24, 28, 32} {
+		path := filepath.Join(t.TempDir(), "city.mmdb")
+		writeMMDB(t, path, 6, recordSize, map[string]map[string]any{
+			"81.2.69.0/24":    cityRecord("GB", "England", "London"),
+			"2001:db8::/32":   cityRecord("DE", "", ""),
+			"203.0.113.64/26": cityRecord("AU", "New South Wales", "Sydney"),
+		})
+
+		database, err := geoip.Open(path)
+		if err != nil {
+			t.Fatalf("Record size %d: failed to open database: %v", recordSize, err)
+		}
+		if database.Type != "Test-City" {
+			t.Errorf("Expected the database type from the metadata, got %q", database.Type)
+		}
+
+		for ip, want := range map[string]geoip.Location{
+			"81.2.69.160":       {Country: "GB", Region: "England", City: "London"},
+			"::ffff:81.2.69.1":  {Country: "GB", Region: "England", City: "London"},
+			"2001:db8:1::1":     {Country: "DE"},
+			"203.0.113.100":     {Country: "AU", Region: "New South Wales", City: "Sydney"},
+			"203.0.113.1":       {},
+			"10.0.0.1":          {},
+			"2a00:1450:4001::1": {},
+		} {
+			loc, err := database.Lookup(netip.MustParseAddr(ip))
+			if err != nil || loc != want {
+				t.Errorf("Record size %d: expected %s to be %+v, got %+v, %v", recordSize, ip, want, loc, err)
+			}
+		}
+	}
+
+	// IPv4 databases have no IPv6 addresses
+	path := filepath.Join(t.TempDir(), "v4.mmdb")
+	writeMMDB(t, path, 4, 24, map[string]map[string]any{"81.2.69.0/24": cityRecord("GB", "", "")})
+	database, err := geoip.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open IPv4 database: %v", err)
+	}
+	if loc, err := database.Lookup(netip.MustParseAddr("81.2.69.1")); err != nil || loc.Country != "GB" {
+		t.Errorf("Expected GB, got %+v, %v", loc, err)
+	}
+	if loc, err := database.Lookup(netip.MustParseAddr("2001:db8::1")); err != nil || loc != (geoip.Location{}) {
+		t.Errorf("Expected no location for IPv6, got %+v, %v", loc, err)
+	}
+
+	if err := os.WriteFile(path, []byte("not a database"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := geoip.Open(path); err == nil {
+		t.Error("Expected an error opening a file that is not a database")
+	}
+}
+
+func TestGeoIPResolverReloads(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "city.mmdb")
+	writeMMDB(t, path, 6, 24, map[string]map[string]any{"81.2.69.0/24": cityRecord("GB", "England", "London")})
+
+	resolver, err := geoip.NewResolver(path, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Failed to load database: %v", err)
+	}
+	defer resolver.Close()
+
+	if loc := resolver.Lookup("81.2.69.1"); loc.City != "London" {
+		t.Fatalf("Expected London, got %+v", loc)
+	}
+	if loc := resolver.Lookup("not an ip"); loc != (geoip.Location{}) {
+		t.Errorf("Expected no location for a bad address, got %+v", loc)
+	}
+
+	waitForCity := func(want string) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for resolver.Lookup("81.2.69.1").City != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected the database to be reloaded with %s, got %+v", want, resolver.Lookup("81.2.69.1"))
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// A replaced file is picked up without a restart
+	writeMMDB(t, path, 6, 24, map[string]map[string]any{"81.2.69.0/24": cityRecord("GB", "Scotland", "Edinburgh")})
+	waitForCity("Edinburgh")
+
+	// A broken file is ignored and the last good database stays in use
+	if err := os.WriteFile(path, []byte("truncated"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	waitForCity("Edinburgh")
+	if err := resolver.Reload(); err == nil {
+		t.Error("Expected an error reloading a broken file")
+	}
+
+	if _, err := geoip.NewResolver(filepath.Join(t.TempDir(), "missing.mmdb"), 0); err == nil {
+		t.Error("Expected an error for a missing database")
+	}
+}
+
+func TestGeoIPClickAnalytics(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "city.mmdb")
+	writeMMDB(t, path, 6, 24, map[string]map[string]any{
+		"81.2.69.0/24":  cityRecord("GB", "England", "London"),
+		"2001:db8::/32": cityRecord("DE", "", ""),
+	})
+	resolver, err := geoip.NewResolver(path, 0)
+	if err != nil {
+		t.Fatalf("Failed to load database: %v", err)
+	}
+	defer resolver.Close()
+
+	repo := setupMemoryRepo(t)
+	recorder := clicks.NewRecorder(repo, clicks.Options{FlushInterval: 10 * time.Millisecond, Enrichers: []clicks.Enricher{clicks.EnricherFunc(useragent.Enrich), resolver}})
+	t.Cleanup(func() { recorder.Close(context.Background()) })
+	cfg := testConfig()
+	cfg.TrustedProxies = []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32"), netip.MustParsePrefix("::1/128")}
+	server := httptest.NewServer(api.NewRouter(cfg, core.NewShortener(repo), repo, recorder))
+	t.Cleanup(server.Close)
+	key := createTestAPIKey(t, repo, "alice")
+
+	doRequest(t, "POST", server.URL+"/api/shorten", key, `{"url":"https://example.com/geo","custom_code":"tstgeo"}`)
+	for _, ip := range []string{"81.2.69.10", "81.2.69.11", "2001:db8::5", "192.0.2.1"} {
+		req, _ := http.NewRequest("GET", server.URL+"/tstgeo", nil)
+		req.Header.Set("X-Forwarded-For", ip)
+		req.Header.Set("User-Agent", uaChromeWindows)
+		resp, err := noRedirectClient.Do(req)
+		if err != nil {
+			t.Fatalf("Redirect failed: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	stored, err := repo.GetShortURL(context.Background(), "tstgeo")
+	if err != nil {
+		t.Fatalf("Failed to get link: %v", err)
+	}
+	waitForClicks(t, repo, stored.ID, 4)
+
+	var analytics handlers.AnalyticsResponse
+	resp := doRequest(t, "GET", server.URL+"/api/analytics/tstgeo", key, "")
+	if err := json.NewDecoder(resp.Body).Decode(&analytics); err != nil {
+		t.Fatalf("Failed to decode analytics: %v", err)
+	}
+
+	summary := analytics.Summary
+	if summary.TopCountries["GB"] != 2 || summary.TopCountries["DE"] != 1 || summary.TopCountries["Unknown"] != 1 {
+		t.Errorf("Unexpected country breakdown %v", summary.TopCountries)
+	}
+	if summary.TopCities["London, England, GB"] != 2 || summary.TopCities["Unknown"] != 2 {
+		t.Errorf("Unexpected city breakdown %v", summary.TopCities)
+	}
+	for _, event := range analytics.ClickEvents {
+		if event.IPAddress == "81.2.69.10" && (event.Country != "GB" || event.Region != "England" || event.City != "London") {
+			t.Errorf("Expected the click to carry its location, got %+v", event)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go-url-shortener/internal/api/handlers"
+	"go-url-shortener/internal/db"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// checkConcurrentClickLimit fires many concurrent redirects at a link
+// limited to 3 clicks and checks that exactly 3 get through
+func checkConcurrentClickLimit(t *testing.T, repo db.RepositoryInterface, code string) {
+	ctx := context.Background()
+	if err := repo.CreateShortURL(ctx, &db.URL{OriginalURL: "https://example.com/limited", ShortCode: code, MaxClicks: 3}); err != nil {
+		t.Fatalf("Failed to create URL: %v", err)
+	}
+
+	var (
+		wg        sync.WaitGroup
+		succeeded atomic.Int64
+		exhausted atomic.Int64
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := repo.GetShortURLForRedirect(ctx, code)
+			switch {
+			case err == nil:
+				succeeded.Add(1)
+			case errors.Is(err, db.ErrExhausted):
+				exhausted.Add(1)
+			default:
+				t.Errorf("Unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if succeeded.Load() != 3 || exhausted.Load() != 17 {
+		t.Errorf("Expected 3 redirects and 17 exhausted, got %d and %d", succeeded.Load(), exhausted.Load())
+	}
+
+	stored, err := repo.GetShortURL(ctx, code)
+	if err != nil {
+		t.Fatalf("Expected an exhausted link to stay readable, got %v", err)
+	}
+	if stored.ClickCount != 3 || stored.GetStatus() != "exhausted" {
+		t.Errorf("Expected 3 clicks and status exhausted, got %d and %q", stored.ClickCount, stored.GetStatus())
+	}
+}
+
+func TestMaxClicksConcurrentRedirects(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo db.RepositoryInterface) {
+		defer cleanupTestURL(t, repo, "tstmax")
+		checkConcurrentClickLimit(t, repo, "tstmax")
+	})
+
+	// Cache hits count clicks without asking the database, so limited
+	// links must not be served from the cache
+	t.Run("cached", func(t *testing.T) {
+		cache, _ := setupCachedRepo(t, db.CacheOptions{Size: 10, TTL: time.Minute})
+		checkConcurrentClickLimit(t, cache, "tstmax")
+	})
+}
+
+func TestMaxClicksStatusFilter(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo db.RepositoryInterface) {
+		ctx := context.Background()
+		defer cleanupTestURL(t, repo, "tstmaxa")
+		defer cleanupTestURL(t, repo, "tstmaxe")
+
+		for _, url := range []*db.URL{
+			{OriginalURL: "https://example.com/maxfilter", ShortCode: "tstmaxa", MaxClicks: 2},
+			{OriginalURL: "https://example.com/maxfilter", ShortCode: "tstmaxe", MaxClicks: 1},
+		} {
+			if err := repo.CreateShortURL(ctx, url); err != nil {
+				t.Fatalf("Failed to create URL: %v", err)
+			}
+			if _, err := repo.GetShortURLForRedirect(ctx, url.ShortCode); err != nil {
+				t.Fatalf("Error resolving redirect: %v", err)
+			}
+		}
+
+		for status, want := range map[string]string{
+			db.StatusActive:    "tstmaxa",
+			db.StatusExhausted: "tstmaxe",
+		} {
+			page, err := repo.ListURLs(ctx, db.ListOptions{Status: status, URLContains: "maxfilter"})
+			if err != nil {
+				t.Fatalf("Error listing %s URLs: %v", status, err)
+			}
+			if len(page.URLs) != 1 || page.URLs[0].ShortCode != want || page.Total != 1 {
+				t.Errorf("Expected only %s to be %s, got %d links", want, status, len(page.URLs))
+			}
+		}
+	})
+}
+
+func TestMaxClicksProtectedLinkCountsUnlocks(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo db.RepositoryInterface) {
+		ctx := context.Background()
+		defer cleanupTestURL(t, repo, "tstmaxpw")
+
+		url := &db.URL{OriginalURL: "https://example.com", ShortCode: "tstmaxpw", MaxClicks: 1, PasswordHash: "pbkdf2-sha256$1$c2FsdA$aGFzaA"}
+		if err := repo.CreateShortURL(ctx, url); err != nil {
+			t.Fatalf("Failed to create URL: %v", err)
+		}
+
+		// Showing the password form is not a click
+		for i := 0; i < 2; i++ {
+			got, err := repo.GetShortURLForRedirect(ctx, "tstmaxpw")
+			if err != nil || got.ClickCount != 0 {
+				t.Fatalf("Expected the protected link uncounted, got %+v, %v", got, err)
+			}
+		}
+
+		if got, err := repo.UnlockShortURL(ctx, "tstmaxpw"); err != nil || got.ClickCount != 1 {
+			t.Fatalf("Expected the unlock to count, got %+v, %v", got, err)
+		}
+		if _, err := repo.UnlockShortURL(ctx, "tstmaxpw"); !errors.Is(err, db.ErrExhausted) {
+			t.Errorf("Expected ErrExhausted, got %v", err)
+		}
+		if _, err := repo.GetShortURLForRedirect(ctx, "tstmaxpw"); !errors.Is(err, db.ErrExhausted) {
+			t.Errorf("Expected ErrExhausted, got %v", err)
+		}
+	})
+}
+
+func TestOneTimeLinkAPI(t *testing.T) {
+	server, _, key := setupTestServer(t)
+
+	resp := doRequest(t, "POST", server.URL+"/api/shorten", key,
+		`{"url":"https://example.com/download","custom_code":"tstonce","max_clicks":1}`)
+	var created handlers.ShortenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil || resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d, %v", resp.StatusCode, err)
+	}
+	if created.MaxClicks != 1 {
+		t.Errorf("Expected max_clicks 1 in the response, got %d", created.MaxClicks)
+	}
+
+	if resp := doRequest(t, "GET", server.URL+"/tstonce", "", ""); resp.StatusCode != http.StatusMovedPermanently {
+		t.Fatalf("Expected the first visit to redirect, got %d", resp.StatusCode)
+	}
+
+	resp = doRequest(t, "GET", server.URL+"/tstonce", "", "")
+	if e := decodeError(t, resp); resp.StatusCode != http.StatusGone || e.Code != handlers.CodeExhausted {
+		t.Errorf("Expected 410 exhausted, got %d %q", resp.StatusCode, e.Code)
+	}
+
+	resp = doRequest(t, "GET", server.URL+"/api/urls/tstonce", key, "")
+	var details db.URL
+	if err := json.NewDecoder(resp.Body).Decode(&details); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected the exhausted link's details, got %d, %v", resp.StatusCode, err)
+	}
+	if details.ClickCount != 1 || details.MaxClicks != 1 {
+		t.Errorf("Expected 1 of 1 clicks, got %d of %d", details.ClickCount, details.MaxClicks)
+	}
+
+	resp = doRequest(t, "POST", server.URL+"/api/shorten", key, `{"url":"https://example.com","max_clicks":-1}`)
+	if e := decodeError(t, resp); resp.StatusCode != http.StatusBadRequest || e.Code != handlers.CodeInvalidRequest {
+		t.Errorf("Expected 400 for a negative limit, got %d %q", resp.StatusCode, e.Code)
+	}
+}
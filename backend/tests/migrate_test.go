@@ -0,0 +1,128 @@
+package tests
+
+import (
+	"context"
+	"go-url-shortener/internal/db"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrateUpDownStatus(t *testing.T) {
+	databaseURL := "sqlite://" + filepath.Join(t.TempDir(), "migrate.db")
+
+	migrator, err := db.OpenMigrator(databaseURL)
+	if err != nil {
+		t.Fatalf("Failed to open migrator: %v", err)
+	}
+	defer migrator.Close()
+
+	statuses, err := migrator.Status()
+	if err != nil {
+		t.Fatalf("Error reading migration status: %v", err)
+	}
+	if len(statuses) == 0 {
+		t.Fatal("Expected at least one embedded migration")
+	}
+	for _, status := range statuses {
+		if status.Applied {
+			t.Errorf("Expected migration %04d to be pending on a new database", status.Version)
+		}
+	}
+
+	applied, err := migrator.Up()
+	if err != nil {
+		t.Fatalf("Error applying migrations: %v", err)
+	}
+	if applied != len(statuses) {
+		t.Errorf("Expected %d migrations applied, got %d", len(statuses), applied)
+	}
+
+	// Running up again is a no-op
+	applied, err = migrator.Up()
+	if err != nil {
+		t.Fatalf("Error re-applying migrations: %v", err)
+	}
+	if applied != 0 {
+		t.Errorf("Expected no migrations on second run, got %d", applied)
+	}
+
+	reverted, err := migrator.Down(len(statuses))
+	if err != nil {
+		t.Fatalf("Error reverting migrations: %v", err)
+	}
+	if reverted != len(statuses) {
+		t.Errorf("Expected %d migrations reverted, got %d", len(statuses), reverted)
+	}
+
+	statuses, err = migrator.Status()
+	if err != nil {
+		t.Fatalf("Error reading migration status: %v", err)
+	}
+	for _, status := range statuses {
+		if status.Applied {
+			t.Errorf("Expected migration %04d to be pending after down", status.Version)
+		}
+	}
+
+	// The repository migrates a fresh database on startup
+	repo, err := db.InitRepository(databaseURL)
+	if err != nil {
+		t.Fatalf("Failed to initialize repository after down: %v", err)
+	}
+	if err := repo.CreateShortURL(context.Background(), &db.URL{OriginalURL: "https://example.com", ShortCode: "tstmig"}); err != nil {
+		t.Errorf("Error creating short URL on migrated schema: %v", err)
+	}
+}
+
+func TestMigrateBackfillsUTM(t *testing.T) {
+	databaseURL := "sqlite://" + filepath.Join(t.TempDir(), "backfill.db")
+	ctx := context.Background()
+
+	repo, err := db.InitRepository(databaseURL)
+	if err != nil {
+		t.Fatalf("Failed to initialize repository: %v", err)
+	}
+	url := &db.URL{OriginalURL: "https://example.com/?utm_source=news&utm_campaign=spring%20sale", ShortCode: "tstmigutm"}
+	if err := repo.CreateShortURL(ctx, url); err != nil {
+		t.Fatalf("Error creating short URL: %v", err)
+	}
+
+	migrator, err := db.OpenMigrator(databaseURL)
+	if err != nil {
+		t.Fatalf("Failed to open migrator: %v", err)
+	}
+	defer migrator.Close()
+
+	// Revert to before the UTM columns existed, then migrate the link's
+	// table forward again
+	statuses, err := migrator.Status()
+	if err != nil {
+		t.Fatalf("Error reading migration status: %v", err)
+	}
+	steps := 0
+	for _, status := range statuses {
+		if status.Version >= 10 {
+			steps++
+		}
+	}
+	if _, err := migrator.Down(steps); err != nil {
+		t.Fatalf("Error reverting migrations: %v", err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("Error applying migrations: %v", err)
+	}
+
+	stored, err := repo.GetShortURL(ctx, "tstmigutm")
+	if err != nil {
+		t.Fatalf("Error retrieving short URL: %v", err)
+	}
+	if want := (db.UTM{Source: "news", Campaign: "spring sale"}); stored.UTM != want {
+		t.Errorf("Expected the UTM columns to be backfilled as %+v, got %+v", want, stored.UTM)
+	}
+}
+
+func TestMigrateMemoryUnsupported(t *testing.T) {
+	if _, err := db.OpenMigrator("memory://"); err == nil {
+		t.Error("Expected error when migrating the in-memory repository, got nil")
+	}
+}
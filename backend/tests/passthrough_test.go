@@ -0,0 +1,93 @@
+package tests
+
+import (
+	"context"
+	"go-url-shortener/internal/api/handlers"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestQueryPassthrough(t *testing.T) {
+	server, _, key := setupTestServer(t)
+
+	for _, tc := range []struct {
+		policy string
+		want   string
+	}{
+		{"", "https://example.com/page?a=1&b=2"},
+		{"keep", "https://example.com/page?a=1&b=2&c=3"},
+		{"override", "https://example.com/page?a=1&b=9&c=3"},
+		{"append", "https://example.com/page?a=1&b=2&b=9&c=3"},
+	} {
+		code := "tstq" + tc.policy
+		resp := doRequest(t, "POST", server.URL+"/api/shorten", key,
+			`{"url":"https://example.com/page?a=1&b=2","custom_code":"`+code+`","query_passthrough":"`+tc.policy+`"}`)
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("Expected 201 for %q, got %d", tc.policy, resp.StatusCode)
+		}
+
+		resp = doRequest(t, "GET", server.URL+"/"+code+"?b=9&c=3", "", "")
+		if got := resp.Header.Get("Location"); resp.StatusCode != http.StatusMovedPermanently || got != tc.want {
+			t.Errorf("Policy %q: expected a redirect to %s, got %d %q", tc.policy, tc.want, resp.StatusCode, got)
+		}
+	}
+
+	// Without a query the target is left as it was
+	if resp := doRequest(t, "GET", server.URL+"/tstqappend", "", ""); resp.Header.Get("Location") != "https://example.com/page?a=1&b=2" {
+		t.Errorf("Expected the plain target, got %q", resp.Header.Get("Location"))
+	}
+
+	resp := doRequest(t, "POST", server.URL+"/api/shorten", key, `{"url":"https://example.com","query_passthrough":"merge"}`)
+	if e := decodeError(t, resp); resp.StatusCode != http.StatusBadRequest || e.Code != handlers.CodeInvalidRequest {
+		t.Errorf("Expected 400 for an unknown policy, got %d %q", resp.StatusCode, e.Code)
+	}
+}
+
+func TestPathPassthrough(t *testing.T) {
+	server, repo, key := setupTestServer(t)
+
+	doRequest(t, "POST", server.URL+"/api/shorten", key,
+		`{"url":"https://docs.example.com/v2/?lang=en","custom_code":"tstdocs","path_passthrough":true,"query_passthrough":"keep"}`)
+	doRequest(t, "POST", server.URL+"/api/shorten", key, `{"url":"https://example.com/fixed","custom_code":"tstfixed"}`)
+
+	for path, want := range map[string]string{
+		"/tstdocs":                     "https://docs.example.com/v2/?lang=en",
+		"/tstdocs/":                    "https://docs.example.com/v2/?lang=en",
+		"/tstdocs/guide/install":       "https://docs.example.com/v2/guide/install?lang=en",
+		"/tstdocs/a%20b/c%2Fd?lang=de": "https://docs.example.com/v2/a%20b/c%2Fd?lang=en",
+		"/tstdocs/admin?x=%3C1%3E":     "https://docs.example.com/v2/admin?lang=en&x=%3C1%3E",
+	} {
+		resp := doRequest(t, "GET", server.URL+path, "", "")
+		if got := resp.Header.Get("Location"); resp.StatusCode != http.StatusMovedPermanently || got != want {
+			t.Errorf("%s: expected a redirect to %s, got %d %q", path, want, resp.StatusCode, got)
+		}
+	}
+
+	// Links without path passthrough keep their sub-paths unmatched, and
+	// such visits are not counted
+	resp := doRequest(t, "GET", server.URL+"/tstfixed/extra", "", "")
+	if e := decodeError(t, resp); resp.StatusCode != http.StatusNotFound || e.Code != handlers.CodeNotFound {
+		t.Errorf("Expected 404 for a sub-path, got %d %q", resp.StatusCode, e.Code)
+	}
+	if stored, err := repo.GetShortURL(context.Background(), "tstfixed"); err != nil || stored.ClickCount != 0 {
+		t.Errorf("Expected the visit not to be counted, got %+v, %v", stored, err)
+	}
+}
+
+func TestPassthroughAfterPasswordUnlock(t *testing.T) {
+	server, _, key := setupTestServer(t)
+
+	doRequest(t, "POST", server.URL+"/api/shorten", key,
+		`{"url":"https://docs.example.com/private","custom_code":"tstpwdocs","password":"pw","path_passthrough":true,"query_passthrough":"keep"}`)
+
+	resp, body := getPage(t, server.URL+"/tstpwdocs/page?ref=mail")
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, `action="/tstpwdocs/page?ref=mail"`) {
+		t.Fatalf("Expected the form to post back to the sub-path, got %d %s", resp.StatusCode, body)
+	}
+
+	resp = postPassword(t, server.URL+"/tstpwdocs/page?ref=mail", "pw")
+	if got := resp.Header.Get("Location"); resp.StatusCode != http.StatusSeeOther || got != "https://docs.example.com/private/page?ref=mail" {
+		t.Errorf("Expected 303 to the sub-path, got %d %q", resp.StatusCode, got)
+	}
+}
@@ -0,0 +1,263 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go-url-shortener/internal/api/handlers"
+	"go-url-shortener/internal/auth"
+	"go-url-shortener/internal/db"
+	"io"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPasswordHashing(t *testing.T) {
+	hash, err := auth.HashPassword("correct horse")
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+	if !strings.HasPrefix(hash, "pbkdf2-sha256$") || strings.Contains(hash, "correct horse") {
+		t.Errorf("Unexpected hash %q", hash)
+	}
+	if other, _ := auth.HashPassword("correct horse"); other == hash {
+		t.Error("Expected a fresh salt for every hash")
+	}
+
+	if !auth.CheckPassword(hash, "correct horse") {
+		t.Error("Expected the password to match")
+	}
+	for _, wrong := range []string{"", "correct horsE", "correct horse "} {
+		if auth.CheckPassword(hash, wrong) {
+			t.Errorf("Expected %q not to match", wrong)
+		}
+	}
+	if auth.CheckPassword("plaintext", "plaintext") || auth.CheckPassword("pbkdf2-sha256$99999999999$AA$AA", "x") {
+		t.Error("Expected malformed hashes never to match")
+	}
+
+	if _, err := auth.HashPassword(strings.Repeat("x", auth.MaxPasswordLength+1)); err != auth.ErrInvalidPassword {
+		t.Errorf("Expected ErrInvalidPassword for an overlong password, got %v", err)
+	}
+}
+
+func TestPasswordThrottle(t *testing.T) {
+	throttle := auth.NewThrottle(2, time.Minute)
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := throttle.Allow("client", now); !ok {
+			t.Fatalf("Expected attempt %d to be allowed", i+1)
+		}
+	}
+	ok, wait := throttle.Allow("client", now.Add(10*time.Second))
+	if ok || wait != 50*time.Second {
+		t.Errorf("Expected lockout for 50s, got %v %v", ok, wait)
+	}
+	if ok, _ := throttle.Allow("other", now); !ok {
+		t.Error("Expected other keys to be unaffected")
+	}
+	if ok, _ := throttle.Allow("client", now.Add(time.Minute)); !ok {
+		t.Error("Expected the lockout to end with the window")
+	}
+
+	throttle.Allow("client", now.Add(time.Minute))
+	throttle.Reset("client")
+	if ok, _ := throttle.Allow("client", now.Add(time.Minute)); !ok {
+		t.Error("Expected Reset to clear the attempts")
+	}
+
+	if ok, _ := auth.NewThrottle(0, time.Minute).Allow("client", now); !ok {
+		t.Error("Expected a zero limit to disable the throttle")
+	}
+}
+
+// postPassword submits the password form of a protected link
+func postPassword(t *testing.T, linkURL, password string) *http.Response {
+	t.Helper()
+	resp, err := noRedirectClient.PostForm(linkURL, url.Values{"password": {password}})
+	if err != nil {
+		t.Fatalf("POST %s failed: %v", linkURL, err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// waitForClicks polls until the link has n click events
+func waitForClicks(t *testing.T, repo db.RepositoryInterface, urlID, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		events, err := repo.GetClickEvents(context.Background(), urlID)
+		if err == nil && len(events) == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d click(s), got %d (%v)", n, len(events), err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPasswordProtectedRedirect(t *testing.T) {
+	server, repo, key := setupTestServer(t)
+
+	resp := doRequest(t, "POST", server.URL+"/api/shorten", key,
+		`{"url":"https://example.com/private","custom_code":"tstpw","password":"s3cret pass"}`)
+	var created handlers.ShortenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil || resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d, %v", resp.StatusCode, err)
+	}
+	if !created.PasswordProtected {
+		t.Error("Expected password_protected in the response")
+	}
+
+	stored, err := repo.GetShortURL(context.Background(), "tstpw")
+	if err != nil || !auth.CheckPassword(stored.PasswordHash, "s3cret pass") {
+		t.Fatalf("Expected the password hash to be stored, got %+v, %v", stored, err)
+	}
+
+	// Visiting shows the form instead of redirecting
+	linkURL := server.URL + "/tstpw"
+	resp = doRequest(t, "GET", linkURL, "", "")
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Location") != "" ||
+		!strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") || resp.Header.Get("Cache-Control") != "no-store" {
+		t.Errorf("Expected the password form, got %d %v", resp.StatusCode, resp.Header)
+	}
+	if !strings.Contains(string(body), `action="/tstpw"`) || !strings.Contains(string(body), `name="password"`) {
+		t.Errorf("Unexpected form %s", body)
+	}
+
+	resp = postPassword(t, linkURL, "wrong")
+	body, _ = io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusForbidden || !strings.Contains(string(body), "Incorrect password") {
+		t.Errorf("Expected 403 with the form again, got %d", resp.StatusCode)
+	}
+
+	resp = postPassword(t, linkURL, "s3cret pass")
+	if resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != "https://example.com/private" {
+		t.Fatalf("Expected 303 to the target, got %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	waitForClicks(t, repo, stored.ID, 1)
+
+	// Public links have no form to submit, and posting to one does not
+	// use up its clicks
+	doRequest(t, "POST", server.URL+"/api/shorten", key, `{"url":"https://example.com/public","custom_code":"tstnopw","max_clicks":1}`)
+	if resp := postPassword(t, server.URL+"/tstnopw", "x"); resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for a public link, got %d", resp.StatusCode)
+	}
+	if public, err := repo.GetShortURL(context.Background(), "tstnopw"); err != nil || public.ClickCount != 0 {
+		t.Errorf("Expected no click to be counted, got %+v, %v", public, err)
+	}
+	if resp := doRequest(t, "GET", server.URL+"/tstnopw", "", ""); resp.StatusCode != http.StatusMovedPermanently {
+		t.Errorf("Expected the one-time link to still redirect, got %d", resp.StatusCode)
+	}
+
+	resp = doRequest(t, "POST", server.URL+"/api/shorten", key,
+		`{"url":"https://example.com","password":"`+strings.Repeat("x", auth.MaxPasswordLength+1)+`"}`)
+	if e := decodeError(t, resp); resp.StatusCode != http.StatusBadRequest || e.Code != handlers.CodeInvalidRequest {
+		t.Errorf("Expected 400 for an overlong password, got %d %q", resp.StatusCode, e.Code)
+	}
+}
+
+func TestPasswordBruteForceThrottle(t *testing.T) {
+	cfg := testConfig()
+	cfg.PasswordMaxAttempts = 2
+	cfg.PasswordLockout = time.Hour
+	server, _, key := setupTestServerWithConfig(t, cfg)
+
+	doRequest(t, "POST", server.URL+"/api/shorten", key, `{"url":"https://example.com/private","custom_code":"tstpwbf","password":"right"}`)
+	linkURL := server.URL + "/tstpwbf"
+
+	for i := 0; i < 2; i++ {
+		if resp := postPassword(t, linkURL, "guess"); resp.StatusCode != http.StatusForbidden {
+			t.Fatalf("Attempt %d: expected 403, got %d", i+1, resp.StatusCode)
+		}
+	}
+
+	// Locked out, even with the right password
+	resp := postPassword(t, linkURL, "right")
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("Expected 429 with Retry-After, got %d %v", resp.StatusCode, resp.Header)
+	}
+	if resp := doRequest(t, "GET", linkURL, "", ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected the form to still be shown, got %d", resp.StatusCode)
+	}
+}
+
+// postPasswordFrom submits a password with a client-chosen X-Forwarded-For
+func postPasswordFrom(t *testing.T, linkURL, password, forwardedFor string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest("POST", linkURL, strings.NewReader(url.Values{"password": {password}}.Encode()))
+	if err != nil {
+		t.Fatalf("Failed to build request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Forwarded-For", forwardedFor)
+	resp, err := noRedirectClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST %s failed: %v", linkURL, err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestPasswordThrottleIgnoresSpoofedAddress(t *testing.T) {
+	cfg := testConfig()
+	cfg.PasswordMaxAttempts = 2
+	cfg.PasswordLockout = time.Hour
+	server, _, key := setupTestServerWithConfig(t, cfg)
+
+	doRequest(t, "POST", server.URL+"/api/shorten", key, `{"url":"https://example.com/private","custom_code":"tstpwxff","password":"right"}`)
+	linkURL := server.URL + "/tstpwxff"
+
+	// The test client is not a trusted proxy, so its header is ignored
+	for i, want := range []int{http.StatusForbidden, http.StatusForbidden, http.StatusTooManyRequests} {
+		if resp := postPasswordFrom(t, linkURL, "guess", fmt.Sprintf("198.51.100.%d", i+1)); resp.StatusCode != want {
+			t.Errorf("Attempt %d: expected %d, got %d", i+1, want, resp.StatusCode)
+		}
+	}
+}
+
+func TestPasswordThrottlePerLink(t *testing.T) {
+	cfg := testConfig()
+	cfg.PasswordMaxAttempts = 2
+	cfg.PasswordMaxAttemptsPerLink = 3
+	cfg.PasswordLockout = time.Hour
+	cfg.TrustedProxies = []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32"), netip.MustParsePrefix("::1/128")}
+	server, _, key := setupTestServerWithConfig(t, cfg)
+
+	doRequest(t, "POST", server.URL+"/api/shorten", key, `{"url":"https://example.com/private","custom_code":"tstpwlink","password":"right"}`)
+	doRequest(t, "POST", server.URL+"/api/shorten", key, `{"url":"https://example.com/other","custom_code":"tstpwother","password":"right"}`)
+	linkURL := server.URL + "/tstpwlink"
+
+	// Each attacker address stays under its own limit
+	for i := 0; i < 2; i++ {
+		if resp := postPasswordFrom(t, linkURL, "guess", fmt.Sprintf("198.51.100.%d", i+1)); resp.StatusCode != http.StatusForbidden {
+			t.Fatalf("Attempt %d: expected 403, got %d", i+1, resp.StatusCode)
+		}
+	}
+
+	// A regular visitor unlocks the link in the middle of the attack, which
+	// does not give the attacker a fresh budget
+	if resp := postPasswordFrom(t, linkURL, "right", "203.0.113.7"); resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("Expected the visitor to unlock the link, got %d", resp.StatusCode)
+	}
+	resp := postPasswordFrom(t, linkURL, "guess", "198.51.100.3")
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("Expected the attacker to stay locked out, got %d %v", resp.StatusCode, resp.Header)
+	}
+	if resp := postPasswordFrom(t, linkURL, "right", "198.51.100.99"); resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("Expected the link to be locked for new clients, got %d", resp.StatusCode)
+	}
+
+	// Other links keep their own count
+	if resp := postPasswordFrom(t, server.URL+"/tstpwother", "right", "198.51.100.99"); resp.StatusCode != http.StatusSeeOther {
+		t.Errorf("Expected another link to unlock, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,130 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"go-url-shortener/internal/api/handlers"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// getPage fetches an HTML page and returns its body
+func getPage(t *testing.T, url string) (*http.Response, string) {
+	t.Helper()
+	resp := doRequest(t, "GET", url, "", "")
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", url, err)
+	}
+	return resp, string(body)
+}
+
+func TestPreviewPage(t *testing.T) {
+	server, repo, key := setupTestServer(t)
+	ctx := context.Background()
+
+	doRequest(t, "POST", server.URL+"/api/shorten", key, `{"url":"https://example.com/report?q=<x>","custom_code":"tstprev"}`)
+	created, err := repo.GetShortURL(ctx, "tstprev")
+	if err != nil {
+		t.Fatalf("Error retrieving short URL: %v", err)
+	}
+
+	for _, path := range []string{"/tstprev+", "/preview/tstprev"} {
+		resp, body := getPage(t, server.URL+path)
+		if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+			t.Fatalf("%s: expected the preview page, got %d", path, resp.StatusCode)
+		}
+		for _, want := range []string{
+			"<code>https://example.com/report?q=&lt;x&gt;</code>",
+			"<dt>Expires</dt>\n<dd>" + created.ExpiresAt.UTC().Format("2006-01-02 15:04 UTC"),
+			"<dt>Clicks</dt>\n<dd>0</dd>",
+			`<a class="continue" href="/tstprev"`,
+		} {
+			if !strings.Contains(body, want) {
+				t.Errorf("%s: expected the page to contain %q, got %s", path, want, body)
+			}
+		}
+	}
+
+	stored, err := repo.GetShortURL(ctx, "tstprev")
+	if err != nil {
+		t.Fatalf("Error retrieving short URL: %v", err)
+	}
+	if stored.ClickCount != 0 {
+		t.Errorf("Expected previews not to count clicks, got %d", stored.ClickCount)
+	}
+
+	resp := doRequest(t, "GET", server.URL+"/tstmissing+", "", "")
+	if e := decodeError(t, resp); resp.StatusCode != http.StatusNotFound || e.Code != handlers.CodeNotFound {
+		t.Errorf("Expected 404 for a missing link, got %d %q", resp.StatusCode, e.Code)
+	}
+
+	// Protected and scheduled links keep their destination to themselves
+	doRequest(t, "POST", server.URL+"/api/shorten", key, `{"url":"https://example.com/secret","custom_code":"tstprevpw","password":"pw"}`)
+	if resp, body := getPage(t, server.URL+"/tstprevpw+"); resp.StatusCode != http.StatusOK ||
+		!strings.Contains(body, `name="password"`) || strings.Contains(body, "secret") {
+		t.Errorf("Expected the password form for a protected link, got %d %s", resp.StatusCode, body)
+	}
+
+	launch := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	doRequest(t, "POST", server.URL+"/api/shorten", key, `{"url":"https://example.com/launch","custom_code":"tstprevs","activates_at":"`+launch+`"}`)
+	resp = doRequest(t, "GET", server.URL+"/preview/tstprevs", "", "")
+	if e := decodeError(t, resp); resp.StatusCode != http.StatusNotFound || e.Code != handlers.CodeScheduled {
+		t.Errorf("Expected 404 scheduled, got %d %q", resp.StatusCode, e.Code)
+	}
+}
+
+func TestForcePreview(t *testing.T) {
+	server, repo, key := setupTestServer(t)
+	ctx := context.Background()
+
+	resp := doRequest(t, "POST", server.URL+"/api/shorten", key,
+		`{"url":"https://example.com/target","custom_code":"tstforce","force_preview":true}`)
+	var created handlers.ShortenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil || !created.ForcePreview {
+		t.Fatalf("Expected force_preview in the response, got %+v, %v", created, err)
+	}
+
+	// The short link itself shows the preview and counts the visit
+	resp, body := getPage(t, server.URL+"/tstforce")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Location") != "" {
+		t.Fatalf("Expected the preview instead of a redirect, got %d", resp.StatusCode)
+	}
+	if !strings.Contains(body, `<a class="continue" href="https://example.com/target"`) || !strings.Contains(body, "<dd>1</dd>") {
+		t.Errorf("Expected a counted preview continuing to the target, got %s", body)
+	}
+
+	stored, err := repo.GetShortURL(ctx, "tstforce")
+	if err != nil {
+		t.Fatalf("Error retrieving short URL: %v", err)
+	}
+	if !stored.ForcePreview {
+		t.Error("Expected force_preview to be stored")
+	}
+	waitForClicks(t, repo, stored.ID, 1)
+
+	// The preview route still records nothing, and continues through the
+	// short link so that the visit is counted without a second preview
+	if _, body := getPage(t, server.URL+"/tstforce+"); !strings.Contains(body, `href="/tstforce?continue=1"`) {
+		t.Errorf("Expected the preview route to continue through the short link, got %s", body)
+	}
+	if stored, _ := repo.GetShortURL(ctx, "tstforce"); stored.ClickCount != 1 {
+		t.Errorf("Expected 1 click, got %d", stored.ClickCount)
+	}
+	resp = doRequest(t, "GET", server.URL+"/tstforce?continue=1", "", "")
+	if resp.StatusCode != http.StatusMovedPermanently || resp.Header.Get("Location") != "https://example.com/target" {
+		t.Errorf("Expected Continue to redirect to the target, got %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	waitForClicks(t, repo, stored.ID, 2)
+
+	// The marker is not passed on to targets that take the visit's query
+	doRequest(t, "POST", server.URL+"/api/shorten", key,
+		`{"url":"https://example.com/search?lang=en","custom_code":"tstforceq","force_preview":true,"query_passthrough":"append"}`)
+	resp = doRequest(t, "GET", server.URL+"/tstforceq?q=go&continue=1", "", "")
+	if want := "https://example.com/search?lang=en&q=go"; resp.Header.Get("Location") != want {
+		t.Errorf("Expected a redirect to %s, got %d %q", want, resp.StatusCode, resp.Header.Get("Location"))
+	}
+}
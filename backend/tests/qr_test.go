@@ -0,0 +1,143 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"go-url-shortener/internal/api/handlers"
+	"go-url-shortener/internal/qr"
+	"image/color"
+	"image/png"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestQRRenderPNG(t *testing.T) {
+	opts := qr.DefaultOptions()
+	opts.Size = 300
+	opts.Margin = 2
+	opts.Foreground = color.NRGBA{R: 0x11, G: 0x22, B: 0x33, A: 0xff}
+
+	data, err := qr.Render("http://localhost:8080/abc123", qr.PNG, opts)
+	if err != nil {
+		t.Fatalf("Error rendering PNG: %v", err)
+	}
+
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Rendered PNG does not decode: %v", err)
+	}
+
+	if b := img.Bounds(); b.Dx() != 300 || b.Dy() != 300 {
+		t.Errorf("Expected 300x300 image, got %dx%d", b.Dx(), b.Dy())
+	}
+
+	// The corner is quiet zone; the finder pattern starts right after it
+	if got := color.NRGBAModel.Convert(img.At(0, 0)); got != opts.Background {
+		t.Errorf("Expected background in the corner, got %v", got)
+	}
+
+	// A 25-module version 2 code plus 2+2 margin gives 10px modules centered
+	// in 300px: offset (300-290)/2 + 2*10 = 25
+	if got := color.NRGBAModel.Convert(img.At(25, 25)); got != opts.Foreground {
+		t.Errorf("Expected finder pattern at (25,25), got %v", got)
+	}
+}
+
+func TestQRRenderSVG(t *testing.T) {
+	opts := qr.DefaultOptions()
+	opts.Background = color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0}
+
+	data, err := qr.Render("http://localhost:8080/abc123", qr.SVG, opts)
+	if err != nil {
+		t.Fatalf("Error rendering SVG: %v", err)
+	}
+
+	svg := string(data)
+	for _, want := range []string{`<svg xmlns="http://www.w3.org/2000/svg" width="256" height="256"`, `fill-opacity="0"`, `<path d="M4 4h7v1h-7z`} {
+		if !strings.Contains(svg, want) {
+			t.Errorf("Expected SVG to contain %q", want)
+		}
+	}
+}
+
+func TestQROptionsValidation(t *testing.T) {
+	if _, err := qr.ParseColor("#12345"); !errors.Is(err, qr.ErrInvalidOptions) {
+		t.Errorf("Expected ErrInvalidOptions for a 5-digit color, got %v", err)
+	}
+	if c, err := qr.ParseColor("f0a"); err != nil || c != (color.NRGBA{R: 0xff, G: 0x00, B: 0xaa, A: 0xff}) {
+		t.Errorf("Expected short hex color to expand, got %v, %v", c, err)
+	}
+	if _, err := qr.ParseLevel("x"); !errors.Is(err, qr.ErrInvalidOptions) {
+		t.Errorf("Expected ErrInvalidOptions for level x, got %v", err)
+	}
+
+	opts := qr.DefaultOptions()
+	opts.Size = qr.MaxSize + 1
+	if _, err := qr.Render("https://example.com", qr.PNG, opts); !errors.Is(err, qr.ErrInvalidOptions) {
+		t.Errorf("Expected ErrInvalidOptions for oversized image, got %v", err)
+	}
+}
+
+func TestShortenReturnsQRCode(t *testing.T) {
+	server, _, key := setupTestServer(t)
+
+	resp := doRequest(t, "POST", server.URL+"/api/shorten", key, `{"url":"https://example.com/qr","custom_code":"tstqr"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d", resp.StatusCode)
+	}
+
+	var body handlers.ShortenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	const prefix = "data:image/png;base64,"
+	if !strings.HasPrefix(body.QRCode, prefix) {
+		t.Fatalf("Expected qr_code to be a PNG data URI, got %.40q", body.QRCode)
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(body.QRCode, prefix))
+	if err != nil {
+		t.Fatalf("qr_code is not valid base64: %v", err)
+	}
+	if _, err := png.Decode(bytes.NewReader(data)); err != nil {
+		t.Errorf("qr_code does not decode as PNG: %v", err)
+	}
+}
+
+func TestQREndpoint(t *testing.T) {
+	server, _, key := setupTestServer(t)
+	doRequest(t, "POST", server.URL+"/api/shorten", key, `{"url":"https://example.com/qr","custom_code":"tstqr"}`)
+
+	resp := doRequest(t, "GET", server.URL+"/api/urls/tstqr/qr?format=svg&size=512&level=H&margin=1&fg=%23336699&bg=fff", key, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "image/svg+xml" {
+		t.Errorf("Expected image/svg+xml, got %q", ct)
+	}
+	svg, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(svg), `fill="#336699"`) || !strings.Contains(string(svg), `width="512"`) {
+		t.Errorf("SVG does not reflect the requested options: %.200s", svg)
+	}
+
+	resp = doRequest(t, "GET", server.URL+"/api/urls/tstqr/qr", key, "")
+	if ct := resp.Header.Get("Content-Type"); resp.StatusCode != http.StatusOK || ct != "image/png" {
+		t.Errorf("Expected 200 image/png by default, got %d %q", resp.StatusCode, ct)
+	}
+
+	for _, query := range []string{"format=gif", "size=10", "size=abc", "level=Z", "margin=-1", "fg=red"} {
+		resp := doRequest(t, "GET", server.URL+"/api/urls/tstqr/qr?"+query, key, "")
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, resp.StatusCode)
+		}
+	}
+
+	resp = doRequest(t, "GET", server.URL+"/api/urls/tstnone/qr", key, "")
+	if body := decodeError(t, resp); resp.StatusCode != http.StatusNotFound || body.Code != handlers.CodeNotFound {
+		t.Errorf("Expected 404 not_found for unknown code, got %d %q", resp.StatusCode, body.Code)
+	}
+}
@@ -0,0 +1,122 @@
+package tests
+
+import (
+	"go-url-shortener/internal/middleware"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterBurst(t *testing.T) {
+	limiter := middleware.NewRateLimiter(middleware.RateLimitOptions{PerMinute: 60, Burst: 2})
+	handler := limiter.Limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	send := func(ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/tstrate", nil)
+		req.RemoteAddr = ip + ":1234"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i, remaining := range []string{"1", "0"} {
+		rec := send("203.0.113.1")
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("Request %d: expected 204 within burst, got %d", i+1, rec.Code)
+		}
+		if got := rec.Header().Get("RateLimit-Remaining"); got != remaining {
+			t.Errorf("Request %d: expected RateLimit-Remaining %s, got %q", i+1, remaining, got)
+		}
+		if got := rec.Header().Get("RateLimit-Limit"); got != "2" {
+			t.Errorf("Expected RateLimit-Limit 2, got %q", got)
+		}
+	}
+
+	rec := send("203.0.113.1")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429 once the burst is spent, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Expected Retry-After 1 at one request per second, got %q", got)
+	}
+	if got := rec.Header().Get("RateLimit-Reset"); got != "2" {
+		t.Errorf("Expected RateLimit-Reset 2, got %q", got)
+	}
+
+	if rec := send("203.0.113.2"); rec.Code != http.StatusNoContent {
+		t.Errorf("Expected another client to have its own bucket, got %d", rec.Code)
+	}
+}
+
+func TestRateLimiterEvictsIdleBuckets(t *testing.T) {
+	// 100 tokens per second refill a one-token bucket in 10ms
+	limiter := middleware.NewRateLimiter(middleware.RateLimitOptions{PerMinute: 6000, Burst: 1, IdleTTL: 20 * time.Millisecond})
+	handler := limiter.Limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, ip := range []string{"203.0.113.1", "203.0.113.2", "203.0.113.3"} {
+		req := httptest.NewRequest("GET", "/tstrate", nil)
+		req.RemoteAddr = ip + ":1234"
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if n := limiter.Len(); n != 3 {
+		t.Fatalf("Expected 3 buckets, got %d", n)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+
+	if n := limiter.Len(); n != 0 {
+		t.Errorf("Expected idle buckets to be evicted, got %d", n)
+	}
+}
+
+func TestRateLimitRoutes(t *testing.T) {
+	cfg := testConfig()
+	cfg.ShortenRateLimit = 1
+	cfg.ShortenRateBurst = 1
+	cfg.RedirectRateLimit = 1
+	cfg.RedirectRateBurst = 2
+	server, repo, aliceKey := setupTestServerWithConfig(t, cfg)
+	bobKey := createTestAPIKey(t, repo, "bob")
+
+	shorten := func(token, code string) *http.Response {
+		return doRequest(t, "POST", server.URL+"/api/shorten", token, `{"url":"https://example.com/rate","custom_code":"`+code+`"}`)
+	}
+
+	if resp := shorten(aliceKey, "tstrate1"); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected first shorten to succeed, got %d", resp.StatusCode)
+	}
+	resp := shorten(aliceKey, "tstrate2")
+	if body := decodeError(t, resp); resp.StatusCode != http.StatusTooManyRequests || body.Code != middleware.CodeRateLimited {
+		t.Errorf("Expected 429 rate_limited, got %d %q", resp.StatusCode, body.Code)
+	}
+
+	// Keys are limited separately even though they share the client IP
+	if resp := shorten(bobKey, "tstrate3"); resp.StatusCode != http.StatusCreated {
+		t.Errorf("Expected another API key to have its own limit, got %d", resp.StatusCode)
+	}
+	if resp := shorten("", "tstrate4"); resp.StatusCode != http.StatusCreated {
+		t.Errorf("Expected anonymous requests to be limited by IP, got %d", resp.StatusCode)
+	}
+
+	// Management routes are unlimited in this config and have no headers
+	resp = doRequest(t, "GET", server.URL+"/api/urls", aliceKey, "")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("RateLimit-Limit") != "" {
+		t.Errorf("Expected unlimited management route, got %d with RateLimit-Limit %q", resp.StatusCode, resp.Header.Get("RateLimit-Limit"))
+	}
+
+	// Redirects have their own bucket
+	for i, status := range []int{http.StatusMovedPermanently, http.StatusMovedPermanently, http.StatusTooManyRequests} {
+		resp, err := noRedirectClient.Get(server.URL + "/tstrate1")
+		if err != nil {
+			t.Fatalf("Redirect request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != status {
+			t.Errorf("Redirect %d: expected %d, got %d", i+1, status, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package tests
+
+import (
+	"context"
+	"go-url-shortener/internal/api/handlers"
+	"go-url-shortener/internal/db"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRedirectTypes(t *testing.T) {
+	cfg := testConfig()
+	cfg.RedirectType = db.RedirectFound
+	server, repo, key := setupTestServerWithConfig(t, cfg)
+
+	const target = "https://example.com/page?a=1&b=<2>"
+	for _, tc := range []struct {
+		redirectType string
+		status       int
+	}{
+		{"", http.StatusFound},
+		{db.RedirectMovedPermanently, http.StatusMovedPermanently},
+		{db.RedirectFound, http.StatusFound},
+		{db.RedirectTemporary, http.StatusTemporaryRedirect},
+		{db.RedirectPermanent, http.StatusPermanentRedirect},
+	} {
+		code := "tstrt" + tc.redirectType
+		resp := doRequest(t, "POST", server.URL+"/api/shorten", key,
+			`{"url":"`+target+`","custom_code":"`+code+`","redirect_type":"`+tc.redirectType+`"}`)
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("Expected 201 for %q, got %d", tc.redirectType, resp.StatusCode)
+		}
+
+		resp = doRequest(t, "GET", server.URL+"/"+code, "", "")
+		if resp.StatusCode != tc.status || resp.Header.Get("Location") != target {
+			t.Errorf("Redirect type %q: expected %d to the target, got %d %q", tc.redirectType, tc.status, resp.StatusCode, resp.Header.Get("Location"))
+		}
+	}
+
+	for _, tc := range []struct {
+		redirectType string
+		marker       string
+	}{
+		{db.RedirectMetaRefresh, `<meta http-equiv="refresh" content="0; url=https://example.com/page?a=1&amp;b=&lt;2&gt;">`},
+		{db.RedirectInterstitial, `<a class="continue" href="https://example.com/page?a=1&amp;b=%3c2%3e"`},
+	} {
+		code := "tstrt" + strings.ReplaceAll(tc.redirectType, "_", "")
+		doRequest(t, "POST", server.URL+"/api/shorten", key,
+			`{"url":"`+target+`","custom_code":"`+code+`","redirect_type":"`+tc.redirectType+`"}`)
+
+		resp := doRequest(t, "GET", server.URL+"/"+code, "", "")
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") ||
+			resp.Header.Get("Cache-Control") != "no-store" {
+			t.Errorf("Redirect type %s: expected an uncached HTML page, got %d %v", tc.redirectType, resp.StatusCode, resp.Header)
+		}
+		if !strings.Contains(string(body), tc.marker) || strings.Contains(string(body), "<2>") {
+			t.Errorf("Redirect type %s: unexpected page %s", tc.redirectType, body)
+		}
+
+		stored, err := repo.GetShortURL(context.Background(), code)
+		if err != nil {
+			t.Fatalf("Error retrieving short URL: %v", err)
+		}
+		if stored.RedirectType != tc.redirectType || stored.ClickCount != 1 {
+			t.Errorf("Expected a counted %s link, got %q with %d clicks", tc.redirectType, stored.RedirectType, stored.ClickCount)
+		}
+		waitForClicks(t, repo, stored.ID, 1)
+	}
+
+	resp := doRequest(t, "POST", server.URL+"/api/shorten", key, `{"url":"https://example.com","redirect_type":"303"}`)
+	if e := decodeError(t, resp); resp.StatusCode != http.StatusBadRequest || e.Code != handlers.CodeInvalidRequest {
+		t.Errorf("Expected 400 for an unknown redirect type, got %d %q", resp.StatusCode, e.Code)
+	}
+}
+
+func TestRedirectTypeAfterPasswordUnlock(t *testing.T) {
+	server, _, key := setupTestServer(t)
+
+	doRequest(t, "POST", server.URL+"/api/shorten", key,
+		`{"url":"https://example.com/private","custom_code":"tstrtpw","password":"pw","redirect_type":"307"}`)
+	// A 307 would post the password on to the target
+	if resp := postPassword(t, server.URL+"/tstrtpw", "pw"); resp.StatusCode != http.StatusSeeOther {
+		t.Errorf("Expected 303 after unlocking, got %d", resp.StatusCode)
+	}
+
+	doRequest(t, "POST", server.URL+"/api/shorten", key,
+		`{"url":"https://example.com/private","custom_code":"tstrtpwi","password":"pw","redirect_type":"interstitial"}`)
+	resp := postPassword(t, server.URL+"/tstrtpwi", "pw")
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), `href="https://example.com/private"`) {
+		t.Errorf("Expected the interstitial after unlocking, got %d %s", resp.StatusCode, body)
+	}
+}
@@ -0,0 +1,237 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go-url-shortener/internal/api/handlers"
+	"go-url-shortener/internal/db"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScheduledLinks(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo db.RepositoryInterface) {
+		ctx := context.Background()
+		defer cleanupTestURL(t, repo, "tstsched")
+		defer cleanupTestURL(t, repo, "tstlive")
+
+		launch := time.Now().Add(48 * time.Hour).Truncate(time.Second)
+		scheduled := &db.URL{OriginalURL: "https://example.com/campaign", ShortCode: "tstsched", ActivatesAt: &launch}
+		if err := repo.CreateShortURL(ctx, scheduled); err != nil {
+			t.Fatalf("Failed to create URL: %v", err)
+		}
+		if scheduled.ExpiresAt == nil || !scheduled.ExpiresAt.Equal(launch.Add(time.Hour)) {
+			t.Errorf("Expected the default expiry to count from activation, got %v", scheduled.ExpiresAt)
+		}
+
+		past := time.Now().Add(-time.Minute)
+		if err := repo.CreateShortURL(ctx, &db.URL{OriginalURL: "https://example.com/campaign", ShortCode: "tstlive", ActivatesAt: &past}); err != nil {
+			t.Fatalf("Failed to create URL: %v", err)
+		}
+
+		if _, err := repo.GetShortURLForRedirect(ctx, "tstsched"); !errors.Is(err, db.ErrScheduled) {
+			t.Errorf("Expected ErrScheduled before launch, got %v", err)
+		}
+		if live, err := repo.GetShortURLForRedirect(ctx, "tstlive"); err != nil || live.ClickCount != 1 {
+			t.Errorf("Expected a link past its activation to redirect, got %v", err)
+		}
+
+		stored, err := repo.GetShortURL(ctx, "tstsched")
+		if err != nil {
+			t.Fatalf("Expected a scheduled link to stay readable, got %v", err)
+		}
+		if stored.ClickCount != 0 || stored.GetStatus() != "scheduled" || !stored.ActivatesAt.Equal(launch) {
+			t.Errorf("Expected an unclicked scheduled link, got %+v with status %q", stored, stored.GetStatus())
+		}
+
+		for status, want := range map[string]string{
+			db.StatusScheduled: "tstsched",
+			db.StatusActive:    "tstlive",
+		} {
+			page, err := repo.ListURLs(ctx, db.ListOptions{Status: status, URLContains: "campaign"})
+			if err != nil {
+				t.Fatalf("Error listing %s URLs: %v", status, err)
+			}
+			if len(page.URLs) != 1 || page.URLs[0].ShortCode != want || page.Total != 1 {
+				t.Errorf("Expected only %s to be %s, got %d links", want, status, len(page.URLs))
+			}
+		}
+	})
+}
+
+func TestScheduledLinkUpdate(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo db.RepositoryInterface) {
+		ctx := context.Background()
+		defer cleanupTestURL(t, repo, "tstreschedule")
+
+		launch := time.Now().Add(24 * time.Hour)
+		url := &db.URL{OriginalURL: "https://example.com/launch", ShortCode: "tstreschedule", OwnerID: "scheduler", ActivatesAt: &launch}
+		if err := repo.CreateShortURL(ctx, url); err != nil {
+			t.Fatalf("Failed to create short URL: %v", err)
+		}
+
+		// An expiry at or before activation would keep the link offline
+		for _, version := range []int{0, url.Version, url.Version + 1} {
+			early := launch.Add(-time.Hour)
+			_, err := repo.UpdateShortURL(ctx, "tstreschedule", "scheduler", version, db.URLUpdate{SetExpiresAt: true, ExpiresAt: &early})
+			if !errors.Is(err, db.ErrInvalidSchedule) {
+				t.Errorf("Version %d: expected ErrInvalidSchedule, got %v", version, err)
+			}
+		}
+		if _, err := repo.UpdateShortURL(ctx, "tstreschedule", "scheduler", url.Version+1, db.URLUpdate{SetExpiresAt: true}); !errors.Is(err, db.ErrVersionConflict) {
+			t.Errorf("Expected ErrVersionConflict, got %v", err)
+		}
+
+		late := launch.Add(time.Hour)
+		updated, err := repo.UpdateShortURL(ctx, "tstreschedule", "scheduler", 0, db.URLUpdate{SetExpiresAt: true, ExpiresAt: &late})
+		if err != nil || updated.ExpiresAt == nil || updated.ExpiresAt.Sub(late).Abs() > time.Second {
+			t.Errorf("Expected the expiry to move after activation, got %+v, %v", updated, err)
+		}
+		if _, err := repo.UpdateShortURL(ctx, "tstreschedule", "scheduler", 0, db.URLUpdate{SetExpiresAt: true}); err != nil {
+			t.Errorf("Expected the expiry to be cleared, got %v", err)
+		}
+	})
+}
+
+// Times with a zone other than UTC must mean the same instant on every
+// backend, even in columns without a zone
+func TestScheduledLinkTimeZones(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo db.RepositoryInterface) {
+		ctx := context.Background()
+		defer cleanupTestURL(t, repo, "tstzone")
+
+		// Read as UTC wall times, activation would lie 10 hours ahead and
+		// the expiry 10 hours back
+		east := time.FixedZone("UTC+10", 10*60*60)
+		west := time.FixedZone("UTC-10", -10*60*60)
+		activatesAt := time.Now().Add(-time.Minute).In(east).Truncate(time.Second)
+		expiresAt := time.Now().Add(time.Hour).In(west).Truncate(time.Second)
+		url := &db.URL{OriginalURL: "https://example.com/zone", ShortCode: "tstzone", OwnerID: "zoned", ActivatesAt: &activatesAt, ExpiresAt: &expiresAt}
+		if err := repo.CreateShortURL(ctx, url); err != nil {
+			t.Fatalf("Failed to create URL: %v", err)
+		}
+
+		stored, err := repo.GetShortURL(ctx, "tstzone")
+		if err != nil || !stored.ActivatesAt.Equal(activatesAt) || !stored.ExpiresAt.Equal(expiresAt) {
+			t.Fatalf("Expected the instants to be kept, got %+v, %v", stored, err)
+		}
+		if _, err := repo.GetShortURLForRedirect(ctx, "tstzone"); err != nil {
+			t.Errorf("Expected the link to be live, got %v", err)
+		}
+
+		later := time.Now().Add(2 * time.Hour).In(west).Truncate(time.Second)
+		updated, err := repo.UpdateShortURL(ctx, "tstzone", "zoned", 0, db.URLUpdate{SetExpiresAt: true, ExpiresAt: &later})
+		if err != nil || !updated.ExpiresAt.Equal(later) {
+			t.Fatalf("Expected the new expiry to be kept, got %+v, %v", updated, err)
+		}
+
+		// An hour before activation, though nine hours after it when the
+		// UTC+10 wall time is read as UTC
+		early := activatesAt.Add(-time.Hour)
+		if _, err := repo.UpdateShortURL(ctx, "tstzone", "zoned", 0, db.URLUpdate{SetExpiresAt: true, ExpiresAt: &early}); !errors.Is(err, db.ErrInvalidSchedule) {
+			t.Errorf("Expected ErrInvalidSchedule, got %v", err)
+		}
+	})
+}
+
+func TestScheduledLinkAPI(t *testing.T) {
+	server, _, key := setupTestServer(t)
+	launch := time.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339)
+
+	resp := doRequest(t, "POST", server.URL+"/api/shorten", key,
+		`{"url":"https://example.com/launch","custom_code":"tstlaunch","activates_at":"`+launch+`"}`)
+	var created handlers.ShortenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil || resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d, %v", resp.StatusCode, err)
+	}
+	if created.ActivatesAt == nil || created.ActivatesAt.UTC().Format(time.RFC3339) != launch {
+		t.Errorf("Expected activates_at %s in the response, got %v", launch, created.ActivatesAt)
+	}
+
+	resp = doRequest(t, "GET", server.URL+"/tstlaunch", "", "")
+	if e := decodeError(t, resp); resp.StatusCode != http.StatusNotFound || e.Code != handlers.CodeScheduled {
+		t.Errorf("Expected 404 scheduled before launch, got %d %q", resp.StatusCode, e.Code)
+	}
+
+	for _, path := range []string{"/api/history?status=scheduled", "/api/urls?status=scheduled"} {
+		var page struct {
+			Items []handlers.URLHistoryItem `json:"items"`
+		}
+		resp = doRequest(t, "GET", server.URL+path, key, "")
+		if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+			t.Fatalf("Failed to decode %s: %v", path, err)
+		}
+		if len(page.Items) != 1 || page.Items[0].ShortCode != "tstlaunch" {
+			t.Errorf("Expected %s to list tstlaunch, got %+v", path, page.Items)
+		}
+	}
+
+	var history struct {
+		Items []handlers.URLHistoryItem `json:"items"`
+	}
+	resp = doRequest(t, "GET", server.URL+"/api/history", key, "")
+	if err := json.NewDecoder(resp.Body).Decode(&history); err != nil || len(history.Items) != 1 {
+		t.Fatalf("Failed to decode history: %v", err)
+	}
+	if history.Items[0].Status != "scheduled" {
+		t.Errorf("Expected status scheduled, got %q", history.Items[0].Status)
+	}
+
+	resp = doRequest(t, "GET", server.URL+"/api/urls", key, "")
+	var active struct {
+		Total int `json:"total"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&active); err != nil || active.Total != 0 {
+		t.Errorf("Expected scheduled links to be left out of the active list, got %d", active.Total)
+	}
+
+	expires := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	resp = doRequest(t, "POST", server.URL+"/api/shorten", key,
+		`{"url":"https://example.com","activates_at":"`+launch+`","expires_at":"`+expires+`"}`)
+	if e := decodeError(t, resp); resp.StatusCode != http.StatusBadRequest || e.Code != handlers.CodeInvalidRequest {
+		t.Errorf("Expected 400 for activation after expiry, got %d %q", resp.StatusCode, e.Code)
+	}
+
+	// Edits are held to the same rule against the stored activation
+	req, err := http.NewRequest("PATCH", server.URL+"/api/urls/tstlaunch", strings.NewReader(`{"expires_at":"`+expires+`"}`))
+	if err != nil {
+		t.Fatalf("Failed to build request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+key)
+	req.Header.Set("If-Match", "*")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("PATCH failed: %v", err)
+	}
+	if e := decodeError(t, resp); resp.StatusCode != http.StatusBadRequest || e.Code != handlers.CodeInvalidRequest {
+		t.Errorf("Expected 400 for an expiry before activation, got %d %q", resp.StatusCode, e.Code)
+	}
+}
+
+func TestScheduledLinkResponseConfig(t *testing.T) {
+	launch := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	body := `{"url":"https://example.com/launch","custom_code":"tstsoon","activates_at":"` + launch + `"}`
+
+	cfg := testConfig()
+	cfg.ScheduledStatus = http.StatusForbidden
+	server, _, key := setupTestServerWithConfig(t, cfg)
+	doRequest(t, "POST", server.URL+"/api/shorten", key, body)
+
+	resp := doRequest(t, "GET", server.URL+"/tstsoon", "", "")
+	if e := decodeError(t, resp); resp.StatusCode != http.StatusForbidden || e.Code != handlers.CodeScheduled {
+		t.Errorf("Expected the configured 403, got %d %q", resp.StatusCode, e.Code)
+	}
+
+	cfg = testConfig()
+	cfg.ScheduledRedirectURL = "https://example.com/coming-soon"
+	server, _, key = setupTestServerWithConfig(t, cfg)
+	doRequest(t, "POST", server.URL+"/api/shorten", key, body)
+
+	resp = doRequest(t, "GET", server.URL+"/tstsoon", "", "")
+	if resp.StatusCode != http.StatusFound || resp.Header.Get("Location") != cfg.ScheduledRedirectURL {
+		t.Errorf("Expected 302 to the coming soon page, got %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+}
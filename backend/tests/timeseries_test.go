@@ -0,0 +1,231 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go-url-shortener/internal/api/handlers"
+	"go-url-shortener/internal/db"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestClickTimeSeries(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatalf("Failed to load time zone: %v", err)
+	}
+
+	forEachBackend(t, func(t *testing.T, repo db.RepositoryInterface) {
+		ctx := context.Background()
+		defer cleanupTestURL(t, repo, "tstts")
+
+		url := &db.URL{OriginalURL: "https://example.com/ts", ShortCode: "tstts"}
+		if err := repo.CreateShortURL(ctx, url); err != nil {
+			t.Fatalf("Failed to create short URL: %v", err)
+		}
+
+		// Berlin switches to summer time on 2026-03-29
+		at := func(s string) time.Time {
+			ts, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				t.Fatalf("Bad time %s: %v", s, err)
+			}
+			return ts
+		}
+		events := []*db.ClickEvent{
+			// 00:30 on the 28th in Berlin, still the 27th in UTC
+			{URLId: url.ID, Browser: "Chrome", Country: "DE", CreatedAt: at("2026-03-27T23:30:00Z")},
+			{URLId: url.ID, Browser: "Firefox", Country: "US", Referer: "https://news.example", CreatedAt: at("2026-03-28T22:30:00Z")},
+			{URLId: url.ID, Bot: "Googlebot", CreatedAt: at("2026-03-28T12:00:00Z")},
+			// 00:30 on the 30th in Berlin, summer time
+			{URLId: url.ID, Browser: "Chrome", Country: "DE", CreatedAt: at("2026-03-29T22:30:00Z")},
+			// After the range
+			{URLId: url.ID, Browser: "Chrome", CreatedAt: at("2026-03-31T00:00:00Z")},
+		}
+		if err := repo.AddClickEvents(ctx, events); err != nil {
+			t.Fatalf("Failed to add clicks: %v", err)
+		}
+
+		opts := db.TimeSeriesOptions{
+			From:     time.Date(2026, 3, 28, 0, 0, 0, 0, berlin),
+			To:       time.Date(2026, 3, 31, 0, 0, 0, 0, berlin),
+			Location: berlin,
+		}
+		buckets, err := repo.GetClickTimeSeries(ctx, url.ID, opts)
+		if err != nil {
+			t.Fatalf("Failed to get time series: %v", err)
+		}
+		if len(buckets) != 3 {
+			t.Fatalf("Expected 3 days, got %d", len(buckets))
+		}
+		for i, want := range []struct {
+			start  string
+			clicks int
+		}{
+			{"2026-03-28T00:00:00+01:00", 2},
+			{"2026-03-29T00:00:00+01:00", 0},
+			{"2026-03-30T00:00:00+02:00", 1},
+		} {
+			if got := buckets[i].Start.Format(time.RFC3339); got != want.start || buckets[i].Clicks != want.clicks {
+				t.Errorf("Bucket %d: expected %d clicks at %s, got %d at %s", i, want.clicks, want.start, buckets[i].Clicks, got)
+			}
+		}
+
+		opts.IncludeBots = true
+		buckets, err = repo.GetClickTimeSeries(ctx, url.ID, opts)
+		if err != nil || buckets[0].Clicks != 3 {
+			t.Errorf("Expected the bot to be counted, got %+v, %v", buckets[0], err)
+		}
+		opts.IncludeBots = false
+
+		for groupBy, want := range map[string][]map[string]int{
+			db.TimeSeriesByBrowser: {{"Chrome": 1, "Firefox": 1}, nil, {"Chrome": 1}},
+			db.TimeSeriesByCountry: {{"DE": 1, "US": 1}, nil, {"DE": 1}},
+			db.TimeSeriesByReferer: {{"Direct": 1, "https://news.example": 1}, nil, {"Direct": 1}},
+		} {
+			opts.GroupBy = groupBy
+			buckets, err := repo.GetClickTimeSeries(ctx, url.ID, opts)
+			if err != nil {
+				t.Fatalf("Failed to group by %s: %v", groupBy, err)
+			}
+			for i, bucket := range buckets {
+				if !reflect.DeepEqual(bucket.Groups, want[i]) {
+					t.Errorf("Group by %s, bucket %d: expected %v, got %v", groupBy, i, want[i], bucket.Groups)
+				}
+			}
+		}
+		opts.GroupBy = ""
+
+		// The night the clocks go forward has no 02:00
+		opts.Granularity = db.GranularityHour
+		opts.From = time.Date(2026, 3, 29, 0, 0, 0, 0, berlin)
+		opts.To = time.Date(2026, 3, 29, 6, 0, 0, 0, berlin)
+		buckets, err = repo.GetClickTimeSeries(ctx, url.ID, opts)
+		if err != nil || len(buckets) != 5 || buckets[2].Start.Hour() != 3 {
+			t.Errorf("Expected 5 hours skipping 02:00, got %d, %v", len(buckets), err)
+		}
+
+		// Weeks start on Monday and the first one is complete
+		opts.Granularity = db.GranularityWeek
+		opts.From = time.Date(2026, 3, 28, 12, 0, 0, 0, berlin)
+		opts.To = time.Date(2026, 4, 1, 0, 0, 0, 0, berlin)
+		buckets, err = repo.GetClickTimeSeries(ctx, url.ID, opts)
+		if err != nil || len(buckets) != 2 || buckets[0].Start.Format("2006-01-02") != "2026-03-23" || buckets[0].Clicks != 2 || buckets[1].Clicks != 2 {
+			t.Errorf("Expected weeks from Monday 2026-03-23 with 2 clicks each, got %+v, %v", buckets, err)
+		}
+
+		opts.Granularity = db.GranularityMonth
+		opts.To = time.Date(2026, 4, 2, 0, 0, 0, 0, berlin)
+		buckets, err = repo.GetClickTimeSeries(ctx, url.ID, opts)
+		if err != nil || len(buckets) != 2 || buckets[0].Clicks != 4 || buckets[1].Clicks != 0 {
+			t.Errorf("Expected March and April, got %+v, %v", buckets, err)
+		}
+
+		opts.Granularity = db.GranularityDay
+		opts.GroupBy = "os"
+		if _, err := repo.GetClickTimeSeries(ctx, url.ID, opts); !errors.Is(err, db.ErrInvalidGroupBy) {
+			t.Errorf("Expected ErrInvalidGroupBy, got %v", err)
+		}
+	})
+}
+
+func TestTimeSeriesOptionsNormalize(t *testing.T) {
+	now := time.Date(2026, 5, 6, 7, 8, 9, 0, time.UTC)
+
+	opts := db.TimeSeriesOptions{From: now.Add(-48 * time.Hour), To: now}
+	if err := opts.Normalize(); err != nil {
+		t.Fatalf("Expected valid options, got %v", err)
+	}
+	if opts.Granularity != db.GranularityDay || opts.Location != time.UTC || !opts.From.Equal(time.Date(2026, 5, 4, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected day buckets in UTC from midnight, got %+v", opts)
+	}
+
+	for name, opts := range map[string]db.TimeSeriesOptions{
+		"granularity": {From: now.Add(-time.Hour), To: now, Granularity: "year"},
+		"group_by":    {From: now.Add(-time.Hour), To: now, GroupBy: "os"},
+		"order":       {From: now, To: now.Add(-time.Hour)},
+		"missing":     {To: now},
+		"too long":    {From: now.AddDate(-1, 0, 0), To: now, Granularity: db.GranularityMinute},
+		"local zone":  {From: now.Add(-time.Hour), To: now, Location: time.Local},
+	} {
+		if err := opts.Normalize(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func getTimeSeries(t *testing.T, url, key string) handlers.TimeSeriesResponse {
+	t.Helper()
+	var series handlers.TimeSeriesResponse
+	resp := doRequest(t, "GET", url, key, "")
+	if err := json.NewDecoder(resp.Body).Decode(&series); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Failed to get time series: %d, %v", resp.StatusCode, err)
+	}
+	return series
+}
+
+func TestClickTimeSeriesAPI(t *testing.T) {
+	server, repo, key := setupTestServer(t)
+
+	doRequest(t, "POST", server.URL+"/api/shorten", key, `{"url":"https://example.com/ts","custom_code":"tstts"}`)
+	for _, ua := range []string{uaChromeWindows, uaSafariIPhone, uaGooglebot} {
+		visitAs(t, server.URL+"/tstts", ua)
+	}
+	stored, err := repo.GetShortURL(context.Background(), "tstts")
+	if err != nil {
+		t.Fatalf("Failed to get link: %v", err)
+	}
+	waitForClicks(t, repo, stored.ID, 3)
+
+	series := getTimeSeries(t, server.URL+"/api/analytics/tstts/timeseries?granularity=hour&tz=Asia/Kolkata&group_by=browser", key)
+	if series.Granularity != db.GranularityHour || series.Timezone != "Asia/Kolkata" || series.GroupBy != db.TimeSeriesByBrowser {
+		t.Errorf("Expected the options to be echoed, got %+v", series)
+	}
+	if series.Total != 2 || len(series.Buckets) < 24 {
+		t.Fatalf("Expected 2 clicks over a day of hours, got %d in %d buckets", series.Total, len(series.Buckets))
+	}
+	browsers := map[string]int{}
+	for _, bucket := range series.Buckets {
+		if _, offset := bucket.Start.Zone(); offset != 5*3600+1800 || bucket.Start.Minute() != 0 {
+			t.Errorf("Expected hours starting in India time, got %s", bucket.Start)
+		}
+		if bucket.Clicks == 0 && bucket.Groups != nil {
+			t.Errorf("Expected an empty bucket to have no groups, got %+v", bucket)
+		}
+		for browser, clicks := range bucket.Groups {
+			browsers[browser] += clicks
+		}
+	}
+	if want := map[string]int{"Chrome": 1, "Safari": 1}; !reflect.DeepEqual(browsers, want) {
+		t.Errorf("Expected %v, got %v", want, browsers)
+	}
+
+	series = getTimeSeries(t, server.URL+"/api/analytics/tstts/timeseries?from=2026-01-01&to=2026-01-03&include_bots=true", key)
+	if series.Total != 0 || len(series.Buckets) != 2 || series.Buckets[0].Start.Format(time.RFC3339) != "2026-01-01T00:00:00Z" {
+		t.Errorf("Expected two empty UTC days, got %+v", series)
+	}
+
+	for _, query := range []string{
+		"tz=Mars/Olympus_Mons",
+		"granularity=year",
+		"group_by=os",
+		"include_bots=maybe",
+		"from=yesterday",
+		"from=2026-01-02&to=2026-01-01",
+		"granularity=minute&from=2025-01-01&to=2026-01-01",
+	} {
+		resp := doRequest(t, "GET", server.URL+"/api/analytics/tstts/timeseries?"+query, key, "")
+		if e := decodeError(t, resp); resp.StatusCode != http.StatusBadRequest || e.Code != handlers.CodeInvalidRequest {
+			t.Errorf("%s: expected 400, got %d %q", query, resp.StatusCode, e.Code)
+		}
+	}
+
+	resp := doRequest(t, "GET", server.URL+"/api/analytics/missing/timeseries", key, "")
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown link, got %d", resp.StatusCode)
+	}
+	resp.Body.Close()
+}
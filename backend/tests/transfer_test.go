@@ -0,0 +1,292 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"go-url-shortener/internal/api/handlers"
+	"go-url-shortener/internal/db"
+	"go-url-shortener/internal/middleware"
+	"go-url-shortener/internal/transfer"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// seedTransferData stores two links, one of them with clicks
+func seedTransferData(t *testing.T, repo db.RepositoryInterface) {
+	t.Helper()
+	ctx := context.Background()
+
+	expiresAt := time.Date(2099, 1, 2, 3, 4, 5, 0, time.UTC)
+	withClicks := &db.URL{OriginalURL: "https://example.com/a", ShortCode: "tstexp1", OwnerID: "tstowner", ExpiresAt: &expiresAt}
+	if err := repo.CreateShortURL(ctx, withClicks); err != nil {
+		t.Fatalf("Failed to create URL: %v", err)
+	}
+	launch := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := repo.CreateShortURL(ctx, &db.URL{OriginalURL: "https://example.com/b?x=1,2", ShortCode: "tstexp2", PasswordHash: "pbkdf2-sha256$1$c2FsdA$aGFzaA", MaxClicks: 5, ActivatesAt: &launch, RedirectType: db.RedirectInterstitial, ForcePreview: true, QueryPassthrough: db.QueryPassthroughAppend, PathPassthrough: true}); err != nil {
+		t.Fatalf("Failed to create URL: %v", err)
+	}
+
+	clickedAt := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	events := []*db.ClickEvent{
+		{URLId: withClicks.ID, IPAddress: "203.0.113.1", UserAgent: "Mozilla/5.0, \"quoted\"", Referer: "https://ref.example", Country: "DE", Region: "Bavaria", City: "Munich",
+			Browser: "Chrome", BrowserVersion: "120.0", OS: "Windows", OSVersion: "10", Device: "desktop", CreatedAt: clickedAt},
+		{URLId: withClicks.ID, IPAddress: "203.0.113.2", UserAgent: "curl/8.4.0", Bot: "curl", CreatedAt: clickedAt.Add(time.Hour)},
+	}
+	if err := repo.AddClickEvents(ctx, events); err != nil {
+		t.Fatalf("Failed to add click events: %v", err)
+	}
+	if err := repo.IncrementClickCount(ctx, "tstexp1", 2, clickedAt.Add(time.Hour)); err != nil {
+		t.Fatalf("Failed to count clicks: %v", err)
+	}
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo db.RepositoryInterface) {
+		ctx := context.Background()
+		defer cleanupTestURL(t, repo, "tstexp1")
+		defer cleanupTestURL(t, repo, "tstexp2")
+		seedTransferData(t, repo)
+
+		original, err := repo.GetShortURL(ctx, "tstexp1")
+		if err != nil {
+			t.Fatalf("Failed to get URL: %v", err)
+		}
+
+		for _, format := range []transfer.Format{transfer.NDJSON, transfer.CSV} {
+			t.Run(string(format), func(t *testing.T) {
+				var out bytes.Buffer
+				summary, err := transfer.Export(ctx, repo, &out, format)
+				if err != nil {
+					t.Fatalf("Export failed: %v", err)
+				}
+				if summary.URLs < 2 || summary.Clicks < 2 {
+					t.Errorf("Expected at least 2 links and 2 clicks, got %+v", summary)
+				}
+
+				target := setupMemoryRepo(t)
+				report, err := transfer.Import(ctx, target, &out, transfer.Options{Format: format})
+				if err != nil {
+					t.Fatalf("Import failed: %v", err)
+				}
+				if report.URLsCreated != summary.URLs || report.ClicksImported != summary.Clicks || report.Records != summary.URLs+summary.Clicks {
+					t.Errorf("Report %+v does not match export %+v", report, summary)
+				}
+
+				imported, err := target.GetShortURL(ctx, "tstexp1")
+				if err != nil {
+					t.Fatalf("Expected imported link, got %v", err)
+				}
+				if !imported.CreatedAt.Equal(original.CreatedAt) || !imported.ExpiresAt.Equal(*original.ExpiresAt) ||
+					imported.OwnerID != "tstowner" || imported.ClickCount != 2 || imported.LastClicked == nil {
+					t.Errorf("Imported link %+v does not match %+v", imported, original)
+				}
+				if other, err := target.GetShortURL(ctx, "tstexp2"); err != nil || other.OriginalURL != "https://example.com/b?x=1,2" || !other.IsPasswordProtected() || other.MaxClicks != 5 || other.RedirectType != db.RedirectInterstitial || !other.ForcePreview || other.QueryPassthrough != db.QueryPassthroughAppend || !other.PathPassthrough ||
+					other.ActivatesAt == nil || !other.ActivatesAt.Equal(time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)) {
+					t.Errorf("Expected tstexp2 to round-trip, got %+v, %v", other, err)
+				}
+
+				events, err := target.GetClickEvents(ctx, imported.ID)
+				if err != nil || len(events) != 2 {
+					t.Fatalf("Expected 2 imported clicks, got %d, %v", len(events), err)
+				}
+				first := events[1]
+				if first.IPAddress != "203.0.113.1" || first.UserAgent != "Mozilla/5.0, \"quoted\"" || first.Referer != "https://ref.example" ||
+					first.Country != "DE" || first.Region != "Bavaria" || first.City != "Munich" ||
+					first.Browser != "Chrome" || first.BrowserVersion != "120.0" || first.OS != "Windows" || first.OSVersion != "10" || first.Device != "desktop" ||
+					!first.CreatedAt.Equal(time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)) {
+					t.Errorf("Unexpected imported click %+v", first)
+				}
+				if events[0].Bot != "curl" {
+					t.Errorf("Expected the bot to round-trip, got %+v", events[0])
+				}
+			})
+		}
+	})
+}
+
+// importInput is an export with a link that conflicts with tstimp1 and a new
+// link, each with one click
+const importInput = `{"type":"url","short_code":"tstimp1","original_url":"https://example.com/new","created_at":"2024-01-01T00:00:00Z"}
+{"type":"url","short_code":"tstimp2","original_url":"https://example.com/2","created_at":"2024-01-01T00:00:00Z"}
+{"type":"click","short_code":"tstimp1","created_at":"2024-01-02T00:00:00Z","ip_address":"203.0.113.9"}
+{"type":"click","short_code":"tstimp2","created_at":"2024-01-02T00:00:00Z","ip_address":"203.0.113.9"}
+{"type":"click","short_code":"tstnowhere","created_at":"2024-01-02T00:00:00Z","ip_address":"203.0.113.9"}
+`
+
+func TestImportConflictPolicies(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo db.RepositoryInterface) {
+		ctx := context.Background()
+		defer cleanupTestURL(t, repo, "tstimp1")
+		defer cleanupTestURL(t, repo, "tstimp2")
+
+		existing := &db.URL{OriginalURL: "https://example.com/old", ShortCode: "tstimp1"}
+		if err := repo.CreateShortURL(ctx, existing); err != nil {
+			t.Fatalf("Failed to create URL: %v", err)
+		}
+		if err := repo.AddClickEvent(ctx, existing.ID, "203.0.113.1", "", ""); err != nil {
+			t.Fatalf("Failed to add click: %v", err)
+		}
+
+		run := func(policy db.ConflictPolicy, dryRun bool) (*transfer.Report, error) {
+			return transfer.Import(ctx, repo, strings.NewReader(importInput), transfer.Options{Conflict: policy, DryRun: dryRun})
+		}
+
+		// Fail stops at the taken code, in a dry run too
+		for _, dryRun := range []bool{true, false} {
+			report, err := run(db.ConflictFail, dryRun)
+			if !errors.Is(err, db.ErrCodeTaken) || len(report.Conflicts) > 0 && report.Conflicts[0] != "tstimp1" {
+				t.Errorf("Expected ErrCodeTaken for tstimp1 (dry run %v), got %v, %+v", dryRun, err, report)
+			}
+		}
+		if _, err := repo.GetShortURL(ctx, "tstimp2"); !errors.Is(err, db.ErrNotFound) {
+			t.Errorf("Expected failed import to store nothing, got %v", err)
+		}
+
+		// A dry run writes nothing
+		report, err := run(db.ConflictOverwrite, true)
+		if err != nil || report.URLsCreated != 1 || report.URLsOverwritten != 1 || report.ClicksImported != 2 || report.ClicksSkipped != 1 {
+			t.Errorf("Unexpected dry-run report %+v, %v", report, err)
+		}
+		if _, err := repo.GetShortURL(ctx, "tstimp2"); !errors.Is(err, db.ErrNotFound) {
+			t.Errorf("Expected dry run to store nothing, got %v", err)
+		}
+
+		// Skip keeps the existing link and drops the clicks meant for it
+		report, err = run(db.ConflictSkip, false)
+		if err != nil || report.URLsCreated != 1 || report.URLsSkipped != 1 || report.ClicksImported != 1 || report.ClicksSkipped != 2 {
+			t.Errorf("Unexpected skip report %+v, %v", report, err)
+		}
+		if len(report.Conflicts) != 1 || report.Conflicts[0] != "tstimp1" {
+			t.Errorf("Expected tstimp1 as the conflict, got %v", report.Conflicts)
+		}
+		if url, _ := repo.GetShortURL(ctx, "tstimp1"); url == nil || url.OriginalURL != "https://example.com/old" {
+			t.Errorf("Expected existing link to be kept, got %+v", url)
+		}
+		cleanupTestURL(t, repo, "tstimp2")
+
+		// Overwrite replaces the link and its click history
+		report, err = run(db.ConflictOverwrite, false)
+		if err != nil || report.URLsCreated != 1 || report.URLsOverwritten != 1 || report.ClicksImported != 2 {
+			t.Errorf("Unexpected overwrite report %+v, %v", report, err)
+		}
+		url, err := repo.GetShortURL(ctx, "tstimp1")
+		if err != nil || url.OriginalURL != "https://example.com/new" || !url.CreatedAt.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) {
+			t.Fatalf("Expected tstimp1 to be overwritten, got %+v, %v", url, err)
+		}
+		events, err := repo.GetClickEvents(ctx, url.ID)
+		if err != nil || len(events) != 1 || !events[0].CreatedAt.Equal(time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)) {
+			t.Errorf("Expected only the imported click, got %+v, %v", events, err)
+		}
+	})
+}
+
+func TestImportRejectsInvalidInput(t *testing.T) {
+	tests := []struct {
+		name   string
+		format transfer.Format
+		input  string
+	}{
+		{"malformed JSON", transfer.NDJSON, `{"type":"url",`},
+		{"unknown type", transfer.NDJSON, `{"type":"visit","short_code":"tstbad","created_at":"2024-01-01T00:00:00Z"}`},
+		{"missing url", transfer.NDJSON, `{"type":"url","short_code":"tstbad","created_at":"2024-01-01T00:00:00Z"}`},
+		{"missing created_at", transfer.NDJSON, `{"type":"url","short_code":"tstbad","original_url":"https://example.com"}`},
+		{"CSV without header columns", transfer.CSV, "short_code\ntstbad\n"},
+		{"CSV bad timestamp", transfer.CSV, "type,short_code,created_at,original_url\nurl,tstbad,yesterday,https://example.com\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := setupMemoryRepo(t)
+			_, err := transfer.Import(context.Background(), repo, strings.NewReader(tt.input), transfer.Options{Format: tt.format})
+			if !errors.Is(err, transfer.ErrInvalidRecord) {
+				t.Errorf("Expected ErrInvalidRecord, got %v", err)
+			}
+		})
+	}
+}
+
+func TestAdminTransferAPI(t *testing.T) {
+	server, repo, key := setupTestServer(t)
+	seedTransferData(t, repo)
+	exportURL := server.URL + "/api/admin/export"
+	importURL := server.URL + "/api/admin/import"
+
+	resp := doRequest(t, "GET", exportURL, key, "")
+	if e := decodeError(t, resp); resp.StatusCode != http.StatusUnauthorized || e.Code != middleware.CodeUnauthorized {
+		t.Errorf("Expected 401 for an API key on the admin API, got %d %q", resp.StatusCode, e.Code)
+	}
+
+	resp = doRequest(t, "GET", exportURL+"?format=csv", testAdminToken, "")
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/csv") ||
+		!strings.Contains(resp.Header.Get("Content-Disposition"), ".csv") {
+		t.Fatalf("Unexpected CSV export response %d %v", resp.StatusCode, resp.Header)
+	}
+	var csvExport bytes.Buffer
+	csvExport.ReadFrom(resp.Body)
+	if !strings.HasPrefix(csvExport.String(), "type,short_code,created_at,") {
+		t.Errorf("Expected CSV header, got %q", csvExport.String())
+	}
+
+	resp = doRequest(t, "GET", exportURL, testAdminToken, "")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("Unexpected NDJSON export response %d %v", resp.StatusCode, resp.Header)
+	}
+	var ndjsonExport bytes.Buffer
+	ndjsonExport.ReadFrom(resp.Body)
+
+	decodeImport := func(resp *http.Response) handlers.ImportResponse {
+		t.Helper()
+		var body handlers.ImportResponse
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("Failed to decode import response: %v", err)
+		}
+		return body
+	}
+
+	// Everything exists already: a dry run reports every link as a conflict
+	resp = doRequest(t, "POST", importURL+"?dry_run=true", testAdminToken, ndjsonExport.String())
+	body := decodeImport(resp)
+	if resp.StatusCode != http.StatusOK || !body.Report.DryRun || body.Report.URLsSkipped != 2 || body.Report.ClicksSkipped != 2 {
+		t.Errorf("Unexpected dry-run response %d %+v", resp.StatusCode, body.Report)
+	}
+
+	resp = doRequest(t, "POST", importURL+"?conflict=fail", testAdminToken, ndjsonExport.String())
+	body = decodeImport(resp)
+	if resp.StatusCode != http.StatusConflict || body.Error == nil || body.Error.Code != handlers.CodeCodeTaken {
+		t.Errorf("Expected 409 code_taken, got %d %+v", resp.StatusCode, body)
+	}
+
+	req, _ := http.NewRequest("POST", importURL+"?conflict=overwrite", strings.NewReader(csvExport.String()))
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	req.Header.Set("Content-Type", "text/csv")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body = decodeImport(resp)
+	if resp.StatusCode != http.StatusOK || body.Report.URLsOverwritten != 2 || body.Report.ClicksImported != 2 {
+		t.Errorf("Unexpected overwrite response %d %+v", resp.StatusCode, body.Report)
+	}
+
+	resp = doRequest(t, "POST", importURL, testAdminToken, `{"type":"url"}`)
+	body = decodeImport(resp)
+	if resp.StatusCode != http.StatusBadRequest || body.Error == nil || body.Error.Code != handlers.CodeInvalidRequest ||
+		!strings.Contains(body.Error.Message, "record 1") {
+		t.Errorf("Expected 400 for an invalid record, got %d %+v", resp.StatusCode, body.Error)
+	}
+
+	for _, query := range []string{"?conflict=merge", "?format=xml", "?dry_run=maybe"} {
+		resp := doRequest(t, "POST", importURL+query, testAdminToken, importInput)
+		if e := decodeError(t, resp); resp.StatusCode != http.StatusBadRequest || e.Code != handlers.CodeInvalidRequest {
+			t.Errorf("%s: expected 400, got %d %q", query, resp.StatusCode, e.Code)
+		}
+	}
+	if resp := doRequest(t, "GET", exportURL+"?format=xml", testAdminToken, ""); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown export format, got %d", resp.StatusCode)
+	}
+}
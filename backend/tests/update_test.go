@@ -0,0 +1,187 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go-url-shortener/internal/api/handlers"
+	"go-url-shortener/internal/db"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUpdateShortURL(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo db.RepositoryInterface) {
+		ctx := context.Background()
+		defer cleanupTestURL(t, repo, "tstedit")
+		defer cleanupTestURL(t, repo, "tstrenamed")
+		defer cleanupTestURL(t, repo, "tstother")
+
+		url := &db.URL{OriginalURL: "https://example.com/typo", ShortCode: "tstedit", OwnerID: "tsteditor"}
+		if err := repo.CreateShortURL(ctx, url); err != nil {
+			t.Fatalf("Failed to create URL: %v", err)
+		}
+		if url.Version != 1 {
+			t.Errorf("Expected new URL at version 1, got %d", url.Version)
+		}
+		if err := repo.CreateShortURL(ctx, &db.URL{OriginalURL: "https://example.com/other", ShortCode: "tstother", OwnerID: "tsteditor"}); err != nil {
+			t.Fatalf("Failed to create URL: %v", err)
+		}
+		if err := repo.AddClickEvent(ctx, url.ID, "203.0.113.1", "test", ""); err != nil {
+			t.Fatalf("Failed to add click: %v", err)
+		}
+
+		fixed := "https://example.com/fixed"
+		updated, err := repo.UpdateShortURL(ctx, "tstedit", "tsteditor", 1, db.URLUpdate{OriginalURL: &fixed})
+		if err != nil {
+			t.Fatalf("Error updating URL: %v", err)
+		}
+		if updated.OriginalURL != fixed || updated.Version != 2 || updated.ExpiresAt == nil {
+			t.Errorf("Expected new target at version 2 with expiry kept, got %+v", updated)
+		}
+
+		if _, err := repo.UpdateShortURL(ctx, "tstedit", "tsteditor", 1, db.URLUpdate{OriginalURL: &fixed}); !errors.Is(err, db.ErrVersionConflict) {
+			t.Errorf("Expected ErrVersionConflict for a stale version, got %v", err)
+		}
+		if _, err := repo.UpdateShortURL(ctx, "tstedit", "tstintruder", 2, db.URLUpdate{OriginalURL: &fixed}); !errors.Is(err, db.ErrNotFound) {
+			t.Errorf("Expected ErrNotFound for another owner, got %v", err)
+		}
+		if _, err := repo.UpdateShortURL(ctx, "tstmissing", "tsteditor", 0, db.URLUpdate{OriginalURL: &fixed}); !errors.Is(err, db.ErrNotFound) {
+			t.Errorf("Expected ErrNotFound for a missing code, got %v", err)
+		}
+
+		taken := "tstother"
+		if _, err := repo.UpdateShortURL(ctx, "tstedit", "tsteditor", 2, db.URLUpdate{ShortCode: &taken}); !errors.Is(err, db.ErrCodeTaken) {
+			t.Errorf("Expected ErrCodeTaken renaming onto an existing code, got %v", err)
+		}
+
+		renamed := "tstrenamed"
+		updated, err = repo.UpdateShortURL(ctx, "tstedit", "tsteditor", 0, db.URLUpdate{ShortCode: &renamed, SetExpiresAt: true})
+		if err != nil {
+			t.Fatalf("Error renaming URL: %v", err)
+		}
+		if updated.ShortCode != renamed || updated.ExpiresAt != nil || updated.Version != 3 || updated.ID != url.ID {
+			t.Errorf("Expected renamed permanent link with the same id at version 3, got %+v", updated)
+		}
+
+		if _, err := repo.GetShortURL(ctx, "tstedit"); !errors.Is(err, db.ErrNotFound) {
+			t.Errorf("Expected old code to be gone, got %v", err)
+		}
+		events, err := repo.GetClickEvents(ctx, url.ID)
+		if err != nil || len(events) != 1 {
+			t.Errorf("Expected click history to survive the rename, got %d events, %v", len(events), err)
+		}
+
+		// Expired links can be extended
+		past := time.Now().Add(-time.Hour)
+		if _, err := repo.UpdateShortURL(ctx, "tstrenamed", "tsteditor", 3, db.URLUpdate{SetExpiresAt: true, ExpiresAt: &past}); err != nil {
+			t.Fatalf("Error expiring URL: %v", err)
+		}
+		future := time.Now().Add(time.Hour)
+		updated, err = repo.UpdateShortURL(ctx, "tstrenamed", "tsteditor", 4, db.URLUpdate{SetExpiresAt: true, ExpiresAt: &future})
+		if err != nil {
+			t.Fatalf("Error extending expired URL: %v", err)
+		}
+		if updated.IsExpired() || updated.ExpiresAt.Sub(future).Abs() > time.Second {
+			t.Errorf("Expected expiry %v, got %v", future, updated.ExpiresAt)
+		}
+	})
+}
+
+func TestUpdateShortURLAPI(t *testing.T) {
+	server, repo, key := setupTestServer(t)
+	bobKey := createTestAPIKey(t, repo, "bob")
+	urlPath := server.URL + "/api/urls/"
+
+	doRequest(t, "POST", server.URL+"/api/shorten", key, `{"url":"https://example.com/typo","custom_code":"tstpatch"}`)
+	doRequest(t, "POST", server.URL+"/api/shorten", key, `{"url":"https://example.com/taken","custom_code":"tsttaken"}`)
+
+	resp := doRequest(t, "GET", urlPath+"tstpatch", key, "")
+	etag := resp.Header.Get("ETag")
+	if etag != `"1"` {
+		t.Fatalf(`Expected ETag "1", got %q`, etag)
+	}
+
+	patch := func(code, token, ifMatch, body string) *http.Response {
+		req, err := http.NewRequest("PATCH", urlPath+code, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Failed to build request: %v", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("PATCH failed: %v", err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	resp = patch("tstpatch", key, etag, `{"original_url":"https://example.com/fixed","expires_at":null}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.StatusCode)
+	}
+	var updated db.URL
+	if err := json.NewDecoder(resp.Body).Decode(&updated); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if updated.OriginalURL != "https://example.com/fixed" || updated.ExpiresAt != nil || updated.Version != 2 {
+		t.Errorf("Unexpected updated link %+v", updated)
+	}
+	if got := resp.Header.Get("ETag"); got != `"2"` {
+		t.Errorf(`Expected ETag "2", got %q`, got)
+	}
+
+	tests := []struct {
+		name    string
+		code    string
+		token   string
+		ifMatch string
+		body    string
+		status  int
+		errCode string
+	}{
+		{"stale If-Match", "tstpatch", key, etag, `{"original_url":"https://example.com/again"}`, http.StatusPreconditionFailed, handlers.CodeVersionConflict},
+		{"stale body version", "tstpatch", key, "", `{"original_url":"https://example.com/again","version":1}`, http.StatusPreconditionFailed, handlers.CodeVersionConflict},
+		{"no precondition", "tstpatch", key, "", `{"original_url":"https://example.com/again"}`, http.StatusPreconditionRequired, handlers.CodePreconditionRequired},
+		{"malformed If-Match", "tstpatch", key, "2", `{"original_url":"https://example.com/again"}`, http.StatusBadRequest, handlers.CodeInvalidRequest},
+		{"empty update", "tstpatch", key, `"2"`, `{}`, http.StatusBadRequest, handlers.CodeInvalidRequest},
+		{"invalid url", "tstpatch", key, `"2"`, `{"original_url":"ftp://example.com"}`, http.StatusBadRequest, handlers.CodeInvalidURL},
+		{"blocked url", "tstpatch", key, `"2"`, `{"original_url":"http://localhost/admin"}`, http.StatusForbidden, handlers.CodeBlocked},
+		{"reserved code", "tstpatch", key, `"2"`, `{"short_code":"api"}`, http.StatusBadRequest, handlers.CodeInvalidCode},
+		{"taken code", "tstpatch", key, `"2"`, `{"short_code":"tsttaken"}`, http.StatusConflict, handlers.CodeCodeTaken},
+		{"bad expiry", "tstpatch", key, `"2"`, `{"expires_at":"tomorrow"}`, http.StatusBadRequest, handlers.CodeInvalidRequest},
+		{"other owner", "tstpatch", bobKey, "*", `{"original_url":"https://example.com/mine"}`, http.StatusNotFound, handlers.CodeNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := patch(tt.code, tt.token, tt.ifMatch, tt.body)
+			body := decodeError(t, resp)
+			if resp.StatusCode != tt.status || body.Code != tt.errCode {
+				t.Errorf("Expected %d %q, got %d %q", tt.status, tt.errCode, resp.StatusCode, body.Code)
+			}
+		})
+	}
+
+	resp = patch("tstpatch", key, "*", `{"short_code":"tstpatched","expires_at":"2099-01-01T00:00:00Z"}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected rename to succeed, got %d", resp.StatusCode)
+	}
+
+	resp, err := noRedirectClient.Get(server.URL + "/tstpatched")
+	if err != nil {
+		t.Fatalf("Redirect request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMovedPermanently || resp.Header.Get("Location") != "https://example.com/fixed" {
+		t.Errorf("Expected renamed link to redirect to the fixed URL, got %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	if resp := doRequest(t, "GET", urlPath+"tstpatch", key, ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected old code to be gone, got %d", resp.StatusCode)
+	}
+}
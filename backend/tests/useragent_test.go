@@ -0,0 +1,145 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"go-url-shortener/internal/api/handlers"
+	"go-url-shortener/internal/useragent"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+const (
+	uaChromeWindows = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+	uaEdgeWindows   = uaChromeWindows + " Edg/120.0.2210.91"
+	uaSafariIPhone  = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.2 Mobile/15E148 Safari/604.1"
+	uaGooglebot     = "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"
+	uaFirefoxLinux  = "Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0"
+)
+
+func TestParseUserAgent(t *testing.T) {
+	for ua, want := range map[string]useragent.Agent{
+		uaChromeWindows: {Browser: "Chrome", BrowserVersion: "120.0.0.0", OS: "Windows", OSVersion: "10", Device: useragent.DeviceDesktop},
+		uaEdgeWindows:   {Browser: "Edge", BrowserVersion: "120.0.2210.91", OS: "Windows", OSVersion: "10", Device: useragent.DeviceDesktop},
+		uaSafariIPhone:  {Browser: "Safari", BrowserVersion: "17.2", OS: "iOS", OSVersion: "17.2", Device: useragent.DeviceMobile},
+		uaFirefoxLinux:  {Browser: "Firefox", BrowserVersion: "121.0", OS: "Linux", Device: useragent.DeviceDesktop},
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/119.0.0.0 Safari/537.36 OPR/105.0.0.0": {
+			Browser: "Opera", BrowserVersion: "105.0.0.0", OS: "Windows", OSVersion: "10", Device: useragent.DeviceDesktop},
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.2 Safari/605.1.15": {
+			Browser: "Safari", BrowserVersion: "17.2", OS: "macOS", OSVersion: "10.15.7", Device: useragent.DeviceDesktop},
+		"Mozilla/5.0 (iPad; CPU OS 17_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/120.0.6099.119 Mobile/15E148 Safari/604.1": {
+			Browser: "Chrome", BrowserVersion: "120.0.6099.119", OS: "iOS", OSVersion: "17.2", Device: useragent.DeviceTablet},
+		"Mozilla/5.0 (Linux; Android 13; SM-S901B) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/23.0 Chrome/115.0.0.0 Mobile Safari/537.36": {
+			Browser: "Samsung Internet", BrowserVersion: "23.0", OS: "Android", OSVersion: "13", Device: useragent.DeviceMobile},
+		"Mozilla/5.0 (Linux; Android 13; SM-X700) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36": {
+			Browser: "Chrome", BrowserVersion: "120.0.0.0", OS: "Android", OSVersion: "13", Device: useragent.DeviceTablet},
+		"Mozilla/5.0 (Android 14; Tablet; rv:121.0) Gecko/121.0 Firefox/121.0": {
+			Browser: "Firefox", BrowserVersion: "121.0", OS: "Android", OSVersion: "14", Device: useragent.DeviceTablet},
+		"Mozilla/5.0 (Linux; Android 12; Pixel 6 Build/SD1A.210817.023; wv) AppleWebKit/537.36 (KHTML, like Gecko) Version/4.0 Chrome/94.0.4606.71 Mobile Safari/537.36": {
+			Browser: "Android WebView", BrowserVersion: "94.0.4606.71", OS: "Android", OSVersion: "12", Device: useragent.DeviceMobile},
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 16_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148 [FBAN/FBIOS;FBAV/442.0.0.40.111;]": {
+			Browser: "Facebook", BrowserVersion: "442.0.0.40.111", OS: "iOS", OSVersion: "16.6", Device: useragent.DeviceMobile},
+		"Mozilla/5.0 (Windows NT 6.1; Trident/7.0; rv:11.0) like Gecko": {
+			Browser: "Internet Explorer", BrowserVersion: "11.0", OS: "Windows", OSVersion: "7", Device: useragent.DeviceDesktop},
+		// A phone brand that contains "bot"
+		"Mozilla/5.0 (Linux; Android 10; CUBOT X30) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36": {
+			Browser: "Chrome", BrowserVersion: "120.0.0.0", OS: "Android", OSVersion: "10", Device: useragent.DeviceMobile},
+		uaGooglebot: {Bot: "Googlebot"},
+		"Mozilla/5.0 (Linux; Android 6.0.1; Nexus 5X Build/MMB29P) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.6099.71 Mobile Safari/537.36 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)": {
+			Browser: "Chrome", BrowserVersion: "120.0.6099.71", OS: "Android", OSVersion: "6.0.1", Bot: "Googlebot"},
+		"facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)":  {Bot: "Facebook"},
+		"Mozilla/5.0 (compatible; ExampleCrawler/1.0; +https://example.com/crawler)": {Bot: "ExampleCrawler"},
+		"curl/8.4.0": {Bot: "curl"},
+		"":           {},
+	} {
+		if got := useragent.Parse(ua); got != want {
+			t.Errorf("Parse(%q):\n got  %+v\n want %+v", ua, got, want)
+		}
+	}
+}
+
+// visitAs follows a short link with the given User-Agent
+func visitAs(t *testing.T, url, userAgent string) {
+	t.Helper()
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		t.Fatalf("Failed to build request: %v", err)
+	}
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := noRedirectClient.Do(req)
+	if err != nil {
+		t.Fatalf("Redirect failed: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func getAnalytics(t *testing.T, url, key string) handlers.AnalyticsResponse {
+	t.Helper()
+	var analytics handlers.AnalyticsResponse
+	resp := doRequest(t, "GET", url, key, "")
+	if err := json.NewDecoder(resp.Body).Decode(&analytics); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Failed to get analytics: %d, %v", resp.StatusCode, err)
+	}
+	return analytics
+}
+
+func TestUserAgentAnalytics(t *testing.T) {
+	server, repo, key := setupTestServer(t)
+	ctx := context.Background()
+
+	doRequest(t, "POST", server.URL+"/api/shorten", key, `{"url":"https://example.com/ua","custom_code":"tstua"}`)
+	for _, ua := range []string{uaChromeWindows, uaEdgeWindows, uaSafariIPhone, uaGooglebot} {
+		visitAs(t, server.URL+"/tstua", ua)
+	}
+
+	stored, err := repo.GetShortURL(ctx, "tstua")
+	if err != nil {
+		t.Fatalf("Failed to get link: %v", err)
+	}
+	waitForClicks(t, repo, stored.ID, 4)
+
+	// Parsed fields are stored with the click
+	events, err := repo.GetClickEvents(ctx, stored.ID)
+	if err != nil {
+		t.Fatalf("Failed to get clicks: %v", err)
+	}
+	for _, event := range events {
+		if event.UserAgent == uaEdgeWindows && (event.Browser != "Edge" || event.OS != "Windows" || event.Device != useragent.DeviceDesktop) {
+			t.Errorf("Expected the parsed user agent to be stored, got %+v", event)
+		}
+		if event.UserAgent == uaGooglebot && event.Bot != "Googlebot" {
+			t.Errorf("Expected the bot to be stored, got %+v", event)
+		}
+	}
+
+	// Clicks recorded before parsing was added are parsed when read
+	if err := repo.AddClickEvent(ctx, stored.ID, "10.0.0.9", uaFirefoxLinux, ""); err != nil {
+		t.Fatalf("Failed to add click: %v", err)
+	}
+
+	analytics := getAnalytics(t, server.URL+"/api/analytics/tstua", key)
+	summary := analytics.Summary
+	if summary.TotalClicks != 4 || summary.BotClicks != 1 || len(analytics.ClickEvents) != 4 {
+		t.Errorf("Expected 4 clicks without the bot, got %d (%d bots, %d events)", summary.TotalClicks, summary.BotClicks, len(analytics.ClickEvents))
+	}
+	if want := map[string]int{"Chrome": 1, "Edge": 1, "Safari": 1, "Firefox": 1}; !reflect.DeepEqual(summary.TopUserAgents, want) {
+		t.Errorf("Expected browsers %v, got %v", want, summary.TopUserAgents)
+	}
+	if want := map[string]int{"desktop": 3, "mobile": 1}; !reflect.DeepEqual(summary.TopDevices, want) {
+		t.Errorf("Expected devices %v, got %v", want, summary.TopDevices)
+	}
+	if want := map[string]int{"Windows": 2, "iOS": 1, "Linux": 1}; !reflect.DeepEqual(summary.TopOS, want) {
+		t.Errorf("Expected operating systems %v, got %v", want, summary.TopOS)
+	}
+
+	analytics = getAnalytics(t, server.URL+"/api/analytics/tstua?include_bots=true", key)
+	if analytics.Summary.TotalClicks != 5 || analytics.Summary.BotClicks != 1 || analytics.Summary.TopUserAgents["Other"] != 1 {
+		t.Errorf("Expected the bot to be included, got %+v", analytics.Summary)
+	}
+
+	resp := doRequest(t, "GET", server.URL+"/api/analytics/tstua?include_bots=maybe", key, "")
+	if e := decodeError(t, resp); resp.StatusCode != http.StatusBadRequest || e.Code != handlers.CodeInvalidRequest {
+		t.Errorf("Expected 400 for a bad include_bots, got %d %q", resp.StatusCode, e.Code)
+	}
+}
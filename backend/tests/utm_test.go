@@ -0,0 +1,146 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go-url-shortener/internal/api/handlers"
+	"go-url-shortener/internal/db"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestUTMBuilder(t *testing.T) {
+	server, _, key := setupTestServer(t)
+
+	resp := doRequest(t, "POST", server.URL+"/api/shorten", key, `{
+		"url": "https://example.com/p?ref=x#top",
+		"utm_source": "news letter", "utm_medium": "email", "utm_campaign": "spring",
+		"query_params": {"lang": "en", "a&b": "c=d"}
+	}`)
+	var created handlers.ShortenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil || resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d, %v", resp.StatusCode, err)
+	}
+	const want = "https://example.com/p?ref=x&utm_source=news+letter&utm_medium=email&utm_campaign=spring&a%26b=c%3Dd&lang=en#top"
+	if created.OriginalURL != want {
+		t.Errorf("Expected %s, got %s", want, created.OriginalURL)
+	}
+	if created.UTM != (db.UTM{Source: "news letter", Medium: "email", Campaign: "spring"}) {
+		t.Errorf("Expected the UTM fields in the response, got %+v", created.UTM)
+	}
+
+	// A parameter the URL already has with the same value is not repeated
+	resp = doRequest(t, "POST", server.URL+"/api/shorten", key, `{"url":"https://example.com/?utm_source=a","utm_source":"a","utm_medium":"b"}`)
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil || created.OriginalURL != "https://example.com/?utm_source=a&utm_medium=b" {
+		t.Errorf("Expected the duplicate to be merged, got %q, %v", created.OriginalURL, err)
+	}
+
+	for name, body := range map[string]string{
+		"conflicting value":   `{"url":"https://example.com/?utm_source=a","utm_source":"b"}`,
+		"utm in query_params": `{"url":"https://example.com","query_params":{"utm_campaign":"x"}}`,
+		"empty name":          `{"url":"https://example.com","query_params":{" ":"x"}}`,
+		"control character":   `{"url":"https://example.com","utm_term":"a\nb"}`,
+	} {
+		resp := doRequest(t, "POST", server.URL+"/api/shorten", key, body)
+		if e := decodeError(t, resp); resp.StatusCode != http.StatusBadRequest || e.Code != handlers.CodeInvalidRequest {
+			t.Errorf("%s: expected 400, got %d %q", name, resp.StatusCode, e.Code)
+		}
+	}
+}
+
+func TestUTMColumns(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo db.RepositoryInterface) {
+		ctx := context.Background()
+		for _, code := range []string{"tstutm1", "tstutm2", "tstutm3", "tstutm4"} {
+			defer cleanupTestURL(t, repo, code)
+		}
+
+		for code, target := range map[string]string{
+			"tstutm1": "https://example.com/a?utm_source=mail&utm_campaign=spring",
+			"tstutm2": "https://example.com/b?utm_source=ads&utm_campaign=spring",
+			"tstutm3": "https://example.com/c?utm_campaign=summer&utm_campaign=ignored",
+			"tstutm4": "https://example.com/d",
+		} {
+			if err := repo.CreateShortURL(ctx, &db.URL{OriginalURL: target, ShortCode: code, OwnerID: "utm-owner"}); err != nil {
+				t.Fatalf("Failed to create %s: %v", code, err)
+			}
+		}
+		if err := repo.IncrementClickCount(ctx, "tstutm2", 3, time.Now()); err != nil {
+			t.Fatalf("Failed to count clicks: %v", err)
+		}
+
+		stored, err := repo.GetShortURL(ctx, "tstutm1")
+		if err != nil || stored.UTM != (db.UTM{Source: "mail", Campaign: "spring"}) {
+			t.Errorf("Expected the UTM columns to be read from the URL, got %+v, %v", stored, err)
+		}
+
+		stats, err := repo.GetCampaignStats(ctx, "utm-owner", db.UTMCampaign)
+		if err != nil {
+			t.Fatalf("Error getting campaign stats: %v", err)
+		}
+		if len(stats) != 2 || *stats[0] != (db.CampaignStat{Value: "spring", Links: 2, Clicks: 3}) || *stats[1] != (db.CampaignStat{Value: "summer", Links: 1}) {
+			t.Errorf("Unexpected campaign stats %+v", stats)
+		}
+
+		// Changing the target updates the columns with it
+		target := "https://example.com/a?utm_source=mail"
+		if _, err := repo.UpdateShortURL(ctx, "tstutm1", "utm-owner", 0, db.URLUpdate{OriginalURL: &target}); err != nil {
+			t.Fatalf("Failed to update: %v", err)
+		}
+		stats, err = repo.GetCampaignStats(ctx, "utm-owner", db.UTMCampaign)
+		if err != nil || len(stats) != 2 || stats[0].Links != 1 {
+			t.Errorf("Expected spring to lose a link, got %+v, %v", stats, err)
+		}
+
+		if stats, err := repo.GetCampaignStats(ctx, "someone-else", db.UTMCampaign); err != nil || len(stats) != 0 {
+			t.Errorf("Expected other owners to see no groups, got %+v, %v", stats, err)
+		}
+		if _, err := repo.GetCampaignStats(ctx, "utm-owner", "owner_id"); !errors.Is(err, db.ErrInvalidGroupBy) {
+			t.Errorf("Expected ErrInvalidGroupBy, got %v", err)
+		}
+	})
+}
+
+func TestCampaignAnalyticsAPI(t *testing.T) {
+	server, _, key := setupTestServer(t)
+
+	for _, body := range []string{
+		`{"url":"https://example.com/a","custom_code":"tstcmp1","utm_source":"mail","utm_campaign":"spring"}`,
+		`{"url":"https://example.com/b","custom_code":"tstcmp2","utm_source":"ads","utm_campaign":"spring"}`,
+		`{"url":"https://example.com/c","custom_code":"tstcmp3","utm_source":"ads","utm_campaign":"summer"}`,
+	} {
+		doRequest(t, "POST", server.URL+"/api/shorten", key, body)
+	}
+	for _, code := range []string{"tstcmp1", "tstcmp2", "tstcmp2", "tstcmp3"} {
+		doRequest(t, "GET", server.URL+"/"+code, "", "")
+	}
+
+	var campaigns handlers.CampaignAnalyticsResponse
+	resp := doRequest(t, "GET", server.URL+"/api/analytics", key, "")
+	if err := json.NewDecoder(resp.Body).Decode(&campaigns); err != nil {
+		t.Fatalf("Failed to decode analytics: %v", err)
+	}
+	if campaigns.GroupBy != db.UTMCampaign || len(campaigns.Groups) != 2 ||
+		*campaigns.Groups[0] != (db.CampaignStat{Value: "spring", Links: 2, Clicks: 3}) {
+		t.Errorf("Unexpected campaign groups %+v", campaigns)
+	}
+
+	var sources handlers.CampaignAnalyticsResponse
+	resp = doRequest(t, "GET", server.URL+"/api/analytics?group_by=utm_source", key, "")
+	if err := json.NewDecoder(resp.Body).Decode(&sources); err != nil {
+		t.Fatalf("Failed to decode analytics: %v", err)
+	}
+	if len(sources.Groups) != 2 || *sources.Groups[0] != (db.CampaignStat{Value: "ads", Links: 2, Clicks: 3}) {
+		t.Errorf("Unexpected source groups %+v", sources.Groups)
+	}
+
+	resp = doRequest(t, "GET", server.URL+"/api/analytics?group_by=referer", key, "")
+	if e := decodeError(t, resp); resp.StatusCode != http.StatusBadRequest || e.Code != handlers.CodeInvalidRequest {
+		t.Errorf("Expected 400 for an unknown group_by, got %d %q", resp.StatusCode, e.Code)
+	}
+	if resp := doRequest(t, "GET", server.URL+"/api/analytics", "", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without an API key, got %d", resp.StatusCode)
+	}
+}
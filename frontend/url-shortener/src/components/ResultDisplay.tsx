@@ -12,9 +12,13 @@ const ResultDisplay: React.FC<ResultDisplayProps> = ({ result, onReset }) => {
     const [copied, setCopied] = useState(false);
     const [qrCodeDataUrl, setQrCodeDataUrl] = useState<string>('');
 
-    // Generate QR code when component mounts or result changes
+    // Use the server's QR code, generating one locally if it is missing
     useEffect(() => {
         const generateQRCode = async () => {
+            if (result.qr_code) {
+                setQrCodeDataUrl(result.qr_code);
+                return;
+            }
             try {
                 const dataUrl = await QRCode.toDataURL(result.short_url, {
                     width: 200,
@@ -31,7 +35,7 @@ const ResultDisplay: React.FC<ResultDisplayProps> = ({ result, onReset }) => {
         };
 
         generateQRCode();
-    }, [result.short_url]);
+    }, [result.short_url, result.qr_code]);
 
     const copyToClipboard = async () => {
         try {
@@ -6,19 +6,73 @@ const API_BASE_URL = import.meta.env.DEV ? '' : 'http://localhost:8080';
 const SHORTLINK_BASE_URL =
     import.meta.env.VITE_SHORTLINK_BASE_URL ??
     (import.meta.env.DEV ? 'http://localhost:8080' : API_BASE_URL);
+// API key for the management endpoints; without it only shortening works
+const API_KEY: string | undefined = import.meta.env.VITE_API_KEY;
 
 export interface ShortenRequest {
     url: string;
     custom_code?: string;
+    // The link does not redirect before this RFC 3339 time
+    activates_at?: string;
     expires_at?: string;
+    // Visitors must enter it before being redirected
+    password?: string;
+    // Redirects allowed before the link stops working, e.g. 1 for one-time links
+    max_clicks?: number;
+    redirect_type?: RedirectType;
+    // Show every visitor the preview page instead of redirecting
+    force_preview?: boolean;
+    // Merge the visit's query into the target; the policy picks the winner
+    query_passthrough?: QueryPassthrough;
+    // Append the path after the short code to the target
+    path_passthrough?: boolean;
+    // Added to the URL's query; a different existing value is rejected
+    utm_source?: string;
+    utm_medium?: string;
+    utm_campaign?: string;
+    utm_term?: string;
+    utm_content?: string;
+    query_params?: Record<string, string>;
 }
 
+// How a link sends visitors on; omitted means the server default
+export type RedirectType = '301' | '302' | '307' | '308' | 'meta_refresh' | 'interstitial';
+
+// Which value wins when the visit and the target set the same parameter
+export type QueryPassthrough = 'keep' | 'override' | 'append';
+
 export interface ShortenResponse {
     short_url: string;
     original_url: string;
     code: string;
+    activates_at?: string;
     expires_at?: string;
     qr_code?: string;
+    password_protected?: boolean;
+    max_clicks?: number;
+    redirect_type?: RedirectType;
+    force_preview?: boolean;
+    query_passthrough?: QueryPassthrough;
+    path_passthrough?: boolean;
+    utm_source?: string;
+    utm_medium?: string;
+    utm_campaign?: string;
+    utm_term?: string;
+    utm_content?: string;
+}
+
+// Result of one item of a batch, in request order
+export interface BatchResult {
+    index: number;
+    result?: ShortenResponse;
+    error?: ApiError['error'];
+}
+
+export interface BatchResponse {
+    mode: 'transactional' | 'best_effort';
+    created: number;
+    failed: number;
+    results: BatchResult[];
 }
 
 export interface URLDetails {
@@ -26,15 +80,66 @@ export interface URLDetails {
     short_code: string;
     original_url: string;
     created_at: string;
+    activates_at?: string;
     expires_at?: string;
     click_count: number;
     last_clicked?: string;
+    max_clicks?: number;
+    redirect_type?: RedirectType;
+    force_preview?: boolean;
+    query_passthrough?: QueryPassthrough;
+    path_passthrough?: boolean;
+    utm_source?: string;
+    utm_medium?: string;
+    utm_campaign?: string;
+    utm_term?: string;
+    utm_content?: string;
+    version: number;
+}
+
+// Changes for updateURL; expires_at: null removes the expiry
+export interface URLUpdate {
+    original_url?: string;
+    short_code?: string;
+    expires_at?: string | null;
 }
 
 export interface URLHistoryItem extends URLDetails {
     status: string;
 }
 
+// Paginated list response from /api/urls and /api/history
+export interface Page<T> {
+    items: T[];
+    next_cursor?: string;
+    total: number;
+}
+
+// Error body returned by every failing API call
+export interface ApiError {
+    error: {
+        code: string;
+        message: string;
+        request_id?: string;
+    };
+}
+
+// Read the message from an error response, falling back to the raw text
+async function errorMessage(response: Response): Promise<string> {
+    const text = await response.text();
+    try {
+        const body: ApiError = JSON.parse(text);
+        return body.error?.message ?? text;
+    } catch {
+        return text || response.statusText;
+    }
+}
+
+// Authorization header for the configured API key, if any
+function authHeaders(): Record<string, string> {
+    return API_KEY ? { Authorization: `Bearer ${API_KEY}` } : {};
+}
+
 class ApiService {
     private baseUrl: string;
     private shortlinkBaseUrl: string;
@@ -54,6 +159,7 @@ class ApiService {
                 method: 'POST',
                 headers: {
                     'Content-Type': 'application/json',
+                    ...authHeaders(),
                 },
                 body: JSON.stringify(request),
             });
@@ -62,9 +168,9 @@ class ApiService {
             console.log('Response headers:', response.headers);
 
             if (!response.ok) {
-                const errorText = await response.text();
-                console.error('Error response:', errorText);
-                throw new Error(`Failed to create short URL: ${errorText}`);
+                const message = await errorMessage(response);
+                console.error('Error response:', message);
+                throw new Error(`Failed to create short URL: ${message}`);
             }
 
             const result = await response.json();
@@ -76,12 +182,36 @@ class ApiService {
         }
     }
 
+    // Create many short URLs; a rejected transactional batch still
+    // resolves so callers can show the per-item errors
+    async createShortURLs(
+        requests: ShortenRequest[],
+        mode: BatchResponse['mode'] = 'transactional',
+    ): Promise<BatchResponse> {
+        const response = await fetch(`${this.baseUrl}/api/shorten/batch?mode=${mode}`, {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+                ...authHeaders(),
+            },
+            body: JSON.stringify(requests),
+        });
+
+        if (!response.ok && response.status !== 422) {
+            throw new Error(`Failed to create short URLs: ${await errorMessage(response)}`);
+        }
+
+        return response.json();
+    }
+
     // Get URL details
     async getURLDetails(shortCode: string): Promise<URLDetails> {
-        const response = await fetch(`${this.baseUrl}/api/urls/${shortCode}`);
+        const response = await fetch(`${this.baseUrl}/api/urls/${shortCode}`, {
+            headers: authHeaders(),
+        });
 
         if (!response.ok) {
-            throw new Error(`Failed to get URL details: ${response.statusText}`);
+            throw new Error(`Failed to get URL details: ${await errorMessage(response)}`);
         }
 
         return response.json();
@@ -89,10 +219,32 @@ class ApiService {
 
     // Get all URLs
     async getAllURLs(): Promise<URLDetails[]> {
-        const response = await fetch(`${this.baseUrl}/api/urls`);
+        const response = await fetch(`${this.baseUrl}/api/urls`, {
+            headers: authHeaders(),
+        });
+
+        if (!response.ok) {
+            throw new Error(`Failed to get URLs: ${await errorMessage(response)}`);
+        }
+
+        const page: Page<URLDetails> = await response.json();
+        return page.items;
+    }
+
+    // Edit a URL; fails with 412 if it changed since the given version
+    async updateURL(shortCode: string, changes: URLUpdate, version: number): Promise<URLDetails> {
+        const response = await fetch(`${this.baseUrl}/api/urls/${shortCode}`, {
+            method: 'PATCH',
+            headers: {
+                'Content-Type': 'application/json',
+                'If-Match': `"${version}"`,
+                ...authHeaders(),
+            },
+            body: JSON.stringify(changes),
+        });
 
         if (!response.ok) {
-            throw new Error(`Failed to get URLs: ${response.statusText}`);
+            throw new Error(`Failed to update URL: ${await errorMessage(response)}`);
         }
 
         return response.json();
@@ -102,22 +254,26 @@ class ApiService {
     async deleteURL(shortCode: string): Promise<void> {
         const response = await fetch(`${this.baseUrl}/api/urls/${shortCode}`, {
             method: 'DELETE',
+            headers: authHeaders(),
         });
 
         if (!response.ok) {
-            throw new Error(`Failed to delete URL: ${response.statusText}`);
+            throw new Error(`Failed to delete URL: ${await errorMessage(response)}`);
         }
     }
 
     // Get URL history
     async getURLHistory(): Promise<URLHistoryItem[]> {
-        const response = await fetch(`${this.baseUrl}/api/history`);
+        const response = await fetch(`${this.baseUrl}/api/history`, {
+            headers: authHeaders(),
+        });
 
         if (!response.ok) {
-            throw new Error(`Failed to get URL history: ${response.statusText}`);
+            throw new Error(`Failed to get URL history: ${await errorMessage(response)}`);
         }
 
-        return response.json();
+        const page: Page<URLHistoryItem> = await response.json();
+        return page.items;
     }
 
     // Build the full short URL for display